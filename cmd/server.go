@@ -2,51 +2,100 @@ package cmd
 
 import (
 	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/codersaadi/go-micro/db"
+	"github.com/codersaadi/go-micro/events"
 	"github.com/codersaadi/go-micro/internal/handler"
 	repository "github.com/codersaadi/go-micro/internal/respository"
 	"github.com/codersaadi/go-micro/internal/service"
 	"github.com/codersaadi/go-micro/pkg/micro"
-	"github.com/kelseyhightower/envconfig"
 	"go.uber.org/zap"
 )
 
+// sampleDefaults are the defaults of this service. They only apply where
+// the environment variable is not set, and the APP_ENV profile overrides
+// them, e.g. development allows any CORS origin.
+var sampleDefaults = []micro.Default{
+	{Env: "APP_NAME", Apply: func(c *micro.Config) { c.AppName = "user-service" }},
+	{Env: "RATE_LIMITER_REQUESTS_PER_SECOND", Apply: func(c *micro.Config) { c.RateLimiter.RequestsPerS = 10 }},
+	{Env: "RATE_LIMITER_BURST", Apply: func(c *micro.Config) { c.RateLimiter.Burst = 20 }},
+	{Env: "CORS_ALLOWED_ORIGINS", Apply: func(c *micro.Config) {
+		c.CORS.AllowedOrigins = []string{"https://yourdomain.com", "https://app.yourdomain.com"}
+	}},
+	{Env: "CORS_ALLOWED_METHODS", Apply: func(c *micro.Config) {
+		c.CORS.AllowedMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	}},
+	{Env: "CORS_ALLOWED_HEADERS", Apply: func(c *micro.Config) {
+		c.CORS.AllowedHeaders = []string{"Content-Type", "Authorization", "X-API-Key", "X-CSRF-Token"}
+	}},
+	{Env: "CORS_EXPOSED_HEADERS", Apply: func(c *micro.Config) {
+		c.CORS.ExposedHeaders = []string{"X-Request-ID", "X-Rate-Limit-Remaining", "X-CSRF-Token"}
+	}},
+	{Env: "CORS_ALLOW_CREDENTIALS", Apply: func(c *micro.Config) { c.CORS.AllowCredentials = true }},
+	{Env: "CORS_MAX_AGE", Apply: func(c *micro.Config) { c.CORS.MaxAge = 600 }},
+}
+
 func getConfig() (*micro.Config, error) {
-	// Define default config with your specified values
-	config := &micro.Config{
-		AppName:        "user-service",
-		Port:           8080,
-		LogLevel:       "info",
-		MetricsEnabled: true,
-		RateLimiter: micro.RateLimiterConfig{
-			Enabled:      true,
-			RequestsPerS: 10,
-			Burst:        20,
-			TTL:          time.Hour,
-			Strategy:     "ip",
-		},
-		CORS: micro.CORSConfig{
-			Enabled:          true,
-			AllowedOrigins:   []string{"https://yourdomain.com", "https://app.yourdomain.com"},
-			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-			AllowedHeaders:   []string{"Content-Type", "Authorization", "X-API-Key"},
-			ExposedHeaders:   []string{"X-Request-ID", "X-Rate-Limit-Remaining"},
-			AllowCredentials: true,
-			MaxAge:           600,
-		},
+	return micro.LoadConfig(sampleDefaults...)
+}
+
+// newEventPublisher builds the publisher selected by EVENTS_DRIVER, or nil
+// when event publishing is disabled
+func newEventPublisher(cfg *micro.Config) (micro.EventPublisher, error) {
+	switch cfg.EventsDriver {
+	case "nats":
+		return events.NewNATSPublisher(cfg.NATSURL)
+	case "kafka":
+		return events.NewKafkaPublisher(cfg.KafkaBrokers), nil
+	default:
+		return nil, nil
 	}
+}
 
-	// Override defaults with any environment variables that are set
-	if err := envconfig.Process("", config); err != nil {
-		return nil, fmt.Errorf("failed to load config from environment: %w", err)
+// newSessionStore creates the store of login sessions, signed with
+// SESSION_KEY. Without one a random key is used, so sessions do not survive
+// a restart and are not shared between instances.
+func newSessionStore(app *micro.App) (*micro.SessionStore, error) {
+	sessionKey, _ := app.Config.LookupEnv("SESSION_KEY")
+	key := []byte(sessionKey)
+	if len(key) == 0 {
+		app.Logger.Warn("SESSION_KEY is not set, using a random session key")
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate session key: %w", err)
+		}
 	}
+	secure, err := sessionCookieSecure(app.Config)
+	if err != nil {
+		return nil, err
+	}
+	return micro.NewSessionStore(micro.SessionOptions{
+		Keys:   [][]byte{key},
+		Secure: secure,
+	})
+}
 
-	return config, nil
+// sessionCookieSecure reports whether the session cookie is only sent over
+// HTTPS. SESSION_COOKIE_SECURE overrides the default, which is on in
+// production and when serving TLS; TLS terminated at a proxy is invisible
+// to the server, so CERT_FILE alone is not enough.
+func sessionCookieSecure(cfg *micro.Config) (bool, error) {
+	if v, _ := cfg.LookupEnv("SESSION_COOKIE_SECURE"); v != "" {
+		secure, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, fmt.Errorf("invalid SESSION_COOKIE_SECURE %q: %w", v, err)
+		}
+		return secure, nil
+	}
+	return cfg.Env == micro.EnvProduction || cfg.CertFile != "", nil
 }
 
 func BootstrapServer() {
@@ -62,18 +111,42 @@ func BootstrapServer() {
 	}
 
 	// Initialize database pool
-	pool, err := db.NewPostgresPool(context.Background(), cfg.DBDSN)
+	pool, err := db.NewPostgresPool(context.Background(), cfg.DBDSN,
+		db.WithStatementTimeout(cfg.DBStatementTimeout))
 	if err != nil {
 		app.Logger.Error("Failed to create database pool", zap.Error(err))
 		return
 	}
 	defer pool.Close()
+	app.Registry().MustRegister(db.NewPoolCollector(pool))
 
 	// Initialize application layers
 	// Handler --> Service ---> Repository --> Database
 	userRepo := repository.NewUserRepository(pool, app.Logger)
-	userService := service.NewUserService(userRepo, app.Logger)
-	userHandler := handler.NewUserHandler(app, userService)
+	publisher, err := newEventPublisher(cfg)
+	if err != nil {
+		app.Logger.Error("Failed to create event publisher", zap.Error(err))
+		return
+	}
+	if worker, ok := publisher.(micro.Worker); ok {
+		app.RegisterWorker(worker)
+	}
+	// Callers may only access their own user record
+	userService := service.NewUserService(userRepo, app.Logger,
+		service.WithEvents(micro.NewEvents(publisher)),
+		service.WithAuthorizationPolicy(service.OwnerOrAdminPolicy{}))
+	sessions, err := newSessionStore(app)
+	if err != nil {
+		app.Logger.Error("Failed to create session store", zap.Error(err))
+		return
+	}
+	userHandler := handler.NewUserHandler(app, userService, sessions)
+	requireAuth := app.AuthMiddleware(userHandler.Authenticate)
+	// Authentication is by session cookie, so changes need the CSRF token
+	// returned by /login
+	requireCSRF := app.CSRFMiddleware(sessions)
+	// Logged-in users get their own rate limit bucket under the token strategy
+	app.SetRateLimitAuthenticator(userHandler.Authenticate)
 
 	v1 := app.Group("/v1")
 	v1.GET("/welcome", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
@@ -85,13 +158,33 @@ func BootstrapServer() {
 		)
 	})
 
-	app.POST("/register", userHandler.Register)
-	app.POST("/login", userHandler.Login)
-	app.GET("/users/{id}", userHandler.GetUser)
-	app.PUT("/users/{id}", userHandler.UpdateUser)
-	app.DELETE("/users/{id}", userHandler.DeleteUser)
+	// Forms resubmitted on refresh replay the first registration response
+	app.POST("/register", micro.Handle(app, userHandler.Register)).
+		Use(app.DedupMiddleware(micro.DedupOptions{})).
+		WithDoc("Register a new user", service.RegisterParams{}, handler.UserResponse{}, http.StatusCreated)
+	app.POST("/login", userHandler.Login, micro.NoStore()).
+		WithDoc("Authenticate a user", handler.LoginRequest{}, handler.UserResponse{})
+	// Registered before /users/{id} so "export" is not captured as an ID
+	app.GET("/users/export", userHandler.ExportUsers).
+		Use(requireAuth)
+	app.GET("/users/{id}", userHandler.GetUser).
+		Use(requireAuth).
+		WithDoc("Get a user by ID", nil, handler.UserResponse{})
+	app.PUT("/users/{id}", userHandler.UpdateUser).
+		Use(requireAuth, requireCSRF).
+		WithDoc("Update a user", service.UpdateParams{}, handler.UserResponse{})
+	app.DELETE("/users/{id}", userHandler.DeleteUser).
+		Use(requireAuth, requireCSRF).
+		WithDoc("Delete a user", nil, nil, http.StatusNoContent)
+
+	app.EnableOpenAPI(micro.OpenAPIOptions{
+		Title:   cfg.AppName,
+		Version: "1.0.0",
+	})
 
-	// Register a rate limit info endpoint (optional)
+	// Register a rate limit info endpoint (optional). It exposes server
+	// config to anonymous callers and is scheduled for removal; the built-in
+	// /_rate_limit reports the caller's live limit instead.
 	app.GET("/rate-limit-info", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 		info := map[string]interface{}{
 			"enabled":             app.Config.RateLimiter.Enabled,
@@ -100,10 +193,19 @@ func BootstrapServer() {
 			"strategy":            app.Config.RateLimiter.Strategy,
 		}
 		return app.JSON(w, http.StatusOK, info)
-	})
+	}, micro.Deprecated(time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC), ""))
 
 	// Start server
-	if err := app.Start(); err != nil && err != http.ErrServerClosed {
+	if err := app.Start(); err != nil {
+		var serverErr *micro.ServerError
+		if errors.As(err, &serverErr) && serverErr.AddrInUse() {
+			app.Logger.Error("Port already in use", zap.String("addr", serverErr.Addr), zap.Error(err))
+			return
+		}
+		if errors.Is(err, micro.ErrForcedShutdown) {
+			pool.Close()
+			os.Exit(1)
+		}
 		app.Logger.Error("Server failed to start", zap.Error(err))
 	}
 }
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -12,7 +13,22 @@ type Database struct {
 	Pool *pgxpool.Pool
 }
 
-func NewPostgresPool(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
+// PoolOption configures the connection pool
+type PoolOption func(*pgxpool.Config)
+
+// WithStatementTimeout sets statement_timeout on every connection so the
+// database aborts runaway queries even if the caller's context is lost.
+// Zero leaves the server default.
+func WithStatementTimeout(d time.Duration) PoolOption {
+	return func(config *pgxpool.Config) {
+		if d <= 0 {
+			return
+		}
+		config.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(d.Milliseconds(), 10)
+	}
+}
+
+func NewPostgresPool(ctx context.Context, dsn string, opts ...PoolOption) (*pgxpool.Pool, error) {
 	config, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse db config: %w", err)
@@ -25,6 +41,10 @@ func NewPostgresPool(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
 	config.MaxConnIdleTime = 30 * time.Minute
 	config.HealthCheckPeriod = 1 * time.Minute
 
+	for _, opt := range opts {
+		opt(config)
+	}
+
 	// Connection timeout
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
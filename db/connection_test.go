@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestWithStatementTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		want    string
+		set     bool
+	}{
+		{"milliseconds", 1500 * time.Millisecond, "1500", true},
+		{"seconds", 30 * time.Second, "30000", true},
+		{"zero keeps server default", 0, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := pgxpool.ParseConfig("postgres://localhost/test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			WithStatementTimeout(tt.timeout)(config)
+			got, set := config.ConnConfig.RuntimeParams["statement_timeout"]
+			if set != tt.set || got != tt.want {
+				t.Errorf("statement_timeout = %q (set %v), want %q (set %v)", got, set, tt.want, tt.set)
+			}
+		})
+	}
+}
+
+// TestStatementTimeoutCancelsSlowQuery needs a database, given by
+// TEST_DB_DSN
+func TestStatementTimeoutCancelsSlowQuery(t *testing.T) {
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN not set")
+	}
+
+	pool, err := NewPostgresPool(context.Background(), dsn, WithStatementTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// No Go deadline: only the server-side timeout can stop the query
+	start := time.Now()
+	_, err = pool.Exec(context.Background(), "SELECT pg_sleep(5)")
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "57014" {
+		t.Fatalf("err = %v, want query_canceled (57014)", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("query ran for %v despite the statement timeout", elapsed)
+	}
+}
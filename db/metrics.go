@@ -0,0 +1,60 @@
+package db
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PoolCollector exports connection pool statistics, including how often and
+// how long requests waited for a connection, to Prometheus
+type PoolCollector struct {
+	pool *pgxpool.Pool
+
+	acquiredConns    *prometheus.Desc
+	idleConns        *prometheus.Desc
+	maxConns         *prometheus.Desc
+	acquireCount     *prometheus.Desc
+	acquireDuration  *prometheus.Desc
+	emptyAcquire     *prometheus.Desc
+	emptyAcquireWait *prometheus.Desc
+	canceledAcquire  *prometheus.Desc
+}
+
+// NewPoolCollector creates a collector for pool, typically registered with
+// app.Registry().MustRegister
+func NewPoolCollector(pool *pgxpool.Pool) *PoolCollector {
+	return &PoolCollector{
+		pool:             pool,
+		acquiredConns:    prometheus.NewDesc("db_pool_acquired_conns", "Connections currently in use.", nil, nil),
+		idleConns:        prometheus.NewDesc("db_pool_idle_conns", "Idle connections in the pool.", nil, nil),
+		maxConns:         prometheus.NewDesc("db_pool_max_conns", "Maximum size of the pool.", nil, nil),
+		acquireCount:     prometheus.NewDesc("db_pool_acquire_total", "Successful connection acquisitions.", nil, nil),
+		acquireDuration:  prometheus.NewDesc("db_pool_acquire_duration_seconds_total", "Total time spent acquiring connections.", nil, nil),
+		emptyAcquire:     prometheus.NewDesc("db_pool_empty_acquire_total", "Acquisitions that had to wait because the pool was empty.", nil, nil),
+		emptyAcquireWait: prometheus.NewDesc("db_pool_empty_acquire_wait_seconds_total", "Total time spent waiting for a connection from an empty pool.", nil, nil),
+		canceledAcquire:  prometheus.NewDesc("db_pool_canceled_acquire_total", "Acquisitions abandoned because the context ended, e.g. on pool exhaustion.", nil, nil),
+	}
+}
+
+func (c *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquiredConns
+	ch <- c.idleConns
+	ch <- c.maxConns
+	ch <- c.acquireCount
+	ch <- c.acquireDuration
+	ch <- c.emptyAcquire
+	ch <- c.emptyAcquireWait
+	ch <- c.canceledAcquire
+}
+
+func (c *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquire, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquireWait, prometheus.CounterValue, stat.EmptyAcquireWaitTime().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquire, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+}
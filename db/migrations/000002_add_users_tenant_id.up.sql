@@ -0,0 +1,14 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+
+-- Emails are unique per tenant rather than globally
+ALTER TABLE users DROP CONSTRAINT users_email_key;
+ALTER TABLE users ADD CONSTRAINT users_tenant_id_email_key UNIQUE (tenant_id, email);
+
+CREATE INDEX idx_users_tenant_id ON users(tenant_id);
+
+-- +goose Down
+DROP INDEX idx_users_tenant_id;
+ALTER TABLE users DROP CONSTRAINT users_tenant_id_email_key;
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+ALTER TABLE users DROP COLUMN tenant_id;
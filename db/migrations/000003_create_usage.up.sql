@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE usage (
+    id BIGSERIAL PRIMARY KEY,
+    api_key TEXT NOT NULL,
+    requests BIGINT NOT NULL,
+    bytes_in BIGINT NOT NULL,
+    bytes_out BIGINT NOT NULL,
+    period_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    period_end TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_usage_api_key_period ON usage(api_key, period_start);
+
+-- +goose Down
+DROP TABLE usage;
@@ -1,23 +1,24 @@
 -- name: CreateUser :one
-INSERT INTO users (name, email, password)
-VALUES ($1, $2, $3)
+INSERT INTO users (name, email, password, tenant_id)
+VALUES ($1, $2, $3, $4)
 RETURNING *;
 
 -- name: GetUserByID :one
-SELECT * FROM users WHERE id = $1;
+SELECT * FROM users WHERE id = $1 AND tenant_id = $2;
 
 -- name: GetUserByEmail :one
-SELECT * FROM users WHERE email = $1;
+SELECT * FROM users WHERE email = $1 AND tenant_id = $2;
 
 -- name: UpdateUser :one
 UPDATE users
-SET 
-    name = COALESCE($2, name),
-    email = COALESCE($3, email),
-    password = COALESCE($4, password),
+SET
+    name = COALESCE(sqlc.narg('name'), name),
+    email = COALESCE(sqlc.narg('email'), email),
+    password = COALESCE(sqlc.narg('password'), password),
+    phone = CASE WHEN sqlc.arg('set_phone')::boolean THEN sqlc.narg('phone') ELSE phone END,
     updated_at = NOW()
-WHERE id = $1
+WHERE id = sqlc.arg('id') AND tenant_id = sqlc.arg('tenant_id')
 RETURNING *;
 
--- name: DeleteUser :exec
-DELETE FROM users WHERE id = $1;
\ No newline at end of file
+-- name: DeleteUser :execrows
+DELETE FROM users WHERE id = $1 AND tenant_id = $2;
\ No newline at end of file
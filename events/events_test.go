@@ -0,0 +1,154 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codersaadi/go-micro/pkg/micro"
+)
+
+// fakeNATSServer speaks just enough of the NATS protocol for a publisher:
+// it answers PINGs and sends every PUB it receives on published
+type fakeNATSServer struct {
+	listener  net.Listener
+	published chan [2]string
+}
+
+func startFakeNATSServer(t *testing.T) *fakeNATSServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeNATSServer{listener: l, published: make(chan [2]string, 16)}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeNATSServer) url() string {
+	return "nats://" + s.listener.Addr().String()
+}
+
+func (s *fakeNATSServer) serve(conn net.Conn) {
+	defer conn.Close()
+	io.WriteString(conn, `INFO {"server_id":"fake","version":"2.10.0","max_payload":1048576}`+"\r\n")
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "PING":
+			io.WriteString(conn, "PONG\r\n")
+		case "PUB":
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, size+2) // Payload followed by CRLF
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			s.published <- [2]string{fields[1], string(payload[:size])}
+		}
+	}
+}
+
+func TestNATSPublisher(t *testing.T) {
+	server := startFakeNATSServer(t)
+	p, err := NewNATSPublisher(server.url())
+	if err != nil {
+		t.Fatalf("NewNATSPublisher: %v", err)
+	}
+
+	if err := p.Publish(context.Background(), "user.created", map[string]int{"id": 7}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	// Stop drains, so the message has reached the server when it returns
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	select {
+	case msg := <-server.published:
+		if msg != [2]string{"user.created", `{"id":7}`} {
+			t.Errorf("published %v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("nothing published")
+	}
+	if !p.conn.IsClosed() {
+		t.Error("connection open after Stop")
+	}
+}
+
+func TestNATSPublisherConnectFailure(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	if _, err := NewNATSPublisher("nats://" + addr); err == nil {
+		t.Error("connected to a closed port")
+	}
+}
+
+func TestPublishRejectsUnencodablePayload(t *testing.T) {
+	server := startFakeNATSServer(t)
+	nats, err := NewNATSPublisher(server.url())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nats.conn.Close()
+	kafka := NewKafkaPublisher([]string{"127.0.0.1:1"})
+	defer kafka.Stop(context.Background())
+
+	// Encoding fails before the broker is contacted
+	for name, p := range map[string]micro.EventPublisher{"nats": nats, "kafka": kafka} {
+		err := p.Publish(context.Background(), "user.created", make(chan int))
+		if err == nil || !strings.Contains(err.Error(), "marshal event") {
+			t.Errorf("%s: Publish err = %v, want a marshal error", name, err)
+		}
+	}
+}
+
+func TestKafkaPublisherUnreachableBroker(t *testing.T) {
+	p := NewKafkaPublisher([]string{"127.0.0.1:1"})
+	defer p.Stop(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if err := p.Publish(ctx, "user.created", map[string]int{"id": 7}); err == nil {
+		t.Error("Publish to an unreachable broker succeeded")
+	}
+}
+
+func TestKafkaPublisherStop(t *testing.T) {
+	p := NewKafkaPublisher([]string{"127.0.0.1:1"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Stop(ctx); err != nil {
+		t.Errorf("Stop without pending messages: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaPublisher publishes JSON-encoded events to the Kafka topic named by
+// the subject. Like NATSPublisher it is a micro.Worker that flushes and
+// closes the writer on shutdown.
+type KafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaPublisher creates a publisher for brokers. Publish waits for all
+// in-sync replicas to acknowledge the message.
+func NewKafkaPublisher(brokers []string) *KafkaPublisher {
+	return &KafkaPublisher{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		RequiredAcks: kafka.RequireAll,
+		// Publishes are synchronous, so don't hold them for a full batch
+		BatchTimeout: 10 * time.Millisecond,
+	}}
+}
+
+// Publish implements micro.EventPublisher
+func (p *KafkaPublisher) Publish(ctx context.Context, subject string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+	if err := p.writer.WriteMessages(ctx, kafka.Message{Topic: subject, Value: data}); err != nil {
+		return fmt.Errorf("kafka publish: %w", err)
+	}
+	return nil
+}
+
+// Start implements micro.Worker; the writer connects lazily
+func (p *KafkaPublisher) Start(ctx context.Context) {
+	<-ctx.Done()
+}
+
+// Stop flushes pending messages and closes the writer
+func (p *KafkaPublisher) Stop(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- p.writer.Close()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("kafka close: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("kafka close: %w", ctx.Err())
+	}
+}
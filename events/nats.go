@@ -0,0 +1,66 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATSPublisher publishes JSON-encoded events to NATS subjects. It is also a
+// micro.Worker: register it with App.RegisterWorker so the connection is
+// drained once HTTP traffic has stopped.
+type NATSPublisher struct {
+	conn *nats.Conn
+}
+
+// NewNATSPublisher connects to the NATS server at url
+func NewNATSPublisher(url string, opts ...nats.Option) (*NATSPublisher, error) {
+	conn, err := nats.Connect(url, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to nats: %w", err)
+	}
+	return &NATSPublisher{conn: conn}, nil
+}
+
+// Publish implements micro.EventPublisher. Core NATS publishes are buffered,
+// so an error means the message was not queued, e.g. while disconnected
+// with a full reconnect buffer.
+func (p *NATSPublisher) Publish(ctx context.Context, subject string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+	if err := p.conn.Publish(subject, data); err != nil {
+		return fmt.Errorf("nats publish: %w", err)
+	}
+	return nil
+}
+
+// Start implements micro.Worker; the connection is managed by the client
+func (p *NATSPublisher) Start(ctx context.Context) {
+	<-ctx.Done()
+}
+
+// Stop flushes pending messages and closes the connection
+func (p *NATSPublisher) Stop(ctx context.Context) error {
+	if err := p.conn.Drain(); err != nil {
+		p.conn.Close()
+		return fmt.Errorf("nats drain: %w", err)
+	}
+
+	// Drain is asynchronous
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for !p.conn.IsClosed() {
+		select {
+		case <-ctx.Done():
+			p.conn.Close()
+			return fmt.Errorf("nats drain: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
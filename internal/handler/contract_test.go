@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/codersaadi/go-micro/internal/models"
+	"github.com/codersaadi/go-micro/pkg/micro"
+)
+
+// TestUserContract pins the JSON the user endpoints return. After an
+// intended change, rewrite the golden files under testdata/contracts with
+//
+//	go test ./internal/handler -run TestUserContract -update-contracts
+func TestUserContract(t *testing.T) {
+	app := newTestApp(t)
+	svc := &fakeUserService{users: []*models.User{{ID: 1, Name: "Ada", Email: "ada@example.com"}}}
+	h := NewUserHandler(app, svc, nil)
+	app.GET("/users/{id}", h.GetUser)
+	app.POST("/register", micro.Handle(app, h.Register))
+
+	micro.ContractTest(t, app.Handler(), []micro.ContractCase{
+		{
+			Name:            "get user",
+			Path:            "/users/1",
+			Status:          http.StatusOK,
+			ResponseHeaders: map[string]string{"Content-Type": "application/json"},
+		},
+		{Name: "get missing user", Path: "/users/2", Status: http.StatusNotFound},
+		{Name: "get invalid user ID", Path: "/users/abc", Status: http.StatusBadRequest},
+		{
+			Name:   "register",
+			Method: http.MethodPost,
+			Path:   "/register",
+			Body:   map[string]string{"name": "Grace", "email": "grace@example.com", "password": "password123"},
+			Status: http.StatusCreated,
+		},
+		{
+			Name:   "register invalid email",
+			Method: http.MethodPost,
+			Path:   "/register",
+			Body:   map[string]string{"name": "Grace", "email": "grace", "password": "password123"},
+			Status: http.StatusBadRequest,
+		},
+	})
+}
@@ -2,63 +2,156 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 
+	"github.com/codersaadi/go-micro/internal/models"
 	"github.com/codersaadi/go-micro/internal/service"
 	"github.com/codersaadi/go-micro/pkg/micro"
 )
 
 // Example Handlers
 type UserHandler struct {
-	service service.UserService
-	app     *micro.App
+	service  service.UserService
+	app      *micro.App
+	sessions *micro.SessionStore
 }
 
-func NewUserHandler(app *micro.App, service service.UserService) *UserHandler {
+// Session values written by Login
+const (
+	sessionUserKey   = "user_id"
+	sessionTenantKey = "tenant_id"
+	sessionRoleKey   = "role"
+)
+
+var errNoSession = errors.New("no user session")
+
+// UserResponse is the public representation of a user
+type UserResponse struct {
+	ID    int32   `json:"id"`
+	Name  string  `json:"name"`
+	Email string  `json:"email"`
+	Phone *string `json:"phone"`
+}
+
+// LoginRequest holds the credentials for Login
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func newUserResponse(user *models.User) UserResponse {
+	resp := UserResponse{
+		ID:    user.ID,
+		Name:  user.Name,
+		Email: user.Email,
+	}
+	if user.Phone.Valid {
+		resp.Phone = &user.Phone.String
+	}
+	return resp
+}
+
+// Error responses of the user endpoints. Clients switch on the error codes,
+// so they must not change.
+var (
+	errInvalidUserID      = micro.NewAPIError(http.StatusBadRequest, "invalid user ID").WithErrorCode("INVALID_USER_ID")
+	errInvalidCredentials = micro.NewAPIError(http.StatusUnauthorized, "invalid credentials").WithErrorCode("INVALID_CREDENTIALS")
+	errUserNotFound       = micro.NewAPIError(http.StatusNotFound, "user not found").WithErrorCode("USER_NOT_FOUND")
+	errAccessDenied       = micro.NewAPIError(http.StatusForbidden, "access denied").WithErrorCode("ACCESS_DENIED")
+	errEmailExists        = micro.NewAPIError(http.StatusConflict, "email already exists").WithErrorCode("EMAIL_EXISTS")
+	errWeakPassword       = micro.NewAPIError(http.StatusBadRequest, "password must be at least 8 characters").WithErrorCode("WEAK_PASSWORD")
+	errNullNotAllowed     = micro.NewAPIError(http.StatusBadRequest, "only phone can be set to null").WithErrorCode("NULL_NOT_ALLOWED")
+
+	// Unexpected failures share the code of micro.ErrInternalServer
+	errGetFailed    = micro.NewAPIError(http.StatusInternalServerError, "failed to retrieve user").WithErrorCode(micro.ErrInternalServer.ErrorCode)
+	errUpdateFailed = micro.NewAPIError(http.StatusInternalServerError, "failed to update user").WithErrorCode(micro.ErrInternalServer.ErrorCode)
+	errDeleteFailed = micro.NewAPIError(http.StatusInternalServerError, "failed to delete user").WithErrorCode(micro.ErrInternalServer.ErrorCode)
+	errExportFailed = micro.NewAPIError(http.StatusInternalServerError, "failed to export users").WithErrorCode(micro.ErrInternalServer.ErrorCode)
+)
+
+// NewUserHandler creates the user handler. Login stores the user in a
+// session of sessions, which Authenticate reads back.
+func NewUserHandler(app *micro.App, svc service.UserService, sessions *micro.SessionStore) *UserHandler {
+	// Register is served through micro.Handle and returns service errors
+	// as they are
+	app.MapError(service.ErrEmailExists, errEmailExists)
+	app.MapError(service.ErrWeakPassword, errWeakPassword)
+
 	return &UserHandler{
-		service: service,
-		app:     app,
+		service:  svc,
+		app:      app,
+		sessions: sessions,
 	}
 }
 
-func (h *UserHandler) Register(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
-	var params service.RegisterParams
-	if err := h.app.Decode(r, &params); err != nil {
-		return err
+// Authenticate resolves the principal from the session written by Login.
+// Use it with App.AuthMiddleware.
+func (h *UserHandler) Authenticate(r *http.Request) (*micro.Principal, error) {
+	session, err := h.sessions.Get(r)
+	if err != nil {
+		return nil, err
 	}
+	userID, ok := micro.SessionValue[int32](session, sessionUserKey)
+	if !ok {
+		return nil, errNoSession
+	}
+	tenantID, _ := micro.SessionValue[string](session, sessionTenantKey)
+	principal := &micro.Principal{ID: strconv.Itoa(int(userID)), TenantID: tenantID}
+	if role, ok := micro.SessionValue[string](session, sessionRoleKey); ok && role != "" {
+		principal.Roles = []string{role}
+	}
+	return principal, nil
+}
+
+// Register creates a user. It is served through micro.Handle, which binds
+// and validates the params and writes the response with 201.
+func (h *UserHandler) Register(ctx context.Context, params service.RegisterParams) (UserResponse, error) {
 	user, err := h.service.RegisterUser(ctx, params)
 	if err != nil {
-		return err
+		return UserResponse{}, err
 	}
-
-	return h.app.JSON(w, http.StatusCreated, map[string]interface{}{
-		"id":    user.ID,
-		"name":  user.Name,
-		"email": user.Email,
-	})
+	return newUserResponse(user), nil
 }
 
 func (h *UserHandler) Login(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
-	var credentials struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
+	var credentials LoginRequest
 
 	if err := h.app.Decode(r, &credentials); err != nil {
 		return err
 	}
 
 	user, err := h.service.Authenticate(ctx, credentials.Email, credentials.Password)
+	if errors.Is(err, micro.ErrServiceBusy) {
+		return err
+	}
 	if err != nil {
-		return micro.NewAPIError(http.StatusUnauthorized, "invalid credentials")
+		return errInvalidCredentials
 	}
 
-	return h.app.JSON(w, http.StatusOK, map[string]interface{}{
-		"id":    user.ID,
-		"name":  user.Name,
-		"email": user.Email,
-	})
+	// A new session rather than the current one, so a session planted
+	// before login is not carried over
+	session := &micro.Session{Values: map[string]json.RawMessage{}, IsNew: true}
+	if err := session.Set(sessionUserKey, user.ID); err != nil {
+		return err
+	}
+	if err := session.Set(sessionTenantKey, user.TenantID); err != nil {
+		return err
+	}
+	if err := session.Set(sessionRoleKey, user.Role); err != nil {
+		return err
+	}
+	// Sent back in X-CSRF-Token with requests that change state
+	w.Header().Set("X-CSRF-Token", session.CSRFToken())
+	if err := h.sessions.Save(w, session); err != nil {
+		return err
+	}
+
+	return h.app.JSON(w, http.StatusOK, newUserResponse(user))
 }
 
 // internal/handler/user.go
@@ -66,28 +159,30 @@ func (h *UserHandler) Login(ctx context.Context, w http.ResponseWriter, r *http.
 func (h *UserHandler) GetUser(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	userID, err := h.app.URLParamInt(r, "id")
 	if err != nil {
-		return micro.NewAPIError(http.StatusBadRequest, "invalid user ID")
+		return errInvalidUserID
 	}
 
 	user, err := h.service.GetUserByID(ctx, int32(userID))
 	if err != nil {
-		if errors.Is(err, service.ErrUserNotFound) {
-			return micro.NewAPIError(http.StatusNotFound, "user not found")
+		switch {
+		case errors.Is(err, service.ErrUserNotFound):
+			return errUserNotFound
+		case errors.Is(err, service.ErrForbidden):
+			return errAccessDenied
+		case errors.Is(err, micro.ErrServiceBusy):
+			return err
+		default:
+			return errGetFailed
 		}
-		return micro.NewAPIError(http.StatusInternalServerError, "failed to retrieve user")
 	}
 
-	return h.app.JSON(w, http.StatusOK, map[string]interface{}{
-		"id":    user.ID,
-		"name":  user.Name,
-		"email": user.Email,
-	})
+	return h.app.JSON(w, http.StatusOK, newUserResponse(user))
 }
 
 func (h *UserHandler) UpdateUser(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	userID, err := h.app.URLParamInt(r, "id")
 	if err != nil {
-		return micro.NewAPIError(http.StatusBadRequest, "invalid user ID")
+		return errInvalidUserID
 	}
 
 	var params service.UpdateParams
@@ -100,34 +195,139 @@ func (h *UserHandler) UpdateUser(ctx context.Context, w http.ResponseWriter, r *
 	if err != nil {
 		switch {
 		case errors.Is(err, service.ErrUserNotFound):
-			return micro.NewAPIError(http.StatusNotFound, "user not found")
+			return errUserNotFound
 		case errors.Is(err, service.ErrEmailExists):
-			return micro.NewAPIError(http.StatusConflict, "email already exists")
+			return errEmailExists
+		case errors.Is(err, service.ErrForbidden):
+			return errAccessDenied
+		case errors.Is(err, service.ErrNullNotAllowed):
+			return errNullNotAllowed
+		case errors.Is(err, micro.ErrServiceBusy):
+			return err
 		default:
-			return micro.NewAPIError(http.StatusInternalServerError, "failed to update user")
+			return errUpdateFailed
 		}
 	}
 
-	return h.app.JSON(w, http.StatusOK, map[string]interface{}{
-		"id":    user.ID,
-		"name":  user.Name,
-		"email": user.Email,
-	})
+	return h.app.JSON(w, http.StatusOK, newUserResponse(user))
 }
 
 func (h *UserHandler) DeleteUser(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	userID, err := h.app.URLParamInt(r, "id")
 	if err != nil {
-		return micro.NewAPIError(http.StatusBadRequest, "invalid user ID")
+		return errInvalidUserID
 	}
 
 	if err := h.service.DeleteUser(ctx, int32(userID)); err != nil {
-		if errors.Is(err, service.ErrUserNotFound) {
-			return micro.NewAPIError(http.StatusNotFound, "user not found")
+		switch {
+		case errors.Is(err, service.ErrUserNotFound):
+			return errUserNotFound
+		case errors.Is(err, service.ErrForbidden):
+			return errAccessDenied
+		case errors.Is(err, micro.ErrServiceBusy):
+			return err
+		default:
+			return errDeleteFailed
 		}
-		return micro.NewAPIError(http.StatusInternalServerError, "failed to delete user")
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
+
+// ExportUsers streams every user as a JSON array, or as JSON Lines when the
+// client accepts application/x-ndjson. The status is only written once the
+// first user arrives, so a denied or failed export still gets an error.
+func (h *UserHandler) ExportUsers(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if strings.Contains(r.Header.Get("Accept"), "application/x-ndjson") {
+		return h.exportUsersNDJSON(ctx, w)
+	}
+
+	// Cancel the producer if the stream stops early, e.g. on a client
+	// disconnect, and wait for it so the cursor is closed before returning
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// started receives nil once the first user is ready, or the result of
+	// a stream that ended before producing any
+	started := make(chan error, 1)
+	var once sync.Once
+	users := make(chan interface{})
+	go func() {
+		defer close(done)
+		defer close(users)
+		err := h.service.StreamUsers(ctx, func(user *models.User) error {
+			once.Do(func() { started <- nil })
+			select {
+			case users <- newUserResponse(user):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		first := false
+		once.Do(func() { started <- err; first = true })
+		if err != nil && !first {
+			select {
+			case users <- err:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	if err := <-started; err != nil {
+		return exportError(err)
+	}
+
+	// The status is already written once streaming starts, so failures can
+	// only be logged; the unterminated array tells the client it was cut short
+	if err := h.app.StreamJSON(ctx, w, http.StatusOK, users); err != nil {
+		micro.LoggerFromContext(ctx).Warn("user export aborted", micro.ErrorField(err))
+	}
+	return nil
+}
+
+// exportUsersNDJSON writes one user per line straight from the database
+// cursor. A client disconnect cancels ctx, which closes the cursor.
+func (h *UserHandler) exportUsersNDJSON(ctx context.Context, w http.ResponseWriter) error {
+	var lines *micro.NDJSONWriter
+	err := h.service.StreamUsers(ctx, func(user *models.User) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if lines == nil {
+			lines = h.app.NDJSON(w, http.StatusOK)
+		}
+		return lines.Write(newUserResponse(user))
+	})
+	if lines == nil {
+		// Nothing was written, so the status can still report the failure
+		if err != nil {
+			return exportError(err)
+		}
+		h.app.NDJSON(w, http.StatusOK)
+		return nil
+	}
+	// The status is already written, so a failure can only be logged; the
+	// client sees the stream end early
+	if err != nil {
+		micro.LoggerFromContext(ctx).Warn("user export aborted", micro.ErrorField(err))
+	}
+	return nil
+}
+
+// exportError maps a failure to start an export to its response
+func exportError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrForbidden):
+		return errAccessDenied
+	case errors.Is(err, micro.ErrServiceBusy), errors.Is(err, context.Canceled):
+		return err
+	default:
+		return errExportFailed
+	}
+}
@@ -0,0 +1,432 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/codersaadi/go-micro/internal/models"
+	repository "github.com/codersaadi/go-micro/internal/respository"
+	"github.com/codersaadi/go-micro/internal/service"
+	"github.com/codersaadi/go-micro/pkg/micro"
+)
+
+// fakeUserService implements service.UserService with canned results.
+// Methods a test does not set panic through the nil embedded interface.
+type fakeUserService struct {
+	service.UserService
+	users []*models.User
+	err   error
+}
+
+func (f *fakeUserService) RegisterUser(ctx context.Context, params service.RegisterParams) (*models.User, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &models.User{ID: 1, Name: params.Name, Email: params.Email, Password: "hashed"}, nil
+}
+
+func (f *fakeUserService) GetUserByID(ctx context.Context, id int32) (*models.User, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	for _, u := range f.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return nil, service.ErrUserNotFound
+}
+
+func (f *fakeUserService) Authenticate(ctx context.Context, email, password string) (*models.User, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &models.User{ID: 1, Email: email, Role: "user"}, nil
+}
+
+func (f *fakeUserService) StreamUsers(ctx context.Context, fn func(*models.User) error) error {
+	for _, u := range f.users {
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	return f.err
+}
+
+func newTestApp(t *testing.T) *micro.App {
+	t.Helper()
+	app, err := micro.NewApp(&micro.Config{
+		Port:           8080,
+		LogLevel:       "error",
+		DBDSN:          "postgres://localhost/test",
+		HandlerTimeout: time.Second,
+		RateLimiter:    micro.RateLimiterConfig{Strategy: "ip"},
+	})
+	if err != nil {
+		t.Fatalf("NewApp: %v", err)
+	}
+	app.Logger = micro.NewNopLogger()
+	return app
+}
+
+func TestExportUsers(t *testing.T) {
+	app := newTestApp(t)
+	svc := &fakeUserService{users: []*models.User{
+		{ID: 1, Name: "Ada", Email: "ada@example.com"},
+		{ID: 2, Name: "Alan", Email: "alan@example.com"},
+	}}
+	h := NewUserHandler(app, svc, nil)
+	app.GET("/users/export", h.ExportUsers)
+
+	w := httptest.NewRecorder()
+	app.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/export", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	var users []UserResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &users); err != nil {
+		t.Fatalf("body is not a JSON array: %v", err)
+	}
+	if len(users) != 2 || users[0].Email != "ada@example.com" || users[1].ID != 2 {
+		t.Errorf("users = %+v", users)
+	}
+}
+
+// closingStream records when StreamUsers returns, after its cursor is closed
+type closingStream struct {
+	fakeUserService
+	closed atomic.Bool
+}
+
+func (c *closingStream) StreamUsers(ctx context.Context, fn func(*models.User) error) error {
+	err := c.fakeUserService.StreamUsers(ctx, fn)
+	time.Sleep(20 * time.Millisecond) // Closing the cursor takes a moment
+	c.closed.Store(true)
+	return err
+}
+
+// brokenWriter fails every write, like a connection the client dropped
+type brokenWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (brokenWriter) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestExportUsersWaitsForProducer(t *testing.T) {
+	app := newTestApp(t)
+	svc := &closingStream{fakeUserService: fakeUserService{users: []*models.User{
+		{ID: 1, Name: "Ada", Email: "ada@example.com"},
+		{ID: 2, Name: "Alan", Email: "alan@example.com"},
+	}}}
+	h := NewUserHandler(app, svc, nil)
+
+	r := httptest.NewRequest(http.MethodGet, "/users/export", nil)
+	if err := h.ExportUsers(r.Context(), brokenWriter{httptest.NewRecorder()}, r); err != nil {
+		t.Fatalf("ExportUsers: %v", err)
+	}
+	// The stream failed on the first write, but the producer was still
+	// stopped and its cursor closed before the handler returned
+	if !svc.closed.Load() {
+		t.Error("ExportUsers returned while the producer still held the cursor")
+	}
+}
+
+func TestExportUsersNDJSON(t *testing.T) {
+	users := []*models.User{
+		{ID: 1, Name: "Ada", Email: "ada@example.com"},
+		{ID: 2, Name: "Alan", Email: "alan@example.com"},
+	}
+	tests := []struct {
+		name   string
+		users  []*models.User
+		err    error
+		status int
+		lines  int
+	}{
+		{"all users", users, nil, http.StatusOK, 2},
+		{"empty", nil, nil, http.StatusOK, 0},
+		// Once a line is sent the status stands and the stream just ends
+		{"fails mid-stream", users, errors.New("connection reset"), http.StatusOK, 2},
+		{"fails before the first user", nil, errors.New("connection reset"), http.StatusInternalServerError, 0},
+		{"busy before the first user", nil, micro.ErrServiceBusy, http.StatusServiceUnavailable, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			h := NewUserHandler(app, &fakeUserService{users: tt.users, err: tt.err}, nil)
+			app.GET("/users/export", h.ExportUsers)
+
+			r := httptest.NewRequest(http.MethodGet, "/users/export", nil)
+			r.Header.Set("Accept", "application/x-ndjson")
+			w := httptest.NewRecorder()
+			app.Handler().ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+
+			// One user per line, and nothing but users
+			var got []UserResponse
+			scanner := bufio.NewScanner(w.Body)
+			for scanner.Scan() {
+				var user UserResponse
+				if err := json.Unmarshal(scanner.Bytes(), &user); err != nil {
+					t.Fatalf("line %q is not a user: %v", scanner.Text(), err)
+				}
+				got = append(got, user)
+			}
+			if len(got) != tt.lines {
+				t.Fatalf("got %d lines, want %d", len(got), tt.lines)
+			}
+			for i, user := range got {
+				if user.ID != tt.users[i].ID || user.Email != tt.users[i].Email {
+					t.Errorf("line %d = %+v, want %+v", i, user, tt.users[i])
+				}
+			}
+			if tt.lines > 0 && !w.Flushed {
+				t.Error("lines were not flushed")
+			}
+		})
+	}
+}
+
+// fakeUserRepo streams a fixed list of users. Methods a test does not need
+// panic through the nil embedded interface.
+type fakeUserRepo struct {
+	repository.UserRepository
+	users []*models.User
+}
+
+func (f *fakeUserRepo) StreamUsers(ctx context.Context, fn func(*models.User) error) error {
+	for _, u := range f.users {
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestExportUsersRequiresAdmin(t *testing.T) {
+	repo := &fakeUserRepo{users: []*models.User{
+		{ID: 1, Name: "Ada", Email: "ada@example.com"},
+		{ID: 2, Name: "Alan", Email: "alan@example.com"},
+	}}
+	svc := service.NewUserService(repo, micro.NewNopLogger(),
+		service.WithAuthorizationPolicy(service.OwnerOrAdminPolicy{}))
+
+	tests := []struct {
+		name   string
+		role   string
+		accept string
+		status int
+		body   string
+	}{
+		{"admin json", "admin", "", http.StatusOK, "alan@example.com"},
+		{"admin ndjson", "admin", "application/x-ndjson", http.StatusOK, "alan@example.com"},
+		{"member json", "member", "", http.StatusForbidden, "ACCESS_DENIED"},
+		{"member ndjson", "member", "application/x-ndjson", http.StatusForbidden, "ACCESS_DENIED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			h := NewUserHandler(app, svc, nil)
+			app.GET("/users/export", h.ExportUsers).
+				Use(app.AuthMiddleware(func(r *http.Request) (*micro.Principal, error) {
+					return &micro.Principal{ID: "1", Roles: []string{r.Header.Get("X-Role")}}, nil
+				}))
+
+			r := httptest.NewRequest(http.MethodGet, "/users/export", nil)
+			r.Header.Set("X-Role", tt.role)
+			r.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			app.Handler().ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.body) {
+				t.Errorf("body = %s, want it to contain %q", w.Body.String(), tt.body)
+			}
+			if tt.status != http.StatusOK && strings.Contains(w.Body.String(), "ada@example.com") {
+				t.Errorf("denied export leaks users: %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		err    error
+		status int
+	}{
+		{"created", `{"name":"Ada","email":"ada@example.com","password":"password123"}`, nil, http.StatusCreated},
+		{"invalid body", `{"name":"Ada","email":"not-an-email","password":"password123"}`, nil, http.StatusBadRequest},
+		{"email taken", `{"name":"Ada","email":"ada@example.com","password":"password123"}`, service.ErrEmailExists, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			h := NewUserHandler(app, &fakeUserService{err: tt.err}, nil)
+			app.POST("/register", micro.Handle(app, h.Register))
+
+			r := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			app.Handler().ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status != http.StatusCreated {
+				return
+			}
+
+			var user UserResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &user); err != nil {
+				t.Fatal(err)
+			}
+			if user.ID != 1 || user.Email != "ada@example.com" {
+				t.Errorf("user = %+v", user)
+			}
+			// The password hash never leaves the service
+			if strings.Contains(w.Body.String(), "hashed") {
+				t.Errorf("response leaks the password: %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestLoginReturnsCSRFToken(t *testing.T) {
+	app := newTestApp(t)
+	sessions, err := micro.NewSessionStore(micro.SessionOptions{Keys: [][]byte{[]byte("test-session-key-of-32-bytes!!!!")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewUserHandler(app, &fakeUserService{}, sessions)
+	app.POST("/login", h.Login)
+	app.DELETE("/users/{id}", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}).Use(app.AuthMiddleware(h.Authenticate), app.CSRFMiddleware(sessions))
+	handler := app.Handler()
+
+	r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"ada@example.com","password":"password123"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login status = %d: %s", w.Code, w.Body.String())
+	}
+	token := w.Header().Get("X-CSRF-Token")
+	if token == "" {
+		t.Fatal("login returned no X-CSRF-Token")
+	}
+	cookies := w.Result().Cookies()
+
+	// The session cookie alone cannot change state
+	for _, tt := range []struct {
+		token  string
+		status int
+	}{
+		{"", http.StatusForbidden},
+		{"forged", http.StatusForbidden},
+		{token, http.StatusNoContent},
+	} {
+		r := httptest.NewRequest(http.MethodDelete, "/users/1", nil)
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		if tt.token != "" {
+			r.Header.Set("X-CSRF-Token", tt.token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("token %q: status = %d, want %d", tt.token, w.Code, tt.status)
+		}
+	}
+}
+
+func TestGetUserServiceBusy(t *testing.T) {
+	app := newTestApp(t)
+	h := NewUserHandler(app, &fakeUserService{err: micro.ErrServiceBusy}, nil)
+	app.GET("/users/{id}", h.GetUser)
+
+	w := httptest.NewRecorder()
+	app.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if got := w.Header().Get("Retry-After"); got != "5" {
+		t.Errorf("Retry-After = %q, want %q", got, "5")
+	}
+}
+
+func TestUserErrorCodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		err    error
+		status int
+		code   string
+	}{
+		{"invalid id", http.MethodGet, "/users/abc", "", nil, http.StatusBadRequest, "INVALID_USER_ID"},
+		{"not found", http.MethodGet, "/users/7", "", fmt.Errorf("lookup: %w", service.ErrUserNotFound), http.StatusNotFound, "USER_NOT_FOUND"},
+		{"forbidden", http.MethodGet, "/users/7", "", service.ErrForbidden, http.StatusForbidden, "ACCESS_DENIED"},
+		{"get failed", http.MethodGet, "/users/7", "", errors.New("connection reset"), http.StatusInternalServerError, "INTERNAL_ERROR"},
+		{"busy", http.MethodGet, "/users/7", "", micro.ErrServiceBusy, http.StatusServiceUnavailable, "SERVICE_BUSY"},
+		// Register returns service errors as they are, mapped with MapError
+		{"email taken", http.MethodPost, "/register", `{"name":"Ada","email":"ada@example.com","password":"password123"}`,
+			fmt.Errorf("register: %w", service.ErrEmailExists), http.StatusConflict, "EMAIL_EXISTS"},
+		{"weak password", http.MethodPost, "/register", `{"name":"Ada","email":"ada@example.com","password":"password123"}`,
+			service.ErrWeakPassword, http.StatusBadRequest, "WEAK_PASSWORD"},
+		{"register failed", http.MethodPost, "/register", `{"name":"Ada","email":"ada@example.com","password":"password123"}`,
+			errors.New("connection reset"), http.StatusInternalServerError, "INTERNAL_ERROR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			h := NewUserHandler(app, &fakeUserService{err: tt.err}, nil)
+			app.GET("/users/{id}", h.GetUser)
+			app.POST("/register", micro.Handle(app, h.Register))
+
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			app.Handler().ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+
+			var body struct {
+				Code      int    `json:"code"`
+				ErrorCode string `json:"error_code"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != tt.status || body.ErrorCode != tt.code {
+				t.Errorf("body = %+v, want code %d and error_code %s", body, tt.status, tt.code)
+			}
+		})
+	}
+}
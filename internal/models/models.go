@@ -15,4 +15,7 @@ type User struct {
 	Password  string             `json:"password"`
 	CreatedAt pgtype.Timestamptz `json:"created_at"`
 	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
+	TenantID  string             `json:"tenant_id"`
+	Phone     pgtype.Text        `json:"phone"`
+	Role      string             `json:"role"`
 }
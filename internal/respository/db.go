@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/codersaadi/go-micro/pkg/micro"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// poolDB runs queries on explicitly acquired connections so a saturated
+// pool can be told apart from a failing query. When the context expires
+// while waiting for another query to free a connection it reports
+// micro.ErrServiceBusy.
+type poolDB struct {
+	pool *pgxpool.Pool
+}
+
+func (db poolDB) acquire(ctx context.Context) (*pgxpool.Conn, error) {
+	// Only a pool whose connections are all in use makes Acquire wait for
+	// a release; otherwise it dials, and a dial timing out means the
+	// database is unreachable, not busy
+	stat := db.pool.Stat()
+	exhausted := stat.AcquiredConns() >= stat.MaxConns()
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		if exhausted && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("acquire connection: %w", micro.ErrServiceBusy)
+		}
+		return nil, fmt.Errorf("acquire connection: %w", err)
+	}
+	return conn, nil
+}
+
+func (db poolDB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	conn, err := db.acquire(ctx)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	defer conn.Release()
+	return conn.Exec(ctx, sql, args...)
+}
+
+func (db poolDB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	conn, err := db.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		conn.Release()
+		return nil, err
+	}
+	return &connRows{Rows: rows, conn: conn}, nil
+}
+
+// queryWithRetry is Query for read-only statements, retried once on a
+// broken connection
+func (db poolDB) queryWithRetry(ctx context.Context, logger micro.Logger, sql string, args ...interface{}) (pgx.Rows, error) {
+	return readWithRetry(ctx, logger, func() (pgx.Rows, error) {
+		return db.Query(ctx, sql, args...)
+	})
+}
+
+func (db poolDB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	conn, err := db.acquire(ctx)
+	if err != nil {
+		return errRow{err: err}
+	}
+	return &connRow{row: conn.QueryRow(ctx, sql, args...), conn: conn}
+}
+
+// connRows releases its connection once the rows are closed
+type connRows struct {
+	pgx.Rows
+	conn     *pgxpool.Conn
+	released bool
+}
+
+func (r *connRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.Close()
+	return false
+}
+
+func (r *connRows) Close() {
+	r.Rows.Close()
+	if !r.released {
+		r.released = true
+		r.conn.Release()
+	}
+}
+
+// connRow releases its connection after Scan
+type connRow struct {
+	row  pgx.Row
+	conn *pgxpool.Conn
+}
+
+func (r *connRow) Scan(dest ...interface{}) error {
+	defer r.conn.Release()
+	return r.row.Scan(dest...)
+}
+
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...interface{}) error {
+	return r.err
+}
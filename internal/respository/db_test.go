@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/codersaadi/go-micro/pkg/micro"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// newStubPool builds a pool without a database whose connection attempts
+// are answered by dial
+func newStubPool(t *testing.T, dial func(ctx context.Context, network, addr string) (net.Conn, error)) *pgxpool.Pool {
+	t.Helper()
+	config, err := pgxpool.ParseConfig("postgres://localhost/test?sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.MaxConns = 1
+	config.ConnConfig.DialFunc = dial
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// fakePostgres answers the startup of a connection the way a server
+// accepting it without a password would, then reads until it is closed
+func fakePostgres(conn net.Conn) {
+	defer conn.Close()
+	backend := pgproto3.NewBackend(conn, conn)
+	if _, err := backend.ReceiveStartupMessage(); err != nil {
+		return
+	}
+	backend.Send(&pgproto3.AuthenticationOk{})
+	backend.Send(&pgproto3.BackendKeyData{ProcessID: 1, SecretKey: 1})
+	backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	if err := backend.Flush(); err != nil {
+		return
+	}
+	for {
+		if _, err := backend.Receive(); err != nil {
+			return
+		}
+	}
+}
+
+func TestAcquireReportsServiceBusy(t *testing.T) {
+	pool := newStubPool(t, func(ctx context.Context, network, addr string) (net.Conn, error) {
+		client, server := net.Pipe()
+		go fakePostgres(server)
+		return client, nil
+	})
+	// Another query holds the only connection
+	held, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Release()
+	db := poolDB{pool: pool}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := db.Exec(ctx, "SELECT 1"); !errors.Is(err, micro.ErrServiceBusy) {
+		t.Errorf("Exec err = %v, want %v", err, micro.ErrServiceBusy)
+	}
+	if err := db.QueryRow(ctx, "SELECT 1").Scan(); !errors.Is(err, micro.ErrServiceBusy) {
+		t.Errorf("QueryRow err = %v, want %v", err, micro.ErrServiceBusy)
+	}
+}
+
+func TestAcquireDialTimeoutIsNotServiceBusy(t *testing.T) {
+	// The database never answers, as when it is down behind a firewall
+	pool := newStubPool(t, func(ctx context.Context, network, addr string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	db := poolDB{pool: pool}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := db.Exec(ctx, "SELECT 1")
+	if err == nil || errors.Is(err, micro.ErrServiceBusy) {
+		t.Errorf("Exec err = %v, want a failure other than %v", err, micro.ErrServiceBusy)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Exec err = %v, want it to wrap %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestAcquireFailureIsNotServiceBusy(t *testing.T) {
+	refused := errors.New("connection refused")
+	pool := newStubPool(t, func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, refused
+	})
+	db := poolDB{pool: pool}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := db.Query(ctx, "SELECT 1")
+	if err == nil || errors.Is(err, micro.ErrServiceBusy) {
+		t.Errorf("Query err = %v, want a failure other than %v", err, micro.ErrServiceBusy)
+	}
+}
+
+// TestPoolExhaustion holds the only connection of a real pool, given by
+// TEST_DB_DSN, so the next query waits until its deadline
+func TestPoolExhaustion(t *testing.T) {
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN not set")
+	}
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.MaxConns = 1
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	held, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := (poolDB{pool: pool}).Exec(ctx, "SELECT 1"); !errors.Is(err, micro.ErrServiceBusy) {
+		t.Errorf("Exec err = %v, want %v", err, micro.ErrServiceBusy)
+	}
+}
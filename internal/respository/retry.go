@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/codersaadi/go-micro/pkg/micro"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// isConnError reports whether err comes from a broken connection, such as
+// one the server closed during a failover, rather than from the query
+func isConnError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if pgconn.SafeToRetry(err) || micro.IsConnClosed(err) {
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Class 08 is connection exceptions; 57P01 is the server shutting
+		// down and terminating the session
+		return strings.HasPrefix(pgErr.Code, "08") || pgErr.Code == "57P01"
+	}
+	return false
+}
+
+// readWithRetry runs a read-only query, retrying it once when the pool
+// handed out a broken connection. pgx discards the broken connection when
+// it is released, so the retry gets a different one. Never use it for
+// writes: the first attempt may have been applied before the connection
+// broke.
+func readWithRetry[T any](ctx context.Context, logger micro.Logger, query func() (T, error)) (T, error) {
+	result, err := query()
+	if !isConnError(err) || ctx.Err() != nil {
+		return result, err
+	}
+	logger.Warn("retrying read on broken connection", zap.Error(err))
+	return query()
+}
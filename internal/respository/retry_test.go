@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/codersaadi/go-micro/internal/models"
+	"github.com/codersaadi/go-micro/pkg/micro"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// brokenConnDB fails the first failures statements with err, as a pool
+// handing out connections the server has closed would, then answers from
+// the wrapped tenantDB
+type brokenConnDB struct {
+	*tenantDB
+	failures int
+	err      error
+	calls    int
+}
+
+func (db *brokenConnDB) fail() bool {
+	db.calls++
+	return db.calls <= db.failures
+}
+
+func (db *brokenConnDB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	if db.fail() {
+		return pgconn.CommandTag{}, db.err
+	}
+	return db.tenantDB.Exec(ctx, sql, args...)
+}
+
+func (db *brokenConnDB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	if db.fail() {
+		return errRow{err: db.err}
+	}
+	return db.tenantDB.QueryRow(ctx, sql, args...)
+}
+
+func newBrokenConnRepo(failures int, err error) (*userRepo, *brokenConnDB, *micro.TestLogger) {
+	_, tenants := newTenantRepo()
+	db := &brokenConnDB{tenantDB: tenants, failures: failures, err: err}
+	logger := micro.NewTestLogger()
+	return &userRepo{queries: models.New(db), logger: logger}, db, logger
+}
+
+func TestReadRetriesBrokenConnection(t *testing.T) {
+	acme := micro.WithTenant(context.Background(), "acme")
+	reads := map[string]func(*userRepo) (*models.User, error){
+		"GetUserByID":    func(r *userRepo) (*models.User, error) { return r.GetUserByID(acme, 1) },
+		"GetUserByEmail": func(r *userRepo) (*models.User, error) { return r.GetUserByEmail(acme, "ada@acme.test") },
+	}
+	for name, read := range reads {
+		t.Run(name, func(t *testing.T) {
+			repo, db, logger := newBrokenConnRepo(1, io.ErrUnexpectedEOF)
+			user, err := read(repo)
+			if err != nil {
+				t.Fatalf("read after a broken connection: %v", err)
+			}
+			if user.Name != "Ada" || db.calls != 2 {
+				t.Errorf("user = %+v after %d calls, want Ada after 2", user, db.calls)
+			}
+			if !logger.Logged("retrying read on broken connection") {
+				t.Error("retry not logged")
+			}
+		})
+	}
+}
+
+func TestReadRetriesOnce(t *testing.T) {
+	repo, db, _ := newBrokenConnRepo(2, io.ErrUnexpectedEOF)
+	if _, err := repo.GetUserByID(micro.WithTenant(context.Background(), "acme"), 1); err == nil {
+		t.Fatal("read succeeded through two broken connections")
+	}
+	if db.calls != 2 {
+		t.Errorf("%d attempts, want 2", db.calls)
+	}
+}
+
+func TestReadDoesNotRetryOtherErrors(t *testing.T) {
+	acme := micro.WithTenant(context.Background(), "acme")
+	cancelled, cancel := context.WithCancel(acme)
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+	}{
+		{"query error", acme, &pgconn.PgError{Code: "42P01"}},
+		{"no rows", acme, pgx.ErrNoRows},
+		{"cancelled request", cancelled, io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, db, _ := newBrokenConnRepo(1, tt.err)
+			repo.GetUserByID(tt.ctx, 1)
+			if db.calls != 1 {
+				t.Errorf("%d attempts, want 1", db.calls)
+			}
+		})
+	}
+}
+
+func TestWritesAreNotRetried(t *testing.T) {
+	acme := micro.WithTenant(context.Background(), "acme")
+	writes := map[string]func(*userRepo) error{
+		"UpdateUser": func(r *userRepo) error {
+			_, err := r.UpdateUser(acme, UpdateUserInput{ID: 1, Name: micro.Some("Eve")})
+			return err
+		},
+		"DeleteUser": func(r *userRepo) error { return r.DeleteUser(acme, 1) },
+	}
+	for name, write := range writes {
+		t.Run(name, func(t *testing.T) {
+			// The first attempt may have been applied before the
+			// connection broke, so a retry could apply it twice
+			repo, db, _ := newBrokenConnRepo(1, io.ErrUnexpectedEOF)
+			if err := write(repo); err == nil {
+				t.Fatal("write succeeded through a broken connection")
+			}
+			if db.calls != 1 {
+				t.Errorf("%d attempts, want 1", db.calls)
+			}
+		})
+	}
+}
+
+func TestIsConnError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"eof", io.EOF, true},
+		{"wrapped unexpected eof", fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, true},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, true},
+		{"reset by peer", &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, false},
+		{"no rows", pgx.ErrNoRows, false},
+		{"deadline", context.DeadlineExceeded, false},
+	}
+	for _, tt := range tests {
+		if got := isConnError(tt.err); got != tt.want {
+			t.Errorf("%s: isConnError(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/codersaadi/go-micro/pkg/micro"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type usageSink struct {
+	pool *pgxpool.Pool
+}
+
+// NewUsageSink creates a micro.UsageSink writing to the usage table
+func NewUsageSink(pool *pgxpool.Pool) micro.UsageSink {
+	return &usageSink{pool: pool}
+}
+
+func (s *usageSink) WriteUsage(ctx context.Context, records []micro.UsageRecord) error {
+	batch := &pgx.Batch{}
+	for _, rec := range records {
+		batch.Queue(
+			`INSERT INTO usage (api_key, requests, bytes_in, bytes_out, period_start, period_end)
+			 VALUES ($1, $2, $3, $4, $5, $6)`,
+			rec.Key, rec.Requests, rec.BytesIn, rec.BytesOut, rec.PeriodStart, rec.PeriodEnd,
+		)
+	}
+
+	if err := s.pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to insert usage: %w", err)
+	}
+	return nil
+}
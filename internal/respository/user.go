@@ -7,7 +7,9 @@ import (
 
 	"github.com/codersaadi/go-micro/internal/models"
 	"github.com/codersaadi/go-micro/pkg/micro"
-	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"go.uber.org/zap"
@@ -22,31 +24,44 @@ var (
 type UserRepository interface {
 	CreateUser(ctx context.Context, params models.CreateUserParams) (*models.User, error)
 	GetUserByID(ctx context.Context, id int32) (*models.User, error)
-	UpdateUser(ctx context.Context, params models.UpdateUserParams) (*models.User, error)
+	UpdateUser(ctx context.Context, input UpdateUserInput) (*models.User, error)
 	DeleteUser(ctx context.Context, id int32) error
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	StreamUsers(ctx context.Context, fn func(*models.User) error) error
 }
 
 type userRepo struct {
-	pool    *pgxpool.Pool
+	db      poolDB
 	queries *models.Queries
 	logger  micro.Logger
 }
 
 func NewUserRepository(pool *pgxpool.Pool, logger micro.Logger) UserRepository {
+	db := poolDB{pool: pool}
 	return &userRepo{
-		pool:    pool,
-		queries: models.New(pool),
-		logger:  logger.With(zap.String("component", "user-repository")),
+		db:      db,
+		queries: models.New(db),
+		logger:  logger,
 	}
 }
 
+// loggerFor returns the request-scoped logger of ctx, so repository logs
+// carry the request ID, or the base logger outside a request. The query is
+// logged as "operation" since the request logger already has the HTTP
+// method.
+func (r *userRepo) loggerFor(ctx context.Context, operation string) micro.Logger {
+	return micro.LoggerFromContextOr(ctx, r.logger).With(
+		zap.String("component", "user-repository"),
+		zap.String("operation", operation),
+	)
+}
+
 func (r *userRepo) CreateUser(ctx context.Context, params models.CreateUserParams) (*models.User, error) {
-	logger := r.logger.With(
-		zap.String("method", "CreateUser"),
+	logger := r.loggerFor(ctx, "CreateUser").With(
 		zap.Any("params", params),
 	)
 
+	params.TenantID = tenantFromContext(ctx)
 	user, err := r.queries.CreateUser(ctx, params)
 	if err != nil {
 		if isDuplicateKeyError(err) {
@@ -62,12 +77,16 @@ func (r *userRepo) CreateUser(ctx context.Context, params models.CreateUserParam
 }
 
 func (r *userRepo) GetUserByID(ctx context.Context, id int32) (*models.User, error) {
-	logger := r.logger.With(
-		zap.String("method", "GetUserByID"),
+	logger := r.loggerFor(ctx, "GetUserByID").With(
 		zap.Int32("user_id", id),
 	)
 
-	user, err := r.queries.GetUserByID(ctx, id)
+	user, err := readWithRetry(ctx, logger, func() (models.User, error) {
+		return r.queries.GetUserByID(ctx, models.GetUserByIDParams{
+			ID:       id,
+			TenantID: tenantFromContext(ctx),
+		})
+	})
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			logger.Warn("user not found")
@@ -80,12 +99,16 @@ func (r *userRepo) GetUserByID(ctx context.Context, id int32) (*models.User, err
 	return &user, nil
 }
 func (r *userRepo) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
-	logger := r.logger.With(
-		zap.String("method", "GetUserByID"),
+	logger := r.loggerFor(ctx, "GetUserByEmail").With(
 		zap.String("email", email),
 	)
 
-	user, err := r.queries.GetUserByEmail(ctx, email)
+	user, err := readWithRetry(ctx, logger, func() (models.User, error) {
+		return r.queries.GetUserByEmail(ctx, models.GetUserByEmailParams{
+			Email:    email,
+			TenantID: tenantFromContext(ctx),
+		})
+	})
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			logger.Warn("user not found")
@@ -98,20 +121,39 @@ func (r *userRepo) GetUserByEmail(ctx context.Context, email string) (*models.Us
 	return &user, nil
 }
 
-func (r *userRepo) UpdateUser(ctx context.Context, params models.UpdateUserParams) (*models.User, error) {
-	logger := r.logger.With(
-		zap.String("method", "UpdateUser"),
-		zap.Any("params", params),
+// UpdateUserInput is a partial update of a user. Absent fields are left
+// unchanged and a present null clears a nullable column.
+type UpdateUserInput struct {
+	ID       int32
+	Name     micro.Optional[string]
+	Email    micro.Optional[string]
+	Password micro.Optional[string]
+	Phone    micro.Optional[string]
+}
+
+func (r *userRepo) UpdateUser(ctx context.Context, input UpdateUserInput) (*models.User, error) {
+	logger := r.loggerFor(ctx, "UpdateUser").With(
+		zap.Int32("user_id", input.ID),
 	)
 
-	user, err := r.queries.UpdateUser(ctx, params)
+	// NULL keeps the current value of non-nullable columns via COALESCE,
+	// while phone is only touched when present so null can clear it
+	user, err := r.queries.UpdateUser(ctx, models.UpdateUserParams{
+		ID:       input.ID,
+		TenantID: tenantFromContext(ctx),
+		Name:     optionalText(input.Name),
+		Email:    optionalText(input.Email),
+		Password: optionalText(input.Password),
+		SetPhone: input.Phone.Set,
+		Phone:    optionalText(input.Phone),
+	})
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			logger.Warn("user not found for update")
 			return nil, ErrUserNotFound
 		}
 		if isDuplicateKeyError(err) {
-			logger.Warn("duplicate email attempt in updint64ate")
+			logger.Warn("duplicate email attempt in update")
 			return nil, ErrEmailExists
 		}
 		logger.Error("failed to update user", zap.Error(err))
@@ -123,26 +165,87 @@ func (r *userRepo) UpdateUser(ctx context.Context, params models.UpdateUserParam
 }
 
 func (r *userRepo) DeleteUser(ctx context.Context, id int32) error {
-	logger := r.logger.With(
-		zap.String("method", "DeleteUser"),
+	logger := r.loggerFor(ctx, "DeleteUser").With(
 		zap.Int32("user_id", id),
 	)
 
-	err := r.queries.DeleteUser(ctx, id)
+	rows, err := r.queries.DeleteUser(ctx, models.DeleteUserParams{
+		ID:       id,
+		TenantID: tenantFromContext(ctx),
+	})
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			logger.Warn("user not found for deletion")
-			return ErrUserNotFound
-		}
 		logger.Error("failed to delete user", zap.Error(err))
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
+	if rows == 0 {
+		logger.Warn("user not found for deletion")
+		return ErrUserNotFound
+	}
 
 	logger.Info("user deleted successfully")
 	return nil
 }
 
+const streamUsers = `SELECT id, name, email, password, created_at, updated_at, tenant_id, phone, role FROM users WHERE tenant_id = $1 ORDER BY id`
+
+// StreamUsers iterates over all users with a database cursor, calling fn for
+// each row so callers never hold the full table in memory
+func (r *userRepo) StreamUsers(ctx context.Context, fn func(*models.User) error) error {
+	logger := r.loggerFor(ctx, "StreamUsers")
+
+	// Only opening the cursor is retried; rows already passed to fn cannot
+	// be taken back
+	rows, err := r.db.queryWithRetry(ctx, logger, streamUsers, tenantFromContext(ctx))
+	if err != nil {
+		logger.Error("failed to query users", zap.Error(err))
+		return fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(
+			&user.ID,
+			&user.Name,
+			&user.Email,
+			&user.Password,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+			&user.TenantID,
+			&user.Phone,
+			&user.Role,
+		); err != nil {
+			logger.Error("failed to scan user", zap.Error(err))
+			return fmt.Errorf("failed to scan user: %w", err)
+		}
+		if err := fn(&user); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		logger.Error("failed to stream users", zap.Error(err))
+		return fmt.Errorf("failed to stream users: %w", err)
+	}
+	return nil
+}
+
+// optionalText converts an Optional to a nullable text parameter; absent and
+// null both map to SQL NULL
+func optionalText(o micro.Optional[string]) pgtype.Text {
+	v, ok := o.Get()
+	return pgtype.Text{String: v, Valid: ok}
+}
+
+// tenantFromContext returns the tenant every query is scoped to. Rows of
+// other tenants are invisible, so cross-tenant access reports not found
+// rather than forbidden and does not leak existence.
+func tenantFromContext(ctx context.Context) string {
+	tenantID, _ := micro.TenantFromContext(ctx)
+	return tenantID
+}
+
 func isDuplicateKeyError(err error) bool {
-	var pgErr *pgx.PgError
+	var pgErr *pgconn.PgError
 	return errors.As(err, &pgErr) && pgErr.Code == "23505"
 }
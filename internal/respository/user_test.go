@@ -0,0 +1,276 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codersaadi/go-micro/internal/models"
+	"github.com/codersaadi/go-micro/pkg/micro"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// tenantDB is an in-memory users table answering the generated queries the
+// way Postgres would, so tests exercise the tenant filters the repository
+// passes
+type tenantDB struct {
+	users      map[int32]models.User
+	lastUpdate []interface{} // Arguments of the last UpdateUser query
+}
+
+func (db *tenantDB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	if !strings.Contains(sql, "name: DeleteUser") {
+		return pgconn.CommandTag{}, errors.New("unexpected statement")
+	}
+	id, tenantID := args[0].(int32), args[1].(string)
+	if u, ok := db.users[id]; ok && u.TenantID == tenantID {
+		delete(db.users, id)
+		return pgconn.NewCommandTag("DELETE 1"), nil
+	}
+	return pgconn.NewCommandTag("DELETE 0"), nil
+}
+
+func (db *tenantDB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return nil, errors.New("unexpected query")
+}
+
+func (db *tenantDB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	switch {
+	case strings.Contains(sql, "name: GetUserByID"):
+		return db.find(args[0].(int32), args[1].(string))
+	case strings.Contains(sql, "name: UpdateUser"):
+		db.lastUpdate = args
+		return db.find(args[5].(int32), args[6].(string))
+	case strings.Contains(sql, "name: GetUserByEmail"):
+		for _, u := range db.users {
+			if u.Email == args[0].(string) && u.TenantID == args[1].(string) {
+				return userRow{user: u}
+			}
+		}
+		return errRow{err: pgx.ErrNoRows}
+	}
+	return errRow{err: errors.New("unexpected query")}
+}
+
+func (db *tenantDB) find(id int32, tenantID string) pgx.Row {
+	if u, ok := db.users[id]; ok && u.TenantID == tenantID {
+		return userRow{user: u}
+	}
+	return errRow{err: pgx.ErrNoRows}
+}
+
+type userRow struct {
+	user models.User
+}
+
+func (r userRow) Scan(dest ...interface{}) error {
+	*dest[0].(*int32) = r.user.ID
+	*dest[1].(*string) = r.user.Name
+	*dest[2].(*string) = r.user.Email
+	*dest[6].(*string) = r.user.TenantID
+	return nil
+}
+
+func newTenantRepo() (*userRepo, *tenantDB) {
+	db := &tenantDB{users: map[int32]models.User{
+		1: {ID: 1, Name: "Ada", Email: "ada@acme.test", TenantID: "acme"},
+		2: {ID: 2, Name: "Grace", Email: "grace@globex.test", TenantID: "globex"},
+	}}
+	return &userRepo{queries: models.New(db), logger: micro.NewNopLogger()}, db
+}
+
+func TestTenantIsolation(t *testing.T) {
+	acme := micro.WithTenant(context.Background(), "acme")
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		id   int32
+		want error
+	}{
+		{"own tenant", acme, 1, nil},
+		{"other tenant", acme, 2, ErrUserNotFound},
+		{"no tenant", context.Background(), 1, ErrUserNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, _ := newTenantRepo()
+			user, err := repo.GetUserByID(tt.ctx, tt.id)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("GetUserByID err = %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && user.TenantID != "acme" {
+				t.Errorf("user tenant = %q, want acme", user.TenantID)
+			}
+
+			// Cross-tenant access reports not found rather than forbidden,
+			// so IDs of other tenants cannot be probed
+			_, err = repo.UpdateUser(tt.ctx, UpdateUserInput{ID: tt.id, Name: micro.Some("Eve")})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("UpdateUser err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTenantIsolationDelete(t *testing.T) {
+	repo, db := newTenantRepo()
+	acme := micro.WithTenant(context.Background(), "acme")
+
+	if err := repo.DeleteUser(acme, 2); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("cross-tenant DeleteUser err = %v, want %v", err, ErrUserNotFound)
+	}
+	if _, ok := db.users[2]; !ok {
+		t.Fatal("cross-tenant delete removed the user")
+	}
+	if err := repo.DeleteUser(acme, 1); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+}
+
+func TestTenantIsolationByEmail(t *testing.T) {
+	repo, _ := newTenantRepo()
+	globex := micro.WithTenant(context.Background(), "globex")
+
+	if _, err := repo.GetUserByEmail(globex, "ada@acme.test"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("cross-tenant GetUserByEmail err = %v, want %v", err, ErrUserNotFound)
+	}
+	if _, err := repo.GetUserByEmail(globex, "grace@globex.test"); err != nil {
+		t.Errorf("GetUserByEmail: %v", err)
+	}
+}
+
+func TestIsDuplicateKeyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"unique violation", &pgconn.PgError{Code: "23505"}, true},
+		{"wrapped unique violation", fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23505"}), true},
+		{"other constraint", &pgconn.PgError{Code: "23503"}, false},
+		{"no rows", pgx.ErrNoRows, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isDuplicateKeyError(tt.err); got != tt.want {
+				t.Errorf("isDuplicateKeyError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateUserOptionalFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		phone    micro.Optional[string]
+		setPhone bool
+		want     pgtype.Text
+	}{
+		{"omitted keeps phone", micro.Optional[string]{}, false, pgtype.Text{}},
+		{"null clears phone", micro.Null[string](), true, pgtype.Text{}},
+		{"value sets phone", micro.Some("+15550100"), true, pgtype.Text{String: "+15550100", Valid: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, db := newTenantRepo()
+			acme := micro.WithTenant(context.Background(), "acme")
+
+			if _, err := repo.UpdateUser(acme, UpdateUserInput{ID: 1, Phone: tt.phone}); err != nil {
+				t.Fatalf("UpdateUser: %v", err)
+			}
+			// $4 says whether phone is written and $5 is the value, where
+			// an invalid pgtype.Text is SQL NULL
+			if setPhone := db.lastUpdate[3].(bool); setPhone != tt.setPhone {
+				t.Errorf("set_phone = %v, want %v", setPhone, tt.setPhone)
+			}
+			if phone := db.lastUpdate[4].(pgtype.Text); phone != tt.want {
+				t.Errorf("phone = %+v, want %+v", phone, tt.want)
+			}
+			// Omitted non-nullable fields are passed as NULL so COALESCE
+			// keeps them
+			if name := db.lastUpdate[0].(pgtype.Text); name.Valid {
+				t.Errorf("name = %+v, want NULL", name)
+			}
+		})
+	}
+}
+
+func TestRepositoryLogsWithRequestLogger(t *testing.T) {
+	app, err := micro.NewApp(&micro.Config{
+		Port:           8080,
+		LogLevel:       "error",
+		DBDSN:          "postgres://localhost/test",
+		HandlerTimeout: time.Second,
+		RateLimiter:    micro.RateLimiterConfig{Strategy: "ip"},
+	})
+	if err != nil {
+		t.Fatalf("NewApp: %v", err)
+	}
+	requestLogger := micro.NewTestLogger()
+	app.Logger = requestLogger
+
+	repo, _ := newTenantRepo()
+	base := micro.NewTestLogger()
+	repo.logger = base
+	app.GET("/users/{id}", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		_, err := repo.GetUserByID(micro.WithTenant(ctx, "acme"), 2)
+		return err
+	})
+
+	w := httptest.NewRecorder()
+	app.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/2", nil))
+
+	fields := logFields(t, requestLogger, "user not found")
+	want := map[string]interface{}{
+		"request_id": w.Header().Get("X-Request-ID"),
+		"component":  "user-repository",
+		"operation":  "GetUserByID",
+		"user_id":    int32(2),
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("%s = %v, want %v", k, fields[k], v)
+		}
+	}
+	if len(base.Entries()) != 0 {
+		t.Errorf("request logged to the base logger: %v", base.Messages())
+	}
+}
+
+func TestRepositoryLogsWithBaseLoggerOutsideRequest(t *testing.T) {
+	repo, _ := newTenantRepo()
+	base := micro.NewTestLogger()
+	repo.logger = base
+
+	// As from a worker or job, without a request-scoped logger
+	if _, err := repo.GetUserByID(micro.WithTenant(context.Background(), "acme"), 2); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("GetUserByID err = %v, want %v", err, ErrUserNotFound)
+	}
+	fields := logFields(t, base, "user not found")
+	if fields["component"] != "user-repository" || fields["operation"] != "GetUserByID" {
+		t.Errorf("fields = %v, want the repository component and operation", fields)
+	}
+	if _, ok := fields["request_id"]; ok {
+		t.Errorf("fields = %v, want no request_id outside a request", fields)
+	}
+}
+
+// logFields returns the fields of the first entry of logger with msg
+func logFields(t *testing.T, logger *micro.TestLogger, msg string) map[string]interface{} {
+	t.Helper()
+	for _, e := range logger.Entries() {
+		if e.Message == msg {
+			return e.ContextMap()
+		}
+	}
+	t.Fatalf("no %q entry in %v", msg, logger.Messages())
+	return nil
+}
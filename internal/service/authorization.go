@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/codersaadi/go-micro/pkg/micro"
+)
+
+// AuthorizationPolicy decides whether the caller in ctx may access a user
+// record, or list every user of the tenant. Implementations return
+// ErrForbidden to deny access.
+type AuthorizationPolicy interface {
+	AuthorizeUserAccess(ctx context.Context, userID int32) error
+	AuthorizeUserList(ctx context.Context) error
+}
+
+// OwnerOrAdminPolicy allows the user themselves and principals holding
+// AdminRole; everyone else, including anonymous callers, is denied. Only
+// admins may list users.
+type OwnerOrAdminPolicy struct {
+	AdminRole string // Defaults to "admin"
+}
+
+func (p OwnerOrAdminPolicy) AuthorizeUserAccess(ctx context.Context, userID int32) error {
+	principal, ok := micro.PrincipalFromContext(ctx)
+	if !ok {
+		return ErrForbidden
+	}
+	if principal.ID == strconv.Itoa(int(userID)) || principal.HasRole(p.adminRole()) {
+		return nil
+	}
+	return ErrForbidden
+}
+
+func (p OwnerOrAdminPolicy) AuthorizeUserList(ctx context.Context) error {
+	if principal, ok := micro.PrincipalFromContext(ctx); ok && principal.HasRole(p.adminRole()) {
+		return nil
+	}
+	return ErrForbidden
+}
+
+func (p OwnerOrAdminPolicy) adminRole() string {
+	if p.AdminRole == "" {
+		return "admin"
+	}
+	return p.AdminRole
+}
+
+// UserServiceOption configures the user service
+type UserServiceOption func(*userService)
+
+// WithAuthorizationPolicy makes the service check the policy before reading,
+// updating, deleting or streaming users. Without it no check is made.
+func WithAuthorizationPolicy(policy AuthorizationPolicy) UserServiceOption {
+	return func(s *userService) {
+		s.policy = policy
+	}
+}
+
+func (s *userService) authorize(ctx context.Context, userID int32) error {
+	if s.policy == nil {
+		return nil
+	}
+	return s.policy.AuthorizeUserAccess(ctx, userID)
+}
+
+func (s *userService) authorizeList(ctx context.Context) error {
+	if s.policy == nil {
+		return nil
+	}
+	return s.policy.AuthorizeUserList(ctx)
+}
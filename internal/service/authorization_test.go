@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/codersaadi/go-micro/internal/models"
+	repository "github.com/codersaadi/go-micro/internal/respository"
+	"github.com/codersaadi/go-micro/pkg/micro"
+)
+
+// fakeUserRepo serves users from a map and counts the lookups that reach it.
+// When err is set, lookups fail with it. Methods a test does not need panic
+// through the nil embedded interface.
+type fakeUserRepo struct {
+	repository.UserRepository
+	users   map[int32]*models.User
+	lookups int
+	err     error
+}
+
+func (f *fakeUserRepo) GetUserByID(ctx context.Context, id int32) (*models.User, error) {
+	f.lookups++
+	if f.err != nil {
+		return nil, f.err
+	}
+	if u, ok := f.users[id]; ok {
+		return u, nil
+	}
+	return nil, repository.ErrUserNotFound
+}
+
+func (f *fakeUserRepo) DeleteUser(ctx context.Context, id int32) error {
+	f.lookups++
+	if _, ok := f.users[id]; !ok {
+		return repository.ErrUserNotFound
+	}
+	delete(f.users, id)
+	return nil
+}
+
+func (f *fakeUserRepo) StreamUsers(ctx context.Context, fn func(*models.User) error) error {
+	f.lookups++
+	for id := int32(1); id <= int32(len(f.users)); id++ {
+		if err := fn(f.users[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newFakeUserRepo() *fakeUserRepo {
+	return &fakeUserRepo{users: map[int32]*models.User{
+		1: {ID: 1, Name: "Ada"},
+		2: {ID: 2, Name: "Grace"},
+	}}
+}
+
+func asPrincipal(id string, roles ...string) context.Context {
+	return micro.WithPrincipal(context.Background(), &micro.Principal{ID: id, Roles: roles})
+}
+
+func TestOwnerOrAdminPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy OwnerOrAdminPolicy
+		ctx    context.Context
+		want   error
+	}{
+		{"owner", OwnerOrAdminPolicy{}, asPrincipal("1"), nil},
+		{"admin", OwnerOrAdminPolicy{}, asPrincipal("2", "admin"), nil},
+		{"other user", OwnerOrAdminPolicy{}, asPrincipal("2", "member"), ErrForbidden},
+		{"anonymous", OwnerOrAdminPolicy{}, context.Background(), ErrForbidden},
+		{"custom admin role", OwnerOrAdminPolicy{AdminRole: "support"}, asPrincipal("2", "support"), nil},
+		{"default role not admin under custom", OwnerOrAdminPolicy{AdminRole: "support"}, asPrincipal("2", "admin"), ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.AuthorizeUserAccess(tt.ctx, 1); !errors.Is(err, tt.want) {
+				t.Errorf("AuthorizeUserAccess = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOwnerOrAdminPolicyUserList(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy OwnerOrAdminPolicy
+		ctx    context.Context
+		want   error
+	}{
+		{"admin", OwnerOrAdminPolicy{}, asPrincipal("2", "admin"), nil},
+		{"member", OwnerOrAdminPolicy{}, asPrincipal("1", "member"), ErrForbidden},
+		{"anonymous", OwnerOrAdminPolicy{}, context.Background(), ErrForbidden},
+		{"custom admin role", OwnerOrAdminPolicy{AdminRole: "support"}, asPrincipal("2", "support"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.AuthorizeUserList(tt.ctx); !errors.Is(err, tt.want) {
+				t.Errorf("AuthorizeUserList = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamUsersEnforcesPolicy(t *testing.T) {
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		want  error
+		users int
+	}{
+		{"admin", asPrincipal("2", "admin"), nil, 2},
+		{"member", asPrincipal("1"), ErrForbidden, 0},
+		{"anonymous", context.Background(), ErrForbidden, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeUserRepo()
+			svc := NewUserService(repo, micro.NewNopLogger(), WithAuthorizationPolicy(OwnerOrAdminPolicy{}))
+
+			streamed := 0
+			err := svc.StreamUsers(tt.ctx, func(*models.User) error {
+				streamed++
+				return nil
+			})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("StreamUsers = %v, want %v", err, tt.want)
+			}
+			if streamed != tt.users {
+				t.Errorf("streamed %d users, want %d", streamed, tt.users)
+			}
+			if tt.want != nil && repo.lookups != 0 {
+				t.Errorf("repository queried %d times for a denied caller", repo.lookups)
+			}
+		})
+	}
+}
+
+func TestGetUserByIDEnforcesPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want error
+	}{
+		{"owner", asPrincipal("1"), nil},
+		{"admin", asPrincipal("2", "admin"), nil},
+		{"other user", asPrincipal("2"), ErrForbidden},
+		{"anonymous", context.Background(), ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeUserRepo()
+			svc := NewUserService(repo, micro.NewNopLogger(), WithAuthorizationPolicy(OwnerOrAdminPolicy{}))
+
+			user, err := svc.GetUserByID(tt.ctx, 1)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("GetUserByID = %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && user.Name != "Ada" {
+				t.Errorf("user = %+v, want Ada", user)
+			}
+			// A denied caller must not learn whether the user exists
+			if tt.want != nil && repo.lookups != 0 {
+				t.Errorf("repository queried %d times for a denied caller", repo.lookups)
+			}
+		})
+	}
+}
+
+func TestDeleteUserEnforcesPolicy(t *testing.T) {
+	repo := newFakeUserRepo()
+	svc := NewUserService(repo, micro.NewNopLogger(), WithAuthorizationPolicy(OwnerOrAdminPolicy{}))
+
+	if err := svc.DeleteUser(asPrincipal("2"), 1); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("DeleteUser by another user = %v, want %v", err, ErrForbidden)
+	}
+	if _, ok := repo.users[1]; !ok {
+		t.Fatal("user deleted despite denial")
+	}
+	if err := svc.DeleteUser(asPrincipal("1"), 1); err != nil {
+		t.Fatalf("DeleteUser by owner: %v", err)
+	}
+}
+
+func TestNoPolicyAllowsAnyCaller(t *testing.T) {
+	svc := NewUserService(newFakeUserRepo(), micro.NewNopLogger())
+	if _, err := svc.GetUserByID(context.Background(), 2); err != nil {
+		t.Errorf("GetUserByID without a policy: %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"time"
+
+	"github.com/codersaadi/go-micro/pkg/micro"
+)
+
+// Domain event subjects published by the user service
+const (
+	EventUserCreated = "user.created"
+)
+
+// UserCreatedEvent is published after a user registers
+type UserCreatedEvent struct {
+	ID        int32     `json:"id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	TenantID  string    `json:"tenant_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WithEvents makes the service publish domain events after successful
+// mutations. Whether a failed publish fails the mutation is decided by
+// events, see micro.NewEvents.
+func WithEvents(events *micro.Events) UserServiceOption {
+	return func(s *userService) {
+		s.events = events
+	}
+}
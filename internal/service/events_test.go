@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/codersaadi/go-micro/pkg/micro"
+)
+
+// mockPublisher records published events and fails with err when set
+type mockPublisher struct {
+	subjects []string
+	payloads []interface{}
+	err      error
+}
+
+func (p *mockPublisher) Publish(ctx context.Context, subject string, payload interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.subjects = append(p.subjects, subject)
+	p.payloads = append(p.payloads, payload)
+	return nil
+}
+
+func TestRegisterUserPublishesEvent(t *testing.T) {
+	publisher := &mockPublisher{}
+	svc := NewUserService(newFakeUserRepo(), micro.NewNopLogger(), WithEvents(micro.NewEvents(publisher)))
+
+	user, err := svc.RegisterUser(context.Background(), RegisterParams{Name: "Edsger", Email: "edsger@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("RegisterUser: %v", err)
+	}
+	if len(publisher.subjects) != 1 || publisher.subjects[0] != EventUserCreated {
+		t.Fatalf("published %v, want one %s event", publisher.subjects, EventUserCreated)
+	}
+	event, ok := publisher.payloads[0].(UserCreatedEvent)
+	if !ok || event.ID != user.ID || event.Email != "edsger@example.com" || event.Name != "Edsger" {
+		t.Errorf("payload = %+v", publisher.payloads[0])
+	}
+}
+
+func TestRegisterUserEventFailure(t *testing.T) {
+	for _, required := range []bool{false, true} {
+		var subjects []string
+		if required {
+			subjects = []string{EventUserCreated}
+		}
+		logger := micro.NewTestLogger()
+		publisher := &mockPublisher{err: errors.New("broker down")}
+		svc := NewUserService(newFakeUserRepo(), logger, WithEvents(micro.NewEvents(publisher, subjects...)))
+
+		// The user is committed either way, so registration still succeeds
+		_, err := svc.RegisterUser(context.Background(), RegisterParams{Name: "Edsger", Email: "edsger@example.com", Password: "password123"})
+		if err != nil {
+			t.Fatalf("required=%v: RegisterUser = %v", required, err)
+		}
+		// A required event is logged so it can be replayed
+		if logged := logger.Logged("user registered without user.created event"); logged != required {
+			t.Errorf("required=%v: replay entry logged = %v", required, logged)
+		}
+	}
+}
+
+func TestRegisterUserFailureDoesNotPublish(t *testing.T) {
+	publisher := &mockPublisher{}
+	repo := newFakeUserRepo()
+	repo.users[1].Email = "ada@example.com"
+	svc := NewUserService(repo, micro.NewNopLogger(), WithEvents(micro.NewEvents(publisher)))
+
+	if _, err := svc.RegisterUser(context.Background(), RegisterParams{Name: "Ada", Email: "ada@example.com", Password: "password123"}); err == nil {
+		t.Fatal("duplicate registration succeeded")
+	}
+	if len(publisher.subjects) != 0 {
+		t.Errorf("published %v for a failed registration", publisher.subjects)
+	}
+}
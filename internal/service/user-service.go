@@ -19,6 +19,8 @@ var (
 	ErrUserNotFound       = errors.New("user not found")
 	ErrEmailExists        = errors.New("email already registered")
 	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrForbidden          = errors.New("access to user denied")
+	ErrNullNotAllowed     = errors.New("field cannot be null")
 )
 
 type UserService interface {
@@ -27,18 +29,25 @@ type UserService interface {
 	UpdateUser(ctx context.Context, params UpdateParams) (*models.User, error)
 	DeleteUser(ctx context.Context, id int32) error
 	Authenticate(ctx context.Context, email, password string) (*models.User, error)
+	StreamUsers(ctx context.Context, fn func(*models.User) error) error
 }
 
 type userService struct {
 	repo   repository.UserRepository
 	logger micro.Logger
+	policy AuthorizationPolicy
+	events *micro.Events
 }
 
-func NewUserService(repo repository.UserRepository, logger micro.Logger) UserService {
-	return &userService{
+func NewUserService(repo repository.UserRepository, logger micro.Logger, opts ...UserServiceOption) UserService {
+	s := &userService{
 		repo:   repo,
 		logger: logger.With(zap.String("component", "user-service")),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 type RegisterParams struct {
@@ -47,11 +56,14 @@ type RegisterParams struct {
 	Password string `json:"password" validate:"required,min=8,max=72"`
 }
 
+// UpdateParams is a partial update. Omitted fields are left unchanged and
+// an explicit null clears Phone; null is rejected for the other fields.
 type UpdateParams struct {
-	ID       int32   `json:"-"`
-	Name     *string `json:"name,omitempty" validate:"omitempty,min=2,max=100"`
-	Email    *string `json:"email,omitempty" validate:"omitempty,email"`
-	Password *string `json:"password,omitempty" validate:"omitempty,min=8,max=72"`
+	ID       int32                  `json:"-"`
+	Name     micro.Optional[string] `json:"name" validate:"omitempty,min=2,max=100"`
+	Email    micro.Optional[string] `json:"email" validate:"omitempty,email"`
+	Password micro.Optional[string] `json:"password" validate:"omitempty,min=8,max=72"`
+	Phone    micro.Optional[string] `json:"phone" validate:"omitempty,e164"`
 }
 
 func (s *userService) RegisterUser(ctx context.Context, params RegisterParams) (*models.User, error) {
@@ -86,7 +98,21 @@ func (s *userService) RegisterUser(ctx context.Context, params RegisterParams) (
 			return nil, ErrEmailExists
 		}
 		logger.Error("failed to create user", micro.ErrorField(err))
-		return nil, micro.ErrInternalServer
+		return nil, internalError(err)
+	}
+
+	// The user is already committed, so failing here would only make a
+	// retrying client hit ErrEmailExists. A required event that fails to
+	// publish is logged for replay instead.
+	if err := s.events.Publish(ctx, EventUserCreated, UserCreatedEvent{
+		ID:        user.ID,
+		Email:     user.Email,
+		Name:      user.Name,
+		TenantID:  user.TenantID,
+		CreatedAt: user.CreatedAt.Time,
+	}); err != nil {
+		logger.Error("user registered without user.created event",
+			micro.UserIDField(user.ID), micro.ErrorField(err))
 	}
 
 	logger.Info("user registered successfully", micro.UserIDField(user.ID))
@@ -99,13 +125,18 @@ func (s *userService) GetUserByID(ctx context.Context, id int32) (*models.User,
 		micro.UserIDField(id),
 	)
 
+	if err := s.authorize(ctx, id); err != nil {
+		logger.Warn("user access denied")
+		return nil, err
+	}
+
 	user, err := s.repo.GetUserByID(ctx, id)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
 			return nil, ErrUserNotFound
 		}
 		logger.Error("failed to retrieve user", micro.ErrorField(err))
-		return nil, micro.ErrInternalServer
+		return nil, internalError(err)
 	}
 
 	return user, nil
@@ -117,29 +148,35 @@ func (s *userService) UpdateUser(ctx context.Context, params UpdateParams) (*mod
 		micro.UserIDField(params.ID),
 	)
 
-	updateParams := models.UpdateUserParams{ID: params.ID}
+	if err := s.authorize(ctx, params.ID); err != nil {
+		logger.Warn("user access denied")
+		return nil, err
+	}
 
-	if params.Name != nil {
-		updateParams.Name = *params.Name
+	if params.Name.Null || params.Email.Null || params.Password.Null {
+		return nil, ErrNullNotAllowed
 	}
 
-	if params.Email != nil {
-		updateParams.Email = *params.Email
+	input := repository.UpdateUserInput{
+		ID:    params.ID,
+		Name:  params.Name,
+		Email: params.Email,
+		Phone: params.Phone,
 	}
 
-	if params.Password != nil {
-		if err := validatePassword(*params.Password); err != nil {
+	if password, ok := params.Password.Get(); ok {
+		if err := validatePassword(password); err != nil {
 			return nil, err
 		}
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*params.Password), bcrypt.DefaultCost)
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 		if err != nil {
 			logger.Error("failed to hash password", micro.ErrorField(err))
 			return nil, micro.ErrInternalServer
 		}
-		updateParams.Password = string(hashedPassword)
+		input.Password = micro.Some(string(hashedPassword))
 	}
 
-	user, err := s.repo.UpdateUser(ctx, updateParams)
+	user, err := s.repo.UpdateUser(ctx, input)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
 			return nil, ErrUserNotFound
@@ -148,7 +185,7 @@ func (s *userService) UpdateUser(ctx context.Context, params UpdateParams) (*mod
 			return nil, ErrEmailExists
 		}
 		logger.Error("failed to update user", micro.ErrorField(err))
-		return nil, micro.ErrInternalServer
+		return nil, internalError(err)
 	}
 
 	logger.Info("user updated successfully")
@@ -161,12 +198,17 @@ func (s *userService) DeleteUser(ctx context.Context, id int32) error {
 		micro.UserIDField(id),
 	)
 
+	if err := s.authorize(ctx, id); err != nil {
+		logger.Warn("user access denied")
+		return err
+	}
+
 	if err := s.repo.DeleteUser(ctx, id); err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
 			return ErrUserNotFound
 		}
 		logger.Error("failed to delete user", micro.ErrorField(err))
-		return micro.ErrInternalServer
+		return internalError(err)
 	}
 
 	logger.Info("user deleted successfully")
@@ -188,7 +230,7 @@ func (s *userService) Authenticate(ctx context.Context, email, password string)
 			return nil, ErrInvalidCredentials
 		}
 		logger.Error("failed to retrieve user", micro.ErrorField(err))
-		return nil, micro.ErrInternalServer
+		return nil, internalError(err)
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
@@ -199,6 +241,35 @@ func (s *userService) Authenticate(ctx context.Context, email, password string)
 	return user, nil
 }
 
+func (s *userService) StreamUsers(ctx context.Context, fn func(*models.User) error) error {
+	logger := s.logger.With(micro.MethodField("StreamUsers"))
+
+	// Streaming exposes every user of the tenant, so it is checked as a
+	// whole rather than per record
+	if err := s.authorizeList(ctx); err != nil {
+		logger.Warn("user listing denied")
+		return err
+	}
+
+	if err := s.repo.StreamUsers(ctx, fn); err != nil {
+		if errors.Is(err, context.Canceled) {
+			return err
+		}
+		logger.Error("failed to stream users", micro.ErrorField(err))
+		return internalError(err)
+	}
+	return nil
+}
+
+// internalError hides repository failures from clients, except overload,
+// which is passed through so clients know to retry
+func internalError(err error) error {
+	if errors.Is(err, micro.ErrServiceBusy) {
+		return micro.ErrServiceBusy
+	}
+	return micro.ErrInternalServer
+}
+
 func validatePassword(password string) error {
 	if len(password) < 8 {
 		return ErrWeakPassword
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/codersaadi/go-micro/internal/models"
+	repository "github.com/codersaadi/go-micro/internal/respository"
+	"github.com/codersaadi/go-micro/pkg/micro"
+)
+
+func (f *fakeUserRepo) CreateUser(ctx context.Context, params models.CreateUserParams) (*models.User, error) {
+	for _, u := range f.users {
+		if u.Email == params.Email {
+			return nil, repository.ErrEmailExists
+		}
+	}
+	u := &models.User{ID: int32(len(f.users) + 1), Name: params.Name, Email: params.Email, Password: params.Password}
+	f.users[u.ID] = u
+	return u, nil
+}
+
+func TestRegisterUserLogs(t *testing.T) {
+	logger := micro.NewTestLogger()
+	svc := NewUserService(newFakeUserRepo(), logger)
+
+	user, err := svc.RegisterUser(context.Background(), RegisterParams{
+		Name:     "Edsger",
+		Email:    "edsger@example.com",
+		Password: "correct horse",
+	})
+	if err != nil {
+		t.Fatalf("RegisterUser: %v", err)
+	}
+	if user.Password == "correct horse" {
+		t.Error("password stored in plain text")
+	}
+
+	entries := logger.Entries()
+	if len(entries) != 1 || entries[0].Message != "user registered successfully" {
+		t.Fatalf("logged %v, want one success entry", logger.Messages())
+	}
+	fields := entries[0].ContextMap()
+	if fields["user_id"] != user.ID || fields["component"] != "user-service" {
+		t.Errorf("fields = %v", fields)
+	}
+	// The password never reaches the logs
+	for k, v := range fields {
+		if s, ok := v.(string); ok && s == "correct horse" {
+			t.Errorf("field %q carries the password", k)
+		}
+	}
+}
+
+func TestRegisterUserDuplicateEmail(t *testing.T) {
+	logger := micro.NewTestLogger()
+	repo := newFakeUserRepo()
+	repo.users[1].Email = "ada@example.com"
+	svc := NewUserService(repo, logger)
+
+	_, err := svc.RegisterUser(context.Background(), RegisterParams{Name: "Ada", Email: "ada@example.com", Password: "password123"})
+	if !errors.Is(err, ErrEmailExists) {
+		t.Fatalf("err = %v, want %v", err, ErrEmailExists)
+	}
+	if logger.Logged("user registered successfully") {
+		t.Error("failed registration logged as successful")
+	}
+}
+
+func TestUpdateUserRejectsNullRequiredFields(t *testing.T) {
+	svc := NewUserService(newFakeUserRepo(), micro.NewNopLogger())
+	for name, params := range map[string]UpdateParams{
+		"name":     {ID: 1, Name: micro.Null[string]()},
+		"email":    {ID: 1, Email: micro.Null[string]()},
+		"password": {ID: 1, Password: micro.Null[string]()},
+	} {
+		if _, err := svc.UpdateUser(context.Background(), params); !errors.Is(err, ErrNullNotAllowed) {
+			t.Errorf("null %s: err = %v, want %v", name, err, ErrNullNotAllowed)
+		}
+	}
+}
+
+func TestGetUserByIDRepositoryErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"pool exhausted", fmt.Errorf("acquire connection: %w", micro.ErrServiceBusy), micro.ErrServiceBusy},
+		{"other failure", errors.New("connection reset"), micro.ErrInternalServer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeUserRepo()
+			repo.err = tt.err
+			svc := NewUserService(repo, micro.NewNopLogger())
+			if _, err := svc.GetUserByID(context.Background(), 1); err != tt.want {
+				t.Errorf("GetUserByID = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
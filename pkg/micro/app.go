@@ -3,23 +3,30 @@ package micro
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"regexp"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
-	"github.com/kelseyhightower/envconfig"
-	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
+	"golang.org/x/text/language"
+	"google.golang.org/grpc"
 )
 
 // CORSConfig represents configuration for CORS middleware
@@ -39,31 +46,104 @@ type App struct {
 	Router *mux.Router
 	Logger Logger
 
-	Validator    *validator.Validate
-	middleware   []mux.MiddlewareFunc
-	server       *http.Server
-	wg           sync.WaitGroup
-	ctx          context.Context
-	cancel       context.CancelFunc
-	healthChecks map[string]HealthCheck
-	rateLimiter  *rateLimiter // Add this field
+	Validator      *validator.Validate
+	middleware     []mux.MiddlewareFunc
+	middlewareOnce sync.Once
+	server         *http.Server
+	wg             sync.WaitGroup
+	ctx            context.Context
+	cancel         context.CancelFunc
+	healthMu       sync.RWMutex // Guards healthChecks and healthCache
+	healthChecks   map[string]HealthCheck
+	healthCache    *healthCache
+	rateLimiter    *rateLimiter // Add this field
+
+	rateLimitResolver       RateLimitResolver
+	rateLimitAuthenticator  Authenticator
+	notFoundHandler         http.Handler
+	methodNotAllowedHandler http.Handler
+	docs                    map[*mux.Route]*RouteDoc
+	routeConfigs            map[*mux.Route]*routeConfig
+	methodRoutes            []methodRoute // Collected by applyMiddleware for allowedMethods
+	workers                 []Worker
+	scheduler               *Scheduler
+	validationMessages      map[string]string
+	buildInfo               BuildInfo
+	metrics                 *metrics
+	debugNets               []*net.IPNet
+	versions                map[string]bool
+	errorEncoder            ErrorEncoder
+	errorMappings           []errorMapping
+	serverMu                sync.Mutex // Guards serverOptions and serverBuilt
+	serverOptions           func(*http.Server)
+	serverBuilt             bool
+	inFlight                atomic.Int64
+	shutdownHooks           []func(ShutdownInfo)
+	shutdownStart           time.Time
+	shutdownInFlight        int64
+	shutdownOnce            sync.Once
+	container               *Container
+	requestIDPattern        *regexp.Regexp
+	grpcServer              *grpc.Server
+	flags                   FeatureFlags
+	panicHandler            PanicHandler
+	catalog                 *catalog
+	schemas                 sync.Map // Compiled JSON schemas keyed by source
 }
 
 // Update Config struct to include the new CORS config
 type Config struct {
-	AppName         string        `envconfig:"APP_NAME" default:"micro-service"`
-	Port            int           `envconfig:"PORT" default:"8080" validate:"required,min=1,max=65535"`
-	LogLevel        string        `envconfig:"LOG_LEVEL" default:"info" validate:"oneof=debug info warn error"`
-	DBDSN           string        `envconfig:"DB_DSN" required:"true"`
-	ReadTimeout     time.Duration `envconfig:"READ_TIMEOUT" default:"5s"`
-	WriteTimeout    time.Duration `envconfig:"WRITE_TIMEOUT" default:"10s"`
-	MetricsEnabled  bool          `envconfig:"METRICS_ENABLED" default:"true"`
-	HandlerTimeout  time.Duration `envconfig:"HANDLER_TIMEOUT" default:"30s"`
-	CertFile        string        `envconfig:"CERT_FILE"`
-	KeyFile         string        `envconfig:"KEY_FILE"`
-	ShutdownTimeout time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"10s"`
-	RateLimiter     RateLimiterConfig
-	CORS            CORSConfig // New detailed CORS configuration
+	AppName                string        `envconfig:"APP_NAME" default:"micro-service"`
+	Env                    string        `envconfig:"APP_ENV"` // Profile applied by LoadConfig: development, staging or production
+	Port                   int           `envconfig:"PORT" default:"8080" validate:"required,min=1,max=65535"`
+	GRPCPort               int           `envconfig:"GRPC_PORT" default:"9090" validate:"min=0,max=65535"` // Serves App.GRPCServer when services are registered
+	LogLevel               string        `envconfig:"LOG_LEVEL" default:"info" validate:"oneof=debug info warn error"`
+	DBDSN                  string        `envconfig:"DB_DSN" validate:"required"`
+	DBStatementTimeout     time.Duration `envconfig:"DB_STATEMENT_TIMEOUT" default:"30s"`                  // Server-side query limit; 0 keeps the database default
+	EventsDriver           string        `envconfig:"EVENTS_DRIVER" validate:"omitempty,oneof=nats kafka"` // Event publisher backend; empty disables publishing
+	NATSURL                string        `envconfig:"NATS_URL" default:"nats://127.0.0.1:4222"`
+	KafkaBrokers           []string      `envconfig:"KAFKA_BROKERS" default:"localhost:9092"`
+	ReadTimeout            time.Duration `envconfig:"READ_TIMEOUT" default:"5s"`
+	WriteTimeout           time.Duration `envconfig:"WRITE_TIMEOUT" default:"10s"`
+	ReadHeaderTimeout      time.Duration `envconfig:"READ_HEADER_TIMEOUT" default:"5s"`                  // Bounds slow header delivery (Slowloris)
+	IdleTimeout            time.Duration `envconfig:"IDLE_TIMEOUT" default:"120s"`                       // Keep-alive idle connection lifetime
+	MaxHeaderBytes         int           `envconfig:"MAX_HEADER_BYTES" default:"65536" validate:"min=0"` // Request header size limit
+	MaxQueryBytes          int           `envconfig:"MAX_QUERY_BYTES" default:"8192" validate:"min=0"`   // Longer query strings get 414; 0 disables
+	MaxBodyBytes           int64         `envconfig:"MAX_BODY_BYTES" default:"1048576" validate:"min=0"` // Larger patch and schema bodies get 413; 0 disables
+	DisableKeepAlives      bool          `envconfig:"DISABLE_KEEP_ALIVES" default:"false"`
+	MetricsEnabled         bool          `envconfig:"METRICS_ENABLED" default:"true"`
+	HandlerTimeout         time.Duration `envconfig:"HANDLER_TIMEOUT" default:"30s"`
+	CertFile               string        `envconfig:"CERT_FILE"`
+	KeyFile                string        `envconfig:"KEY_FILE"`
+	ShutdownTimeout        time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"10s"`
+	RoutesEndpoint         bool          `envconfig:"ROUTES_ENDPOINT_ENABLED" default:"false"`               // Expose /_routes
+	HealthCheckConcurrency int           `envconfig:"HEALTH_CHECK_CONCURRENCY" default:"8" validate:"min=0"` // Checks run at once per probe; 0 runs all at once
+	AllowEmptyBody         bool          `envconfig:"ALLOW_EMPTY_BODY" default:"false"`                      // Decode empty bodies as zero values
+	StrictContentType      bool          `envconfig:"STRICT_CONTENT_TYPE" default:"false"`                   // Decode rejects bodies without a Content-Type
+	ExposeErrorDetails     *bool         `envconfig:"EXPOSE_ERROR_DETAILS"`                                  // Unset exposes details only at debug level
+	StrictSlash            bool          `envconfig:"STRICT_SLASH" default:"false"`                          // Treat /users and /users/ as different routes
+	RequireLogger          *bool         `envconfig:"REQUIRE_LOGGER"`                                        // Unset or true fails startup if the logger cannot be built
+	DebugHeader            string        `envconfig:"DEBUG_HEADER" default:"X-Debug"`                        // Enables debug logs for a request
+	DebugTrustedCIDRs      []string      `envconfig:"DEBUG_TRUSTED_CIDRS"`                                   // Clients allowed to send DebugHeader
+	APIVendor              string        `envconfig:"API_VENDOR"`                                            // Enables application/vnd.<vendor>.v{n}+json versioning
+	ProblemJSON            bool          `envconfig:"PROBLEM_JSON" default:"false"`                          // Emit RFC 7807 application/problem+json errors
+	ProblemTypeBase        string        `envconfig:"PROBLEM_TYPE_BASE"`                                     // URI prefix for problem types, e.g. https://example.com/problems
+	RequestIDPattern       string        `envconfig:"REQUEST_ID_PATTERN"`                                    // Honor upstream X-Request-ID values matching this regexp
+	RequestIDGenerator     func() string `ignored:"true"`                                                    // Generates request IDs; defaults to xid
+	DefaultLanguage        string        `envconfig:"DEFAULT_LANGUAGE" default:"en"`                         // Fallback for Accept-Language negotiation
+	TimeFormat             string        `envconfig:"TIME_FORMAT" default:"rfc3339"`                         // rfc3339, unix, unixmilli or a Go layout for micro.Time in JSON
+	ValidationMode         string        `envconfig:"VALIDATION_MODE" default:"all"`                         // "first" reports only the first invalid field
+	ResponseStatusHeader   string        `envconfig:"RESPONSE_STATUS_HEADER"`                                // Echoes the final status in this header, e.g. X-Response-Status
+	SlowRequestThreshold   time.Duration `envconfig:"SLOW_REQUEST_THRESHOLD"`                                // Requests taking longer are logged at warn; 0 disables
+
+	FeatureFlags       map[string]bool                 `envconfig:"FEATURE_FLAGS"` // Static flags, e.g. new_checkout:true,beta_search:false
+	ConfigureValidator func(*validator.Validate) error `ignored:"true"`            // Customizes App.Validator during NewApp, e.g. custom types
+	Metrics            MetricsConfig
+	RateLimiter        RateLimiterConfig
+	CORS               CORSConfig // New detailed CORS configuration
+	Pagination         PaginationConfig
+
+	fileEnv map[string]string // Variables read from CONFIG_FILE, see LookupEnv
 }
 
 // Handler is a function that processes requests with context
@@ -74,46 +154,43 @@ type HealthCheck struct {
 	Name        string
 	Description string
 	Check       func(context.Context) error
-}
-
-var (
-	httpRequestsTotal = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "http_requests_total",
-			Help: "Total number of HTTP requests.",
-		},
-		[]string{"method", "path", "status"},
-	)
-	httpDuration = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "http_request_duration_seconds",
-			Help:    "Duration of HTTP requests.",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"method", "path"},
-	)
-)
-
-func init() {
-	prometheus.MustRegister(httpRequestsTotal)
-	prometheus.MustRegister(httpDuration)
+	// A failing check returns 503 unless it is NonCritical, in which case
+	// the service reports itself as degraded with a 200
+	NonCritical bool
+	// CacheFor reuses a result younger than this for probes, while the
+	// check is refreshed in the background; 0 runs it on every probe
+	CacheFor time.Duration
 }
 
 // Update NewApp to initialize the rate limiter
 func NewApp(config *Config) (*App, error) {
 	if config == nil {
-		config = &Config{}
-		if err := envconfig.Process("", config); err != nil {
-			return nil, fmt.Errorf("failed to load config: %w", err)
+		loaded, err := LoadConfig()
+		if err != nil {
+			return nil, err
 		}
+		config = loaded
 	}
 
 	validate := validator.New()
+	if err := registerBuiltinValidations(validate); err != nil {
+		return nil, fmt.Errorf("failed to register validations: %w", err)
+	}
 	if err := validate.Struct(config); err != nil {
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if config.ConfigureValidator != nil {
+		if err := config.ConfigureValidator(validate); err != nil {
+			return nil, fmt.Errorf("failed to configure validator: %w", err)
+		}
+	}
+
+	jsonTimeFormat.Store(config.TimeFormat)
 
-	logger, err := NewLogger(config.LogLevel)
+	logger, err := buildLogger(config, NewLogger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize logger: %w", err)
 	}
@@ -128,13 +205,65 @@ func NewApp(config *Config) (*App, error) {
 		ctx:          ctx,
 		cancel:       cancel,
 		healthChecks: make(map[string]HealthCheck),
+		docs:         make(map[*mux.Route]*RouteDoc),
+		routeConfigs: make(map[*mux.Route]*routeConfig),
+		metrics:      newMetrics(config.Metrics),
+		versions:     make(map[string]bool),
+		container:    NewContainer(),
+
+		validationMessages: make(map[string]string),
 	}
+	app.notFoundHandler = http.HandlerFunc(app.defaultNotFoundHandler)
+	app.methodNotAllowedHandler = http.HandlerFunc(app.defaultMethodNotAllowedHandler)
+	app.Router.NotFoundHandler = app.notFoundHandler
+	app.Router.MethodNotAllowedHandler = app.methodNotAllowedHandler
 
 	// Initialize rate limiter
 	if app.Config.RateLimiter.Enabled {
-		app.rateLimiter = newRateLimiter(app.Config.RateLimiter)
+		rl, err := newRateLimiter(app.Config.RateLimiter, app.metrics)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("invalid rate limiter config: %w", err)
+		}
+		app.rateLimiter = rl
+	}
+
+	app.debugNets, err = parseCIDRs(config.DebugTrustedCIDRs)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("invalid debug trusted CIDRs: %w", err)
 	}
 
+	if config.RequestIDPattern != "" {
+		// Anchored so the whole ID must match, not just a substring
+		app.requestIDPattern, err = regexp.Compile("^(?:" + config.RequestIDPattern + ")$")
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("invalid request ID pattern: %w", err)
+		}
+	}
+
+	rules := make(map[string]FlagRule, len(config.FeatureFlags))
+	for flag, enabled := range config.FeatureFlags {
+		rules[flag] = FlagRule{Enabled: enabled}
+	}
+	app.flags = NewStaticFlags(rules)
+
+	fallback := language.English
+	if config.DefaultLanguage != "" {
+		fallback, err = language.Parse(config.DefaultLanguage)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("invalid default language: %w", err)
+		}
+	}
+	app.catalog = newCatalog(fallback)
+
+	app.container.ProvideValue(app)
+	app.container.ProvideValue(config)
+	ProvideAs[Logger](app.container, logger)
+
+	app.SetBuildInfo(DefaultBuildInfo())
 	app.setupDefaultMiddleware()
 	app.registerSystemEndpoints()
 
@@ -143,80 +272,85 @@ func NewApp(config *Config) (*App, error) {
 
 // Update setupDefaultMiddleware to use the new CORS config
 func (a *App) setupDefaultMiddleware() {
+	a.Use(a.requestStartMiddleware)
 	a.Use(a.requestIDMiddleware)
-	a.Use(a.securityHeadersMiddleware)
-
-	if a.Config.RateLimiter.Enabled {
-		a.Use(a.rateLimiterMiddleware)
-	}
+	a.Use(a.requestScopeMiddleware)
 
+	// Metrics and logging wrap the middleware that may reject a request,
+	// so 414 and 429 responses are counted and logged too
 	if a.Config.MetricsEnabled {
 		a.Use(a.metricsMiddleware)
 	}
 
 	a.Use(a.logMiddleware)
 	a.Use(a.recoveryMiddleware)
+	a.Use(a.queryMiddleware)
+	a.Use(a.localeMiddleware)
+	a.Use(a.featureFlagsMiddleware)
+	a.Use(a.securityHeadersMiddleware)
+
+	if a.Config.RateLimiter.Enabled {
+		a.Use(a.rateLimiterMiddleware)
+	}
+
 	a.Use(a.timeoutMiddleware(a.Config.HandlerTimeout))
 
 	// Enhanced CORS configuration
 	if a.Config.CORS.Enabled {
-		corsOptions := []handlers.CORSOption{}
-
-		// Configure allowed origins
-		if len(a.Config.CORS.AllowedOrigins) > 0 {
-			corsOptions = append(corsOptions, handlers.AllowedOrigins(a.Config.CORS.AllowedOrigins))
-		}
-
-		// Configure allowed methods
-		if len(a.Config.CORS.AllowedMethods) > 0 {
-			corsOptions = append(corsOptions, handlers.AllowedMethods(a.Config.CORS.AllowedMethods))
-		}
-
-		// Configure allowed headers
-		if len(a.Config.CORS.AllowedHeaders) > 0 {
-			corsOptions = append(corsOptions, handlers.AllowedHeaders(a.Config.CORS.AllowedHeaders))
-		}
-
-		// Configure exposed headers
-		if len(a.Config.CORS.ExposedHeaders) > 0 {
-			corsOptions = append(corsOptions, handlers.ExposedHeaders(a.Config.CORS.ExposedHeaders))
-		}
-
-		// Configure credentials
-		if a.Config.CORS.AllowCredentials {
-			corsOptions = append(corsOptions, handlers.AllowCredentials())
-		}
-
-		// Configure max age
-		if a.Config.CORS.MaxAge > 0 {
-			corsOptions = append(corsOptions, handlers.MaxAge(a.Config.CORS.MaxAge))
-		}
-
-		a.Router.Use(handlers.CORS(corsOptions...))
+		a.Router.Use(handlers.CORS(corsOptions(a.Config.CORS)...))
 	}
 }
+
 func (a *App) registerSystemEndpoints() {
 	if a.Config.MetricsEnabled {
-		a.Router.Handle("/metrics", promhttp.Handler())
+		a.Router.Handle("/metrics", promhttp.HandlerFor(a.metrics.registry, promhttp.HandlerOpts{
+			// Exemplars are only exposed in the OpenMetrics format
+			EnableOpenMetrics: true,
+		}))
 	}
 
 	a.Router.HandleFunc("/health", a.healthHandler)
+	a.Router.HandleFunc("/version", a.versionHandler).Methods(http.MethodGet)
+
+	// Route listing is opt-in since it exposes the API surface
+	if a.Config.RoutesEndpoint {
+		a.Router.HandleFunc("/_routes", a.routesHandler).Methods(http.MethodGet)
+	}
+
+	// Only ever reports the caller's own limit
+	if a.Config.RateLimiter.Enabled {
+		a.Router.HandleFunc(rateLimitStatusPath, a.rateLimitStatusHandler).Methods(http.MethodGet)
+	}
 }
 
-// Start starts the application server
+// Start starts the application server and blocks until it shuts down. It
+// returns nil after a clean shutdown and a *ServerError if the server fails
+// to listen or serve.
 func (a *App) Start() error {
 	a.applyMiddleware()
 
-	a.server = &http.Server{
-		Addr:         fmt.Sprintf(":%d", a.Config.Port),
-		Handler:      a.Router,
-		ReadTimeout:  a.Config.ReadTimeout,
-		WriteTimeout: a.Config.WriteTimeout,
+	if rl := a.Config.RateLimiter; rl.Enabled && float64(rl.Burst) < rl.RequestsPerS {
+		// Valid, but a second's worth of requests arriving together is
+		// partly rejected
+		a.Logger.Warn("rate limiter burst is below the requests per second",
+			zap.Int("burst", rl.Burst),
+			zap.Float64("requests_per_second", rl.RequestsPerS))
 	}
 
-	serverErrors := make(chan error, 1)
+	a.server = a.newServer()
+
+	a.startWorkers()
+
+	// One slot per server so a failing one never blocks
+	serverErrors := make(chan error, 2)
+	if a.grpcServer != nil {
+		go a.serveGRPC(serverErrors)
+	}
 	go func() {
-		a.Logger.Info("server starting", zap.String("addr", a.server.Addr))
+		a.Logger.Info("server starting", append(
+			[]zap.Field{zap.String("addr", a.server.Addr)},
+			a.Config.summaryFields()...,
+		)...)
 
 		var err error
 		if a.Config.CertFile != "" && a.Config.KeyFile != "" {
@@ -228,29 +362,154 @@ func (a *App) Start() error {
 		serverErrors <- err
 	}()
 
-	shutdown := make(chan os.Signal, 1)
+	// Buffer two signals so a second one forces shutdown
+	shutdown := make(chan os.Signal, 2)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(shutdown)
 
 	select {
 	case err := <-serverErrors:
-		return fmt.Errorf("server error: %w", err)
+		a.cancel()
+		// Take the other server down with the one that failed
+		a.server.Close()
+		if a.grpcServer != nil {
+			a.grpcServer.Stop()
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), a.Config.ShutdownTimeout)
+		defer cancel()
+		a.stopWorkers(ctx)
+		a.wg.Wait()
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		var serverErr *ServerError
+		if errors.As(err, &serverErr) {
+			return err
+		}
+		return &ServerError{Addr: a.server.Addr, Err: err}
 
 	case <-shutdown:
-		a.Logger.Info("server shutdown initiated")
-		return a.gracefulShutdown()
+		a.beginShutdown()
+
+		done := make(chan error, 1)
+		go func() {
+			done <- a.gracefulShutdown()
+		}()
+
+		select {
+		case err := <-done:
+			return err
+		case <-shutdown:
+			a.Logger.Warn("forced shutdown requested")
+			a.cancel()
+			if a.grpcServer != nil {
+				a.grpcServer.Stop()
+			}
+			if err := a.server.Close(); err != nil {
+				err = fmt.Errorf("forced shutdown error: %w", err)
+				a.completeShutdown(true, err)
+				return err
+			}
+			a.completeShutdown(true, ErrForcedShutdown)
+			return ErrForcedShutdown
+		}
+	}
+}
+
+// newServer builds the HTTP server from the config
+func (a *App) newServer() *http.Server {
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", a.Config.Port),
+		Handler:           a.handler(),
+		ReadTimeout:       a.Config.ReadTimeout,
+		ReadHeaderTimeout: a.Config.ReadHeaderTimeout,
+		WriteTimeout:      a.Config.WriteTimeout,
+		IdleTimeout:       a.Config.IdleTimeout,
+		MaxHeaderBytes:    a.Config.MaxHeaderBytes,
+	}
+	if a.Config.DisableKeepAlives {
+		server.SetKeepAlivesEnabled(false)
+	}
+	a.serverMu.Lock()
+	options := a.serverOptions
+	a.serverBuilt = true
+	a.serverMu.Unlock()
+	if options != nil {
+		options(server)
 	}
+	return server
+}
+
+// SetServerOptions sets a hook that adjusts the HTTP server after it is
+// built from the config and before Start listens, for fields the config
+// does not cover such as ConnState, BaseContext, ConnContext or ErrorLog.
+// Once Start has built the server the hook can no longer apply, so later
+// calls are ignored with a warning.
+func (a *App) SetServerOptions(fn func(*http.Server)) {
+	a.serverMu.Lock()
+	defer a.serverMu.Unlock()
+	if a.serverBuilt {
+		a.Logger.Warn("SetServerOptions called after Start, ignoring it")
+		return
+	}
+	a.serverOptions = fn
 }
 
 func (a *App) applyMiddleware() {
-	for _, m := range a.middleware {
-		a.Router.Use(m)
+	// Both Start and Handler apply it, so only the first call counts
+	a.middlewareOnce.Do(func() {
+		for _, m := range a.middleware {
+			a.Router.Use(m)
+		}
+		a.collectMethodRoutes()
+
+		// mux does not run middleware for unmatched requests, so wrap the
+		// fallback handlers ourselves to get request IDs, logging and metrics.
+		methodFallback := a.methodFallback(a.wrapMiddleware(a.methodNotAllowedHandler))
+		a.Router.NotFoundHandler = a.pathFallback(a.wrapMiddleware(a.notFoundHandler), methodFallback)
+		a.Router.MethodNotAllowedHandler = methodFallback
+	})
+}
+
+// Handler returns the app as an http.Handler with all middleware applied,
+// for serving it in-process, e.g. with httptest. Register routes and
+// middleware before calling it.
+func (a *App) Handler() http.Handler {
+	a.applyMiddleware()
+	return a.handler()
+}
+
+// wrapMiddleware applies the app middleware chain to a handler
+func (a *App) wrapMiddleware(h http.Handler) http.Handler {
+	for i := len(a.middleware) - 1; i >= 0; i-- {
+		h = a.middleware[i](h)
 	}
+	return h
+}
+
+// SetNotFoundHandler overrides the handler used when no route matches
+func (a *App) SetNotFoundHandler(h http.Handler) {
+	a.notFoundHandler = h
+	a.Router.NotFoundHandler = h
+}
+
+// SetMethodNotAllowedHandler overrides the handler used when a route matches
+// the path but not the method
+func (a *App) SetMethodNotAllowedHandler(h http.Handler) {
+	a.methodNotAllowedHandler = h
+	a.Router.MethodNotAllowedHandler = h
+}
+
+func (a *App) defaultNotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	a.handleError(w, r, NewAPIError(http.StatusNotFound, "route not found"))
+}
+
+func (a *App) defaultMethodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	a.handleError(w, r, NewAPIError(http.StatusMethodNotAllowed, "method not allowed"))
 }
 
 // Update gracefulShutdown to clean up the rate limiter
 func (a *App) gracefulShutdown() error {
-	a.cancel()
-
 	// Stop the rate limiter's cleanup goroutine
 	if a.rateLimiter != nil {
 		a.rateLimiter.stop()
@@ -259,18 +518,32 @@ func (a *App) gracefulShutdown() error {
 	ctx, cancel := context.WithTimeout(context.Background(), a.Config.ShutdownTimeout)
 	defer cancel()
 
+	// Drain HTTP traffic first so in-flight handlers can still rely on
+	// background workers, then signal and stop the workers
+	var shutdownErr error
+	forced := false
 	if err := a.server.Shutdown(ctx); err != nil {
+		forced = true
 		a.Logger.Error("graceful shutdown failed", zap.Error(err))
 
 		if closeErr := a.server.Close(); closeErr != nil {
-			return fmt.Errorf("forced shutdown error: %w", closeErr)
+			shutdownErr = fmt.Errorf("forced shutdown error: %w", closeErr)
+		} else {
+			shutdownErr = fmt.Errorf("graceful shutdown failed: %w", err)
 		}
-		return fmt.Errorf("graceful shutdown failed: %w", err)
 	}
 
+	if !a.stopGRPC(ctx) {
+		forced = true
+		a.Logger.Error("graceful grpc shutdown timed out")
+	}
+
+	a.cancel()
+	a.stopWorkers(ctx)
 	a.wg.Wait()
-	a.Logger.Info("server shutdown complete")
-	return nil
+
+	a.completeShutdown(forced, shutdownErr)
+	return shutdownErr
 }
 
 // Parameter handling functions
@@ -291,7 +564,7 @@ func (a *App) URLParamInt(r *http.Request, name string) (int, error) {
 }
 
 func (a *App) QueryParam(r *http.Request, name string) string {
-	return r.URL.Query().Get(name)
+	return queryValues(r).Get(name)
 }
 
 func (a *App) QueryParamInt(r *http.Request, name string) (int, error) {
@@ -306,11 +579,15 @@ func (a *App) QueryParamInt(r *http.Request, name string) (int, error) {
 	return result, nil
 }
 
+// QueryParams returns the parsed query, shared by the query helpers of the
+// request, so it must not be modified
 func (a *App) QueryParams(r *http.Request) url.Values {
-	return r.URL.Query()
+	return queryValues(r)
 }
 
-// JSON response helpers
+// JSON writes data as a JSON response. Returning its error from a handler
+// is safe: write failures from a disconnected client (see IsConnClosed) are
+// only logged at debug level.
 func (a *App) JSON(w http.ResponseWriter, status int, data interface{}) error {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -318,37 +595,83 @@ func (a *App) JSON(w http.ResponseWriter, status int, data interface{}) error {
 }
 
 func (a *App) JSONError(w http.ResponseWriter, err error) {
-	a.handleError(w, err)
+	a.handleError(w, nil, err)
 }
 
-// Decode request body with validation
+// Decode binds the request body to v based on its Content-Type and
+// validates it. JSON (the default when no Content-Type is sent) and
+// form-urlencoded bodies, using `form` struct tags, are supported; other
+// types, and a missing Content-Type with Config.StrictContentType, are
+// rejected with 415.
 func (a *App) Decode(r *http.Request, v interface{}) error {
-	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
-		return NewAPIError(http.StatusBadRequest, "invalid request body")
-	}
 	defer r.Body.Close()
 
-	if err := a.Validator.Struct(v); err != nil {
-		validationErrors := make(map[string]string)
-		if ve, ok := err.(validator.ValidationErrors); ok {
-			for _, fe := range ve {
-				validationErrors[fe.Field()] = fe.Tag()
-			}
-		}
+	mt := mediaType(r)
+	if mt == "" && a.Config.StrictContentType {
+		return NewAPIError(http.StatusUnsupportedMediaType, "Content-Type header is required")
+	}
 
-		apiError := NewAPIError(http.StatusBadRequest, "validation failed")
-		if a.Config.LogLevel == "debug" {
-			apiError.Details = validationErrors
+	switch mt {
+	case "", "application/json":
+		if err := a.decodeJSON(r, v); err != nil {
+			return err
+		}
+	case "application/x-www-form-urlencoded":
+		if err := bindForm(r, v); err != nil {
+			return err
 		}
-		return apiError
+	default:
+		return NewAPIError(http.StatusUnsupportedMediaType, "unsupported content type", map[string]string{
+			"content_type": r.Header.Get("Content-Type"),
+		})
+	}
+
+	if err := a.Validator.Struct(v); err != nil {
+		return a.newValidationError(r.Context(), http.StatusBadRequest, err)
 	}
 
 	return nil
 }
 
+func (a *App) decodeJSON(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		// io.EOF means the body was empty or whitespace only, as opposed
+		// to malformed JSON
+		if !errors.Is(err, io.EOF) {
+			return NewAPIError(http.StatusBadRequest, "invalid request body")
+		}
+		if !a.Config.AllowEmptyBody {
+			return NewAPIError(http.StatusBadRequest, "request body is required")
+		}
+	}
+	return nil
+}
+
+// mediaType returns the request media type without parameters, mapping
+// structured JSON types such as application/merge-patch+json to
+// application/json
+func mediaType(r *http.Request) string {
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		return ""
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return ct
+	}
+	if strings.HasSuffix(mt, "+json") {
+		return "application/json"
+	}
+	return mt
+}
+
 func getRequestIDFromContext(w http.ResponseWriter) string {
-	if ctx := w.(*loggingResponseWriter).context; ctx != nil {
-		if reqID, ok := ctx.Value("request_id").(string); ok {
+	lrw, ok := w.(*loggingResponseWriter)
+	if !ok {
+		return ""
+	}
+	if ctx := lrw.context; ctx != nil {
+		if reqID, ok := ctx.Value(contextKeyRequestID).(string); ok {
 			return reqID
 		}
 	}
@@ -356,28 +679,106 @@ func getRequestIDFromContext(w http.ResponseWriter) string {
 }
 
 func (lrw *loggingResponseWriter) WriteHeader(code int) {
+	// Informational responses are followed by the final status
+	if lrw.statusHeader != "" && code >= http.StatusOK && !lrw.wroteHeader {
+		lrw.Header().Set(lrw.statusHeader, strconv.Itoa(code))
+	}
+	if code >= http.StatusOK {
+		lrw.wroteHeader = true
+	}
 	lrw.statusCode = code
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
+// Write sends the implicit 200 through WriteHeader so it is recorded
+func (lrw *loggingResponseWriter) Write(b []byte) (int, error) {
+	if !lrw.wroteHeader {
+		lrw.WriteHeader(http.StatusOK)
+	}
+	return lrw.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming responses pass through the wrapped writer
+func (lrw *loggingResponseWriter) Flush() {
+	if !lrw.wroteHeader {
+		lrw.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := lrw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (lrw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
+
 // Use adds middleware to the application
 func (a *App) Use(middleware mux.MiddlewareFunc) {
 	a.middleware = append(a.middleware, middleware)
 }
 
 // HTTP method shortcuts
-func (a *App) GET(path string, handler Handler)    { a.Handle(http.MethodGet, path, handler) }
-func (a *App) POST(path string, handler Handler)   { a.Handle(http.MethodPost, path, handler) }
-func (a *App) PUT(path string, handler Handler)    { a.Handle(http.MethodPut, path, handler) }
-func (a *App) DELETE(path string, handler Handler) { a.Handle(http.MethodDelete, path, handler) }
+func (a *App) GET(path string, handler Handler, opts ...RouteOption) *Route {
+	return a.Handle(http.MethodGet, path, handler, opts...)
+}
+func (a *App) POST(path string, handler Handler, opts ...RouteOption) *Route {
+	return a.Handle(http.MethodPost, path, handler, opts...)
+}
+func (a *App) PUT(path string, handler Handler, opts ...RouteOption) *Route {
+	return a.Handle(http.MethodPut, path, handler, opts...)
+}
+func (a *App) DELETE(path string, handler Handler, opts ...RouteOption) *Route {
+	return a.Handle(http.MethodDelete, path, handler, opts...)
+}
+
+func (a *App) Handle(method, path string, handler Handler, opts ...RouteOption) *Route {
+	return a.Match([]string{method}, path, handler, opts...)
+}
+
+// anyMethods are the methods registered by Any. OPTIONS is left to the
+// app so preflight and Allow keep working.
+var anyMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+}
+
+// Match registers one route serving handler for each of methods
+func (a *App) Match(methods []string, path string, handler Handler, opts ...RouteOption) *Route {
+	route := a.Router.HandleFunc(path, a.serve(handler)).Methods(methods...)
 
-func (a *App) Handle(method, path string, handler Handler) {
-	a.Router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+	return (&Route{app: a, route: route}).apply(opts)
+}
+
+// Any registers handler for all methods except OPTIONS
+func (a *App) Any(path string, handler Handler, opts ...RouteOption) *Route {
+	return a.Match(anyMethods, path, handler, opts...)
+}
+
+// MatchPaths registers handler for methods on each of paths, applying opts
+// to every route, e.g. for a resource also served under a legacy path
+func (a *App) MatchPaths(methods []string, paths []string, handler Handler, opts ...RouteOption) []*Route {
+	routes := make([]*Route, len(paths))
+	for i, path := range paths {
+		routes[i] = a.Match(methods, path, handler, opts...)
+	}
+	return routes
+}
+
+// serve adapts a Handler to net/http, routing returned errors through the
+// app error handling
+func (a *App) serve(handler Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
+		recordHandlerContext(ctx)
+		// Framework overhead: middleware, rate limiting and queueing in
+		// bulkheads before the handler runs
+		if start := RequestStartTime(ctx); a.Config.MetricsEnabled && !start.IsZero() {
+			a.metrics.middlewareWait.WithLabelValues(r.Method, routeLabel(r)).Observe(time.Since(start).Seconds())
+		}
 		if err := handler(ctx, w, r); err != nil {
-			a.handleError(w, err)
+			a.handleError(w, r, err)
 		}
-	}).Methods(method)
+	}
 }
 
 // RouterGroup represents a group of routes with shared prefix and middleware
@@ -386,6 +787,7 @@ type RouterGroup struct {
 	middleware []mux.MiddlewareFunc
 	app        *App
 	router     *mux.Router
+	cors       *CORSConfig // Group CORS policy, inherited by nested groups
 }
 
 // Group creates a new router group with the given prefix
@@ -420,41 +822,57 @@ func (g *RouterGroup) Group(prefix string) *RouterGroup {
 		middleware: g.middleware,
 		app:        g.app,
 		router:     subRouter,
+		cors:       g.cors,
 	}
 }
 
 // GET adds a GET route to the group
-func (g *RouterGroup) GET(path string, handler Handler) *RouterGroup {
-	g.HandleMethod(http.MethodGet, path, handler)
+func (g *RouterGroup) GET(path string, handler Handler, opts ...RouteOption) *RouterGroup {
+	g.HandleMethod(http.MethodGet, path, handler, opts...)
 	return g
 }
 
 // POST adds a POST route to the group
-func (g *RouterGroup) POST(path string, handler Handler) *RouterGroup {
-	g.HandleMethod(http.MethodPost, path, handler)
+func (g *RouterGroup) POST(path string, handler Handler, opts ...RouteOption) *RouterGroup {
+	g.HandleMethod(http.MethodPost, path, handler, opts...)
 	return g
 }
 
 // PUT adds a PUT route to the group
-func (g *RouterGroup) PUT(path string, handler Handler) *RouterGroup {
-	g.HandleMethod(http.MethodPut, path, handler)
+func (g *RouterGroup) PUT(path string, handler Handler, opts ...RouteOption) *RouterGroup {
+	g.HandleMethod(http.MethodPut, path, handler, opts...)
 	return g
 }
 
 // DELETE adds a DELETE route to the group
-func (g *RouterGroup) DELETE(path string, handler Handler) *RouterGroup {
-	g.HandleMethod(http.MethodDelete, path, handler)
+func (g *RouterGroup) DELETE(path string, handler Handler, opts ...RouteOption) *RouterGroup {
+	g.HandleMethod(http.MethodDelete, path, handler, opts...)
 	return g
 }
 
+// Match adds a route serving handler for each of methods to the group
+func (g *RouterGroup) Match(methods []string, path string, handler Handler, opts ...RouteOption) *RouterGroup {
+	return g.handle(methods, path, handler, opts)
+}
+
+// Any adds a route serving handler for all methods except OPTIONS to the
+// group
+func (g *RouterGroup) Any(path string, handler Handler, opts ...RouteOption) *RouterGroup {
+	return g.handle(anyMethods, path, handler, opts)
+}
+
 // HandleMethod adds a route with the specified method to the group
 // Using a different name than Handle to avoid conflicts with App.Handle
-func (g *RouterGroup) HandleMethod(method, path string, handler Handler) *RouterGroup {
-	g.router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		if err := handler(ctx, w, r); err != nil {
-			g.app.handleError(w, err)
-		}
-	}).Methods(method)
+func (g *RouterGroup) HandleMethod(method, path string, handler Handler, opts ...RouteOption) *RouterGroup {
+	return g.handle([]string{method}, path, handler, opts)
+}
+
+func (g *RouterGroup) handle(methods []string, path string, handler Handler, opts []RouteOption) *RouterGroup {
+	route := g.router.HandleFunc(path, g.app.serve(handler)).Methods(methods...)
+	rt := &Route{app: g.app, route: route}
+	if g.cors != nil {
+		rt.config().cors = g.cors
+	}
+	rt.apply(opts)
 	return g
 }
@@ -0,0 +1,482 @@
+package micro
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// newTestApp builds an app for in-process tests, with rate limiting off and
+// a no-op logger. configure may adjust the config before NewApp.
+func newTestApp(t testing.TB, configure ...func(*Config)) *App {
+	t.Helper()
+	cfg := &Config{
+		AppName:         "test",
+		Port:            8080,
+		LogLevel:        "error",
+		DBDSN:           "postgres://localhost/test",
+		MetricsEnabled:  true,
+		HandlerTimeout:  time.Second,
+		WriteTimeout:    10 * time.Second,
+		ShutdownTimeout: 5 * time.Second,
+		RateLimiter: RateLimiterConfig{
+			Strategy: "ip",
+			TTL:      time.Hour,
+		},
+	}
+	for _, c := range configure {
+		c(cfg)
+	}
+	app, err := NewApp(cfg)
+	if err != nil {
+		t.Fatalf("NewApp: %v", err)
+	}
+	app.Logger = NewNopLogger()
+	t.Cleanup(app.cancel)
+	return app
+}
+
+// serve runs r through h and returns the recorded response
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// decodeBody decodes the JSON body of a recorded response into a map
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode body %q: %v", w.Body.String(), err)
+	}
+	return body
+}
+
+// freePort returns a TCP port that was free a moment ago
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// startApp runs app.Start on a free port and waits until it accepts
+// connections. It returns the base URL and the result of Start.
+func startApp(t *testing.T, app *App) (string, <-chan error) {
+	t.Helper()
+	// Keep the default action of SIGTERM, exiting, away from the test
+	// binary, even before Start subscribes
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM)
+	t.Cleanup(func() { signal.Stop(sigs) })
+
+	app.Config.Port = freePort(t)
+	done := make(chan error, 1)
+	go func() { done <- app.Start() }()
+
+	addr := fmt.Sprintf("127.0.0.1:%d", app.Config.Port)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return "http://" + addr, done
+		}
+	}
+	t.Fatal("server did not start")
+	return "", nil
+}
+
+// sendShutdownSignal signals the process as an orchestrator would
+func sendShutdownSignal(t *testing.T) {
+	t.Helper()
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitStart waits for the result of Start
+func waitStart(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(10 * time.Second):
+		t.Fatal("Start did not return")
+		return nil
+	}
+}
+
+func okHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	w.WriteHeader(http.StatusOK)
+	_, err := io.WriteString(w, "ok")
+	return err
+}
+
+// okHTTPHandler is okHandler for middleware tested outside an app
+func okHTTPHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestUnmatchedRoutesReturnAPIErrors(t *testing.T) {
+	app := newTestApp(t)
+	app.GET("/users", okHandler)
+	h := app.Handler()
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		status  int
+		message string
+	}{
+		{"unknown path", http.MethodGet, "/missing", http.StatusNotFound, "route not found"},
+		{"wrong method", http.MethodDelete, "/users", http.StatusMethodNotAllowed, "method not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(h, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			body := decodeBody(t, w)
+			if body["message"] != tt.message {
+				t.Errorf("message = %v, want %q", body["message"], tt.message)
+			}
+			// The fallback handlers run behind the app middleware
+			if body["request_id"] == "" || w.Header().Get("X-Request-ID") == "" {
+				t.Errorf("missing request ID in %v", body)
+			}
+		})
+	}
+}
+
+func TestSetNotFoundHandler(t *testing.T) {
+	app := newTestApp(t)
+	app.SetNotFoundHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if w.Code != http.StatusTeapot {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTeapot)
+	}
+}
+
+type decodeTarget struct {
+	Name string `json:"name"`
+}
+
+func TestDecodeEmptyBody(t *testing.T) {
+	tests := []struct {
+		name       string
+		allowEmpty bool
+		body       string
+		message    string // Empty when Decode succeeds
+	}{
+		{"empty body", false, "", "request body is required"},
+		{"whitespace only", false, "  \n", "request body is required"},
+		{"malformed JSON", false, `{"name":`, "invalid request body"},
+		{"empty body allowed", true, "", ""},
+		{"malformed JSON with empty allowed", true, `{"name":`, "invalid request body"},
+		{"valid JSON", false, `{"name":"ada"}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, func(c *Config) { c.AllowEmptyBody = tt.allowEmpty })
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+
+			var v decodeTarget
+			err := app.Decode(r, &v)
+			if tt.message == "" {
+				if err != nil {
+					t.Fatalf("Decode: %v", err)
+				}
+				return
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("err = %v, want an *APIError", err)
+			}
+			if apiErr.Code != http.StatusBadRequest || apiErr.Message != tt.message {
+				t.Errorf("err = %d %q, want 400 %q", apiErr.Code, apiErr.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestStartReportsAddrInUse(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	app := newTestApp(t)
+	app.Config.Port = l.Addr().(*net.TCPAddr).Port
+	done := make(chan error, 1)
+	go func() { done <- app.Start() }()
+
+	err = waitStart(t, done)
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) {
+		t.Fatalf("Start = %v, want a *ServerError", err)
+	}
+	if !serverErr.AddrInUse() {
+		t.Errorf("AddrInUse = false for %v", serverErr)
+	}
+}
+
+func TestStartReturnsNilOnShutdown(t *testing.T) {
+	app := newTestApp(t)
+	_, done := startApp(t, app)
+	sendShutdownSignal(t)
+	if err := waitStart(t, done); err != nil {
+		t.Errorf("Start = %v, want nil after a clean shutdown", err)
+	}
+}
+
+func TestSecondSignalForcesShutdown(t *testing.T) {
+	app := newTestApp(t, func(c *Config) {
+		c.HandlerTimeout = 30 * time.Second
+		c.ShutdownTimeout = 30 * time.Second
+	})
+	logger := NewTestLogger()
+	app.Logger = logger
+
+	inHandler := make(chan struct{})
+	app.GET("/slow", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		close(inHandler)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	var info ShutdownInfo
+	app.OnShutdownComplete(func(i ShutdownInfo) { info = i })
+
+	base, done := startApp(t, app)
+	go http.Get(base + "/slow")
+	<-inHandler
+
+	// The in-flight request keeps the graceful shutdown waiting
+	sendShutdownSignal(t)
+	for deadline := time.Now().Add(5 * time.Second); !logger.Logged("server shutdown initiated"); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("shutdown did not start")
+		}
+	}
+	start := time.Now()
+	sendShutdownSignal(t)
+
+	if err := waitStart(t, done); !errors.Is(err, ErrForcedShutdown) {
+		t.Fatalf("Start = %v, want %v", err, ErrForcedShutdown)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("forced shutdown took %v", elapsed)
+	}
+	if !logger.Logged("forced shutdown requested") || !info.Forced {
+		t.Errorf("forced path not taken: logged %v, info %+v", logger.Messages(), info)
+	}
+}
+
+func TestServerLimits(t *testing.T) {
+	app := newTestApp(t, func(c *Config) {
+		c.ReadTimeout = 15 * time.Second
+		c.ReadHeaderTimeout = 3 * time.Second
+		c.IdleTimeout = 90 * time.Second
+		c.MaxHeaderBytes = 32 << 10
+	})
+	server := app.newServer()
+
+	if server.ReadTimeout != 15*time.Second ||
+		server.ReadHeaderTimeout != 3*time.Second ||
+		server.WriteTimeout != 10*time.Second ||
+		server.IdleTimeout != 90*time.Second ||
+		server.MaxHeaderBytes != 32<<10 {
+		t.Errorf("server = read %v, read header %v, write %v, idle %v, max header bytes %d",
+			server.ReadTimeout, server.ReadHeaderTimeout, server.WriteTimeout, server.IdleTimeout, server.MaxHeaderBytes)
+	}
+}
+
+func TestServerLimitDefaults(t *testing.T) {
+	t.Setenv("DB_DSN", "postgres://localhost/test")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	// The header timeout in particular guards against Slowloris
+	if cfg.ReadHeaderTimeout != 5*time.Second || cfg.IdleTimeout != 120*time.Second || cfg.MaxHeaderBytes != 64<<10 || cfg.DisableKeepAlives {
+		t.Errorf("defaults = read header %v, idle %v, max header bytes %d, keep-alives disabled %v",
+			cfg.ReadHeaderTimeout, cfg.IdleTimeout, cfg.MaxHeaderBytes, cfg.DisableKeepAlives)
+	}
+}
+
+func TestServerDisableKeepAlives(t *testing.T) {
+	for _, disable := range []bool{false, true} {
+		app := newTestApp(t, func(c *Config) { c.DisableKeepAlives = disable })
+		app.GET("/users", okHandler)
+
+		srv := httptest.NewUnstartedServer(nil)
+		srv.Config = app.newServer()
+		srv.Start()
+		resp, err := http.Get(srv.URL + "/users")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		srv.Close()
+
+		if resp.Close != disable {
+			t.Errorf("DisableKeepAlives=%v: connection closed = %v", disable, resp.Close)
+		}
+	}
+}
+
+func TestSetServerOptions(t *testing.T) {
+	type baseKey struct{}
+	app := newTestApp(t, func(c *Config) { c.ReadHeaderTimeout = 3 * time.Second })
+	app.GET("/users", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		_, err := fmt.Fprint(w, ctx.Value(baseKey{}))
+		return err
+	})
+
+	var newConns atomic.Int32
+	configured := make(chan time.Duration, 1)
+	app.SetServerOptions(func(s *http.Server) {
+		// The hook sees the server built from the config and may override it
+		configured <- s.ReadHeaderTimeout
+		s.ReadHeaderTimeout = time.Second
+		s.BaseContext = func(net.Listener) context.Context {
+			return context.WithValue(context.Background(), baseKey{}, "from BaseContext")
+		}
+		s.ConnState = func(_ net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				newConns.Add(1)
+			}
+		}
+	})
+
+	base, done := startApp(t, app)
+	if got := <-configured; got != 3*time.Second {
+		t.Errorf("hook saw ReadHeaderTimeout %v, want the configured 3s", got)
+	}
+	resp, err := http.Get(base + "/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "from BaseContext" {
+		t.Errorf("body = %q, want the BaseContext value", body)
+	}
+	// startApp's readiness probe counts as a connection too
+	if n := newConns.Load(); n < 2 {
+		t.Errorf("ConnState saw %d new connections, want at least 2", n)
+	}
+
+	sendShutdownSignal(t)
+	if err := waitStart(t, done); err != nil {
+		t.Errorf("Start = %v", err)
+	}
+}
+
+func TestSetServerOptionsAfterStart(t *testing.T) {
+	app := newTestApp(t)
+	logger := NewTestLogger()
+	app.Logger = logger
+	app.GET("/users", okHandler)
+	base, done := startApp(t, app)
+
+	var called atomic.Bool
+	app.SetServerOptions(func(s *http.Server) { called.Store(true) })
+	if !logger.Logged("SetServerOptions called after Start, ignoring it") {
+		t.Errorf("no warning logged: %v", logger.Messages())
+	}
+
+	resp, err := http.Get(base + "/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	sendShutdownSignal(t)
+	if err := waitStart(t, done); err != nil {
+		t.Errorf("Start = %v", err)
+	}
+	if called.Load() {
+		t.Error("hook set after Start was applied")
+	}
+}
+
+// brokenPipeWriter fails every body write as a disconnected client would
+type brokenPipeWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w brokenPipeWriter) Write([]byte) (int, error) {
+	return 0, &net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)}
+}
+
+func TestIsConnClosed(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{syscall.EPIPE, true},
+		{syscall.ECONNRESET, true},
+		{&net.OpError{Op: "write", Err: os.NewSyscallError("write", syscall.ECONNRESET)}, true},
+		{fmt.Errorf("encode: %w", net.ErrClosed), true},
+		{io.ErrClosedPipe, true},
+		{errors.New("broken pipe"), false},
+		{context.DeadlineExceeded, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsConnClosed(tt.err); got != tt.want {
+			t.Errorf("IsConnClosed(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestJSONClientDisconnect(t *testing.T) {
+	app := newTestApp(t)
+	logger := NewTestLogger()
+	app.Logger = logger
+	var encodeErr error
+	app.GET("/users", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		encodeErr = app.JSON(w, http.StatusOK, map[string]string{"name": "Ada"})
+		return encodeErr
+	})
+
+	app.Handler().ServeHTTP(brokenPipeWriter{httptest.NewRecorder()}, httptest.NewRequest(http.MethodGet, "/users", nil))
+
+	if !IsConnClosed(encodeErr) {
+		t.Fatalf("JSON err = %v, want a closed connection error", encodeErr)
+	}
+	if !logger.Logged("client closed connection") {
+		t.Errorf("disconnect not logged, got %v", logger.Messages())
+	}
+	for _, e := range logger.Entries() {
+		if e.Level >= zapcore.ErrorLevel {
+			t.Errorf("disconnect logged at %v: %q", e.Level, e.Message)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package micro
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+)
+
+// BindQuery populates v, a pointer to a struct, from the query string using
+// `query` struct tags and validates it with the app validator. A `limit`
+// field gets Config.Pagination's default when absent, and once validated is
+// capped at its maximum.
+//
+//	type ListParams struct {
+//		Limit int `query:"limit" validate:"min=1,max=100"`
+//	}
+func (a *App) BindQuery(r *http.Request, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return NewAPIError(http.StatusInternalServerError, "BindQuery requires a pointer to a struct")
+	}
+
+	query := queryValues(r)
+	if name, value, err := bindValues(rv.Elem(), query, "query"); err != nil {
+		return NewAPIError(http.StatusBadRequest, "invalid query parameter", map[string]string{
+			"parameter": name,
+			"value":     value,
+		})
+	}
+	a.applyPaginationDefault(rv.Elem(), query)
+
+	if err := a.Validator.Struct(v); err != nil {
+		return a.newValidationError(r.Context(), http.StatusUnprocessableEntity, err)
+	}
+	return a.capPaginationLimit(rv.Elem())
+}
+
+// bindForm populates v from a form-urlencoded body using `form` struct tags
+func bindForm(r *http.Request, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return NewAPIError(http.StatusInternalServerError, "form decoding requires a pointer to a struct")
+	}
+	if err := r.ParseForm(); err != nil {
+		return NewAPIError(http.StatusBadRequest, "invalid request body")
+	}
+
+	if name, value, err := bindValues(rv.Elem(), r.PostForm, "form"); err != nil {
+		return NewAPIError(http.StatusBadRequest, "invalid form field", map[string]string{
+			"field": name,
+			"value": value,
+		})
+	}
+	return nil
+}
+
+// bindValues sets the fields of elem named by the given struct tag. On
+// failure it returns the offending name and value.
+func bindValues(elem reflect.Value, values url.Values, tag string) (string, string, error) {
+	t := elem.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get(tag)
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+
+		vals, ok := values[name]
+		if !ok || len(vals) == 0 {
+			continue
+		}
+
+		if err := setField(elem.Field(i), vals); err != nil {
+			return name, vals[0], err
+		}
+	}
+	return "", "", nil
+}
+
+// setField assigns string values to a struct field of a basic kind,
+// a pointer to one, or a slice of them
+func setField(field reflect.Value, values []string) error {
+	switch field.Kind() {
+	case reflect.Ptr:
+		ptr := reflect.New(field.Type().Elem())
+		if err := setField(ptr.Elem(), values); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	case reflect.Slice:
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setField(slice.Index(i), []string{value}); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+
+	value := values[0]
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return strconv.ErrSyntax
+	}
+	return nil
+}
+
+// readBody reads the whole request body, rejecting bodies larger than
+// Config.MaxBodyBytes with 413 so one request cannot exhaust memory
+func (a *App) readBody(r *http.Request) ([]byte, error) {
+	limit := a.Config.MaxBodyBytes
+	var reader io.Reader = r.Body
+	if limit > 0 {
+		reader = io.LimitReader(r.Body, limit+1)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, NewAPIError(http.StatusBadRequest, "invalid request body")
+	}
+	if limit > 0 && int64(len(body)) > limit {
+		return nil, NewAPIError(http.StatusRequestEntityTooLarge, "request body too large")
+	}
+	return body, nil
+}
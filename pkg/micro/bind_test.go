@@ -0,0 +1,145 @@
+package micro
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type listParams struct {
+	Limit  int      `query:"limit" validate:"min=1,max=100"`
+	Sort   string   `query:"sort" validate:"omitempty,oneof=name created_at"`
+	Active *bool    `query:"active"`
+	Tags   []string `query:"tag"`
+}
+
+func TestBindQuery(t *testing.T) {
+	app := newTestApp(t)
+	r := httptest.NewRequest(http.MethodGet, "/?limit=10&sort=name&active=true&tag=a&tag=b", nil)
+
+	var params listParams
+	if err := app.BindQuery(r, &params); err != nil {
+		t.Fatalf("BindQuery: %v", err)
+	}
+	active := true
+	want := listParams{Limit: 10, Sort: "name", Active: &active, Tags: []string{"a", "b"}}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("params = %+v, want %+v", params, want)
+	}
+}
+
+func TestBindQueryErrors(t *testing.T) {
+	app := newTestApp(t)
+
+	tests := []struct {
+		name    string
+		query   string
+		status  int
+		details map[string]string
+	}{
+		{"out of range limit", "limit=500", http.StatusUnprocessableEntity, map[string]string{"limit": "must be at most 100"}},
+		{"negative limit", "limit=-1", http.StatusUnprocessableEntity, map[string]string{"limit": "must be at least 1"}},
+		{"invalid enum", "limit=5&sort=email", http.StatusUnprocessableEntity, map[string]string{"sort": "must be one of: name created_at"}},
+		{"not a number", "limit=ten", http.StatusBadRequest, map[string]string{"parameter": "limit", "value": "ten"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var params listParams
+			err := app.BindQuery(httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil), &params)
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("err = %v, want an *APIError", err)
+			}
+			if apiErr.Code != tt.status {
+				t.Errorf("code = %d, want %d", apiErr.Code, tt.status)
+			}
+			if !reflect.DeepEqual(apiErr.Details, tt.details) {
+				t.Errorf("details = %v, want %v", apiErr.Details, tt.details)
+			}
+		})
+	}
+}
+
+func TestBindQueryRequiresStructPointer(t *testing.T) {
+	app := newTestApp(t)
+	var params listParams
+	err := app.BindQuery(httptest.NewRequest(http.MethodGet, "/", nil), params)
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusInternalServerError {
+		t.Fatalf("err = %v, want a 500 APIError", err)
+	}
+}
+
+func TestBindQueryResponse(t *testing.T) {
+	app := newTestApp(t)
+	app.GET("/items", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		var params listParams
+		if err := app.BindQuery(r, &params); err != nil {
+			return err
+		}
+		return app.JSON(w, http.StatusOK, params)
+	})
+
+	w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/items?limit=0", nil))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+	if body := decodeBody(t, w); body["error_count"] != 1.0 {
+		t.Errorf("error_count = %v, want 1", body["error_count"])
+	}
+}
+
+type signupForm struct {
+	Name  string `json:"name" form:"name" validate:"required,min=2"`
+	Email string `json:"email" form:"email" validate:"required,email"`
+	Age   int    `json:"age" form:"age"`
+}
+
+func TestDecodeJSONAndForm(t *testing.T) {
+	app := newTestApp(t)
+	var got signupForm
+	app.POST("/signup", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		got = signupForm{}
+		if err := app.Decode(r, &got); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusCreated)
+		return nil
+	})
+	h := app.Handler()
+	want := signupForm{Name: "Ada", Email: "ada@example.com", Age: 36}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"json", "application/json", `{"name":"Ada","email":"ada@example.com","age":36}`, http.StatusCreated},
+		{"json with charset", "application/json; charset=utf-8", `{"name":"Ada","email":"ada@example.com","age":36}`, http.StatusCreated},
+		{"form", "application/x-www-form-urlencoded", "name=Ada&email=ada%40example.com&age=36", http.StatusCreated},
+		{"invalid form", "application/x-www-form-urlencoded", "name=A&email=ada%40example.com", http.StatusBadRequest},
+		{"bad form number", "application/x-www-form-urlencoded", "name=Ada&email=ada%40example.com&age=old", http.StatusBadRequest},
+		{"unsupported", "text/xml", "<signup/>", http.StatusUnsupportedMediaType},
+		{"multipart", "multipart/form-data; boundary=x", "--x--", http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := serve(h, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status == http.StatusCreated && got != want {
+				t.Errorf("decoded %+v, want %+v", got, want)
+			}
+		})
+	}
+}
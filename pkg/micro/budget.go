@@ -0,0 +1,32 @@
+package micro
+
+import (
+	"context"
+	"time"
+)
+
+// Budget returns the time left before ctx's deadline, or false when ctx has
+// no deadline. An expired deadline leaves a budget of 0.
+func Budget(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return max(time.Until(deadline), 0), true
+}
+
+// WithBudget derives a context for a downstream call that may spend
+// fraction of the remaining budget, so a request making sequential calls
+// leaves time for those after it. Each call takes its slice of what is left
+// at the time, e.g. 0.5 then 0.5 then 1 for three calls. A fraction outside
+// (0, 1] spends the whole budget, and a ctx without a deadline gets none.
+func WithBudget(ctx context.Context, fraction float64) (context.Context, context.CancelFunc) {
+	remaining, ok := Budget(ctx)
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	if fraction <= 0 || fraction > 1 {
+		fraction = 1
+	}
+	return context.WithTimeout(ctx, time.Duration(float64(remaining)*fraction))
+}
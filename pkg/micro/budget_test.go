@@ -0,0 +1,94 @@
+package micro
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBudget(t *testing.T) {
+	if _, ok := Budget(context.Background()); ok {
+		t.Error("a context without a deadline has a budget")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	left, ok := Budget(ctx)
+	if !ok || left <= 0 || left > time.Minute {
+		t.Errorf("Budget = %v, %v, want up to a minute", left, ok)
+	}
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if left, ok := Budget(expired); !ok || left != 0 {
+		t.Errorf("Budget of an expired context = %v, %v, want 0, true", left, ok)
+	}
+}
+
+func TestWithBudgetSpendsRemainingTime(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Each call gets its fraction of the budget left when it starts
+	for _, fraction := range []float64{0.5, 0.5, 1} {
+		before, _ := Budget(ctx)
+		call, cancel := WithBudget(ctx, fraction)
+		left, ok := Budget(call)
+		cancel()
+		if !ok {
+			t.Fatalf("WithBudget(%v) has no deadline", fraction)
+		}
+		want := time.Duration(float64(before) * fraction)
+		if left > want || left < want-time.Second {
+			t.Errorf("WithBudget(%v) budget = %v, want about %v", fraction, left, want)
+		}
+	}
+}
+
+func TestWithBudgetFraction(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for _, fraction := range []float64{0, -1, 2} {
+		call, cancel := WithBudget(ctx, fraction)
+		left, _ := Budget(call)
+		cancel()
+		if left < 59*time.Second {
+			t.Errorf("WithBudget(%v) budget = %v, want the whole minute", fraction, left)
+		}
+	}
+
+	call, cancel := WithBudget(context.Background(), 0.5)
+	defer cancel()
+	if _, ok := call.Deadline(); ok {
+		t.Error("WithBudget added a deadline to a context without one")
+	}
+}
+
+func TestWithBudgetExhausted(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	call, cancelCall := WithBudget(ctx, 0.2)
+	defer cancelCall()
+	<-call.Done()
+	if !errors.Is(call.Err(), context.DeadlineExceeded) {
+		t.Errorf("call error = %v, want %v", call.Err(), context.DeadlineExceeded)
+	}
+	// Running out of the slice leaves the rest of the request budget
+	if ctx.Err() != nil {
+		t.Fatalf("request context ended with its first call: %v", ctx.Err())
+	}
+
+	<-ctx.Done()
+	if left, ok := Budget(ctx); !ok || left != 0 {
+		t.Errorf("Budget after the deadline = %v, %v, want 0, true", left, ok)
+	}
+	// A call made once the budget is spent fails right away
+	late, cancelLate := WithBudget(ctx, 1)
+	defer cancelLate()
+	if !errors.Is(late.Err(), context.DeadlineExceeded) {
+		t.Errorf("call after the deadline error = %v, want %v", late.Err(), context.DeadlineExceeded)
+	}
+}
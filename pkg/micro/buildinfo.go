@@ -0,0 +1,70 @@
+package micro
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build metadata, set at build time with
+// -ldflags "-X github.com/codersaadi/go-micro/pkg/micro.Version=v1.2.3"
+var (
+	Version   string
+	Commit    string
+	BuildTime string
+)
+
+// BuildInfo describes the running build
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// DefaultBuildInfo returns the build info set via ldflags, falling back to
+// the module and VCS data embedded by the Go toolchain
+func DefaultBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" {
+			info.Version = bi.Main.Version
+		}
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = setting.Value
+				}
+			}
+		}
+	}
+
+	return info
+}
+
+// SetBuildInfo overrides the build info reported by /version and the
+// build_info metric
+func (a *App) SetBuildInfo(info BuildInfo) {
+	if info.GoVersion == "" {
+		info.GoVersion = runtime.Version()
+	}
+	a.buildInfo = info
+
+	a.metrics.buildInfo.Reset()
+	a.metrics.buildInfo.WithLabelValues(info.Version, info.Commit, info.GoVersion).Set(1)
+}
+
+func (a *App) versionHandler(w http.ResponseWriter, r *http.Request) {
+	a.JSON(w, http.StatusOK, a.buildInfo)
+}
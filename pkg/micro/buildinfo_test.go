@@ -0,0 +1,57 @@
+package micro
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestVersionEndpoint(t *testing.T) {
+	app := newTestApp(t)
+	app.SetBuildInfo(BuildInfo{Version: "v1.2.3", Commit: "abc123", BuildTime: "2024-05-01T10:00:00Z"})
+
+	w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/version", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var info BuildInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	want := BuildInfo{Version: "v1.2.3", Commit: "abc123", BuildTime: "2024-05-01T10:00:00Z", GoVersion: runtime.Version()}
+	if info != want {
+		t.Errorf("build info = %+v, want %+v", info, want)
+	}
+}
+
+func TestBuildInfoMetric(t *testing.T) {
+	app := newTestApp(t)
+	app.SetBuildInfo(BuildInfo{Version: "v1.0.0", Commit: "old"})
+	app.SetBuildInfo(BuildInfo{Version: "v1.2.3", Commit: "abc123"})
+
+	// Only the current build is reported
+	if n := testutil.CollectAndCount(app.metrics.buildInfo); n != 1 {
+		t.Fatalf("build_info series = %d, want 1", n)
+	}
+	got := testutil.ToFloat64(app.metrics.buildInfo.WithLabelValues("v1.2.3", "abc123", runtime.Version()))
+	if got != 1 {
+		t.Errorf("build_info = %v, want 1", got)
+	}
+}
+
+func TestDefaultBuildInfoPrefersLdflags(t *testing.T) {
+	defer func(v, c, b string) { Version, Commit, BuildTime = v, c, b }(Version, Commit, BuildTime)
+	Version, Commit, BuildTime = "v9.9.9", "feedbeef", "2024-05-01T10:00:00Z"
+
+	info := DefaultBuildInfo()
+	if info.Version != Version || info.Commit != Commit || info.BuildTime != BuildTime {
+		t.Errorf("build info = %+v, want the ldflags values", info)
+	}
+	if info.GoVersion != runtime.Version() {
+		t.Errorf("go version = %q, want %q", info.GoVersion, runtime.Version())
+	}
+}
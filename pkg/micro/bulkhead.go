@@ -0,0 +1,107 @@
+package micro
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// BulkheadOptions configures the concurrency limiting middleware
+type BulkheadOptions struct {
+	// MaxConcurrent is the number of requests allowed to run at once
+	MaxConcurrent int
+	// MaxWait is how long an excess request waits in the queue for a free
+	// slot. Zero rejects excess requests immediately.
+	MaxWait time.Duration
+	// MaxQueue bounds the number of waiting requests; defaults to
+	// MaxConcurrent when MaxWait is set
+	MaxQueue int
+	// Name labels the bulkhead metrics; defaults to the route template
+	Name string
+}
+
+// Bulkhead caps concurrent executions of the routes it wraps so one slow
+// endpoint cannot drain shared resources such as the database pool. Excess
+// requests wait in a bounded queue for up to MaxWait and are rejected with
+// 503 when the queue is full, the wait expires or the client gives up.
+func (a *App) Bulkhead(opts BulkheadOptions) mux.MiddlewareFunc {
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = 1
+	}
+	if opts.MaxWait > 0 && opts.MaxQueue <= 0 {
+		opts.MaxQueue = opts.MaxConcurrent
+	}
+	sem := make(chan struct{}, opts.MaxConcurrent)
+	queue := make(chan struct{}, opts.MaxQueue)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := opts.Name
+			if name == "" {
+				name = routeLabel(r)
+			}
+
+			if !a.admit(r, name, sem, queue, opts.MaxWait) {
+				LoggerFromContext(r.Context()).Warn("bulkhead full, rejecting request",
+					zap.String("bulkhead", name),
+					zap.Int("max_concurrent", opts.MaxConcurrent),
+				)
+				a.metrics.bulkheadRejected.WithLabelValues(name).Inc()
+				a.handleError(w, r, NewAPIError(http.StatusServiceUnavailable, "server busy, try again later"))
+				return
+			}
+			defer func() { <-sem }()
+
+			inFlight := a.metrics.bulkheadInFlight.WithLabelValues(name)
+			inFlight.Inc()
+			defer inFlight.Dec()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// admit takes a slot from sem, queueing for up to maxWait when none is free.
+// Waiting stops early if the request is cancelled so abandoned requests do
+// not hold queue slots.
+func (a *App) admit(r *http.Request, name string, sem, queue chan struct{}, maxWait time.Duration) bool {
+	select {
+	case sem <- struct{}{}:
+		return true
+	default:
+	}
+	if maxWait <= 0 {
+		return false
+	}
+
+	select {
+	case queue <- struct{}{}:
+	default:
+		return false
+	}
+	depth := a.metrics.bulkheadQueued.WithLabelValues(name)
+	depth.Inc()
+	defer func() {
+		<-queue
+		depth.Dec()
+	}()
+
+	start := time.Now()
+	defer func() {
+		a.metrics.bulkheadWait.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	}()
+
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
@@ -0,0 +1,163 @@
+package micro
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// gate is a handler that blocks each request until released
+type gate struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newGate() *gate {
+	return &gate{entered: make(chan struct{}, 16), release: make(chan struct{})}
+}
+
+func (g *gate) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.entered <- struct{}{}
+	<-g.release
+	w.WriteHeader(http.StatusOK)
+}
+
+// serveAsync serves r in the background and returns the eventual status
+func serveAsync(h http.Handler, r *http.Request) <-chan int {
+	status := make(chan int, 1)
+	go func() { status <- serve(h, r).Code }()
+	return status
+}
+
+// waitGauge waits until g reports want
+func waitGauge(t *testing.T, g prometheus.Gauge, want float64) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); testutil.ToFloat64(g) != want; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("gauge = %v, want %v", testutil.ToFloat64(g), want)
+		}
+	}
+}
+
+func bulkheadRequest() *http.Request {
+	return httptest.NewRequest(http.MethodGet, "/reports", nil)
+}
+
+func TestBulkheadRejectsExcessRequests(t *testing.T) {
+	app := newTestApp(t)
+	g := newGate()
+	h := app.Bulkhead(BulkheadOptions{MaxConcurrent: 1, Name: "reports"})(g)
+
+	first := serveAsync(h, bulkheadRequest())
+	<-g.entered
+	if got := testutil.ToFloat64(app.metrics.bulkheadInFlight.WithLabelValues("reports")); got != 1 {
+		t.Errorf("in flight = %v, want 1", got)
+	}
+
+	if w := serve(h, bulkheadRequest()); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("excess request status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if got := testutil.ToFloat64(app.metrics.bulkheadRejected.WithLabelValues("reports")); got != 1 {
+		t.Errorf("rejected = %v, want 1", got)
+	}
+
+	close(g.release)
+	if status := <-first; status != http.StatusOK {
+		t.Errorf("first request status = %d, want %d", status, http.StatusOK)
+	}
+	// The slot is free again once the first request completes
+	if w := serve(h, bulkheadRequest()); w.Code != http.StatusOK {
+		t.Errorf("later request status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := testutil.ToFloat64(app.metrics.bulkheadInFlight.WithLabelValues("reports")); got != 0 {
+		t.Errorf("in flight = %v, want 0", got)
+	}
+}
+
+func TestBulkheadQueuesExcessRequests(t *testing.T) {
+	app := newTestApp(t)
+	g := newGate()
+	h := app.Bulkhead(BulkheadOptions{MaxConcurrent: 1, MaxWait: 5 * time.Second, Name: "reports"})(g)
+
+	first := serveAsync(h, bulkheadRequest())
+	<-g.entered
+	second := serveAsync(h, bulkheadRequest())
+	waitGauge(t, app.metrics.bulkheadQueued.WithLabelValues("reports"), 1)
+
+	close(g.release)
+	for i, status := range []int{<-first, <-second} {
+		if status != http.StatusOK {
+			t.Errorf("request %d status = %d, want %d", i, status, http.StatusOK)
+		}
+	}
+}
+
+func TestBulkheadQueueLimits(t *testing.T) {
+	t.Run("wait timeout", func(t *testing.T) {
+		app := newTestApp(t)
+		g := newGate()
+		defer close(g.release)
+		h := app.Bulkhead(BulkheadOptions{MaxConcurrent: 1, MaxWait: 20 * time.Millisecond, Name: "reports"})(g)
+
+		serveAsync(h, bulkheadRequest())
+		<-g.entered
+		start := time.Now()
+		if w := serve(h, bulkheadRequest()); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+		}
+		if waited := time.Since(start); waited < 20*time.Millisecond {
+			t.Errorf("rejected after %v, want it to wait MaxWait", waited)
+		}
+		if n := testutil.CollectAndCount(app.metrics.bulkheadWait); n != 1 {
+			t.Errorf("wait time series = %d, want 1", n)
+		}
+	})
+
+	t.Run("queue full", func(t *testing.T) {
+		app := newTestApp(t)
+		g := newGate()
+		defer close(g.release)
+		h := app.Bulkhead(BulkheadOptions{MaxConcurrent: 1, MaxWait: 5 * time.Second, MaxQueue: 1, Name: "reports"})(g)
+
+		serveAsync(h, bulkheadRequest())
+		<-g.entered
+		serveAsync(h, bulkheadRequest())
+		waitGauge(t, app.metrics.bulkheadQueued.WithLabelValues("reports"), 1)
+
+		// Rejected at once rather than after MaxWait
+		start := time.Now()
+		if w := serve(h, bulkheadRequest()); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+		}
+		if waited := time.Since(start); waited > time.Second {
+			t.Errorf("rejected after %v, want immediately", waited)
+		}
+	})
+
+	t.Run("client gives up", func(t *testing.T) {
+		app := newTestApp(t)
+		g := newGate()
+		defer close(g.release)
+		h := app.Bulkhead(BulkheadOptions{MaxConcurrent: 1, MaxWait: 5 * time.Second, MaxQueue: 1, Name: "reports"})(g)
+
+		serveAsync(h, bulkheadRequest())
+		<-g.entered
+
+		ctx, cancel := context.WithCancel(context.Background())
+		waiting := serveAsync(h, bulkheadRequest().WithContext(ctx))
+		queued := app.metrics.bulkheadQueued.WithLabelValues("reports")
+		waitGauge(t, queued, 1)
+		cancel()
+
+		if status := <-waiting; status != http.StatusServiceUnavailable {
+			t.Errorf("status = %d, want %d", status, http.StatusServiceUnavailable)
+		}
+		// The abandoned request released its queue slot
+		waitGauge(t, queued, 0)
+	})
+}
@@ -0,0 +1,301 @@
+package micro
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// CachedResponse is a response snapshot held by a CacheStore
+type CachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	// Vary holds the values of the request headers named by the response's
+	// Vary header; the response is only served to requests that match them
+	Vary map[string]string
+}
+
+// CacheStore stores cached responses. Implementations backed by shared
+// storage such as Redis let several instances share a cache.
+type CacheStore interface {
+	Get(ctx context.Context, key string) (*CachedResponse, bool)
+	Set(ctx context.Context, key string, resp *CachedResponse, ttl time.Duration)
+}
+
+// CacheOptions configures the response cache middleware
+type CacheOptions struct {
+	TTL         time.Duration
+	MaxEntries  int        // Used by the default in-memory store
+	VaryHeaders []string   // Request headers included in the cache key
+	Store       CacheStore // Defaults to an in-memory LRU store
+}
+
+// CacheMiddleware caches successful GET responses keyed by host, tenant,
+// path, query and the configured Vary headers, honouring the Vary header of responses.
+// Requests with credentials (Authorization or Cookie) bypass the cache
+// unless the credential header is one of VaryHeaders.
+func (a *App) CacheMiddleware(opts CacheOptions) mux.MiddlewareFunc {
+	if opts.TTL <= 0 {
+		opts.TTL = time.Minute
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = 1000
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryCacheStore(opts.MaxEntries)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cacheControl := strings.ToLower(r.Header.Get("Cache-Control"))
+			if strings.Contains(cacheControl, "no-store") || hasUnkeyedCredentials(r, opts.VaryHeaders) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := cacheKey(r, opts.VaryHeaders)
+
+			// no-cache requires revalidation, so skip the lookup but still
+			// refresh the stored entry
+			if !strings.Contains(cacheControl, "no-cache") {
+				if cached, ok := opts.Store.Get(r.Context(), key); ok && varyMatches(r, cached.Vary) {
+					writeCachedResponse(w, cached)
+					return
+				}
+			}
+
+			w.Header().Set("X-Cache", "MISS")
+			rec := &cacheRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			vary, varyOK := responseVary(r, rec.header)
+			if rec.status >= 200 && rec.status < 300 && varyOK && isCacheable(rec.header) {
+				// A route's CacheFor or SetCacheControl policy takes precedence
+				ttl := opts.TTL
+				if maxAge, ok := cacheMaxAge(rec.header.Get("Cache-Control")); ok {
+					ttl = maxAge
+				}
+				if ttl > 0 {
+					opts.Store.Set(r.Context(), key, &CachedResponse{
+						Status: rec.status,
+						Header: rec.header,
+						Body:   rec.body.Bytes(),
+						Vary:   vary,
+					}, ttl)
+				}
+			}
+		})
+	}
+}
+
+// cacheKey identifies the response to r. The host and the tenant resolved by
+// TenantMiddleware are part of it, so tenants never see each other's
+// responses; the tenant middleware must run before the cache.
+func cacheKey(r *http.Request, vary []string) string {
+	var b strings.Builder
+	b.WriteString(r.Host)
+	if tenantID, ok := TenantFromContext(r.Context()); ok {
+		b.WriteString("|tenant=")
+		b.WriteString(tenantID)
+	}
+	b.WriteString("|")
+	b.WriteString(r.URL.Path)
+	b.WriteString("?")
+	b.WriteString(r.URL.RawQuery)
+	for _, h := range vary {
+		b.WriteString("|")
+		b.WriteString(h)
+		b.WriteString("=")
+		b.WriteString(r.Header.Get(h))
+	}
+	return b.String()
+}
+
+// hasUnkeyedCredentials reports whether r carries credentials that are not
+// part of the cache key, so its response may be specific to the caller
+func hasUnkeyedCredentials(r *http.Request, vary []string) bool {
+	for _, h := range []string{"Authorization", "Cookie"} {
+		if r.Header.Get(h) == "" {
+			continue
+		}
+		keyed := false
+		for _, v := range vary {
+			if http.CanonicalHeaderKey(v) == h {
+				keyed = true
+				break
+			}
+		}
+		if !keyed {
+			return true
+		}
+	}
+	return false
+}
+
+// responseVary returns the request values of the headers named by the
+// response's Vary header. It reports false for Vary: *, which matches no
+// other request.
+func responseVary(r *http.Request, header http.Header) (map[string]string, bool) {
+	var vary map[string]string
+	for _, line := range header.Values("Vary") {
+		for _, name := range strings.Split(line, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if name == "*" {
+				return nil, false
+			}
+			if vary == nil {
+				vary = make(map[string]string)
+			}
+			vary[name] = r.Header.Get(name)
+		}
+	}
+	return vary, true
+}
+
+func varyMatches(r *http.Request, vary map[string]string) bool {
+	for name, value := range vary {
+		if r.Header.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+func isCacheable(header http.Header) bool {
+	// A response setting a cookie belongs to one client
+	if header.Get("Set-Cookie") != "" {
+		return false
+	}
+	cc := strings.ToLower(header.Get("Cache-Control"))
+	return !strings.Contains(cc, "no-store") && !strings.Contains(cc, "private")
+}
+
+func writeCachedResponse(w http.ResponseWriter, cached *CachedResponse) {
+	// Keep headers set by outer middleware, such as the request ID
+	for k, v := range cached.Header {
+		if _, exists := w.Header()[k]; !exists {
+			w.Header()[k] = v
+		}
+	}
+	w.Header().Set("X-Cache", "HIT")
+	w.WriteHeader(cached.Status)
+	w.Write(cached.Body)
+}
+
+// cacheRecorder passes the response through while keeping a copy
+type cacheRecorder struct {
+	http.ResponseWriter
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (rec *cacheRecorder) WriteHeader(code int) {
+	if !rec.wroteHeader {
+		rec.wroteHeader = true
+		rec.status = code
+		rec.header = rec.ResponseWriter.Header().Clone()
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *cacheRecorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *cacheRecorder) Flush() {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rec *cacheRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// memoryCacheStore is an in-memory CacheStore with LRU eviction
+type memoryCacheStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List
+}
+
+type memoryCacheEntry struct {
+	key       string
+	resp      *CachedResponse
+	expiresAt time.Time
+}
+
+// NewMemoryCacheStore creates an in-memory store holding at most maxEntries
+// responses, evicting the least recently used when full
+func NewMemoryCacheStore(maxEntries int) CacheStore {
+	return &memoryCacheStore{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+func (s *memoryCacheStore) Get(ctx context.Context, key string) (*CachedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := el.Value.(*memoryCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		s.order.Remove(el)
+		delete(s.entries, key)
+		return nil, false
+	}
+
+	s.order.MoveToFront(el)
+	return entry.resp, true
+}
+
+func (s *memoryCacheStore) Set(ctx context.Context, key string, resp *CachedResponse, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[key]; ok {
+		el.Value = &memoryCacheEntry{key: key, resp: resp, expiresAt: time.Now().Add(ttl)}
+		s.order.MoveToFront(el)
+		return
+	}
+
+	s.entries[key] = s.order.PushFront(&memoryCacheEntry{key: key, resp: resp, expiresAt: time.Now().Add(ttl)})
+
+	for s.order.Len() > s.maxEntries {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+}
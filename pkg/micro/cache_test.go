@@ -0,0 +1,294 @@
+package micro
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// countingHandler answers with the number of times it has been called
+func countingHandler(status int, header http.Header) (http.Handler, *int) {
+	calls := 0
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "call %d", calls)
+	}), &calls
+}
+
+type cacheRequest struct {
+	method string
+	target string
+	header http.Header
+	want   string // Expected X-Cache value, empty when the cache is bypassed
+}
+
+func TestCacheMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      CacheOptions
+		status    int
+		header    http.Header // Set by the handler
+		requests  []cacheRequest
+		wantCalls int
+	}{
+		{
+			name: "miss then hit",
+			requests: []cacheRequest{
+				{target: "/items?page=1", want: "MISS"},
+				{target: "/items?page=1", want: "HIT"},
+				{target: "/items?page=2", want: "MISS"},
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "non-GET bypasses",
+			requests: []cacheRequest{
+				{method: http.MethodPost, target: "/items"},
+				{method: http.MethodPost, target: "/items"},
+			},
+			wantCalls: 2,
+		},
+		{
+			name:   "errors are not cached",
+			status: http.StatusInternalServerError,
+			requests: []cacheRequest{
+				{target: "/items", want: "MISS"},
+				{target: "/items", want: "MISS"},
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "no-cache revalidates",
+			requests: []cacheRequest{
+				{target: "/items", want: "MISS"},
+				{target: "/items", header: http.Header{"Cache-Control": {"no-cache"}}, want: "MISS"},
+				{target: "/items", want: "HIT"},
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "no-store bypasses",
+			requests: []cacheRequest{
+				{target: "/items", header: http.Header{"Cache-Control": {"no-store"}}},
+				{target: "/items", want: "MISS"},
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "configured vary headers are keyed",
+			opts: CacheOptions{VaryHeaders: []string{"Accept"}},
+			requests: []cacheRequest{
+				{target: "/items", header: http.Header{"Accept": {"application/json"}}, want: "MISS"},
+				{target: "/items", header: http.Header{"Accept": {"text/csv"}}, want: "MISS"},
+				{target: "/items", header: http.Header{"Accept": {"application/json"}}, want: "HIT"},
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "credentials bypass",
+			requests: []cacheRequest{
+				{target: "/me", header: http.Header{"Authorization": {"Bearer a"}}},
+				{target: "/me", header: http.Header{"Cookie": {"session=b"}}},
+				{target: "/me", want: "MISS"},
+				{target: "/me", header: http.Header{"Authorization": {"Bearer a"}}},
+			},
+			wantCalls: 4,
+		},
+		{
+			name: "keyed credentials are cached per caller",
+			opts: CacheOptions{VaryHeaders: []string{"authorization"}},
+			requests: []cacheRequest{
+				{target: "/me", header: http.Header{"Authorization": {"Bearer a"}}, want: "MISS"},
+				{target: "/me", header: http.Header{"Authorization": {"Bearer b"}}, want: "MISS"},
+				{target: "/me", header: http.Header{"Authorization": {"Bearer a"}}, want: "HIT"},
+			},
+			wantCalls: 2,
+		},
+		{
+			name:   "response vary is honoured",
+			header: http.Header{"Vary": {"Accept-Language"}},
+			requests: []cacheRequest{
+				{target: "/items", header: http.Header{"Accept-Language": {"en"}}, want: "MISS"},
+				{target: "/items", header: http.Header{"Accept-Language": {"fr"}}, want: "MISS"},
+				{target: "/items", header: http.Header{"Accept-Language": {"fr"}}, want: "HIT"},
+			},
+			wantCalls: 2,
+		},
+		{
+			name:   "vary star is not cached",
+			header: http.Header{"Vary": {"*"}},
+			requests: []cacheRequest{
+				{target: "/items", want: "MISS"},
+				{target: "/items", want: "MISS"},
+			},
+			wantCalls: 2,
+		},
+		{
+			name:   "set-cookie is not cached",
+			header: http.Header{"Set-Cookie": {"session=c"}},
+			requests: []cacheRequest{
+				{target: "/items", want: "MISS"},
+				{target: "/items", want: "MISS"},
+			},
+			wantCalls: 2,
+		},
+		{
+			name:   "private is not cached",
+			header: http.Header{"Cache-Control": {"private, max-age=60"}},
+			requests: []cacheRequest{
+				{target: "/items", want: "MISS"},
+				{target: "/items", want: "MISS"},
+			},
+			wantCalls: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			status := tt.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			next, calls := countingHandler(status, tt.header)
+			h := app.CacheMiddleware(tt.opts)(next)
+
+			for i, req := range tt.requests {
+				method := req.method
+				if method == "" {
+					method = http.MethodGet
+				}
+				r := httptest.NewRequest(method, req.target, nil)
+				for k, v := range req.header {
+					r.Header[k] = v
+				}
+				w := serve(h, r)
+				if got := w.Header().Get("X-Cache"); got != req.want {
+					t.Errorf("request %d: X-Cache = %q, want %q", i, got, req.want)
+				}
+			}
+			if *calls != tt.wantCalls {
+				t.Errorf("handler calls = %d, want %d", *calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCacheMiddlewareServesCachedResponse(t *testing.T) {
+	app := newTestApp(t)
+	next, _ := countingHandler(http.StatusAccepted, http.Header{"Content-Type": {"text/plain"}})
+	h := app.CacheMiddleware(CacheOptions{})(next)
+
+	serve(h, httptest.NewRequest(http.MethodGet, "/items", nil))
+	w := serve(h, httptest.NewRequest(http.MethodGet, "/items", nil))
+	if w.Code != http.StatusAccepted || w.Body.String() != "call 1" {
+		t.Errorf("response = %d %q, want %d %q", w.Code, w.Body.String(), http.StatusAccepted, "call 1")
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain" {
+		t.Errorf("Content-Type = %q, want text/plain", ct)
+	}
+}
+
+func TestCacheMiddlewareExpiry(t *testing.T) {
+	app := newTestApp(t)
+	next, calls := countingHandler(http.StatusOK, nil)
+	h := app.CacheMiddleware(CacheOptions{TTL: 20 * time.Millisecond})(next)
+
+	serve(h, httptest.NewRequest(http.MethodGet, "/items", nil))
+	if w := serve(h, httptest.NewRequest(http.MethodGet, "/items", nil)); w.Header().Get("X-Cache") != "HIT" {
+		t.Fatal("second request was not served from the cache")
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if w := serve(h, httptest.NewRequest(http.MethodGet, "/items", nil)); w.Header().Get("X-Cache") != "MISS" {
+		t.Error("expired entry was served")
+	}
+	if *calls != 2 {
+		t.Errorf("handler calls = %d, want 2", *calls)
+	}
+}
+
+func TestCacheMiddlewareResponseMaxAge(t *testing.T) {
+	app := newTestApp(t)
+	next, _ := countingHandler(http.StatusOK, http.Header{"Cache-Control": {"public, max-age=0"}})
+	h := app.CacheMiddleware(CacheOptions{TTL: time.Hour})(next)
+
+	// A route policy of max-age=0 overrides the middleware TTL
+	serve(h, httptest.NewRequest(http.MethodGet, "/items", nil))
+	if w := serve(h, httptest.NewRequest(http.MethodGet, "/items", nil)); w.Header().Get("X-Cache") != "MISS" {
+		t.Error("response with max-age=0 was cached")
+	}
+}
+
+func TestCacheMiddlewareFlush(t *testing.T) {
+	app := newTestApp(t)
+	h := app.CacheMiddleware(CacheOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("chunk"))
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("Flush: %v", err)
+		}
+	}))
+
+	w := serve(h, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	if !w.Flushed {
+		t.Error("flush did not reach the underlying writer")
+	}
+}
+
+func TestMemoryCacheStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryCacheStore(2)
+	resp := &CachedResponse{Status: http.StatusOK}
+
+	store.Set(ctx, "a", resp, time.Minute)
+	store.Set(ctx, "b", resp, time.Minute)
+	store.Get(ctx, "a") // a is now more recent than b
+	store.Set(ctx, "c", resp, time.Minute)
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := store.Get(ctx, key); ok != want {
+			t.Errorf("Get(%q) found = %v, want %v", key, ok, want)
+		}
+	}
+}
+
+func TestCacheMiddlewareSeparatesTenants(t *testing.T) {
+	app := newTestApp(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenantID, _ := TenantFromContext(r.Context())
+		fmt.Fprintf(w, "items of %s", tenantID)
+	})
+	h := app.TenantMiddleware(TenantOptions{BaseDomain: "example.com"})(
+		app.CacheMiddleware(CacheOptions{})(handler))
+
+	tests := []struct {
+		name   string
+		host   string
+		header string
+		want   string
+	}{
+		{"header tenant a", "api.test", "acme", "items of acme"},
+		{"header tenant b", "api.test", "globex", "items of globex"},
+		{"subdomain tenant a", "acme.example.com", "", "items of acme"},
+		{"subdomain tenant b", "globex.example.com", "", "items of globex"},
+	}
+	// Each request runs twice so the second is served from the cache
+	for range 2 {
+		for _, tt := range tests {
+			r := httptest.NewRequest(http.MethodGet, "/items", nil)
+			r.Host = tt.host
+			if tt.header != "" {
+				r.Header.Set("X-Tenant-ID", tt.header)
+			}
+			if w := serve(h, r); w.Body.String() != tt.want {
+				t.Errorf("%s: body = %q, want %q", tt.name, w.Body.String(), tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package micro
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SetCacheControl sets the Cache-Control directive of a response with a
+// matching Expires for HTTP/1.0 caches. Call it before writing the status.
+func (a *App) SetCacheControl(w http.ResponseWriter, directive string) {
+	h := w.Header()
+	h.Set("Cache-Control", directive)
+
+	lower := strings.ToLower(directive)
+	if strings.Contains(lower, "no-store") || strings.Contains(lower, "no-cache") {
+		h.Set("Expires", "0")
+		h.Set("Pragma", "no-cache")
+		return
+	}
+	h.Del("Pragma")
+	if maxAge, ok := cacheMaxAge(lower); ok {
+		h.Set("Expires", time.Now().Add(maxAge).UTC().Format(http.TimeFormat))
+	}
+}
+
+// CacheFor lets clients and shared caches reuse the route's responses for
+// d. vary lists the request headers the response depends on. Handlers can
+// still override the policy with SetCacheControl, and CacheMiddleware keeps
+// the responses for d.
+func CacheFor(d time.Duration, vary ...string) RouteOption {
+	directive := "public, max-age=" + strconv.Itoa(int(d.Seconds()))
+	return cachePolicy(directive, vary)
+}
+
+// NoStore forbids caching the route's responses anywhere, for credentials
+// and other sensitive data. CacheMiddleware skips them too.
+func NoStore() RouteOption {
+	return cachePolicy("no-store", nil)
+}
+
+func cachePolicy(directive string, vary []string) RouteOption {
+	return func(rt *Route) {
+		rt.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				rt.app.SetCacheControl(w, directive)
+				for _, h := range vary {
+					w.Header().Add("Vary", h)
+				}
+				next.ServeHTTP(w, r)
+			})
+		})
+	}
+}
+
+// cacheMaxAge returns the lifetime a shared cache may keep a response for,
+// preferring s-maxage over max-age
+func cacheMaxAge(cacheControl string) (time.Duration, bool) {
+	var maxAge time.Duration
+	found := false
+	for _, part := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(strings.ToLower(part)), "=")
+		if name != "max-age" && name != "s-maxage" {
+			continue
+		}
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			continue
+		}
+		if name == "s-maxage" {
+			return time.Duration(seconds) * time.Second, true
+		}
+		maxAge, found = time.Duration(seconds)*time.Second, true
+	}
+	return maxAge, found
+}
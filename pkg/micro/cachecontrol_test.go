@@ -0,0 +1,162 @@
+package micro
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSetCacheControl(t *testing.T) {
+	tests := []struct {
+		directive   string
+		wantExpires time.Duration // -1 for "0", 0 for no Expires header
+		wantPragma  bool
+	}{
+		{"public, max-age=300", 5 * time.Minute, false},
+		{"public, max-age=60, s-maxage=600", 10 * time.Minute, false},
+		{"private, max-age=30", 30 * time.Second, false},
+		{"no-store", -1, true},
+		{"No-Cache", -1, true},
+		{"public", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.directive, func(t *testing.T) {
+			app := newTestApp(t)
+			w := httptest.NewRecorder()
+			w.Header().Set("Pragma", "no-cache") // Stale from an earlier policy
+			app.SetCacheControl(w, tt.directive)
+
+			if got := w.Header().Get("Cache-Control"); got != tt.directive {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.directive)
+			}
+			if got := w.Header().Get("Pragma") == "no-cache"; got != tt.wantPragma {
+				t.Errorf("Pragma no-cache = %v, want %v", got, tt.wantPragma)
+			}
+
+			expires := w.Header().Get("Expires")
+			switch tt.wantExpires {
+			case -1:
+				if expires != "0" {
+					t.Errorf("Expires = %q, want 0", expires)
+				}
+			case 0:
+				if expires != "" {
+					t.Errorf("Expires = %q, want none", expires)
+				}
+			default:
+				at, err := http.ParseTime(expires)
+				if err != nil {
+					t.Fatalf("Expires %q: %v", expires, err)
+				}
+				if d := time.Until(at) - tt.wantExpires; d < -2*time.Second || d > time.Second {
+					t.Errorf("Expires = %s, want about %s from now", expires, tt.wantExpires)
+				}
+			}
+		})
+	}
+}
+
+func TestCachePolicyRouteOptions(t *testing.T) {
+	app := newTestApp(t)
+	app.GET("/catalog", okHandler, CacheFor(5*time.Minute, "Accept-Language"))
+	app.POST("/login", okHandler, NoStore())
+	app.GET("/plain", okHandler)
+	app.GET("/override", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		app.SetCacheControl(w, "private, max-age=10")
+		return app.JSON(w, http.StatusOK, nil)
+	}, CacheFor(time.Hour))
+	h := app.Handler()
+
+	w := serve(h, httptest.NewRequest(http.MethodGet, "/catalog", nil))
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=300" {
+		t.Errorf("CacheFor Cache-Control = %q", got)
+	}
+	if got := w.Header().Get("Vary"); got != "Accept-Language" {
+		t.Errorf("CacheFor Vary = %q", got)
+	}
+	if w.Header().Get("Expires") == "" {
+		t.Error("CacheFor did not set Expires")
+	}
+
+	w = serve(h, httptest.NewRequest(http.MethodPost, "/login", nil))
+	if got := w.Header().Get("Cache-Control"); got != "no-store" || w.Header().Get("Expires") != "0" {
+		t.Errorf("NoStore headers = %v", w.Header())
+	}
+
+	w = serve(h, httptest.NewRequest(http.MethodGet, "/plain", nil))
+	if got := w.Header().Get("Cache-Control"); got != "" {
+		t.Errorf("route without a policy got Cache-Control %q", got)
+	}
+
+	w = serve(h, httptest.NewRequest(http.MethodGet, "/override", nil))
+	if got := w.Header().Get("Cache-Control"); got != "private, max-age=10" {
+		t.Errorf("handler override Cache-Control = %q", got)
+	}
+}
+
+func TestCachePolicyWithCacheMiddleware(t *testing.T) {
+	app := newTestApp(t)
+	calls := 0
+	counting := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		calls++
+		return app.JSON(w, http.StatusOK, map[string]int{"call": calls})
+	}
+	store := NewMemoryCacheStore(10)
+	cache := app.CacheMiddleware(CacheOptions{TTL: time.Hour, Store: store})
+	app.GET("/cached", counting, CacheFor(time.Minute)).Use(cache)
+	app.GET("/secret", counting, NoStore()).Use(cache)
+	h := app.Handler()
+
+	for _, want := range []string{"MISS", "HIT"} {
+		w := serve(h, httptest.NewRequest(http.MethodGet, "/cached", nil))
+		if got := w.Header().Get("X-Cache"); got != want {
+			t.Errorf("/cached X-Cache = %q, want %q", got, want)
+		}
+		if got := w.Header().Get("Cache-Control"); got != "public, max-age=60" {
+			t.Errorf("/cached Cache-Control = %q", got)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("CacheFor route called %d times, want 1", calls)
+	}
+
+	calls = 0
+	for i := 0; i < 2; i++ {
+		w := serve(h, httptest.NewRequest(http.MethodGet, "/secret", nil))
+		if w.Header().Get("X-Cache") == "HIT" {
+			t.Error("NoStore response was served from the cache")
+		}
+	}
+	if calls != 2 {
+		t.Errorf("NoStore route called %d times, want 2", calls)
+	}
+}
+
+func TestCachePolicyWithETag(t *testing.T) {
+	app := newTestApp(t)
+	modtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	app.GET("/report.txt", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return app.ServeContent(w, r, "report.txt", modtime, bytes.NewReader([]byte("quarterly")))
+	}, CacheFor(time.Minute))
+	h := app.Handler()
+
+	w := serve(h, httptest.NewRequest(http.MethodGet, "/report.txt", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("status = %d, ETag = %q", w.Code, etag)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/report.txt", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = serve(h, r)
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("revalidation status = %d, want 304", w.Code)
+	}
+	// A 304 repeats the caching headers so the stored copy is refreshed
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=60" || w.Header().Get("Expires") == "" {
+		t.Errorf("304 caching headers = %v", w.Header())
+	}
+}
@@ -0,0 +1,116 @@
+package micro
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"go.uber.org/zap"
+)
+
+const redacted = "xxxxx"
+
+var dsnPasswordPattern = regexp.MustCompile(`(?i)(password\s*=\s*)('[^']*'|\S+)`)
+
+// Redacted returns a copy of the config that is safe to log, with secrets
+// masked, including the password embedded in DBDSN
+func (c *Config) Redacted() Config {
+	safe := *c
+	safe.DBDSN = redactDSN(c.DBDSN)
+	safe.NATSURL = redactDSN(c.NATSURL)
+	if safe.RateLimiter.InternalToken != "" {
+		safe.RateLimiter.InternalToken = redacted
+	}
+	safe.fileEnv = nil // May hold secrets the service reads itself
+	return safe
+}
+
+// Validate checks the invariants between fields that struct tags cannot
+// express, reporting every violation with how to fix it. NewApp calls it
+// after the field validation.
+func (c *Config) Validate() error {
+	var errs []error
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		errs = append(errs, errors.New("CERT_FILE and KEY_FILE must be set together to serve TLS, or both left empty"))
+	}
+	if c.RateLimiter.Enabled {
+		if c.RateLimiter.RequestsPerS <= 0 {
+			errs = append(errs, errors.New("RATE_LIMITER_REQUESTS_PER_SECOND must be positive, or disable the limiter with RATE_LIMITER_ENABLED=false"))
+		}
+		if c.RateLimiter.Burst < 1 {
+			errs = append(errs, errors.New("RATE_LIMITER_BURST must be at least 1, otherwise every request is rejected"))
+		}
+	}
+	if c.CORS.Enabled {
+		if err := c.CORS.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if p := c.Pagination; p.MaxLimit > 0 && p.DefaultLimit > p.MaxLimit {
+		errs = append(errs, fmt.Errorf("PAGINATION_DEFAULT_LIMIT (%d) exceeds PAGINATION_MAX_LIMIT (%d)", p.DefaultLimit, p.MaxLimit))
+	}
+	switch c.ValidationMode {
+	case "", ValidationModeAll, ValidationModeFirst:
+	default:
+		errs = append(errs, fmt.Errorf("VALIDATION_MODE %q must be %s or %s", c.ValidationMode, ValidationModeAll, ValidationModeFirst))
+	}
+	if !validTimeFormat(c.TimeFormat) {
+		errs = append(errs, fmt.Errorf("TIME_FORMAT %q must be rfc3339, unix, unixmilli or a Go layout such as 2006-01-02", c.TimeFormat))
+	}
+	if err := c.Metrics.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("invalid metrics config: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// redactDSN masks the password of URL-style and key/value DSNs
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+		// Key/value parameters may carry a password too
+		if q := u.Query(); q.Has("password") {
+			q.Set("password", redacted)
+			u.RawQuery = q.Encode()
+		}
+		return u.String()
+	}
+	return dsnPasswordPattern.ReplaceAllString(dsn, "${1}"+redacted)
+}
+
+// summaryFields describes the effective configuration for startup logs
+func (c *Config) summaryFields() []zap.Field {
+	safe := c.Redacted()
+	return []zap.Field{
+		zap.String("app", safe.AppName),
+		zap.String("env", safe.Env),
+		zap.Int("port", safe.Port),
+		zap.String("log_level", safe.LogLevel),
+		zap.String("db_dsn", safe.DBDSN),
+		zap.String("events_driver", safe.EventsDriver),
+		zap.Bool("tls", safe.CertFile != "" && safe.KeyFile != ""),
+		zap.Bool("metrics", safe.MetricsEnabled),
+		zap.Duration("read_timeout", safe.ReadTimeout),
+		zap.Duration("write_timeout", safe.WriteTimeout),
+		zap.Duration("read_header_timeout", safe.ReadHeaderTimeout),
+		zap.Duration("idle_timeout", safe.IdleTimeout),
+		zap.Int("max_header_bytes", safe.MaxHeaderBytes),
+		zap.Bool("keep_alives", !safe.DisableKeepAlives),
+		zap.Duration("handler_timeout", safe.HandlerTimeout),
+		zap.Duration("shutdown_timeout", safe.ShutdownTimeout),
+		zap.Bool("rate_limiter", safe.RateLimiter.Enabled),
+		zap.String("rate_limiter_strategy", safe.RateLimiter.Strategy),
+		zap.Float64("rate_limiter_rps", safe.RateLimiter.RequestsPerS),
+		zap.Int("rate_limiter_burst", safe.RateLimiter.Burst),
+		zap.Bool("cors", safe.CORS.Enabled),
+		zap.Strings("cors_origins", safe.CORS.AllowedOrigins),
+	}
+}
+
+// requireLogger reports whether a logger build failure aborts startup rather
+// than falling back to stderr. It defaults to true.
+func (c *Config) requireLogger() bool {
+	return c.RequireLogger == nil || *c.RequireLogger
+}
@@ -0,0 +1,281 @@
+package micro
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Message is a message received from a broker. Ack and Nack are set by the
+// MessageSource and may be nil when the broker has no acknowledgements.
+type Message struct {
+	Subject string
+	Data    []byte
+	Headers map[string]string
+
+	Ack  func() error
+	Nack func() error
+}
+
+// MessageSource subscribes to a broker subject or topic. Messages are sent
+// on the returned channel, keeping at most prefetch unacknowledged, until
+// ctx is cancelled. The channel need not be closed.
+type MessageSource interface {
+	Subscribe(ctx context.Context, subject string, prefetch int) (<-chan *Message, error)
+}
+
+// MessageHandler processes one message. Returning an error retries the
+// message with backoff; wrap it with Permanent to skip the retries.
+type MessageHandler func(ctx context.Context, msg *Message) error
+
+// Permanent marks a handler error as not worth retrying
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// ConsumerOptions configures a Consumer
+type ConsumerOptions struct {
+	Concurrency int           // Messages handled at once; defaults to 1
+	Prefetch    int           // Unacknowledged messages buffered; defaults to Concurrency
+	MaxRetries  int           // Retries after the first attempt before nacking; defaults to 3, -1 disables
+	Backoff     time.Duration // Delay before the first retry, doubled each time; defaults to 100ms
+	MaxBackoff  time.Duration // Defaults to 10s
+}
+
+// Consumer dispatches messages from a MessageSource to a handler. It is a
+// Worker: register it with App.RegisterWorker. On shutdown it stops taking
+// messages and waits for in-flight ones to finish; prefetched messages that
+// were never started stay unacknowledged for the broker to redeliver.
+type Consumer struct {
+	app     *App
+	source  MessageSource
+	subject string
+	handler MessageHandler
+	opts    ConsumerOptions
+
+	wg   sync.WaitGroup
+	done chan struct{}
+}
+
+// NewConsumer creates a consumer of subject. Each message is handled with
+// a context carrying a correlation ID, taken from the X-Request-ID header
+// when RequestIDPattern accepts it, a request logger and a request scope.
+func (a *App) NewConsumer(source MessageSource, subject string, handler MessageHandler, opts ConsumerOptions) *Consumer {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.Prefetch <= 0 {
+		opts.Prefetch = opts.Concurrency
+	}
+	switch {
+	case opts.MaxRetries == 0:
+		opts.MaxRetries = 3
+	case opts.MaxRetries < 0:
+		opts.MaxRetries = 0
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 10 * time.Second
+	}
+	return &Consumer{
+		app:     a,
+		source:  source,
+		subject: subject,
+		handler: handler,
+		opts:    opts,
+		done:    make(chan struct{}),
+	}
+}
+
+// Start subscribes and handles messages until ctx is cancelled and the
+// in-flight messages are done
+func (c *Consumer) Start(ctx context.Context) {
+	defer close(c.done)
+
+	msgs, err := c.source.Subscribe(ctx, c.subject, c.opts.Prefetch)
+	if err != nil {
+		c.app.Logger.Error("consumer subscribe failed", zap.String("subject", c.subject), zap.Error(err))
+		return
+	}
+
+	for i := 0; i < c.opts.Concurrency; i++ {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case msg := <-msgs:
+					if msg != nil {
+						c.process(ctx, msg)
+					}
+				}
+			}
+		}()
+	}
+	c.wg.Wait()
+}
+
+// Stop waits for in-flight messages to finish or for ctx to expire
+func (c *Consumer) Stop(ctx context.Context) error {
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("consumer %s: %w", c.subject, ctx.Err())
+	}
+}
+
+// process handles msg with retries. stop is the worker context: once it is
+// cancelled, pending retries give up so shutdown is not held by backoff.
+func (c *Consumer) process(stop context.Context, msg *Message) {
+	requestID := c.app.acceptRequestID(msg.Headers["X-Request-ID"])
+	if requestID == "" {
+		requestID = c.app.newRequestID()
+	}
+	logger := c.app.Logger.With(
+		zap.String("request_id", requestID),
+		zap.String("subject", msg.Subject),
+	)
+
+	// Detached from stop so a message in flight can finish during shutdown
+	ctx := context.WithValue(context.Background(), contextKeyRequestID, requestID)
+	ctx = context.WithValue(ctx, contextKeyLogger, logger)
+	ctx = WithRequestScope(ctx)
+
+	backoff := c.opts.Backoff
+	for attempt := 1; ; attempt++ {
+		err := c.handle(ctx, msg)
+		if err == nil {
+			c.app.metrics.consumerMessagesTotal.WithLabelValues(c.subject, "ok").Inc()
+			settle(logger, "ack", msg.Ack)
+			return
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) || attempt > c.opts.MaxRetries {
+			c.app.metrics.consumerMessagesTotal.WithLabelValues(c.subject, "failed").Inc()
+			logger.Error("message handling failed", zap.Int("attempts", attempt), zap.Error(err))
+			settle(logger, "nack", msg.Nack)
+			return
+		}
+
+		c.app.metrics.consumerMessagesTotal.WithLabelValues(c.subject, "retry").Inc()
+		logger.Warn("message handling failed, retrying",
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", backoff),
+			zap.Error(err),
+		)
+
+		select {
+		case <-time.After(backoff):
+		case <-stop.Done():
+			settle(logger, "nack", msg.Nack)
+			return
+		}
+		backoff = min(backoff*2, c.opts.MaxBackoff)
+	}
+}
+
+// handle runs the handler, turning a panic into an error
+func (c *Consumer) handle(ctx context.Context, msg *Message) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			LoggerFromContext(ctx).Error("panic recovered", zap.Any("error", p))
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return c.handler(ctx, msg)
+}
+
+func settle(logger Logger, action string, fn func() error) {
+	if fn == nil {
+		return
+	}
+	if err := fn(); err != nil {
+		logger.Error("message "+action+" failed", zap.Error(err))
+	}
+}
+
+// MemoryBroker is an in-process EventPublisher and MessageSource, for
+// local development and tests. Every subscriber of a subject receives each
+// message; acknowledgements are no-ops and nothing is redelivered.
+type MemoryBroker struct {
+	mu   sync.RWMutex
+	subs map[string][]*memorySubscription
+}
+
+type memorySubscription struct {
+	ch   chan *Message
+	done <-chan struct{}
+}
+
+// NewMemoryBroker creates an empty in-memory broker
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{subs: make(map[string][]*memorySubscription)}
+}
+
+// Publish JSON-encodes payload and delivers it to the subject's
+// subscribers, blocking while their prefetch buffers are full
+func (b *MemoryBroker) Publish(ctx context.Context, subject string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+
+	headers := map[string]string{}
+	if requestID, ok := ctx.Value(contextKeyRequestID).(string); ok {
+		headers["X-Request-ID"] = requestID
+	}
+
+	b.mu.RLock()
+	subs := b.subs[subject]
+	b.mu.RUnlock()
+
+	for _, sub := range subs {
+		msg := &Message{Subject: subject, Data: data, Headers: headers}
+		select {
+		case sub.ch <- msg:
+		case <-sub.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Subscribe implements MessageSource
+func (b *MemoryBroker) Subscribe(ctx context.Context, subject string, prefetch int) (<-chan *Message, error) {
+	sub := &memorySubscription{ch: make(chan *Message, prefetch), done: ctx.Done()}
+
+	b.mu.Lock()
+	b.subs[subject] = append(b.subs[subject], sub)
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		subs := b.subs[subject]
+		for i, s := range subs {
+			if s == sub {
+				b.subs[subject] = append(subs[:i:i], subs[i+1:]...)
+				break
+			}
+		}
+	}()
+	return sub.ch, nil
+}
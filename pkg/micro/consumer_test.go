@@ -0,0 +1,304 @@
+package micro
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// chanSource hands out a fixed channel, so tests control delivery and can
+// observe acknowledgements
+type chanSource struct {
+	msgs chan *Message
+	err  error
+}
+
+func (s *chanSource) Subscribe(ctx context.Context, subject string, prefetch int) (<-chan *Message, error) {
+	return s.msgs, s.err
+}
+
+// trackedMessage returns a message whose Ack and Nack close acked or nacked
+func trackedMessage(data string) (msg *Message, acked, nacked chan struct{}) {
+	acked, nacked = make(chan struct{}), make(chan struct{})
+	msg = &Message{
+		Subject: "jobs",
+		Data:    []byte(data),
+		Ack:     func() error { close(acked); return nil },
+		Nack:    func() error { close(nacked); return nil },
+	}
+	return msg, acked, nacked
+}
+
+// runConsumer starts c and returns a function stopping it the way the app
+// does on shutdown
+func runConsumer(t *testing.T, c *Consumer) (stop func() error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	go c.Start(ctx)
+	t.Cleanup(cancel)
+	return func() error {
+		cancel()
+		stopCtx, done := context.WithTimeout(context.Background(), 5*time.Second)
+		defer done()
+		return c.Stop(stopCtx)
+	}
+}
+
+func waitClosed(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+func TestConsumerMemoryBroker(t *testing.T) {
+	app := newTestApp(t, func(c *Config) { c.RequestIDPattern = `[a-z0-9-]+` })
+	broker := NewMemoryBroker()
+
+	type seen struct {
+		data, requestID string
+		logger          bool
+	}
+	got := make(chan seen, 2)
+	c := app.NewConsumer(broker, "user.created", func(ctx context.Context, msg *Message) error {
+		id, _ := ctx.Value(contextKeyRequestID).(string)
+		_, hasLogger := ctx.Value(contextKeyLogger).(Logger)
+		got <- seen{string(msg.Data), id, hasLogger}
+		return nil
+	}, ConsumerOptions{})
+	stop := runConsumer(t, c)
+
+	// Wait for the subscription before publishing
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		broker.mu.RLock()
+		n := len(broker.subs["user.created"])
+		broker.mu.RUnlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("consumer did not subscribe")
+		}
+	}
+
+	// The publisher's request ID becomes the correlation ID
+	ctx := context.WithValue(context.Background(), contextKeyRequestID, "req-42")
+	if err := broker.Publish(ctx, "user.created", map[string]int{"id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := broker.Publish(context.Background(), "user.created", map[string]int{"id": 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	first, second := <-got, <-got
+	if first != (seen{`{"id":1}`, "req-42", true}) {
+		t.Errorf("first message = %+v", first)
+	}
+	if second.data != `{"id":2}` || second.requestID == "" {
+		t.Errorf("second message = %+v, want a generated correlation ID", second)
+	}
+	if err := stop(); err != nil {
+		t.Errorf("Stop: %v", err)
+	}
+}
+
+func TestConsumerRetries(t *testing.T) {
+	boom := errors.New("boom")
+	tests := []struct {
+		name     string
+		failures int // Attempts failing before one succeeds
+		err      error
+		retries  int
+		attempts int32
+		acked    bool
+	}{
+		{"first attempt", 0, boom, 3, 1, true},
+		{"succeeds on retry", 2, boom, 3, 3, true},
+		{"retries exhausted", 10, boom, 2, 3, false},
+		{"permanent", 10, Permanent(boom), 3, 1, false},
+		{"retries disabled", 10, boom, -1, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			source := &chanSource{msgs: make(chan *Message, 1)}
+			var attempts atomic.Int32
+			c := app.NewConsumer(source, "jobs", func(ctx context.Context, msg *Message) error {
+				if int(attempts.Add(1)) <= tt.failures {
+					return tt.err
+				}
+				return nil
+			}, ConsumerOptions{MaxRetries: tt.retries, Backoff: time.Millisecond})
+			stop := runConsumer(t, c)
+
+			msg, acked, nacked := trackedMessage("job")
+			source.msgs <- msg
+			if tt.acked {
+				waitClosed(t, acked, "ack")
+			} else {
+				waitClosed(t, nacked, "nack")
+			}
+			if n := attempts.Load(); n != tt.attempts {
+				t.Errorf("attempts = %d, want %d", n, tt.attempts)
+			}
+			stop()
+		})
+	}
+}
+
+func TestConsumerRecoversPanics(t *testing.T) {
+	app := newTestApp(t)
+	source := &chanSource{msgs: make(chan *Message, 2)}
+	c := app.NewConsumer(source, "jobs", func(ctx context.Context, msg *Message) error {
+		if string(msg.Data) == "bad" {
+			panic("bad message")
+		}
+		return nil
+	}, ConsumerOptions{MaxRetries: -1})
+	stop := runConsumer(t, c)
+
+	bad, _, badNacked := trackedMessage("bad")
+	good, goodAcked, _ := trackedMessage("good")
+	source.msgs <- bad
+	source.msgs <- good
+	waitClosed(t, badNacked, "nack of the panicking message")
+	waitClosed(t, goodAcked, "ack of the next message")
+	stop()
+
+	if n := testutil.ToFloat64(app.metrics.consumerMessagesTotal.WithLabelValues("jobs", "failed")); n != 1 {
+		t.Errorf("failed messages recorded = %v, want 1", n)
+	}
+	if n := testutil.ToFloat64(app.metrics.consumerMessagesTotal.WithLabelValues("jobs", "ok")); n != 1 {
+		t.Errorf("ok messages recorded = %v, want 1", n)
+	}
+}
+
+func TestConsumerConcurrency(t *testing.T) {
+	app := newTestApp(t)
+	source := &chanSource{msgs: make(chan *Message, 10)}
+	var running, peak atomic.Int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(6)
+	c := app.NewConsumer(source, "jobs", func(ctx context.Context, msg *Message) error {
+		defer wg.Done()
+		n := running.Add(1)
+		defer running.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		<-release
+		return nil
+	}, ConsumerOptions{Concurrency: 3})
+	stop := runConsumer(t, c)
+
+	for range 6 {
+		msg, _, _ := trackedMessage("job")
+		source.msgs <- msg
+	}
+	for deadline := time.Now().Add(5 * time.Second); running.Load() < 3; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d handlers running, want 3", running.Load())
+		}
+	}
+	close(release)
+	wg.Wait()
+	stop()
+
+	if p := peak.Load(); p != 3 {
+		t.Errorf("peak concurrency = %d, want 3", p)
+	}
+}
+
+func TestConsumerDrainsOnShutdown(t *testing.T) {
+	app := newTestApp(t)
+	source := &chanSource{msgs: make(chan *Message, 1)}
+	started, release := make(chan struct{}), make(chan struct{})
+	c := app.NewConsumer(source, "jobs", func(ctx context.Context, msg *Message) error {
+		close(started)
+		<-release
+		// The message context outlives the worker context
+		return ctx.Err()
+	}, ConsumerOptions{})
+	stop := runConsumer(t, c)
+
+	msg, acked, _ := trackedMessage("job")
+	source.msgs <- msg
+	waitClosed(t, started, "handler")
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- stop() }()
+	select {
+	case err := <-stopped:
+		t.Fatalf("Stop returned %v with a message in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-stopped; err != nil {
+		t.Errorf("Stop: %v", err)
+	}
+	waitClosed(t, acked, "ack of the in-flight message")
+}
+
+func TestConsumerShutdownAbandonsRetries(t *testing.T) {
+	app := newTestApp(t)
+	source := &chanSource{msgs: make(chan *Message, 1)}
+	failed := make(chan struct{}, 1)
+	c := app.NewConsumer(source, "jobs", func(ctx context.Context, msg *Message) error {
+		failed <- struct{}{}
+		return errors.New("boom")
+	}, ConsumerOptions{Backoff: time.Hour})
+	stop := runConsumer(t, c)
+
+	msg, _, nacked := trackedMessage("job")
+	source.msgs <- msg
+	<-failed
+
+	// Shutdown is not held by the hour long backoff
+	if err := stop(); err != nil {
+		t.Errorf("Stop: %v", err)
+	}
+	waitClosed(t, nacked, "nack of the abandoned message")
+}
+
+func TestConsumerStopTimeout(t *testing.T) {
+	app := newTestApp(t)
+	source := &chanSource{msgs: make(chan *Message, 1)}
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	c := app.NewConsumer(source, "jobs", func(ctx context.Context, msg *Message) error {
+		close(started)
+		<-release
+		return nil
+	}, ConsumerOptions{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go c.Start(ctx)
+	msg, _, _ := trackedMessage("job")
+	source.msgs <- msg
+	waitClosed(t, started, "handler")
+	cancel()
+
+	stopCtx, done := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer done()
+	if err := c.Stop(stopCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestConsumerSubscribeFailure(t *testing.T) {
+	app := newTestApp(t)
+	c := app.NewConsumer(&chanSource{err: errors.New("no broker")}, "jobs", func(context.Context, *Message) error {
+		return nil
+	}, ConsumerOptions{})
+	stop := runConsumer(t, c)
+	if err := stop(); err != nil {
+		t.Errorf("Stop after a failed subscribe: %v", err)
+	}
+}
@@ -0,0 +1,264 @@
+package micro
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Scope controls how long a provided instance lives
+type Scope int
+
+const (
+	// Singleton instances are created once and shared
+	Singleton Scope = iota
+	// RequestScoped instances are created once per request
+	RequestScoped
+)
+
+// ErrNoProvider is returned when resolving a type nobody provides
+var ErrNoProvider = errors.New("no provider registered")
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Container is an optional dependency registry. Providers are constructor
+// functions whose parameters are resolved from the container; instances are
+// built lazily on first use.
+//
+//	c.Provide(repository.NewUserRepository)
+//	c.Provide(service.NewUserService)
+//	svc, err := micro.Resolve[service.UserService](ctx, c)
+type Container struct {
+	mu        sync.RWMutex
+	providers map[reflect.Type]*provider
+}
+
+type provider struct {
+	fn    reflect.Value
+	out   reflect.Type
+	scope Scope
+
+	mu       sync.Mutex
+	built    bool
+	instance reflect.Value
+}
+
+// requestScope caches request-scoped instances for one request
+type requestScope struct {
+	mu        sync.Mutex
+	instances map[reflect.Type]reflect.Value
+}
+
+// NewContainer creates an empty container
+func NewContainer() *Container {
+	return &Container{providers: make(map[reflect.Type]*provider)}
+}
+
+// Provide registers constructor, a function returning T or (T, error), as
+// the provider of T. Its parameters are resolved from the container, and a
+// context.Context parameter receives the resolving context.
+func (c *Container) Provide(constructor interface{}, scope ...Scope) error {
+	fn := reflect.ValueOf(constructor)
+	t := fn.Type()
+	if t.Kind() != reflect.Func {
+		return fmt.Errorf("provider must be a function, got %s", t)
+	}
+	if t.NumOut() == 0 || t.NumOut() > 2 || (t.NumOut() == 2 && t.Out(1) != errorType) {
+		return fmt.Errorf("provider %s must return T or (T, error)", t)
+	}
+
+	p := &provider{fn: fn, out: t.Out(0), scope: Singleton}
+	if len(scope) > 0 {
+		p.scope = scope[0]
+	}
+	return c.register(p)
+}
+
+// ProvideValue registers an existing value as a singleton of its own type
+func (c *Container) ProvideValue(v interface{}) error {
+	if v == nil {
+		return errors.New("cannot provide a nil value")
+	}
+	rv := reflect.ValueOf(v)
+	return c.register(&provider{out: rv.Type(), scope: Singleton, built: true, instance: rv})
+}
+
+// ProvideAs registers an existing value as a singleton of T, typically an
+// interface it implements
+func ProvideAs[T any](c *Container, v T) error {
+	rv := reflect.ValueOf(&v).Elem()
+	return c.register(&provider{out: rv.Type(), scope: Singleton, built: true, instance: rv})
+}
+
+func (c *Container) register(p *provider) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.providers[p.out]; exists {
+		return fmt.Errorf("provider for %s already registered", p.out)
+	}
+	c.providers[p.out] = p
+	return nil
+}
+
+// Resolve builds or fetches the instance of T. Request-scoped types need a
+// ctx from a request served by the app, or wrapped with WithRequestScope.
+func Resolve[T any](ctx context.Context, c *Container) (T, error) {
+	var zero T
+	v, err := c.resolve(ctx, reflect.TypeOf((*T)(nil)).Elem(), nil)
+	if err != nil {
+		return zero, err
+	}
+	return v.Interface().(T), nil
+}
+
+// MustResolve is like Resolve but panics on error, for use during startup
+func MustResolve[T any](ctx context.Context, c *Container) T {
+	v, err := Resolve[T](ctx, c)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// resolve builds t, tracking the resolution path to detect cycles
+func (c *Container) resolve(ctx context.Context, t reflect.Type, path []reflect.Type) (reflect.Value, error) {
+	if t == contextType {
+		return reflect.ValueOf(&ctx).Elem(), nil
+	}
+
+	for _, seen := range path {
+		if seen == t {
+			return reflect.Value{}, fmt.Errorf("dependency cycle: %s", formatPath(append(path, t)))
+		}
+	}
+	path = append(path, t)
+
+	c.mu.RLock()
+	p, ok := c.providers[t]
+	c.mu.RUnlock()
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("resolve %s: %w", formatPath(path), ErrNoProvider)
+	}
+
+	if p.scope == RequestScoped {
+		return c.resolveRequestScoped(ctx, p, path)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.built {
+		return p.instance, nil
+	}
+	// Singletons outlive requests, so they are built with a background
+	// context and cannot capture request-scoped dependencies
+	v, err := c.build(context.Background(), p, path)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	p.instance, p.built = v, true
+	return v, nil
+}
+
+func (c *Container) resolveRequestScoped(ctx context.Context, p *provider, path []reflect.Type) (reflect.Value, error) {
+	scope, _ := ctx.Value(contextKeyRequestScope).(*requestScope)
+	if scope == nil {
+		// Also reached when a singleton depends on a request-scoped type
+		return reflect.Value{}, fmt.Errorf("resolve %s: request-scoped dependency without a request scope", formatPath(path))
+	}
+
+	scope.mu.Lock()
+	v, ok := scope.instances[p.out]
+	scope.mu.Unlock()
+	if ok {
+		return v, nil
+	}
+
+	v, err := c.build(ctx, p, path)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	scope.mu.Lock()
+	defer scope.mu.Unlock()
+	// Another goroutine of the same request may have won the race
+	if existing, ok := scope.instances[p.out]; ok {
+		return existing, nil
+	}
+	scope.instances[p.out] = v
+	return v, nil
+}
+
+func (c *Container) build(ctx context.Context, p *provider, path []reflect.Type) (reflect.Value, error) {
+	t := p.fn.Type()
+	n := t.NumIn()
+	// Variadic options such as ...UserServiceOption are left empty unless
+	// their slice type is provided
+	variadic := t.IsVariadic() && c.has(t.In(n-1))
+	if t.IsVariadic() && !variadic {
+		n--
+	}
+
+	args := make([]reflect.Value, n)
+	for i := range args {
+		arg, err := c.resolve(ctx, t.In(i), path)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		args[i] = arg
+	}
+
+	if variadic {
+		return p.result(p.fn.CallSlice(args))
+	}
+	return p.result(p.fn.Call(args))
+}
+
+func (c *Container) has(t reflect.Type) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.providers[t]
+	return ok
+}
+
+func (p *provider) result(out []reflect.Value) (reflect.Value, error) {
+	if len(out) == 2 && !out[1].IsNil() {
+		return reflect.Value{}, fmt.Errorf("provide %s: %w", p.out, out[1].Interface().(error))
+	}
+	return out[0], nil
+}
+
+func formatPath(path []reflect.Type) string {
+	names := make([]string, len(path))
+	for i, t := range path {
+		names[i] = t.String()
+	}
+	return strings.Join(names, " -> ")
+}
+
+// WithRequestScope returns a context in which request-scoped dependencies
+// are created once and reused. The app adds one to every request.
+func WithRequestScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKeyRequestScope, &requestScope{
+		instances: make(map[reflect.Type]reflect.Value),
+	})
+}
+
+// requestScopeMiddleware gives each request its own request scope
+func (a *App) requestScopeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithRequestScope(r.Context())))
+	})
+}
+
+// Container returns the app dependency container. The app config and
+// logger are provided by default.
+func (a *App) Container() *Container {
+	return a.container
+}
@@ -0,0 +1,167 @@
+package micro
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type (
+	testDB      struct{ dsn string }
+	testRepo    struct{ db *testDB }
+	testService struct{ repo *testRepo }
+	testAuditor interface{ Audit(string) }
+	testTx      struct{ id int }
+
+	cycleA struct{}
+	cycleB struct{}
+	cycleC struct{}
+)
+
+type nopAuditor struct{}
+
+func (nopAuditor) Audit(string) {}
+
+func mustProvide(t *testing.T, c *Container, constructor interface{}, scope ...Scope) {
+	t.Helper()
+	if err := c.Provide(constructor, scope...); err != nil {
+		t.Fatalf("Provide: %v", err)
+	}
+}
+
+func TestContainerResolutionOrder(t *testing.T) {
+	c := NewContainer()
+	var order []string
+	// Registered out of dependency order; resolution is lazy
+	mustProvide(t, c, func(r *testRepo) *testService { order = append(order, "service"); return &testService{repo: r} })
+	mustProvide(t, c, func(db *testDB) *testRepo { order = append(order, "repo"); return &testRepo{db: db} })
+	mustProvide(t, c, func() *testDB { order = append(order, "db"); return &testDB{dsn: "postgres://localhost/test"} })
+
+	if len(order) != 0 {
+		t.Fatalf("providers ran at registration: %v", order)
+	}
+	svc, err := Resolve[*testService](context.Background(), c)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if want := []string{"db", "repo", "service"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("build order = %v, want %v", order, want)
+	}
+	if svc.repo.db.dsn != "postgres://localhost/test" {
+		t.Errorf("service wired to %+v", svc.repo.db)
+	}
+
+	// Singletons are built once
+	again := MustResolve[*testService](context.Background(), c)
+	if again != svc || len(order) != 3 {
+		t.Errorf("singleton rebuilt: order %v", order)
+	}
+}
+
+func TestContainerCycleDetection(t *testing.T) {
+	c := NewContainer()
+	mustProvide(t, c, func(*cycleB) *cycleA { return &cycleA{} })
+	mustProvide(t, c, func(*cycleC) *cycleB { return &cycleB{} })
+	mustProvide(t, c, func(*cycleA) *cycleC { return &cycleC{} })
+
+	_, err := Resolve[*cycleA](context.Background(), c)
+	if err == nil || !strings.Contains(err.Error(), "dependency cycle: *micro.cycleA -> *micro.cycleB -> *micro.cycleC -> *micro.cycleA") {
+		t.Errorf("err = %v, want the cycle path", err)
+	}
+}
+
+func TestContainerErrors(t *testing.T) {
+	c := NewContainer()
+	failure := errors.New("connection refused")
+	mustProvide(t, c, func() (*testDB, error) { return nil, failure })
+	mustProvide(t, c, func(db *testDB) *testRepo { return &testRepo{db: db} })
+
+	if _, err := Resolve[*testRepo](context.Background(), c); !errors.Is(err, failure) {
+		t.Errorf("provider failure err = %v, want %v", err, failure)
+	}
+	if _, err := Resolve[*testService](context.Background(), c); !errors.Is(err, ErrNoProvider) {
+		t.Errorf("missing provider err = %v, want %v", err, ErrNoProvider)
+	}
+	if err := c.Provide(func() *testDB { return nil }); err == nil {
+		t.Error("duplicate provider accepted")
+	}
+	for _, bad := range []interface{}{"not a func", func() {}, func() (*testTx, int) { return nil, 0 }} {
+		if err := c.Provide(bad); err == nil {
+			t.Errorf("Provide(%T) accepted", bad)
+		}
+	}
+}
+
+func TestContainerValuesAndInterfaces(t *testing.T) {
+	c := NewContainer()
+	if err := c.ProvideValue(&testDB{dsn: "memory"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ProvideAs[testAuditor](c, nopAuditor{}); err != nil {
+		t.Fatal(err)
+	}
+	var gotCtx context.Context
+	mustProvide(t, c, func(ctx context.Context, db *testDB, a testAuditor) *testRepo {
+		gotCtx = ctx
+		return &testRepo{db: db}
+	})
+
+	repo, err := Resolve[*testRepo](context.Background(), c)
+	if err != nil || repo.db.dsn != "memory" {
+		t.Fatalf("Resolve = %+v, %v", repo, err)
+	}
+	if gotCtx == nil {
+		t.Error("context parameter not injected")
+	}
+	if err := c.ProvideValue(nil); err == nil {
+		t.Error("nil value accepted")
+	}
+}
+
+func TestContainerRequestScope(t *testing.T) {
+	app := newTestApp(t)
+	c := app.Container()
+	next := 0
+	mustProvide(t, c, func() *testTx { next++; return &testTx{id: next} }, RequestScoped)
+
+	var ids []int
+	app.GET("/tx", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		first := MustResolve[*testTx](ctx, c)
+		second := MustResolve[*testTx](ctx, c)
+		if first != second {
+			t.Error("request-scoped instance not reused within a request")
+		}
+		ids = append(ids, first.id)
+		return okHandler(ctx, w, r)
+	})
+	h := app.Handler()
+	serve(h, httptest.NewRequest(http.MethodGet, "/tx", nil))
+	serve(h, httptest.NewRequest(http.MethodGet, "/tx", nil))
+
+	if !reflect.DeepEqual(ids, []int{1, 2}) {
+		t.Errorf("instances per request = %v, want a fresh one each", ids)
+	}
+	if _, err := Resolve[*testTx](context.Background(), c); err == nil {
+		t.Error("request-scoped type resolved outside a request")
+	}
+	// Singletons cannot capture request-scoped dependencies
+	mustProvide(t, c, func(tx *testTx) *testRepo { return &testRepo{} })
+	if _, err := Resolve[*testRepo](WithRequestScope(context.Background()), c); err == nil {
+		t.Error("singleton captured a request-scoped dependency")
+	}
+}
+
+func TestAppContainerDefaults(t *testing.T) {
+	app := newTestApp(t)
+	cfg, err := Resolve[*Config](context.Background(), app.Container())
+	if err != nil || cfg != app.Config {
+		t.Errorf("Resolve config = %p, %v, want the app config", cfg, err)
+	}
+	if _, err := Resolve[Logger](context.Background(), app.Container()); err != nil {
+		t.Errorf("Resolve logger: %v", err)
+	}
+}
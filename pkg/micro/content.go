@@ -0,0 +1,66 @@
+package micro
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServeContent serves content, such as a stored file, with support for
+// range and conditional requests (If-Modified-Since, If-None-Match,
+// If-Range). The Content-Type comes from the extension of name or is
+// sniffed from the content, and the ETag is derived from the size and
+// modtime unless the handler set one. Errors such as an unsatisfiable range
+// are written like other API errors. Errors found before anything is
+// written are returned for the handler to pass on.
+func (a *App) ServeContent(w http.ResponseWriter, r *http.Request, name string, modtime time.Time, content io.ReadSeeker) error {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("serve %s: %w", name, err)
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("serve %s: %w", name, err)
+	}
+
+	if w.Header().Get("ETag") == "" {
+		w.Header().Set("ETag", `"`+strconv.FormatInt(size, 36)+"-"+strconv.FormatInt(modtime.UnixNano(), 36)+`"`)
+	}
+
+	ew := &contentErrorWriter{ResponseWriter: w, app: a, r: r}
+	http.ServeContent(ew, r, name, modtime, content)
+	return nil
+}
+
+// contentErrorWriter replaces the plain text error responses of
+// http.ServeContent with the app's error format
+type contentErrorWriter struct {
+	http.ResponseWriter
+	app      *App
+	r        *http.Request
+	replaced bool
+}
+
+func (w *contentErrorWriter) WriteHeader(code int) {
+	if code >= http.StatusBadRequest && !w.replaced {
+		w.replaced = true
+		w.ResponseWriter.Header().Del("Content-Length")
+		w.app.handleError(w.ResponseWriter, w.r, NewAPIError(code, strings.ToLower(http.StatusText(code))))
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *contentErrorWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *contentErrorWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,150 @@
+package micro
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var contentModTime = time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+// pngHeader is the signature content sniffing recognizes as PNG
+const pngHeader = "\x89PNG\r\n\x1a\n"
+
+// newContentApp serves fixed files through ServeContent; "tagged.txt" has
+// an ETag set by the handler
+func newContentApp(t *testing.T) http.Handler {
+	t.Helper()
+	files := map[string]string{
+		"hello.txt":  "hello, world",
+		"image":      pngHeader + "rest of the image",
+		"tagged.txt": "tagged",
+	}
+	app := newTestApp(t)
+	app.GET("/files/{name}", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		name := app.URLParam(r, "name")
+		if name == "tagged.txt" {
+			w.Header().Set("ETag", `"v1"`)
+		}
+		return app.ServeContent(w, r, name, contentModTime, strings.NewReader(files[name]))
+	})
+	return app.Handler()
+}
+
+func contentRequest(path string, header http.Header) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	return r
+}
+
+func TestServeContent(t *testing.T) {
+	h := newContentApp(t)
+
+	w := serve(h, contentRequest("/files/hello.txt", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "hello, world" {
+		t.Fatalf("response = %d %q", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Last-Modified"); got != contentModTime.Format(http.TimeFormat) {
+		t.Errorf("Last-Modified = %q", got)
+	}
+	if got := w.Header().Get("ETag"); got == "" {
+		t.Error("no ETag was derived")
+	}
+	if got := w.Header().Get("Accept-Ranges"); got != "bytes" {
+		t.Errorf("Accept-Ranges = %q, want bytes", got)
+	}
+}
+
+func TestServeContentType(t *testing.T) {
+	h := newContentApp(t)
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"from extension", "/files/hello.txt", "text/plain; charset=utf-8"},
+		{"sniffed", "/files/image", "image/png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(h, contentRequest(tt.path, nil))
+			if got := w.Header().Get("Content-Type"); got != tt.want {
+				t.Errorf("Content-Type = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeContentRange(t *testing.T) {
+	h := newContentApp(t)
+
+	w := serve(h, contentRequest("/files/hello.txt", http.Header{"Range": {"bytes=0-4"}}))
+	if w.Code != http.StatusPartialContent || w.Body.String() != "hello" {
+		t.Fatalf("range response = %d %q, want 206 hello", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Range"); got != "bytes 0-4/12" {
+		t.Errorf("Content-Range = %q, want bytes 0-4/12", got)
+	}
+
+	// An unsatisfiable range is reported in the app's error format
+	w = serve(h, contentRequest("/files/hello.txt", http.Header{"Range": {"bytes=100-200"}}))
+	if w.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("unsatisfiable range status = %d, want %d", w.Code, http.StatusRequestedRangeNotSatisfiable)
+	}
+	body := decodeBody(t, w)
+	if body["message"] != "requested range not satisfiable" {
+		t.Errorf("error body = %v", body)
+	}
+
+	// If-Range with a stale validator serves the whole content
+	w = serve(h, contentRequest("/files/hello.txt", http.Header{
+		"Range":    {"bytes=0-4"},
+		"If-Range": {`"stale"`},
+	}))
+	if w.Code != http.StatusOK || w.Body.String() != "hello, world" {
+		t.Errorf("stale If-Range response = %d %q, want the full content", w.Code, w.Body.String())
+	}
+}
+
+func TestServeContentConditional(t *testing.T) {
+	h := newContentApp(t)
+
+	tests := []struct {
+		name   string
+		path   string
+		header http.Header
+		status int
+	}{
+		{"not modified since", "/files/hello.txt", http.Header{
+			"If-Modified-Since": {contentModTime.Format(http.TimeFormat)},
+		}, http.StatusNotModified},
+		{"modified since", "/files/hello.txt", http.Header{
+			"If-Modified-Since": {contentModTime.Add(-time.Hour).Format(http.TimeFormat)},
+		}, http.StatusOK},
+		{"handler ETag matches", "/files/tagged.txt", http.Header{"If-None-Match": {`"v1"`}}, http.StatusNotModified},
+		{"handler ETag differs", "/files/tagged.txt", http.Header{"If-None-Match": {`"v0"`}}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(h, contentRequest(tt.path, tt.header))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("304 has a body: %q", w.Body.String())
+			}
+		})
+	}
+
+	// The derived ETag revalidates too
+	etag := serve(h, contentRequest("/files/hello.txt", nil)).Header().Get("ETag")
+	if w := serve(h, contentRequest("/files/hello.txt", http.Header{"If-None-Match": {etag}})); w.Code != http.StatusNotModified {
+		t.Errorf("derived ETag status = %d, want %d", w.Code, http.StatusNotModified)
+	}
+}
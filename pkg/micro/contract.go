@@ -0,0 +1,251 @@
+package micro
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// updateContracts rewrites golden files instead of comparing against them.
+// It is only registered in test binaries, e.g. go test ./... -update-contracts.
+var updateContracts = new(bool)
+
+func init() {
+	if testing.Testing() {
+		flag.BoolVar(updateContracts, "update-contracts", false, "rewrite contract golden files")
+	}
+}
+
+// VolatileFields are JSON keys, at any depth, whose values ContractTest
+// masks before comparing response bodies
+var VolatileFields = []string{"request_id", "created_at", "updated_at", "timestamp"}
+
+// ContractCase is one request and the response it must produce
+type ContractCase struct {
+	Name    string
+	Method  string
+	Path    string
+	Headers map[string]string
+	Body    interface{} // Sent as is when a string or []byte, JSON-encoded otherwise
+
+	Status          int               // Expected status code
+	ResponseHeaders map[string]string // Expected header values
+	Golden          string            // Golden file under testdata/contracts; defaults to the name
+	Ignore          []string          // Keys masked in addition to VolatileFields
+}
+
+// ContractTest runs each case against handler, usually App.Handler, as a
+// subtest. The status and headers must match, and the JSON body must match
+// the case's golden file structurally once volatile fields are masked. Run
+// the tests with -update-contracts to write the golden files.
+func ContractTest(t *testing.T, handler http.Handler, cases []ContractCase) {
+	t.Helper()
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			runContractCase(t, handler, tc)
+		})
+	}
+}
+
+func runContractCase(t *testing.T, handler http.Handler, tc ContractCase) {
+	t.Helper()
+
+	body, err := contractBody(tc.Body)
+	if err != nil {
+		t.Fatalf("encode request body: %v", err)
+	}
+	method := tc.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req := httptest.NewRequest(method, tc.Path, body)
+	if tc.Body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range tc.Headers {
+		req.Header.Set(k, v)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if tc.Status != 0 && rec.Code != tc.Status {
+		t.Errorf("status = %d, want %d", rec.Code, tc.Status)
+	}
+	for k, want := range tc.ResponseHeaders {
+		if got := rec.Header().Get(k); got != want {
+			t.Errorf("header %s = %q, want %q", k, got, want)
+		}
+	}
+
+	ignore := append(append([]string(nil), VolatileFields...), tc.Ignore...)
+	got, err := normalizeContractJSON(rec.Body.Bytes(), ignore)
+	if err != nil {
+		t.Fatalf("response body is not JSON: %v\n%s", err, rec.Body.String())
+	}
+
+	golden := filepath.Join("testdata", "contracts", goldenName(tc))
+	if *updateContracts {
+		if err := writeGolden(golden, got); err != nil {
+			t.Fatalf("write golden file: %v", err)
+		}
+		return
+	}
+
+	data, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("read golden file (run with -update-contracts to create it): %v", err)
+	}
+	var want interface{}
+	if err := json.Unmarshal(data, &want); err != nil {
+		t.Fatalf("golden file %s is not JSON: %v", golden, err)
+	}
+	if diffs := diffJSON("$", got, want); len(diffs) > 0 {
+		t.Errorf("response body does not match %s:\n%s", golden, strings.Join(diffs, "\n"))
+	}
+}
+
+func contractBody(body interface{}) (io.Reader, error) {
+	switch b := body.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return strings.NewReader(b), nil
+	case []byte:
+		return bytes.NewReader(b), nil
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(data), nil
+	}
+}
+
+var goldenNameChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+func goldenName(tc ContractCase) string {
+	if tc.Golden != "" {
+		return tc.Golden
+	}
+	return strings.Trim(goldenNameChars.ReplaceAllString(tc.Name, "_"), "_") + ".json"
+}
+
+// normalizeContractJSON decodes body, with an empty body as null, and
+// masks the values of the ignored keys
+func normalizeContractJSON(body []byte, ignore []string) (interface{}, error) {
+	var v interface{}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &v); err != nil {
+			return nil, err
+		}
+	}
+	return maskJSON(v, ignore), nil
+}
+
+func maskJSON(v interface{}, ignore []string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if contains(ignore, k) {
+				v[k] = "<ignored>"
+				continue
+			}
+			v[k] = maskJSON(child, ignore)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = maskJSON(child, ignore)
+		}
+	}
+	return v
+}
+
+func writeGolden(path string, v interface{}) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// diffJSON lists the differences between two decoded JSON values by path
+func diffJSON(path string, got, want interface{}) []string {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make(map[string]struct{}, len(w)+len(g))
+		for k := range w {
+			keys[k] = struct{}{}
+		}
+		for k := range g {
+			keys[k] = struct{}{}
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		var diffs []string
+		for _, k := range sorted {
+			gv, inGot := g[k]
+			wv, inWant := w[k]
+			switch {
+			case !inGot:
+				diffs = append(diffs, fmt.Sprintf("%s.%s: missing", path, k))
+			case !inWant:
+				diffs = append(diffs, fmt.Sprintf("%s.%s: unexpected %s", path, k, compactJSON(gv)))
+			default:
+				diffs = append(diffs, diffJSON(path+"."+k, gv, wv)...)
+			}
+		}
+		return diffs
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok {
+			break
+		}
+		if len(g) != len(w) {
+			return []string{fmt.Sprintf("%s: got %d elements, want %d", path, len(g), len(w))}
+		}
+		var diffs []string
+		for i := range w {
+			diffs = append(diffs, diffJSON(fmt.Sprintf("%s[%d]", path, i), g[i], w[i])...)
+		}
+		return diffs
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		return []string{fmt.Sprintf("%s: got %s, want %s", path, compactJSON(got), compactJSON(want))}
+	}
+	return nil
+}
+
+func compactJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
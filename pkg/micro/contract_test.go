@@ -0,0 +1,117 @@
+package micro
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		got, want string
+		diffs     []string
+	}{
+		{"equal", `{"a":1,"b":[1,{"c":true}]}`, `{"b":[1,{"c":true}],"a":1}`, nil},
+		{"changed value", `{"a":{"b":2}}`, `{"a":{"b":1}}`, []string{"$.a.b: got 2, want 1"}},
+		{"missing and unexpected", `{"a":1,"x":"y"}`, `{"a":1,"b":2}`, []string{"$.b: missing", `$.x: unexpected "y"`}},
+		{"array length", `[1,2,3]`, `[1,2]`, []string{"$: got 3 elements, want 2"}},
+		{"array element", `[{"id":1},{"id":3}]`, `[{"id":1},{"id":2}]`, []string{"$[1].id: got 3, want 2"}},
+		{"type change", `{"a":[1]}`, `{"a":{"b":1}}`, []string{`$.a: got [1], want {"b":1}`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got, want interface{}
+			json.Unmarshal([]byte(tt.got), &got)
+			json.Unmarshal([]byte(tt.want), &want)
+			if diffs := diffJSON("$", got, want); !reflect.DeepEqual(diffs, tt.diffs) {
+				t.Errorf("diffs = %q, want %q", diffs, tt.diffs)
+			}
+		})
+	}
+}
+
+func TestNormalizeContractJSONMasksVolatileFields(t *testing.T) {
+	body := `{"id":1,"request_id":"abc","items":[{"created_at":"2024-01-01","name":"a"}],"etag":"x"}`
+	got, err := normalizeContractJSON([]byte(body), append(VolatileFields, "etag"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"id":         1.0,
+		"request_id": "<ignored>",
+		"items":      []interface{}{map[string]interface{}{"created_at": "<ignored>", "name": "a"}},
+		"etag":       "<ignored>",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("normalized = %v, want %v", got, want)
+	}
+
+	if got, err := normalizeContractJSON([]byte("  "), nil); err != nil || got != nil {
+		t.Errorf("empty body = %v, %v, want null", got, err)
+	}
+	if _, err := normalizeContractJSON([]byte("<html>"), nil); err == nil {
+		t.Error("non-JSON body accepted")
+	}
+}
+
+func TestGoldenName(t *testing.T) {
+	tests := []struct {
+		tc   ContractCase
+		want string
+	}{
+		{ContractCase{Name: "get user"}, "get_user.json"},
+		{ContractCase{Name: "POST /users (invalid)"}, "POST_users_invalid.json"},
+		{ContractCase{Name: "x", Golden: "custom.golden"}, "custom.golden"},
+	}
+	for _, tt := range tests {
+		if got := goldenName(tt.tc); got != tt.want {
+			t.Errorf("goldenName(%q) = %q, want %q", tt.tc.Name, got, tt.want)
+		}
+	}
+}
+
+func TestContractTestUpdateFlow(t *testing.T) {
+	t.Chdir(t.TempDir())
+	app := newTestApp(t)
+	app.POST("/echo", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		var v struct {
+			Name      string   `json:"name"`
+			Tags      []string `json:"tags"`
+			RequestID string   `json:"request_id"`
+		}
+		if err := app.Decode(r, &v); err != nil {
+			return err
+		}
+		v.RequestID, _ = r.Context().Value(contextKeyRequestID).(string)
+		return app.JSON(w, http.StatusCreated, v)
+	})
+	cases := []ContractCase{{
+		Name:   "echo",
+		Method: http.MethodPost,
+		Path:   "/echo",
+		Body:   map[string]interface{}{"name": "Ada", "tags": []string{"a"}},
+		Status: http.StatusCreated,
+	}}
+
+	// The first run writes the golden file, the request ID masked
+	*updateContracts = true
+	ContractTest(t, app.Handler(), cases)
+	*updateContracts = false
+
+	data, err := os.ReadFile(filepath.Join("testdata", "contracts", "echo.json"))
+	if err != nil {
+		t.Fatalf("golden file not written: %v", err)
+	}
+	if !strings.Contains(string(data), `"request_id": "<ignored>"`) || !strings.Contains(string(data), `"name": "Ada"`) {
+		t.Errorf("golden file = %s", data)
+	}
+
+	// Later runs compare against it even though the request ID changes
+	ContractTest(t, app.Handler(), cases)
+}
@@ -0,0 +1,257 @@
+package micro
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+)
+
+// corsOptions converts a CORSConfig to gorilla CORS options
+func corsOptions(cfg CORSConfig) []handlers.CORSOption {
+	opts := []handlers.CORSOption{}
+	if len(cfg.AllowedOrigins) > 0 {
+		opts = append(opts, handlers.AllowedOrigins(cfg.AllowedOrigins))
+	}
+	if len(cfg.AllowedMethods) > 0 {
+		opts = append(opts, handlers.AllowedMethods(cfg.AllowedMethods))
+	}
+	if len(cfg.AllowedHeaders) > 0 {
+		opts = append(opts, handlers.AllowedHeaders(cfg.AllowedHeaders))
+	}
+	if len(cfg.ExposedHeaders) > 0 {
+		opts = append(opts, handlers.ExposedHeaders(cfg.ExposedHeaders))
+	}
+	if cfg.AllowCredentials {
+		opts = append(opts, handlers.AllowCredentials())
+	}
+	if cfg.MaxAge > 0 {
+		opts = append(opts, handlers.MaxAge(cfg.MaxAge))
+	}
+	return opts
+}
+
+// validate rejects credentials for a wildcard origin, which browsers refuse
+func (cfg CORSConfig) validate() error {
+	if cfg.AllowCredentials && contains(cfg.AllowedOrigins, "*") {
+		return errors.New("CORS_ALLOW_CREDENTIALS cannot be combined with CORS_ALLOWED_ORIGINS=*: list the allowed origins explicitly")
+	}
+	return nil
+}
+
+// CORS applies a CORS policy to the group and its nested groups, replacing
+// the app policy for their routes, including preflight requests. Like the
+// app policy, credentials with a wildcard origin are rejected: it panics,
+// as the policy is fixed at startup.
+func (g *RouterGroup) CORS(cfg CORSConfig) *RouterGroup {
+	if err := cfg.validate(); err != nil {
+		panic(fmt.Sprintf("CORS policy of group %q: %v", g.prefix, err))
+	}
+	g.cors = &cfg
+	return g.WithMiddleware(handlers.CORS(corsOptions(cfg)...))
+}
+
+// pathFallback sends requests mux reports as not found to methodFallback
+// when a route serves their path with another method. mux 1.8 loses the
+// method mismatch inside a group that also has routes on other paths.
+func (a *App) pathFallback(notFound, methodFallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, allowed := a.requestMethods(r)
+		if len(allowed.methods) > 0 {
+			methodFallback.ServeHTTP(w, r)
+			return
+		}
+		notFound.ServeHTTP(w, r)
+	})
+}
+
+// methodFallback answers requests whose path matched a route but whose
+// method did not. OPTIONS gets an automatic 204 with an Allow header listing
+// the methods registered for the path, whether or not CORS is enabled, and
+// CORS preflight is handled with the policy of the route's group; HEAD is
+// served by the GET route. Anything else is a 405, also with Allow.
+func (a *App) methodFallback(notAllowed http.Handler) http.Handler {
+	options := a.wrapMiddleware(http.HandlerFunc(a.optionsHandler))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, allowed := a.requestMethods(r)
+		switch r.Method {
+		case http.MethodOptions:
+			options.ServeHTTP(w, r)
+			return
+		case http.MethodHead:
+			if contains(allowed.methods, http.MethodGet) {
+				get := r.Clone(r.Context())
+				get.Method = http.MethodGet
+				a.Router.ServeHTTP(w, get)
+				return
+			}
+		}
+		w.Header().Set("Allow", strings.Join(append(allowed.methods, http.MethodOptions), ", "))
+		notAllowed.ServeHTTP(w, r)
+	})
+}
+
+func (a *App) optionsHandler(w http.ResponseWriter, r *http.Request) {
+	_, allowed := a.requestMethods(r)
+	methods, cors := allowed.methods, allowed.cors
+	allow := strings.Join(append(methods, http.MethodOptions), ", ")
+	w.Header().Set("Allow", allow)
+
+	origin := r.Header.Get("Origin")
+	requested := r.Header.Get("Access-Control-Request-Method")
+	if origin == "" || requested == "" || cors == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// A policy listing methods narrows those registered for the path
+	methodAllowed := contains(methods, requested) &&
+		(len(cors.AllowedMethods) == 0 || contains(cors.AllowedMethods, requested))
+	if !originAllowed(cors.AllowedOrigins, origin) || !methodAllowed ||
+		!headersAllowed(cors.AllowedHeaders, r.Header.Get("Access-Control-Request-Headers")) {
+		a.handleError(w, r, NewAPIError(http.StatusForbidden, "CORS preflight rejected"))
+		return
+	}
+
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	if contains(cors.AllowedOrigins, "*") && !cors.AllowCredentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	h.Set("Access-Control-Allow-Methods", allow)
+	if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+		h.Set("Access-Control-Allow-Headers", reqHeaders)
+	}
+	if cors.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if cors.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(cors.MaxAge))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// methodRoute is a route with the methods it serves and its group's CORS
+// policy
+type methodRoute struct {
+	route   *mux.Route
+	methods []string
+	cors    *CORSConfig
+}
+
+// collectMethodRoutes lists the routes restricted to methods once, so
+// unmatched requests do not walk the router
+func (a *App) collectMethodRoutes() {
+	a.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil || route.GetHandler() == nil {
+			return nil
+		}
+		mr := methodRoute{route: route, methods: methods}
+		if cfg := a.routeConfigs[route]; cfg != nil {
+			mr.cors = cfg.cors
+		}
+		a.methodRoutes = append(a.methodRoutes, mr)
+		return nil
+	})
+}
+
+// allowedRoute is the result of allowedMethods for a request
+type allowedRoute struct {
+	methods []string
+	cors    *CORSConfig
+}
+
+// requestMethods returns allowedMethods for r, computed once per request:
+// the result is kept in the context of the returned request for the
+// fallback handlers it is passed on to
+func (a *App) requestMethods(r *http.Request) (*http.Request, *allowedRoute) {
+	if allowed, ok := r.Context().Value(contextKeyMethods).(*allowedRoute); ok {
+		return r, allowed
+	}
+	methods, cors := a.allowedMethods(r)
+	allowed := &allowedRoute{methods: methods, cors: cors}
+	return r.WithContext(context.WithValue(r.Context(), contextKeyMethods, allowed)), allowed
+}
+
+// allowedMethods returns the methods registered for the request path and
+// the CORS policy that applies to them: the first group policy found, else
+// the app policy when enabled
+func (a *App) allowedMethods(r *http.Request) ([]string, *CORSConfig) {
+	var methods []string
+	var cors *CORSConfig
+
+	var match mux.RouteMatch
+	for _, mr := range a.methodRoutes {
+		// A route matching everything but the method reports
+		// ErrMethodMismatch, so one match covers all of its methods
+		match = mux.RouteMatch{}
+		if !mr.route.Match(r, &match) && !errors.Is(match.MatchErr, mux.ErrMethodMismatch) {
+			continue
+		}
+		for _, m := range mr.methods {
+			if !contains(methods, m) {
+				methods = append(methods, m)
+			}
+		}
+		if cors == nil && mr.cors != nil {
+			cors = mr.cors
+		}
+	}
+
+	if contains(methods, http.MethodGet) && !contains(methods, http.MethodHead) {
+		methods = append(methods, http.MethodHead)
+	}
+	if cors == nil && a.Config.CORS.Enabled {
+		cors = &a.Config.CORS
+	}
+	return methods, cors
+}
+
+func originAllowed(allowed []string, origin string) bool {
+	for _, o := range allowed {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func headersAllowed(allowed []string, requested string) bool {
+	if requested == "" || contains(allowed, "*") {
+		return true
+	}
+	for _, h := range strings.Split(requested, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		found := false
+		for _, a := range allowed {
+			if strings.EqualFold(a, h) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
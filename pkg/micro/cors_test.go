@@ -0,0 +1,207 @@
+package micro
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newCORSApp registers a nested admin group whose policy differs from the
+// app policy, with a non-default set of methods
+func newCORSApp(t *testing.T) http.Handler {
+	t.Helper()
+	app := newTestApp(t, func(c *Config) {
+		c.CORS = CORSConfig{Enabled: true, AllowedOrigins: []string{"https://app.example"}}
+	})
+	app.GET("/users", okHandler)
+
+	admin := app.Group("/admin").CORS(CORSConfig{
+		AllowedOrigins: []string{"https://admin.example"},
+		AllowedMethods: []string{http.MethodGet, http.MethodPatch, http.MethodPut},
+		AllowedHeaders: []string{"Content-Type", "X-Admin-Token"},
+		MaxAge:         600,
+	})
+	// The nested group inherits the admin policy
+	users := admin.Group("/users")
+	users.HandleMethod(http.MethodPatch, "/{id}", okHandler)
+	users.HandleMethod(http.MethodPut, "/{id}", okHandler)
+	users.HandleMethod(http.MethodDelete, "/{id}", okHandler)
+	return app.Handler()
+}
+
+func preflight(path, origin, method, headers string) *http.Request {
+	r := httptest.NewRequest(http.MethodOptions, path, nil)
+	r.Header.Set("Origin", origin)
+	r.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		r.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	return r
+}
+
+func TestNestedGroupPreflight(t *testing.T) {
+	h := newCORSApp(t)
+
+	tests := []struct {
+		name    string
+		origin  string
+		method  string
+		headers string
+		status  int
+	}{
+		{"group method", "https://admin.example", http.MethodPatch, "X-Admin-Token", http.StatusNoContent},
+		{"app origin rejected by group", "https://app.example", http.MethodPatch, "", http.StatusForbidden},
+		// DELETE is registered but not in the group policy
+		{"method outside policy", "https://admin.example", http.MethodDelete, "", http.StatusForbidden},
+		{"unregistered method", "https://admin.example", http.MethodGet, "", http.StatusForbidden},
+		{"header outside policy", "https://admin.example", http.MethodPut, "X-Other", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(h, preflight("/admin/users/7", tt.origin, tt.method, tt.headers))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status != http.StatusNoContent {
+				return
+			}
+			hdr := w.Header()
+			if got := hdr.Get("Access-Control-Allow-Origin"); got != tt.origin {
+				t.Errorf("Allow-Origin = %q, want %q", got, tt.origin)
+			}
+			if got := hdr.Get("Access-Control-Allow-Methods"); !strings.Contains(got, tt.method) {
+				t.Errorf("Allow-Methods = %q, want it to include %s", got, tt.method)
+			}
+			if hdr.Get("Access-Control-Allow-Headers") != tt.headers || hdr.Get("Access-Control-Max-Age") != "600" {
+				t.Errorf("headers = %v", hdr)
+			}
+		})
+	}
+}
+
+func TestAppPolicyPreflight(t *testing.T) {
+	h := newCORSApp(t)
+
+	w := serve(h, preflight("/users", "https://app.example", http.MethodGet, ""))
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example" {
+		t.Errorf("app preflight = %d %v", w.Code, w.Header())
+	}
+	if w := serve(h, preflight("/users", "https://admin.example", http.MethodGet, "")); w.Code != http.StatusForbidden {
+		t.Errorf("group origin on app route status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestAutomaticOptionsAndHead(t *testing.T) {
+	h := newCORSApp(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		allow  string
+	}{
+		// Plain OPTIONS without CORS headers lists the path's methods
+		{"options", http.MethodOptions, "/admin/users/7", http.StatusNoContent, "PATCH, PUT, DELETE, OPTIONS"},
+		{"options with GET", http.MethodOptions, "/users", http.StatusNoContent, "GET, HEAD, OPTIONS"},
+		{"head served by GET", http.MethodHead, "/users", http.StatusOK, ""},
+		{"method not allowed", http.MethodPost, "/admin/users/7", http.StatusMethodNotAllowed, "PATCH, PUT, DELETE, OPTIONS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(h, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("Allow"); got != tt.allow {
+				t.Errorf("Allow = %q, want %q", got, tt.allow)
+			}
+		})
+	}
+}
+
+func TestGroupCORSRejectsCredentialsWithWildcardOrigin(t *testing.T) {
+	app := newTestApp(t)
+	defer func() {
+		if recover() == nil {
+			t.Error("CORS with credentials and a wildcard origin did not panic")
+		}
+	}()
+	app.Group("/admin").CORS(CORSConfig{
+		AllowedOrigins:   []string{"*"},
+		AllowCredentials: true,
+	})
+}
+
+func TestAllowHeaderWithAndWithoutCORS(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		t.Run(fmt.Sprintf("cors enabled %v", enabled), func(t *testing.T) {
+			app := newTestApp(t, func(c *Config) {
+				c.CORS = CORSConfig{Enabled: enabled, AllowedOrigins: []string{"https://app.example"}}
+			})
+			app.GET("/items", okHandler)
+			app.POST("/items", okHandler)
+			app.DELETE("/items/{id}", okHandler)
+			h := app.Handler()
+
+			tests := []struct {
+				name   string
+				method string
+				path   string
+				status int
+				allow  string
+			}{
+				{"options", http.MethodOptions, "/items", http.StatusNoContent, "GET, POST, HEAD, OPTIONS"},
+				{"options without GET", http.MethodOptions, "/items/7", http.StatusNoContent, "DELETE, OPTIONS"},
+				{"method not allowed", http.MethodPut, "/items", http.StatusMethodNotAllowed, "GET, POST, HEAD, OPTIONS"},
+				{"method not allowed without GET", http.MethodGet, "/items/7", http.StatusMethodNotAllowed, "DELETE, OPTIONS"},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					w := serve(h, httptest.NewRequest(tt.method, tt.path, nil))
+					if w.Code != tt.status {
+						t.Fatalf("status = %d, want %d", w.Code, tt.status)
+					}
+					if got := w.Header().Get("Allow"); got != tt.allow {
+						t.Errorf("Allow = %q, want %q", got, tt.allow)
+					}
+				})
+			}
+
+			// A preflight only gets CORS headers when CORS is enabled
+			w := serve(h, preflight("/items", "https://app.example", http.MethodPost, ""))
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("preflight status = %d, want %d", w.Code, http.StatusNoContent)
+			}
+			if got := w.Header().Get("Allow"); got != "GET, POST, HEAD, OPTIONS" {
+				t.Errorf("preflight Allow = %q", got)
+			}
+			want := ""
+			if enabled {
+				want = "https://app.example"
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != want {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestAllowedMethodsCostDoesNotGrowWithRoutes(t *testing.T) {
+	allocs := func(routes int) float64 {
+		app := newTestApp(t)
+		for i := range routes {
+			app.GET(fmt.Sprintf("/items%d/{id}", i), okHandler)
+		}
+		app.Handler()
+		r := httptest.NewRequest(http.MethodGet, "/missing", nil)
+		return testing.AllocsPerRun(100, func() { app.allowedMethods(r) })
+	}
+	// Unmatched requests are checked against the routes collected at
+	// startup, without copying the request per route
+	if few, many := allocs(2), allocs(200); many > few {
+		t.Errorf("allowedMethods allocates %v times with 200 routes, %v with 2", many, few)
+	}
+}
@@ -0,0 +1,114 @@
+package micro
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/sync/singleflight"
+)
+
+// DedupOptions configures the duplicate submission middleware
+type DedupOptions struct {
+	TTL          time.Duration // How long a response is replayed; defaults to 10s
+	MaxEntries   int           // Used by the default in-memory store; defaults to 1000
+	MaxBodyBytes int64         // Larger bodies are not deduplicated; defaults to 1MiB
+	Store        CacheStore    // Defaults to an in-memory LRU store
+}
+
+// DedupMiddleware replays the response to an identical request received
+// within TTL, for forms that resubmit on refresh or double clicks. Unlike
+// an idempotency key, the key is inferred from the method, path, query,
+// credentials (Authorization and Cookie headers) and a hash of the body.
+// Concurrent duplicates wait for the first one. Replays carry
+// X-Deduplicated: true; 5xx responses are not kept, so those requests can
+// be retried. Apply it per route with Route.Use.
+func (a *App) DedupMiddleware(opts DedupOptions) mux.MiddlewareFunc {
+	if opts.TTL <= 0 {
+		opts.TTL = 10 * time.Second
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = 1000
+	}
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = 1 << 20
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryCacheStore(opts.MaxEntries)
+	}
+	var group singleflight.Group
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(io.LimitReader(r.Body, opts.MaxBodyBytes+1))
+			if err != nil {
+				a.handleError(w, r, NewAPIError(http.StatusBadRequest, "failed to read request body"))
+				return
+			}
+			if int64(len(body)) > opts.MaxBodyBytes {
+				// Too large to hash cheaply; hand over the whole body
+				r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+				next.ServeHTTP(w, r)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			key := dedupKey(r, body)
+			if cached, ok := opts.Store.Get(r.Context(), key); ok {
+				writeDeduplicated(w, cached)
+				return
+			}
+
+			leader := false
+			v, _, _ := group.Do(key, func() (interface{}, error) {
+				leader = true
+				rec := &cacheRecorder{ResponseWriter: w, status: http.StatusOK}
+				next.ServeHTTP(rec, r)
+				if rec.header == nil {
+					rec.header = w.Header().Clone()
+				}
+				resp := &CachedResponse{
+					Status: rec.status,
+					Header: rec.header,
+					Body:   rec.body.Bytes(),
+				}
+				if resp.Status < http.StatusInternalServerError {
+					opts.Store.Set(r.Context(), key, resp, opts.TTL)
+				}
+				return resp, nil
+			})
+			if !leader {
+				writeDeduplicated(w, v.(*CachedResponse))
+			}
+		})
+	}
+}
+
+func dedupKey(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+cacheKey(r, []string{"Authorization", "Cookie"})+"\n")
+	h.Write(body)
+	return "dedup:" + hex.EncodeToString(h.Sum(nil))
+}
+
+func writeDeduplicated(w http.ResponseWriter, resp *CachedResponse) {
+	// Keep headers set by outer middleware, such as the request ID
+	for k, v := range resp.Header {
+		if _, exists := w.Header()[k]; !exists {
+			w.Header()[k] = v
+		}
+	}
+	w.Header().Set("X-Deduplicated", "true")
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+// readCloser reads from a replacement reader but closes the original body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
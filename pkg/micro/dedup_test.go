@@ -0,0 +1,149 @@
+package micro
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newDedupApp mounts a create handler behind DedupMiddleware that answers
+// with a fresh order number per call, so replays are recognisable
+func newDedupApp(t *testing.T, opts DedupOptions, status int) (http.Handler, *atomic.Int32) {
+	t.Helper()
+	app := newTestApp(t)
+	var calls atomic.Int32
+	app.POST("/orders", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		body, _ := io.ReadAll(r.Body)
+		n := calls.Add(1)
+		w.WriteHeader(status)
+		_, err := fmt.Fprintf(w, "order %d for %d bytes", n, len(body))
+		return err
+	}).Use(app.DedupMiddleware(opts))
+	return app.Handler(), &calls
+}
+
+func postOrder(h http.Handler, body, auth string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	if auth != "" {
+		r.Header.Set("Authorization", auth)
+	}
+	return serve(h, r)
+}
+
+func TestDedupMiddleware(t *testing.T) {
+	h, calls := newDedupApp(t, DedupOptions{}, http.StatusCreated)
+
+	first := postOrder(h, `{"item":"book"}`, "")
+	second := postOrder(h, `{"item":"book"}`, "")
+	if calls.Load() != 1 {
+		t.Fatalf("handler called %d times for a duplicate", calls.Load())
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+		t.Errorf("replay = %d %q, want %d %q", second.Code, second.Body, first.Code, first.Body)
+	}
+	if first.Header().Get("X-Deduplicated") != "" || second.Header().Get("X-Deduplicated") != "true" {
+		t.Error("X-Deduplicated should only mark the replay")
+	}
+	// The replay keeps its own request ID
+	if second.Header().Get("X-Request-ID") == first.Header().Get("X-Request-ID") {
+		t.Error("replay reused the original request ID")
+	}
+
+	// Distinct bodies and callers are distinct requests
+	postOrder(h, `{"item":"pen"}`, "")
+	postOrder(h, `{"item":"book"}`, "Bearer other-user")
+	if n := calls.Load(); n != 3 {
+		t.Errorf("handler called %d times, want 3", n)
+	}
+}
+
+func TestDedupMiddlewareExpiry(t *testing.T) {
+	h, calls := newDedupApp(t, DedupOptions{TTL: 20 * time.Millisecond}, http.StatusCreated)
+	postOrder(h, "same", "")
+	time.Sleep(40 * time.Millisecond)
+	if w := postOrder(h, "same", ""); w.Header().Get("X-Deduplicated") != "" || calls.Load() != 2 {
+		t.Errorf("request after the TTL was replayed")
+	}
+}
+
+func TestDedupMiddlewareSkipsServerErrors(t *testing.T) {
+	h, calls := newDedupApp(t, DedupOptions{}, http.StatusBadGateway)
+	postOrder(h, "same", "")
+	postOrder(h, "same", "")
+	if n := calls.Load(); n != 2 {
+		t.Errorf("handler called %d times, want a retry after a 5xx", n)
+	}
+}
+
+func TestDedupMiddlewareLargeBodies(t *testing.T) {
+	h, calls := newDedupApp(t, DedupOptions{MaxBodyBytes: 8}, http.StatusCreated)
+	body := strings.Repeat("x", 100)
+	w := postOrder(h, body, "")
+	postOrder(h, body, "")
+	if n := calls.Load(); n != 2 {
+		t.Errorf("handler called %d times, want large bodies passed through", n)
+	}
+	// The handler still reads the whole body
+	if !strings.HasSuffix(w.Body.String(), "for 100 bytes") {
+		t.Errorf("response = %q", w.Body)
+	}
+}
+
+func TestDedupMiddlewareCoalescesConcurrentDuplicates(t *testing.T) {
+	app := newTestApp(t)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	app.POST("/orders", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		calls.Add(1)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+		return nil
+	}).Use(app.DedupMiddleware(DedupOptions{}))
+	h := app.Handler()
+
+	var wg sync.WaitGroup
+	codes := make([]int, 5)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = postOrder(h, "same", "").Code
+		}()
+	}
+	for deadline := time.Now().Add(5 * time.Second); calls.Load() == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("handler not called")
+		}
+	}
+	time.Sleep(20 * time.Millisecond) // Let the duplicates queue up
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("handler called %d times for concurrent duplicates", n)
+	}
+	for i, code := range codes {
+		if code != http.StatusCreated {
+			t.Errorf("request %d: status = %d", i, code)
+		}
+	}
+}
+
+func TestDedupMiddlewareBoundedMemory(t *testing.T) {
+	h, calls := newDedupApp(t, DedupOptions{MaxEntries: 2}, http.StatusCreated)
+	for _, body := range []string{"a", "b", "c"} {
+		postOrder(h, body, "")
+	}
+	// "a" was evicted to make room for "c"
+	postOrder(h, "a", "")
+	if n := calls.Load(); n != 4 {
+		t.Errorf("handler called %d times, want the oldest entry evicted", n)
+	}
+}
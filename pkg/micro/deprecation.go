@@ -0,0 +1,38 @@
+package micro
+
+import (
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Deprecated marks a route as deprecated. Responses carry the Deprecation
+// and Sunset headers, plus a Link to migration docs when link is set, and
+// each call is logged and counted in deprecated_requests_total so remaining
+// callers can be tracked before the route is removed. A zero sunset omits
+// the Sunset header.
+func Deprecated(sunset time.Time, link string) RouteOption {
+	return func(rt *Route) {
+		route := rt.route
+		rt.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Deprecation", "true")
+				if !sunset.IsZero() {
+					w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+				}
+				if link != "" {
+					w.Header().Add("Link", "<"+link+`>; rel="deprecation"`)
+				}
+
+				path, _ := route.GetPathTemplate()
+				rt.app.metrics.deprecatedRequestsTotal.WithLabelValues(r.Method, path).Inc()
+				LoggerFromContext(r.Context()).Warn("deprecated route called",
+					zap.String("user_agent", r.UserAgent()),
+					zap.Time("sunset", sunset),
+				)
+				next.ServeHTTP(w, r)
+			})
+		})
+	}
+}
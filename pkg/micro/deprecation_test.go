@@ -0,0 +1,69 @@
+package micro
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDeprecatedRoute(t *testing.T) {
+	app := newTestApp(t)
+	logger := NewTestLogger()
+	app.Logger = logger
+	sunset := time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)
+	app.GET("/v1/users/{id}", okHandler, Deprecated(sunset, "https://example.com/migrate"))
+	app.GET("/v2/users/{id}", okHandler)
+	h := app.Handler()
+
+	for range 2 {
+		w := serve(h, httptest.NewRequest(http.MethodGet, "/v1/users/7", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d", w.Code)
+		}
+		want := map[string]string{
+			"Deprecation": "true",
+			"Sunset":      "Fri, 01 Jan 2027 00:00:00 GMT",
+			"Link":        `<https://example.com/migrate>; rel="deprecation"`,
+		}
+		for k, v := range want {
+			if got := w.Header().Get(k); got != v {
+				t.Errorf("%s = %q, want %q", k, got, v)
+			}
+		}
+	}
+
+	// Calls are counted per route template, not per URL
+	if n := testutil.ToFloat64(app.metrics.deprecatedRequestsTotal.WithLabelValues(http.MethodGet, "/v1/users/{id}")); n != 2 {
+		t.Errorf("deprecated_requests_total = %v, want 2", n)
+	}
+	if !logger.Logged("deprecated route called") {
+		t.Error("deprecated call not logged")
+	}
+
+	w := serve(h, httptest.NewRequest(http.MethodGet, "/v2/users/7", nil))
+	if w.Header().Get("Deprecation") != "" || w.Header().Get("Sunset") != "" {
+		t.Errorf("current route has deprecation headers %v", w.Header())
+	}
+	if n := testutil.CollectAndCount(app.metrics.deprecatedRequestsTotal); n != 1 {
+		t.Errorf("%d deprecated series, want only the v1 route", n)
+	}
+}
+
+func TestDeprecatedWithoutSunsetOrLink(t *testing.T) {
+	app := newTestApp(t)
+	app.GET("/legacy", okHandler, Deprecated(time.Time{}, ""))
+
+	w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/legacy", nil))
+	if w.Header().Get("Deprecation") != "true" {
+		t.Error("Deprecation header missing")
+	}
+	if _, ok := w.Header()["Sunset"]; ok {
+		t.Error("Sunset set without a date")
+	}
+	if _, ok := w.Header()["Link"]; ok {
+		t.Error("Link set without a URL")
+	}
+}
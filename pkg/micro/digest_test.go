@@ -0,0 +1,157 @@
+package micro
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+type digestPayload struct {
+	Name string `json:"name" validate:"required"`
+}
+
+// newDigestApp mounts handlers behind BodyDigestMiddleware that echo the
+// decoded name and the raw body length
+func newDigestApp(t *testing.T, opts BodyDigestOptions, configure ...func(*Config)) (http.Handler, *int) {
+	t.Helper()
+	app := newTestApp(t, configure...)
+	calls := new(int)
+	app.POST("/upload", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		*calls++
+		var p digestPayload
+		if err := app.Decode(r, &p); err != nil {
+			return err
+		}
+		return app.JSON(w, http.StatusOK, map[string]string{"name": p.Name})
+	}).Use(app.BodyDigestMiddleware(opts))
+	app.POST("/raw", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		*calls++
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		return app.JSON(w, http.StatusOK, map[string]int{"length": len(body)})
+	}).Use(app.BodyDigestMiddleware(opts))
+	return app.Handler(), calls
+}
+
+func sha256Digest(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func md5Digest(body string) string {
+	sum := md5.Sum([]byte(body))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func postDigest(h http.Handler, path, body string, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	return serve(h, r)
+}
+
+func TestBodyDigestMiddleware(t *testing.T) {
+	const body = `{"name":"report.pdf"}`
+	const other = `{"name":"other.pdf"}`
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   int
+	}{
+		{"no digest", nil, http.StatusOK},
+		{"sha-256", map[string]string{"Digest": "SHA-256=" + sha256Digest(body)}, http.StatusOK},
+		{"md5 digest", map[string]string{"Digest": "MD5=" + md5Digest(body)}, http.StatusOK},
+		{"content-md5", map[string]string{"Content-MD5": md5Digest(body)}, http.StatusOK},
+		{"several algorithms", map[string]string{"Digest": "sha-256=" + sha256Digest(body) + ", md5=" + md5Digest(body)}, http.StatusOK},
+		{"unsupported algorithm ignored", map[string]string{"Digest": "SHA-512=abc, sha-256=" + sha256Digest(body)}, http.StatusOK},
+		{"sha-256 mismatch", map[string]string{"Digest": "SHA-256=" + sha256Digest(other)}, http.StatusBadRequest},
+		{"content-md5 mismatch", map[string]string{"Content-MD5": md5Digest(other)}, http.StatusBadRequest},
+		{"one of several mismatched", map[string]string{"Digest": "sha-256=" + sha256Digest(body) + ", md5=" + md5Digest(other)}, http.StatusBadRequest},
+		{"invalid base64", map[string]string{"Digest": "SHA-256=not base64!"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, calls := newDigestApp(t, BodyDigestOptions{})
+			w := postDigest(h, "/upload", body, tt.header)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want != http.StatusOK {
+				if *calls != 0 {
+					t.Error("handler ran for a rejected body")
+				}
+				return
+			}
+			if got := decodeBody(t, w)["name"]; got != "report.pdf" {
+				t.Errorf("decoded name = %v, want report.pdf", got)
+			}
+		})
+	}
+}
+
+func TestBodyDigestMismatchNamesAlgorithm(t *testing.T) {
+	expose := true
+	h, _ := newDigestApp(t, BodyDigestOptions{}, func(c *Config) { c.ExposeErrorDetails = &expose })
+	w := postDigest(h, "/upload", `{"name":"a"}`, map[string]string{"Content-MD5": md5Digest("b")})
+	body := decodeBody(t, w)
+	details, _ := body["details"].(map[string]interface{})
+	if body["message"] != "body digest mismatch" || details["algorithm"] != "md5" {
+		t.Errorf("body = %v, want a mismatch naming md5", body)
+	}
+}
+
+func TestBodyDigestRequire(t *testing.T) {
+	h, calls := newDigestApp(t, BodyDigestOptions{Require: true})
+	w := postDigest(h, "/upload", `{"name":"a"}`, nil)
+	if w.Code != http.StatusBadRequest || *calls != 0 {
+		t.Fatalf("status = %d, calls = %d; want 400 without reaching the handler", w.Code, *calls)
+	}
+	if msg := decodeBody(t, w)["message"]; msg != "digest header is required" {
+		t.Errorf("message = %v", msg)
+	}
+
+	w = postDigest(h, "/upload", `{"name":"a"}`, map[string]string{"Digest": "SHA-256=" + sha256Digest(`{"name":"a"}`)})
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d with a digest, want 200", w.Code)
+	}
+}
+
+func TestBodyDigestSpoolsLargeBodies(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	h, _ := newDigestApp(t, BodyDigestOptions{MaxMemory: 64})
+	body := strings.Repeat("x", 4096)
+	w := postDigest(h, "/raw", body, map[string]string{"Digest": "SHA-256=" + sha256Digest(body)})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if got := decodeBody(t, w)["length"]; got != float64(len(body)) {
+		t.Errorf("handler read %v bytes, want %d", got, len(body))
+	}
+
+	// A mismatch is rejected too, and the spool file is removed either way
+	w = postDigest(h, "/raw", body, map[string]string{"Digest": "SHA-256=" + sha256Digest("y")})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d for a mismatch, want 400", w.Code)
+	}
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("spool files left behind: %v", entries)
+	}
+}
@@ -1,10 +1,18 @@
 package micro
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -13,8 +21,16 @@ import (
 type APIError struct {
 	Code      int               `json:"code"`
 	Message   string            `json:"message"`
+	ErrorCode string            `json:"error_code,omitempty"` // Stable machine-readable code, e.g. USER_NOT_FOUND
 	Details   map[string]string `json:"details,omitempty"`
 	RequestID string            `json:"request_id,omitempty"`
+
+	// ErrorCount is the number of invalid fields of a validation error,
+	// sent even when the details are not
+	ErrorCount int `json:"error_count,omitempty"`
+
+	// RetryAfter is sent as the Retry-After header when set
+	RetryAfter time.Duration `json:"-"`
 }
 
 func (e *APIError) Error() string {
@@ -33,14 +49,98 @@ func NewAPIError(code int, message string, details ...map[string]string) *APIErr
 	return err
 }
 
+// WithErrorCode returns a copy of the error with a machine-readable code
+// clients can switch on instead of the message
+func (e *APIError) WithErrorCode(code string) *APIError {
+	err := *e
+	err.ErrorCode = code
+	return &err
+}
+
+// errorMapping translates errors matching target into an API error
+type errorMapping struct {
+	target error
+	apiErr *APIError
+}
+
+// MapError makes handlers returning an error that matches target (by
+// errors.Is) respond with apiErr instead of a 500, so domain sentinel errors
+// need not be translated in every handler. Mappings are tried in
+// registration order.
+func (a *App) MapError(target error, apiErr *APIError) {
+	a.errorMappings = append(a.errorMappings, errorMapping{target: target, apiErr: apiErr})
+}
+
+// ErrForcedShutdown is returned by Start when a second signal interrupts
+// the graceful shutdown
+var ErrForcedShutdown = errors.New("forced shutdown")
+
+// ServerError is returned by Start when the server fails to listen or serve
+type ServerError struct {
+	Addr string
+	Err  error
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("server error on %s: %v", e.Addr, e.Err)
+}
+
+func (e *ServerError) Unwrap() error {
+	return e.Err
+}
+
+// AddrInUse reports whether the server could not bind because the address
+// is already in use
+func (e *ServerError) AddrInUse() bool {
+	return errors.Is(e.Err, syscall.EADDRINUSE)
+}
+
 var (
-	ErrInternalServer = NewAPIError(500, "internal server error")
+	ErrInternalServer = NewAPIError(500, "internal server error").WithErrorCode("INTERNAL_ERROR")
+	ErrRequestTimeout = NewAPIError(504, "request timed out").WithErrorCode("REQUEST_TIMEOUT")
+	// ErrServiceBusy reports overload, such as an exhausted connection
+	// pool, as opposed to a failure
+	ErrServiceBusy = &APIError{Code: 503, Message: "service busy, try again later", ErrorCode: "SERVICE_BUSY", RetryAfter: 5 * time.Second}
 )
 
+// ErrorEncoder writes a normalized error to the client. r is nil when the
+// error is written through JSONError.
+type ErrorEncoder func(w http.ResponseWriter, r *http.Request, apiErr *APIError)
+
+// SetErrorEncoder replaces the encoder used for all error responses, giving
+// full control over the error wire format
+func (a *App) SetErrorEncoder(encoder ErrorEncoder) {
+	a.errorEncoder = encoder
+}
+
+// IsConnClosed reports whether err comes from writing to a connection the
+// client already closed, such as a broken pipe or connection reset. These
+// are client-side and not server failures.
+func IsConnClosed(err error) bool {
+	return errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, io.ErrClosedPipe)
+}
+
 // Enhanced error handling
-func (a *App) handleError(w http.ResponseWriter, err error) {
+func (a *App) handleError(w http.ResponseWriter, r *http.Request, err error) {
 	reqID := getRequestIDFromContext(w)
+
+	// Nothing can be written back once the client has gone away
+	if IsConnClosed(err) {
+		a.Logger.Debug("client closed connection",
+			zap.Error(err),
+			zap.String("request_id", reqID),
+		)
+		return
+	}
+
 	apiError := a.normalizeError(err, reqID)
+	if r != nil {
+		apiError.Message = Localizer(r.Context()).T(apiError.Message)
+	}
 
 	a.Logger.Error("request error",
 		zap.Error(err),
@@ -48,20 +148,105 @@ func (a *App) handleError(w http.ResponseWriter, err error) {
 		zap.Int("status_code", apiError.Code),
 	)
 
+	if apiError.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(apiError.RetryAfter.Seconds()))))
+	}
+
+	if a.errorEncoder != nil {
+		a.errorEncoder(w, r, apiError)
+		return
+	}
+	a.encodeError(w, r, apiError)
+}
+
+// encodeError is the default ErrorEncoder, writing APIError JSON or problem
+// details when Config.ProblemJSON is set
+func (a *App) encodeError(w http.ResponseWriter, r *http.Request, apiError *APIError) {
+	if a.Config.ProblemJSON {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(apiError.Code)
+		json.NewEncoder(w).Encode(a.newProblem(apiError))
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(apiError.Code)
 	json.NewEncoder(w).Encode(apiError)
 }
 
+// Problem is an RFC 7807 problem details body
+type Problem struct {
+	Type     string            `json:"type"`
+	Title    string            `json:"title"`
+	Status   int               `json:"status"`
+	Detail   string            `json:"detail,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Errors   map[string]string `json:"errors,omitempty"`
+
+	ErrorCode  string `json:"error_code,omitempty"`
+	ErrorCount int    `json:"error_count,omitempty"`
+}
+
+// newProblem maps an APIError onto problem details. The type is the
+// configured base followed by the status code, or about:blank without one.
+func (a *App) newProblem(apiErr *APIError) *Problem {
+	problemType := "about:blank"
+	if base := strings.TrimSuffix(a.Config.ProblemTypeBase, "/"); base != "" {
+		problemType = base + "/" + strconv.Itoa(apiErr.Code)
+	}
+	return &Problem{
+		Type:     problemType,
+		Title:    http.StatusText(apiErr.Code),
+		Status:   apiErr.Code,
+		Detail:   apiErr.Message,
+		Instance: apiErr.RequestID,
+		Errors:   apiErr.Details,
+
+		ErrorCode:  apiErr.ErrorCode,
+		ErrorCount: apiErr.ErrorCount,
+	}
+}
+
 func (a *App) normalizeError(err error, requestID string) *APIError {
 	var apiErr *APIError
 	if !errors.As(err, &apiErr) {
-		apiErr = NewAPIError(http.StatusInternalServerError, "internal server error")
+		apiErr = a.mappedError(err)
+	}
+	switch {
+	case apiErr != nil:
+	case errors.Is(err, context.DeadlineExceeded):
+		// The handler ran past its timeout, see WithTimeout
+		apiErr = ErrRequestTimeout
+	default:
+		apiErr = ErrInternalServer
+	}
+
+	// Copy so shared sentinel errors are never mutated
+	normalized := *apiErr
+	normalized.RequestID = requestID
+
+	// Details of server errors are internal and never exposed
+	if !a.exposeErrorDetails() || normalized.Code >= http.StatusInternalServerError {
+		normalized.Details = nil
+	}
+	return &normalized
+}
+
+// mappedError returns the API error registered with MapError for err, or nil
+func (a *App) mappedError(err error) *APIError {
+	for _, m := range a.errorMappings {
+		if errors.Is(err, m.target) {
+			return m.apiErr
+		}
 	}
+	return nil
+}
 
-	apiErr.RequestID = requestID
-	if a.Config.LogLevel != "debug" {
-		apiErr.Details = nil // Remove details in production
+// exposeErrorDetails reports whether error details are sent to clients.
+// Unless configured explicitly they are only exposed at debug log level.
+func (a *App) exposeErrorDetails() bool {
+	if a.Config.ExposeErrorDetails != nil {
+		return *a.Config.ExposeErrorDetails
 	}
-	return apiErr
+	return a.Config.LogLevel == "debug"
 }
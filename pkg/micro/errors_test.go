@@ -0,0 +1,242 @@
+package micro
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestErrorDetailExposure(t *testing.T) {
+	details := map[string]string{"email": "is required"}
+
+	tests := []struct {
+		name     string
+		logLevel string
+		expose   *bool
+		status   int
+		want     bool
+	}{
+		{"default at info level", "info", nil, http.StatusBadRequest, false},
+		{"default at debug level", "debug", nil, http.StatusBadRequest, true},
+		{"enabled at info level", "info", boolPtr(true), http.StatusBadRequest, true},
+		{"disabled at debug level", "debug", boolPtr(false), http.StatusBadRequest, false},
+		{"server error when enabled", "info", boolPtr(true), http.StatusInternalServerError, false},
+		{"server error at debug level", "debug", nil, http.StatusServiceUnavailable, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, func(c *Config) {
+				c.LogLevel = tt.logLevel
+				c.ExposeErrorDetails = tt.expose
+			})
+			app.GET("/fail", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				return NewAPIError(tt.status, "request failed", details)
+			})
+
+			w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			_, exposed := decodeBody(t, w)["details"]
+			if exposed != tt.want {
+				t.Errorf("details exposed = %v, want %v", exposed, tt.want)
+			}
+		})
+	}
+}
+
+func TestProblemJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		typeBase string
+		err      error
+		want     Problem
+	}{
+		{
+			"with type base", "https://example.com/problems/",
+			NewAPIError(http.StatusNotFound, "user not found").WithErrorCode("USER_NOT_FOUND"),
+			Problem{Type: "https://example.com/problems/404", Title: "Not Found", Status: 404, Detail: "user not found", ErrorCode: "USER_NOT_FOUND"},
+		},
+		{
+			"without type base", "",
+			NewAPIError(http.StatusConflict, "email already registered"),
+			Problem{Type: "about:blank", Title: "Conflict", Status: 409, Detail: "email already registered"},
+		},
+		{
+			"unexpected error", "",
+			errors.New("connection refused"),
+			Problem{Type: "about:blank", Title: "Internal Server Error", Status: 500, Detail: ErrInternalServer.Message, ErrorCode: ErrInternalServer.ErrorCode},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, func(c *Config) {
+				c.ProblemJSON = true
+				c.ProblemTypeBase = tt.typeBase
+			})
+			app.GET("/fail", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				return tt.err
+			})
+
+			w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+			if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Content-Type = %q, want application/problem+json", ct)
+			}
+			if w.Code != tt.want.Status {
+				t.Errorf("status = %d, want %d", w.Code, tt.want.Status)
+			}
+			var got Problem
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			// The instance identifies the request
+			tt.want.Instance = w.Header().Get("X-Request-ID")
+			if tt.want.Instance == "" || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("problem = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProblemJSONDisabledByDefault(t *testing.T) {
+	app := newTestApp(t)
+	app.GET("/fail", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return NewAPIError(http.StatusNotFound, "user not found")
+	})
+
+	w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	body := decodeBody(t, w)
+	if body["message"] != "user not found" || body["code"] != float64(404) {
+		t.Errorf("body = %v, want the APIError shape", body)
+	}
+}
+
+func TestCustomErrorEncoder(t *testing.T) {
+	app := newTestApp(t)
+	var gotRequest bool
+	app.SetErrorEncoder(func(w http.ResponseWriter, r *http.Request, apiErr *APIError) {
+		gotRequest = r != nil
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(apiErr.Code)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": map[string]string{"msg": apiErr.Message, "id": apiErr.RequestID},
+		})
+	})
+	app.GET("/fail", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return NewAPIError(http.StatusTeapot, "no coffee")
+	})
+	app.GET("/unexpected", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return errors.New("disk full")
+	})
+	h := app.Handler()
+
+	w := serve(h, httptest.NewRequest(http.MethodGet, "/fail", nil))
+	if w.Code != http.StatusTeapot {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTeapot)
+	}
+	body := decodeBody(t, w)
+	errBody, _ := body["error"].(map[string]interface{})
+	if errBody["msg"] != "no coffee" || errBody["id"] != w.Header().Get("X-Request-ID") {
+		t.Errorf("body = %v, want the custom shape", body)
+	}
+	if _, ok := body["message"]; ok {
+		t.Error("default encoder also ran")
+	}
+	if !gotRequest {
+		t.Error("encoder did not receive the request")
+	}
+
+	// Errors are normalized before they reach the encoder
+	w = serve(h, httptest.NewRequest(http.MethodGet, "/unexpected", nil))
+	errBody, _ = decodeBody(t, w)["error"].(map[string]interface{})
+	if w.Code != http.StatusInternalServerError || errBody["msg"] != ErrInternalServer.Message {
+		t.Errorf("unexpected error = %d %v, want a normalized 500", w.Code, errBody)
+	}
+
+	// JSONError goes through the encoder without a request
+	rec := httptest.NewRecorder()
+	app.JSONError(rec, NewAPIError(http.StatusNotFound, "gone"))
+	if _, ok := decodeBody(t, rec)["error"]; !ok || gotRequest {
+		t.Errorf("JSONError body = %s, request passed = %v", rec.Body.String(), gotRequest)
+	}
+}
+
+func TestWithErrorCode(t *testing.T) {
+	base := NewAPIError(http.StatusNotFound, "user not found")
+	coded := base.WithErrorCode("USER_NOT_FOUND")
+
+	if coded.ErrorCode != "USER_NOT_FOUND" || coded.Code != http.StatusNotFound || coded.Message != "user not found" {
+		t.Errorf("coded = %+v", coded)
+	}
+	// Shared sentinel errors are copied, not changed
+	if base.ErrorCode != "" {
+		t.Errorf("WithErrorCode changed the original: %+v", base)
+	}
+}
+
+func TestErrorCodeResponses(t *testing.T) {
+	errNotFound := errors.New("not found")
+	errConflict := errors.New("conflict")
+	errUnmapped := errors.New("disk on fire")
+	mappedNotFound := NewAPIError(http.StatusNotFound, "user not found").WithErrorCode("USER_NOT_FOUND")
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string // "" expects no error_code field
+	}{
+		{"api error with code", NewAPIError(http.StatusConflict, "email taken").WithErrorCode("EMAIL_EXISTS"), http.StatusConflict, "EMAIL_EXISTS"},
+		{"api error without code", NewAPIError(http.StatusBadRequest, "bad request"), http.StatusBadRequest, ""},
+		{"wrapped api error", fmt.Errorf("loading: %w", mappedNotFound), http.StatusNotFound, "USER_NOT_FOUND"},
+		{"mapped sentinel", errNotFound, http.StatusNotFound, "USER_NOT_FOUND"},
+		{"wrapped mapped sentinel", fmt.Errorf("repository: %w", errNotFound), http.StatusNotFound, "USER_NOT_FOUND"},
+		// Mappings are tried in registration order
+		{"joined sentinels", errors.Join(errConflict, errNotFound), http.StatusNotFound, "USER_NOT_FOUND"},
+		{"unmapped error", errUnmapped, http.StatusInternalServerError, "INTERNAL_ERROR"},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, "REQUEST_TIMEOUT"},
+		{"service busy", ErrServiceBusy, http.StatusServiceUnavailable, "SERVICE_BUSY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			app.MapError(errNotFound, mappedNotFound)
+			app.MapError(errConflict, NewAPIError(http.StatusConflict, "conflict").WithErrorCode("CONFLICT"))
+			app.GET("/fail", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				return tt.err
+			})
+
+			w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			body := decodeBody(t, w)
+			if body["code"] != float64(tt.status) {
+				t.Errorf("code = %v, want %d", body["code"], tt.status)
+			}
+			code, ok := body["error_code"]
+			if tt.code == "" {
+				if ok {
+					t.Errorf("error_code = %v, want none", code)
+				}
+				return
+			}
+			if code != tt.code {
+				t.Errorf("error_code = %v, want %s", code, tt.code)
+			}
+		})
+	}
+
+	// Responses never write the request ID into the registered error
+	if mappedNotFound.RequestID != "" {
+		t.Errorf("mapped error was changed: %+v", mappedNotFound)
+	}
+}
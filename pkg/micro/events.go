@@ -0,0 +1,55 @@
+package micro
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// EventPublisher publishes domain events to a message broker. The events
+// package provides NATS and Kafka implementations.
+type EventPublisher interface {
+	Publish(ctx context.Context, subject string, payload interface{}) error
+}
+
+// Events publishes domain events on behalf of services and decides per
+// subject whether a failed publish fails the operation. Failures are always
+// logged; only subjects marked required return them, so a broker outage
+// does not fail requests whose events are best effort.
+type Events struct {
+	publisher EventPublisher
+	required  map[string]bool
+}
+
+// NewEvents wraps publisher, returning publish errors for requiredSubjects
+// only. A nil publisher turns Publish into a no-op.
+func NewEvents(publisher EventPublisher, requiredSubjects ...string) *Events {
+	required := make(map[string]bool, len(requiredSubjects))
+	for _, subject := range requiredSubjects {
+		required[subject] = true
+	}
+	return &Events{publisher: publisher, required: required}
+}
+
+// Publish sends payload to subject. It is safe to call on a nil *Events.
+func (e *Events) Publish(ctx context.Context, subject string, payload interface{}) error {
+	if e == nil || e.publisher == nil {
+		return nil
+	}
+
+	err := e.publisher.Publish(ctx, subject, payload)
+	if err == nil {
+		return nil
+	}
+
+	LoggerFromContext(ctx).Error("event publish failed",
+		zap.String("subject", subject),
+		zap.Bool("required", e.required[subject]),
+		zap.Error(err),
+	)
+	if e.required[subject] {
+		return fmt.Errorf("publish %s: %w", subject, err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package micro
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// recordingPublisher records published events and fails with err when set
+type recordingPublisher struct {
+	subjects []string
+	payloads []interface{}
+	err      error
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, subject string, payload interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.subjects = append(p.subjects, subject)
+	p.payloads = append(p.payloads, payload)
+	return nil
+}
+
+func TestEventsPublish(t *testing.T) {
+	publisher := &recordingPublisher{}
+	events := NewEvents(publisher)
+	if err := events.Publish(context.Background(), "user.created", map[string]int{"id": 1}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if len(publisher.subjects) != 1 || publisher.subjects[0] != "user.created" {
+		t.Errorf("published %v", publisher.subjects)
+	}
+}
+
+func TestEventsPublishFailure(t *testing.T) {
+	brokerDown := errors.New("broker down")
+	tests := []struct {
+		name     string
+		required []string
+		wantErr  bool
+	}{
+		{"best effort", nil, false},
+		{"required", []string{"user.created"}, true},
+		{"other subject required", []string{"user.deleted"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := NewTestLogger()
+			ctx := context.WithValue(context.Background(), contextKeyLogger, Logger(logger))
+			events := NewEvents(&recordingPublisher{err: brokerDown}, tt.required...)
+
+			err := events.Publish(ctx, "user.created", nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Publish err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, brokerDown) {
+				t.Errorf("err = %v, want it to wrap %v", err, brokerDown)
+			}
+			// Failures are logged whether or not they are returned
+			fields := entryFields(t, logger, "event publish failed")
+			if fields["subject"] != "user.created" || fields["required"] != tt.wantErr {
+				t.Errorf("fields = %v", fields)
+			}
+		})
+	}
+}
+
+func TestEventsWithoutPublisher(t *testing.T) {
+	var nilEvents *Events
+	for name, events := range map[string]*Events{"nil events": nilEvents, "nil publisher": NewEvents(nil, "user.created")} {
+		if err := events.Publish(context.Background(), "user.created", nil); err != nil {
+			t.Errorf("%s: Publish = %v, want a no-op", name, err)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package micro
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// FeatureFlags evaluates feature flags for the caller described by ctx,
+// returning def for unknown flags
+type FeatureFlags interface {
+	Enabled(ctx context.Context, flag string, def bool) bool
+}
+
+// FlagContext is who a flag is evaluated for, derived from the principal
+// and tenant of the request
+type FlagContext struct {
+	UserID   string
+	TenantID string
+}
+
+// FlagContextFrom returns the evaluation context of ctx
+func FlagContextFrom(ctx context.Context) FlagContext {
+	var fc FlagContext
+	if p, ok := PrincipalFromContext(ctx); ok {
+		fc.UserID = p.ID
+		fc.TenantID = p.TenantID
+	}
+	if tenant, ok := TenantFromContext(ctx); ok {
+		fc.TenantID = tenant
+	}
+	return fc
+}
+
+// FlagRule decides a flag for a cohort. Listed users and tenants always get
+// the flag, then Percentage of the remaining users by a stable hash, and
+// everyone else gets Enabled.
+type FlagRule struct {
+	Enabled    bool     `json:"enabled"`
+	Users      []string `json:"users,omitempty"`
+	Tenants    []string `json:"tenants,omitempty"`
+	Percentage int      `json:"percentage,omitempty"`
+}
+
+func (r FlagRule) evaluate(flag string, fc FlagContext) bool {
+	if r.Enabled {
+		return true
+	}
+	if fc.UserID != "" && contains(r.Users, fc.UserID) {
+		return true
+	}
+	if fc.TenantID != "" && contains(r.Tenants, fc.TenantID) {
+		return true
+	}
+	if r.Percentage > 0 && fc.UserID != "" {
+		// Hash with the flag name so rollouts of different flags reach
+		// different users
+		h := fnv.New32a()
+		h.Write([]byte(flag + ":" + fc.UserID))
+		return int(h.Sum32()%100) < r.Percentage
+	}
+	return false
+}
+
+// StaticFlags evaluates a fixed set of rules that can be replaced at
+// runtime with Set
+type StaticFlags struct {
+	mu    sync.RWMutex
+	rules map[string]FlagRule
+}
+
+// NewStaticFlags creates a provider from rules keyed by flag name
+func NewStaticFlags(rules map[string]FlagRule) *StaticFlags {
+	f := &StaticFlags{}
+	f.Set(rules)
+	return f
+}
+
+// Set replaces all rules
+func (f *StaticFlags) Set(rules map[string]FlagRule) {
+	copied := make(map[string]FlagRule, len(rules))
+	for k, v := range rules {
+		copied[k] = v
+	}
+	f.mu.Lock()
+	f.rules = copied
+	f.mu.Unlock()
+}
+
+// Enabled implements FeatureFlags
+func (f *StaticFlags) Enabled(ctx context.Context, flag string, def bool) bool {
+	f.mu.RLock()
+	rule, ok := f.rules[flag]
+	f.mu.RUnlock()
+	if !ok {
+		return def
+	}
+	return rule.evaluate(flag, FlagContextFrom(ctx))
+}
+
+// FlagSource fetches the current flag rules from an external provider
+type FlagSource func(ctx context.Context) (map[string]FlagRule, error)
+
+// PollingFlags refreshes a StaticFlags from a FlagSource. It is a Worker:
+// register it with App.RegisterWorker. The last rules fetched stay in use
+// while the source fails.
+type PollingFlags struct {
+	*StaticFlags
+	source   FlagSource
+	interval time.Duration
+	logger   Logger
+	done     chan struct{}
+}
+
+// NewPollingFlags creates a provider that starts with initial rules and
+// polls source every interval
+func (a *App) NewPollingFlags(source FlagSource, interval time.Duration, initial map[string]FlagRule) *PollingFlags {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	return &PollingFlags{
+		StaticFlags: NewStaticFlags(initial),
+		source:      source,
+		interval:    interval,
+		logger:      a.Logger,
+		done:        make(chan struct{}),
+	}
+}
+
+// Start polls until ctx is cancelled
+func (p *PollingFlags) Start(ctx context.Context) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		p.refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop waits for an in-progress poll to finish
+func (p *PollingFlags) Stop(ctx context.Context) error {
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *PollingFlags) refresh(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, p.interval)
+	defer cancel()
+
+	rules, err := p.source(ctx)
+	if err != nil {
+		p.logger.Warn("feature flag refresh failed", zap.Error(err))
+		return
+	}
+	p.Set(rules)
+}
+
+// HTTPFlagSource fetches rules as a JSON object keyed by flag name from url
+func HTTPFlagSource(client *http.Client, url string) FlagSource {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context) (map[string]FlagRule, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("create flag request: %w", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("fetch flags: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetch flags: unexpected status %d", resp.StatusCode)
+		}
+
+		var rules map[string]FlagRule
+		if err := json.NewDecoder(resp.Body).Decode(&rules); err != nil {
+			return nil, fmt.Errorf("decode flags: %w", err)
+		}
+		return rules, nil
+	}
+}
+
+// SetFeatureFlags replaces the flag provider, which defaults to a
+// StaticFlags built from Config.FeatureFlags
+func (a *App) SetFeatureFlags(flags FeatureFlags) {
+	a.flags = flags
+}
+
+// FeatureEnabled reports whether flag is on for the caller of the request
+// in ctx. Unknown flags, and contexts outside a request, are off.
+func FeatureEnabled(ctx context.Context, flag string) bool {
+	flags, ok := ctx.Value(contextKeyFeatureFlags).(FeatureFlags)
+	if !ok || flags == nil {
+		return false
+	}
+	return flags.Enabled(ctx, flag, false)
+}
+
+// featureFlagsMiddleware makes the app's provider available to
+// FeatureEnabled. The caller is resolved at evaluation time, so flags see
+// principals set by later auth middleware.
+func (a *App) featureFlagsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), contextKeyFeatureFlags, a.flags)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// FeatureGate hides routes behind flag, answering 404 while it is off for
+// the caller
+func (a *App) FeatureGate(flag string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !FeatureEnabled(r.Context(), flag) {
+				a.notFoundHandler.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// FeatureGate hides every route in the group behind flag
+func (g *RouterGroup) FeatureGate(flag string) *RouterGroup {
+	return g.WithMiddleware(g.app.FeatureGate(flag))
+}
@@ -0,0 +1,207 @@
+package micro
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStaticFlags(t *testing.T) {
+	flags := NewStaticFlags(map[string]FlagRule{
+		"on":      {Enabled: true},
+		"off":     {},
+		"beta":    {Users: []string{"u1"}, Tenants: []string{"acme"}},
+		"rollout": {Percentage: 100},
+	})
+	user := func(id, tenant string) context.Context {
+		return WithPrincipal(context.Background(), &Principal{ID: id, TenantID: tenant})
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		flag string
+		def  bool
+		want bool
+	}{
+		{"enabled for everyone", context.Background(), "on", false, true},
+		{"disabled", user("u1", ""), "off", true, false},
+		{"listed user", user("u1", ""), "beta", false, true},
+		{"listed tenant of principal", user("u2", "acme"), "beta", false, true},
+		{"listed tenant of context", WithTenant(context.Background(), "acme"), "beta", false, true},
+		{"outside the cohort", user("u2", "globex"), "beta", false, false},
+		{"anonymous", context.Background(), "beta", false, false},
+		{"full rollout", user("u2", ""), "rollout", false, true},
+		{"rollout needs a user", context.Background(), "rollout", false, false},
+		{"unknown flag default on", context.Background(), "missing", true, true},
+		{"unknown flag default off", context.Background(), "missing", false, false},
+	}
+	for _, tt := range tests {
+		if got := flags.Enabled(tt.ctx, tt.flag, tt.def); got != tt.want {
+			t.Errorf("%s: Enabled(%q) = %v, want %v", tt.name, tt.flag, got, tt.want)
+		}
+	}
+}
+
+func TestFlagPercentageRollout(t *testing.T) {
+	flags := NewStaticFlags(map[string]FlagRule{
+		"checkout": {Percentage: 30},
+		"search":   {Percentage: 30},
+	})
+	enabled := map[string]int{}
+	differ := 0
+	for i := range 1000 {
+		ctx := WithPrincipal(context.Background(), &Principal{ID: fmt.Sprint(i)})
+		checkout := flags.Enabled(ctx, "checkout", false)
+		// A user keeps their bucket across evaluations
+		if flags.Enabled(ctx, "checkout", false) != checkout {
+			t.Fatalf("user %d flipped between evaluations", i)
+		}
+		search := flags.Enabled(ctx, "search", false)
+		if checkout {
+			enabled["checkout"]++
+		}
+		if checkout != search {
+			differ++
+		}
+	}
+	if n := enabled["checkout"]; n < 250 || n > 350 {
+		t.Errorf("%d of 1000 users enabled, want about 300", n)
+	}
+	// Rollouts of different flags reach different users
+	if differ == 0 {
+		t.Error("two flags at the same percentage enabled the same users")
+	}
+}
+
+func TestStaticFlagsSet(t *testing.T) {
+	rules := map[string]FlagRule{"beta": {Enabled: true}}
+	flags := NewStaticFlags(rules)
+	// Rules are copied, so later changes to the map do not leak in
+	rules["beta"] = FlagRule{}
+	if !flags.Enabled(context.Background(), "beta", false) {
+		t.Error("rule changed through the caller's map")
+	}
+	flags.Set(map[string]FlagRule{"beta": {}})
+	if flags.Enabled(context.Background(), "beta", true) {
+		t.Error("Set did not replace the rules")
+	}
+}
+
+func TestFeatureEnabledOutsideRequest(t *testing.T) {
+	if FeatureEnabled(context.Background(), "anything") {
+		t.Error("flag enabled without a provider")
+	}
+}
+
+func TestFeatureFlagsFromConfig(t *testing.T) {
+	t.Setenv("DB_DSN", "postgres://localhost/test")
+	t.Setenv("FEATURE_FLAGS", "new_checkout:true,beta_search:false")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	app := newTestApp(t, func(c *Config) { c.FeatureFlags = cfg.FeatureFlags })
+
+	var checkout, search bool
+	app.GET("/checkout", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		checkout, search = FeatureEnabled(ctx, "new_checkout"), FeatureEnabled(ctx, "beta_search")
+		return nil
+	})
+	serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/checkout", nil))
+	if !checkout || search {
+		t.Errorf("new_checkout = %v, beta_search = %v, want true, false", checkout, search)
+	}
+}
+
+func TestFeatureGate(t *testing.T) {
+	app := newTestApp(t)
+	app.SetFeatureFlags(NewStaticFlags(map[string]FlagRule{"v2": {Users: []string{"u1"}}}))
+	// Auth runs after the flags middleware, as in a real stack
+	app.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if id := r.Header.Get("X-User"); id != "" {
+				r = r.WithContext(WithPrincipal(r.Context(), &Principal{ID: id}))
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	app.Group("/v2").WithMiddleware(app.FeatureGate("v2")).GET("/report", okHandler)
+	app.Group("/beta").FeatureGate("v2").GET("/search", okHandler)
+	h := app.Handler()
+
+	for _, path := range []string{"/v2/report", "/beta/search"} {
+		for user, want := range map[string]int{"u1": http.StatusOK, "u2": http.StatusNotFound, "": http.StatusNotFound} {
+			r := httptest.NewRequest(http.MethodGet, path, nil)
+			r.Header.Set("X-User", user)
+			if w := serve(h, r); w.Code != want {
+				t.Errorf("%s as %q: status = %d, want %d", path, user, w.Code, want)
+			}
+		}
+	}
+}
+
+func TestPollingFlags(t *testing.T) {
+	var body atomic.Value
+	body.Store(`{"beta":{"enabled":true}}`)
+	var fail atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, body.Load())
+	}))
+	defer srv.Close()
+
+	app := newTestApp(t)
+	flags := app.NewPollingFlags(HTTPFlagSource(srv.Client(), srv.URL), 10*time.Millisecond, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	go flags.Start(ctx)
+
+	waitFlag := func(want bool) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); flags.Enabled(context.Background(), "beta", !want) != want; time.Sleep(5 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("beta never became %v", want)
+			}
+		}
+	}
+	waitFlag(true)
+
+	// The last rules fetched stay in use while the source fails
+	fail.Store(true)
+	time.Sleep(50 * time.Millisecond)
+	if !flags.Enabled(context.Background(), "beta", false) {
+		t.Error("rules dropped while the source failed")
+	}
+
+	body.Store(`{"beta":{"enabled":false}}`)
+	fail.Store(false)
+	waitFlag(false)
+
+	cancel()
+	stopCtx, done := context.WithTimeout(context.Background(), time.Second)
+	defer done()
+	if err := flags.Stop(stopCtx); err != nil {
+		t.Errorf("Stop: %v", err)
+	}
+}
+
+func TestHTTPFlagSourceErrors(t *testing.T) {
+	tests := map[string]http.HandlerFunc{
+		"bad status": func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) },
+		"bad json":   func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, "not json") },
+	}
+	for name, handler := range tests {
+		srv := httptest.NewServer(handler)
+		if _, err := HTTPFlagSource(srv.Client(), srv.URL)(context.Background()); err == nil {
+			t.Errorf("%s: fetch succeeded", name)
+		}
+		srv.Close()
+	}
+}
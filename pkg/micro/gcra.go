@@ -0,0 +1,83 @@
+package micro
+
+import (
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// requestLimiter decides whether a single request may proceed
+type requestLimiter interface {
+	Allow() bool
+	// state reports how many requests may be made at once and when the
+	// limiter is back to its full burst
+	state(now time.Time) (remaining int, reset time.Time)
+}
+
+// newRequestLimiter builds a limiter for the configured algorithm
+func newRequestLimiter(algorithm string, rps float64, burst int) requestLimiter {
+	if algorithm == "gcra" && rps > 0 {
+		return newGCRALimiter(rps, burst)
+	}
+	return tokenBucket{rate.NewLimiter(rate.Limit(rps), burst)}
+}
+
+// tokenBucket adapts rate.Limiter to requestLimiter
+type tokenBucket struct {
+	*rate.Limiter
+}
+
+func (b tokenBucket) state(now time.Time) (int, time.Time) {
+	tokens := max(b.TokensAt(now), 0)
+	missing := float64(b.Burst()) - tokens
+	if missing <= 0 || b.Limit() <= 0 {
+		return int(tokens), now
+	}
+	return int(tokens), now.Add(time.Duration(missing / float64(b.Limit()) * float64(time.Second)))
+}
+
+// gcraLimiter implements the generic cell rate algorithm. Its only state is
+// the theoretical arrival time of the next request, updated lock-free, which
+// makes it much smaller than a token bucket.
+type gcraLimiter struct {
+	tat       atomic.Int64 // Unix nanoseconds
+	interval  int64        // Nanoseconds between requests at the sustained rate
+	tolerance int64        // How far ahead of schedule a burst may run
+}
+
+func newGCRALimiter(rps float64, burst int) *gcraLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	// Rates above one request per nanosecond would round the interval down
+	// to 0, which state divides by
+	interval := max(int64(float64(time.Second)/rps), 1)
+	return &gcraLimiter{
+		interval:  interval,
+		tolerance: interval * int64(burst-1),
+	}
+}
+
+func (g *gcraLimiter) Allow() bool {
+	now := time.Now().UnixNano()
+	for {
+		old := g.tat.Load()
+		tat := max(old, now)
+		if tat-now > g.tolerance {
+			return false
+		}
+		if g.tat.CompareAndSwap(old, tat+g.interval) {
+			return true
+		}
+	}
+}
+
+func (g *gcraLimiter) state(now time.Time) (int, time.Time) {
+	tat := max(g.tat.Load(), now.UnixNano())
+	ahead := tat - now.UnixNano()
+	if ahead > g.tolerance {
+		return 0, time.Unix(0, tat)
+	}
+	return int((g.tolerance-ahead)/g.interval) + 1, time.Unix(0, tat)
+}
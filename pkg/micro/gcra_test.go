@@ -0,0 +1,196 @@
+package micro
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGCRALimiterBurstAndRate(t *testing.T) {
+	g := newGCRALimiter(20, 3)
+
+	allowed := 0
+	for range 10 {
+		if g.Allow() {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Fatalf("burst allowed %d requests, want 3", allowed)
+	}
+	if remaining, _ := g.state(time.Now()); remaining != 0 {
+		t.Errorf("remaining after burst = %d, want 0", remaining)
+	}
+
+	// One request is earned back every 50ms
+	time.Sleep(60 * time.Millisecond)
+	if !g.Allow() {
+		t.Error("request denied after the emission interval passed")
+	}
+	if g.Allow() {
+		t.Error("second request allowed before the next interval")
+	}
+}
+
+func TestGCRALimiterState(t *testing.T) {
+	g := newGCRALimiter(10, 5)
+	now := time.Now()
+	if remaining, reset := g.state(now); remaining != 5 || reset.After(now) {
+		t.Errorf("fresh state = %d, %v, want full burst now", remaining, reset)
+	}
+
+	g.Allow()
+	g.Allow()
+	remaining, reset := g.state(time.Now())
+	if remaining != 3 {
+		t.Errorf("remaining = %d, want 3", remaining)
+	}
+	if d := time.Until(reset); d <= 100*time.Millisecond || d > 200*time.Millisecond {
+		t.Errorf("reset in %v, want about 200ms", d)
+	}
+}
+
+func TestGCRALimiterConcurrentAllow(t *testing.T) {
+	// A rate slow enough that no request is earned back during the test
+	g := newGCRALimiter(0.001, 50)
+
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				if g.Allow() {
+					allowed.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n := allowed.Load(); n != 50 {
+		t.Errorf("allowed %d requests, want exactly the burst of 50", n)
+	}
+}
+
+func TestNewRequestLimiterAlgorithm(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		rps       float64
+		gcra      bool
+	}{
+		{"gcra", 10, true},
+		{"token-bucket", 10, false},
+		{"", 10, false},
+		// GCRA cannot express a zero rate, which blocks everything
+		{"gcra", 0, false},
+	}
+	for _, tt := range tests {
+		_, isGCRA := newRequestLimiter(tt.algorithm, tt.rps, 1).(*gcraLimiter)
+		if isGCRA != tt.gcra {
+			t.Errorf("newRequestLimiter(%q, %v) gcra = %v, want %v", tt.algorithm, tt.rps, isGCRA, tt.gcra)
+		}
+	}
+}
+
+func TestRateLimiterWithGCRA(t *testing.T) {
+	app := newLimitedApp(t, func(c *Config) { c.RateLimiter.Algorithm = "gcra" })
+	app.GET("/users", okHandler)
+	h := app.Handler()
+
+	var codes []int
+	for range 2 {
+		codes = append(codes, serve(h, limitedRequest("/users", "192.0.2.1:1234")).Code)
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("status codes = %v, want [200 429]", codes)
+	}
+}
+
+// BenchmarkNewVisitor measures what each new visitor costs per algorithm
+func BenchmarkNewVisitor(b *testing.B) {
+	for _, algorithm := range []string{"token-bucket", "gcra"} {
+		b.Run(algorithm, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				newRequestLimiter(algorithm, 100, 100).Allow()
+			}
+		})
+	}
+}
+
+// BenchmarkRateLimitedRequest measures a limiter lookup and decision per
+// request across many distinct visitors
+func BenchmarkRateLimitedRequest(b *testing.B) {
+	keys := make([]string, 4096)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("192.0.2.%d:%d", i%256, i)
+	}
+	for _, algorithm := range []string{"token-bucket", "gcra"} {
+		b.Run(algorithm, func(b *testing.B) {
+			app := newTestApp(b, func(c *Config) {
+				c.RateLimiter.Enabled = true
+				c.RateLimiter.RequestsPerS = 1e6
+				c.RateLimiter.Burst = 1e6
+				c.RateLimiter.Algorithm = algorithm
+			})
+			b.Cleanup(app.rateLimiter.stop)
+			rl := app.rateLimiter
+
+			b.ReportAllocs()
+			i := 0
+			for b.Loop() {
+				rl.getLimiter(keys[i%len(keys)], 1e6, 1e6).Allow()
+				i++
+			}
+		})
+	}
+}
+
+func TestTokenBucketState(t *testing.T) {
+	b := newRequestLimiter("token-bucket", 10, 5)
+	now := time.Now()
+	if remaining, reset := b.state(now); remaining != 5 || !reset.Equal(now) {
+		t.Errorf("fresh state = %d, %v, want full burst now", remaining, reset)
+	}
+
+	b.Allow()
+	b.Allow()
+	remaining, reset := b.state(time.Now())
+	if remaining != 3 {
+		t.Errorf("remaining = %d, want 3", remaining)
+	}
+	if d := time.Until(reset); d <= 100*time.Millisecond || d > 200*time.Millisecond {
+		t.Errorf("reset in %v, want about 200ms", d)
+	}
+
+	// Without a refill rate the bucket never resets
+	empty := newRequestLimiter("token-bucket", 0, 1)
+	empty.Allow()
+	now = time.Now()
+	if remaining, reset := empty.state(now); remaining != 0 || !reset.Equal(now) {
+		t.Errorf("zero rate state = %d, %v, want 0 and no reset time", remaining, reset)
+	}
+}
+
+func TestLimiterStateAfterExhaustion(t *testing.T) {
+	for _, algorithm := range []string{"token-bucket", "gcra"} {
+		t.Run(algorithm, func(t *testing.T) {
+			l := newRequestLimiter(algorithm, 10, 3)
+			for range 5 {
+				l.Allow()
+			}
+			remaining, reset := l.state(time.Now())
+			if remaining != 0 {
+				t.Errorf("remaining = %d, want 0", remaining)
+			}
+			// The whole burst takes 300ms to earn back
+			if d := time.Until(reset); d <= 200*time.Millisecond || d > 300*time.Millisecond {
+				t.Errorf("reset in %v, want about 300ms", d)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package micro
+
+import (
+	"context"
+	"runtime/debug"
+
+	"go.uber.org/zap"
+)
+
+// PanicHandler is told about a recovered panic, e.g. to report it to an
+// error tracker. ctx carries the correlation ID of the request or goroutine
+// that panicked.
+type PanicHandler func(ctx context.Context, recovered interface{})
+
+// SetPanicHandler sets the handler called after a panic is recovered and
+// logged, both in HTTP handlers and in goroutines started with App.Go
+func (a *App) SetPanicHandler(h PanicHandler) {
+	a.panicHandler = h
+}
+
+// Go runs fn in a goroutine that recovers panics, logging them with the
+// logger from ctx instead of crashing the process
+func Go(ctx context.Context, fn func()) {
+	go runRecovered(ctx, LoggerFromContext(ctx), nil, fn)
+}
+
+// Go runs fn in a goroutine that recovers panics, logging them with the
+// correlation ID from ctx, or a new one outside a request, and passing them
+// to the panic handler
+func (a *App) Go(ctx context.Context, fn func()) {
+	logger := a.Logger
+	if requestID, ok := ctx.Value(contextKeyRequestID).(string); ok {
+		if l, ok := ctx.Value(contextKeyLogger).(Logger); ok {
+			logger = l
+		} else {
+			logger = logger.With(zap.String("request_id", requestID))
+		}
+	} else {
+		requestID = a.newRequestID()
+		ctx = context.WithValue(ctx, contextKeyRequestID, requestID)
+		logger = logger.With(zap.String("request_id", requestID))
+	}
+	go runRecovered(ctx, logger, a.panicHandler, fn)
+}
+
+func runRecovered(ctx context.Context, logger Logger, handler PanicHandler, fn func()) {
+	defer func() {
+		if p := recover(); p != nil {
+			logger.Error("goroutine panicked",
+				zap.Any("error", p),
+				zap.ByteString("stack", debug.Stack()),
+			)
+			if handler != nil {
+				handler(ctx, p)
+			}
+		}
+	}()
+	fn()
+}
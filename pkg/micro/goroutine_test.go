@@ -0,0 +1,116 @@
+package micro
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type recoveredPanic struct {
+	requestID string
+	value     interface{}
+}
+
+// panicRecorder returns a PanicHandler sending what it is told on the
+// returned channel
+func panicRecorder() (PanicHandler, <-chan recoveredPanic) {
+	ch := make(chan recoveredPanic, 1)
+	return func(ctx context.Context, recovered interface{}) {
+		id, _ := ctx.Value(contextKeyRequestID).(string)
+		ch <- recoveredPanic{id, recovered}
+	}, ch
+}
+
+func waitPanic(t *testing.T, ch <-chan recoveredPanic) recoveredPanic {
+	t.Helper()
+	select {
+	case p := <-ch:
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatal("panic handler not called")
+		return recoveredPanic{}
+	}
+}
+
+func TestAppGoRecoversPanics(t *testing.T) {
+	app := newTestApp(t)
+	logger := NewTestLogger()
+	app.Logger = logger
+	handler, panics := panicRecorder()
+	app.SetPanicHandler(handler)
+
+	// Outside a request the goroutine gets its own correlation ID
+	app.Go(context.Background(), func() { panic("background boom") })
+	p := waitPanic(t, panics)
+	if p.value != "background boom" || p.requestID == "" {
+		t.Errorf("panic handler got %+v", p)
+	}
+	fields := entryFields(t, logger, "goroutine panicked")
+	if fields["request_id"] != p.requestID || fields["error"] != "background boom" || fields["stack"] == "" {
+		t.Errorf("log fields = %v", fields)
+	}
+
+	// The process survived, so later goroutines still run
+	done := make(chan struct{})
+	app.Go(context.Background(), func() { close(done) })
+	<-done
+}
+
+func TestAppGoKeepsRequestCorrelation(t *testing.T) {
+	app := newTestApp(t)
+	handler, panics := panicRecorder()
+	app.SetPanicHandler(handler)
+	requestLogger := NewTestLogger()
+
+	app.GET("/users", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		ctx = context.WithValue(ctx, contextKeyLogger, Logger(requestLogger))
+		app.Go(ctx, func() { panic("in request") })
+		return nil
+	})
+	w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/users", nil))
+
+	p := waitPanic(t, panics)
+	if p.requestID != w.Header().Get("X-Request-ID") {
+		t.Errorf("panic correlated with %q, request ID is %q", p.requestID, w.Header().Get("X-Request-ID"))
+	}
+	// The request logger already carries the correlation fields
+	if !requestLogger.Logged("goroutine panicked") {
+		t.Error("panic not logged with the request logger")
+	}
+}
+
+func TestGoRecoversPanics(t *testing.T) {
+	logger := NewTestLogger()
+	ctx := context.WithValue(context.Background(), contextKeyLogger, Logger(logger))
+
+	done := make(chan struct{})
+	Go(ctx, func() {
+		defer close(done)
+		panic("no app")
+	})
+	<-done
+	for deadline := time.Now().Add(5 * time.Second); !logger.Logged("goroutine panicked"); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("panic not logged")
+		}
+	}
+}
+
+func TestPanicHandlerSharedWithHTTP(t *testing.T) {
+	app := newTestApp(t)
+	handler, panics := panicRecorder()
+	app.SetPanicHandler(handler)
+	app.GET("/boom", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		panic("handler boom")
+	})
+
+	w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/boom", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if p := waitPanic(t, panics); p.value != "handler boom" || p.requestID != w.Header().Get("X-Request-ID") {
+		t.Errorf("panic handler got %+v", p)
+	}
+}
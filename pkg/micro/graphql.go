@@ -0,0 +1,211 @@
+package micro
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"go.uber.org/zap"
+)
+
+// GraphQLOptions configures a GraphQL endpoint
+type GraphQLOptions struct {
+	MaxDepth      int   // Deepest allowed selection nesting; defaults to 10, -1 disables
+	MaxComplexity int   // Most fields one query may select; defaults to 1000, -1 disables
+	MaxBodyBytes  int64 // Defaults to 1 MiB
+}
+
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// GraphQL mounts schema at path for GET and POST requests. The endpoint is a
+// regular route, so app middleware such as auth, rate limiting and logging
+// applies, and resolvers receive the request context (see
+// LoggerFromContext and PrincipalFromContext). Queries nested deeper than
+// MaxDepth or selecting more than MaxComplexity fields are rejected before
+// execution. Mutations are only accepted over POST, so a cross-site GET
+// cannot trigger them.
+func (a *App) GraphQL(path string, schema graphql.Schema, opts GraphQLOptions, routeOpts ...RouteOption) *Route {
+	if opts.MaxDepth == 0 {
+		opts.MaxDepth = 10
+	}
+	if opts.MaxComplexity == 0 {
+		opts.MaxComplexity = 1000
+	}
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = 1 << 20
+	}
+
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		req, err := readGraphQLRequest(w, r, opts.MaxBodyBytes)
+		if err != nil {
+			return err
+		}
+
+		// Syntax errors are left for execution to report
+		doc, _ := parser.Parse(parser.ParseParams{Source: req.Query})
+		if r.Method == http.MethodGet && isGraphQLMutation(doc, req.OperationName) {
+			w.Header().Set("Allow", http.MethodPost)
+			return NewAPIError(http.StatusMethodNotAllowed, "GraphQL mutations require POST")
+		}
+
+		if err := checkGraphQLLimits(doc, opts); err != nil {
+			return a.JSON(w, http.StatusBadRequest, &graphql.Result{
+				Errors: []gqlerrors.FormattedError{gqlerrors.NewFormattedError(err.Error())},
+			})
+		}
+
+		result := graphql.Do(graphql.Params{
+			Schema:         schema,
+			RequestString:  req.Query,
+			VariableValues: req.Variables,
+			OperationName:  req.OperationName,
+			Context:        ctx,
+		})
+		for _, e := range result.Errors {
+			LoggerFromContext(ctx).Warn("graphql error",
+				zap.String("operation", req.OperationName),
+				zap.String("error", e.Message),
+			)
+		}
+
+		// Execution errors are part of a GraphQL response, so the status
+		// stays 200 as long as the query could be run
+		return a.JSON(w, http.StatusOK, result)
+	}
+
+	route := a.Router.HandleFunc(path, a.serve(handler)).Methods(http.MethodGet, http.MethodPost)
+	return (&Route{app: a, route: route}).apply(routeOpts)
+}
+
+func readGraphQLRequest(w http.ResponseWriter, r *http.Request, maxBytes int64) (*graphQLRequest, error) {
+	req := &graphQLRequest{}
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if vars := q.Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				return nil, NewAPIError(http.StatusBadRequest, "invalid GraphQL variables")
+			}
+		}
+	} else {
+		defer r.Body.Close()
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBytes)).Decode(req); err != nil {
+			return nil, NewAPIError(http.StatusBadRequest, "invalid GraphQL request body")
+		}
+	}
+
+	if req.Query == "" {
+		return nil, NewAPIError(http.StatusBadRequest, "GraphQL query is required")
+	}
+	return req, nil
+}
+
+// isGraphQLMutation reports whether the operation of doc selected by
+// operationName is a mutation. Without a name every operation is
+// considered, since execution picks the only one.
+func isGraphQLMutation(doc *ast.Document, operationName string) bool {
+	if doc == nil {
+		return false
+	}
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok || op.Operation != ast.OperationTypeMutation {
+			continue
+		}
+		if operationName == "" || (op.Name != nil && op.Name.Value == operationName) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGraphQLLimits measures the depth and field count of every operation
+// of doc, expanding fragments. A nil doc, which failed to parse, passes.
+func checkGraphQLLimits(doc *ast.Document, opts GraphQLOptions) error {
+	if doc == nil {
+		return nil
+	}
+
+	m := &queryMeasure{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		memo:      make(map[string][2]int),
+		visiting:  make(map[string]bool),
+	}
+	for _, def := range doc.Definitions {
+		if frag, ok := def.(*ast.FragmentDefinition); ok && frag.Name != nil {
+			m.fragments[frag.Name.Value] = frag
+		}
+	}
+
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		depth, fields := m.selectionSet(op.SelectionSet)
+		if opts.MaxDepth > 0 && depth > opts.MaxDepth {
+			return fmt.Errorf("query depth %d exceeds the limit of %d", depth, opts.MaxDepth)
+		}
+		if opts.MaxComplexity > 0 && fields > opts.MaxComplexity {
+			return fmt.Errorf("query selects %d fields, exceeding the limit of %d", fields, opts.MaxComplexity)
+		}
+	}
+	return nil
+}
+
+// queryMeasure computes selection depth and field counts. Fragment results
+// are memoized so repeated spreads cannot make the walk exponential.
+type queryMeasure struct {
+	fragments map[string]*ast.FragmentDefinition
+	memo      map[string][2]int
+	visiting  map[string]bool
+}
+
+func (m *queryMeasure) selectionSet(set *ast.SelectionSet) (depth, fields int) {
+	if set == nil {
+		return 0, 0
+	}
+	for _, sel := range set.Selections {
+		var d, f int
+		switch s := sel.(type) {
+		case *ast.Field:
+			d, f = m.selectionSet(s.SelectionSet)
+			d, f = d+1, f+1
+		case *ast.InlineFragment:
+			d, f = m.selectionSet(s.SelectionSet)
+		case *ast.FragmentSpread:
+			d, f = m.fragment(s.Name.Value)
+		}
+		depth = max(depth, d)
+		fields += f
+	}
+	return depth, fields
+}
+
+func (m *queryMeasure) fragment(name string) (depth, fields int) {
+	if cached, ok := m.memo[name]; ok {
+		return cached[0], cached[1]
+	}
+	frag, ok := m.fragments[name]
+	// Unknown and cyclic fragments fail validation during execution
+	if !ok || m.visiting[name] {
+		return 0, 0
+	}
+
+	m.visiting[name] = true
+	depth, fields = m.selectionSet(frag.SelectionSet)
+	delete(m.visiting, name)
+
+	m.memo[name] = [2]int{depth, fields}
+	return depth, fields
+}
@@ -0,0 +1,200 @@
+package micro
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+)
+
+// newGraphQLSchema has a recursive user type, so tests can nest queries
+// freely, and a rename mutation
+func newGraphQLSchema(t *testing.T) graphql.Schema {
+	t.Helper()
+	var user *graphql.Object
+	user = graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"name": &graphql.Field{Type: graphql.String},
+				"friend": &graphql.Field{
+					Type:    user,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) { return p.Source, nil },
+				},
+			}
+		}),
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"me": &graphql.Field{
+					Type: user,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return map[string]interface{}{"name": "Ada"}, nil
+					},
+				},
+				// requestId shows resolvers run with the request context
+				"requestId": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Context.Value(contextKeyRequestID), nil
+					},
+				},
+			},
+		}),
+		Mutation: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Mutation",
+			Fields: graphql.Fields{
+				"rename": &graphql.Field{
+					Type: graphql.String,
+					Args: graphql.FieldConfigArgument{"name": &graphql.ArgumentConfig{Type: graphql.String}},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Args["name"], nil
+					},
+				},
+			},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+type graphQLResponse struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func graphQLPost(h http.Handler, body string) (*httptest.ResponseRecorder, graphQLResponse) {
+	r := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := serve(h, r)
+	var resp graphQLResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+func TestGraphQLSmoke(t *testing.T) {
+	app := newTestApp(t)
+	app.GraphQL("/graphql", newGraphQLSchema(t), GraphQLOptions{})
+	h := app.Handler()
+
+	w, resp := graphQLPost(h, `{"query":"{ me { name friend { name } } requestId }"}`)
+	if w.Code != http.StatusOK || len(resp.Errors) != 0 {
+		t.Fatalf("status = %d, errors = %v", w.Code, resp.Errors)
+	}
+	me := resp.Data["me"].(map[string]interface{})
+	if me["name"] != "Ada" || me["friend"].(map[string]interface{})["name"] != "Ada" {
+		t.Errorf("me = %v", me)
+	}
+	if id := w.Header().Get("X-Request-ID"); id == "" || resp.Data["requestId"] != id {
+		t.Errorf("resolver saw request ID %v, response has %q", resp.Data["requestId"], id)
+	}
+
+	w, resp = graphQLPost(h, `{"query":"mutation($n: String) { rename(name: $n) }","variables":{"n":"Grace"}}`)
+	if w.Code != http.StatusOK || resp.Data["rename"] != "Grace" {
+		t.Errorf("mutation: status = %d, data = %v, errors = %v", w.Code, resp.Data, resp.Errors)
+	}
+}
+
+func TestGraphQLGet(t *testing.T) {
+	app := newTestApp(t)
+	app.GraphQL("/graphql", newGraphQLSchema(t), GraphQLOptions{})
+	h := app.Handler()
+
+	get := func(query string) *httptest.ResponseRecorder {
+		return serve(h, httptest.NewRequest(http.MethodGet, "/graphql?query="+url.QueryEscape(query), nil))
+	}
+	if w := get("{ me { name } }"); w.Code != http.StatusOK {
+		t.Errorf("query over GET: status = %d", w.Code)
+	}
+	// A cross-site GET must not be able to run a mutation
+	w := get(`mutation { rename(name: "x") }`)
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("mutation over GET: status = %d, Allow = %q", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	app := newTestApp(t)
+	app.GraphQL("/graphql", newGraphQLSchema(t), GraphQLOptions{MaxDepth: 3, MaxComplexity: 5})
+	h := app.Handler()
+
+	tests := []struct {
+		name  string
+		query string
+		error string
+	}{
+		{"within limits", "{ me { friend { name } } }", ""},
+		{"too deep", "{ me { friend { friend { name } } } }", "depth 4"},
+		{"too deep through fragment", "{ me { ...F } } fragment F on User { friend { friend { name } } }", "depth 4"},
+		{"too many fields", "{ me { name a: name b: name c: name d: name } }", "selects 6 fields"},
+		// Cyclic fragments fail validation instead of hanging the measure
+		{"cyclic fragment", "{ me { ...A } } fragment A on User { friend { ...A } }", "Cannot spread fragment"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]string{"query": tt.query})
+			w, resp := graphQLPost(h, string(body))
+			if tt.error == "" {
+				if w.Code != http.StatusOK || len(resp.Errors) != 0 {
+					t.Errorf("status = %d, errors = %v", w.Code, resp.Errors)
+				}
+				return
+			}
+			if len(resp.Errors) == 0 || !strings.Contains(resp.Errors[0].Message, tt.error) {
+				t.Errorf("status = %d, errors = %v, want %q", w.Code, resp.Errors, tt.error)
+			}
+		})
+	}
+}
+
+func TestGraphQLBadRequests(t *testing.T) {
+	app := newTestApp(t)
+	app.GraphQL("/graphql", newGraphQLSchema(t), GraphQLOptions{MaxBodyBytes: 64})
+	h := app.Handler()
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"not json", `query { me }`, http.StatusBadRequest},
+		{"no query", `{"query":""}`, http.StatusBadRequest},
+		{"body too large", `{"query":"{ me { name } }","variables":{"pad":"` + strings.Repeat("x", 64) + `"}}`, http.StatusBadRequest},
+		// Execution errors are reported in a 200 response
+		{"unknown field", `{"query":"{ nope }"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w, _ := graphQLPost(h, tt.body); w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
+
+func TestGraphQLAppliesAppMiddleware(t *testing.T) {
+	app := newTestApp(t)
+	app.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	app.GraphQL("/graphql", newGraphQLSchema(t), GraphQLOptions{})
+
+	if w, _ := graphQLPost(app.Handler(), `{"query":"{ me { name } }"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
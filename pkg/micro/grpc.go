@@ -0,0 +1,153 @@
+package micro
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcRequestIDKey is the metadata key carrying request IDs, the gRPC
+// counterpart of the X-Request-ID header
+const grpcRequestIDKey = "x-request-id"
+
+// GRPCServer returns the app's gRPC server, creating it on first use with
+// interceptors mirroring the HTTP middleware: request ID, request scope,
+// logging, metrics and panic recovery. opts only apply to that first call;
+// interceptors passed with grpc.ChainUnaryInterceptor run inside the
+// built-in ones.
+//
+// Register services before Start, which then serves them on GRPCPort and
+// stops them gracefully together with the HTTP server:
+//
+//	pb.RegisterUserServiceServer(app.GRPCServer(), userServer)
+func (a *App) GRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	if a.grpcServer == nil {
+		opts = append([]grpc.ServerOption{
+			grpc.ChainUnaryInterceptor(a.unaryServerInterceptor),
+			grpc.ChainStreamInterceptor(a.streamServerInterceptor),
+		}, opts...)
+		a.grpcServer = grpc.NewServer(opts...)
+	}
+	return a.grpcServer
+}
+
+func (a *App) unaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var resp interface{}
+	err := a.grpcCall(ctx, info.FullMethod, func(ctx context.Context) error {
+		var err error
+		resp, err = handler(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+func (a *App) streamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return a.grpcCall(ss.Context(), info.FullMethod, func(ctx context.Context) error {
+		return handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+	})
+}
+
+// contextServerStream overrides the stream context so handlers see the
+// request ID and logger
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcCall runs one RPC with the request ID, request scope and logger in
+// its context, turning panics into codes.Internal and recording the access
+// log and metrics
+func (a *App) grpcCall(ctx context.Context, method string, call func(context.Context) error) (err error) {
+	start := time.Now()
+	a.inFlight.Add(1)
+	defer a.inFlight.Add(-1)
+
+	var requestID string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(grpcRequestIDKey); len(ids) > 0 {
+			requestID = a.acceptRequestID(ids[0])
+		}
+	}
+	if requestID == "" {
+		requestID = a.newRequestID()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(grpcRequestIDKey, requestID))
+
+	ctx = context.WithValue(ctx, contextKeyRequestID, requestID)
+	ctx = WithRequestScope(ctx)
+	fields := append([]zap.Field{zap.String("request_id", requestID)}, traceFields(ctx)...)
+	ctx = context.WithValue(ctx, contextKeyLogger, a.Logger.With(fields...).With(zap.String("method", method)))
+
+	defer func() {
+		if p := recover(); p != nil {
+			a.Logger.Error("panic recovered",
+				zap.Any("error", p),
+				zap.String("request_id", requestID),
+			)
+			err = status.Error(codes.Internal, "internal server error")
+		}
+
+		code := status.Code(err)
+		duration := time.Since(start)
+		if a.Config.MetricsEnabled {
+			a.metrics.grpcRequestsTotal.WithLabelValues(method, code.String()).Inc()
+			observeWithTrace(ctx, a.metrics.grpcRequestDuration.WithLabelValues(method), duration.Seconds())
+		}
+		a.Logger.Info("grpc request processed", append([]zap.Field{
+			zap.String("method", method),
+			zap.String("code", code.String()),
+			zap.Duration("duration", duration),
+		}, fields...)...)
+	}()
+
+	return call(ctx)
+}
+
+// serveGRPC serves the gRPC server on GRPCPort until it is stopped,
+// reporting listen and serve failures on errs
+func (a *App) serveGRPC(errs chan<- error) {
+	addr := fmt.Sprintf(":%d", a.Config.GRPCPort)
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		errs <- &ServerError{Addr: addr, Err: err}
+		return
+	}
+
+	a.Logger.Info("grpc server starting", zap.String("addr", addr))
+	if err := a.grpcServer.Serve(lis); err != nil {
+		errs <- &ServerError{Addr: addr, Err: err}
+	}
+}
+
+// stopGRPC drains in-flight RPCs, closing the remaining connections when
+// ctx expires first. It reports whether the stop was graceful.
+func (a *App) stopGRPC(ctx context.Context) bool {
+	if a.grpcServer == nil {
+		return true
+	}
+
+	done := make(chan struct{})
+	go func() {
+		a.grpcServer.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		a.grpcServer.Stop()
+		return false
+	}
+}
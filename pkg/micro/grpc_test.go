@@ -0,0 +1,146 @@
+package micro
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// echoHealthServer reports the request ID it sees as the service status
+// message of a health check and panics for the "panic" service
+type echoHealthServer struct {
+	healthpb.UnimplementedHealthServer
+	seen chan string
+}
+
+func (s *echoHealthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if req.Service == "panic" {
+		panic("boom")
+	}
+	id, _ := ctx.Value(contextKeyRequestID).(string)
+	s.seen <- id
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+func (s *echoHealthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	id, _ := stream.Context().Value(contextKeyRequestID).(string)
+	s.seen <- id
+	return stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING})
+}
+
+// startGRPCApp starts app with srv registered and returns a client
+// connected to its gRPC port
+func startGRPCApp(t *testing.T, app *App, srv healthpb.HealthServer) (healthpb.HealthClient, <-chan error) {
+	t.Helper()
+	app.Config.GRPCPort = freePort(t)
+	healthpb.RegisterHealthServer(app.GRPCServer(), srv)
+	_, done := startApp(t, app)
+
+	conn, err := grpc.NewClient(fmt.Sprintf("127.0.0.1:%d", app.Config.GRPCPort),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn), done
+}
+
+func TestGRPCServer(t *testing.T) {
+	app := newTestApp(t, func(c *Config) { c.RequestIDPattern = `[a-z0-9-]+` })
+	srv := &echoHealthServer{seen: make(chan string, 4)}
+	client, done := startGRPCApp(t, app, srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var header metadata.MD
+	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true), grpc.Header(&header))
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("status = %v", resp.Status)
+	}
+	ids := header.Get(grpcRequestIDKey)
+	if seen := <-srv.seen; len(ids) != 1 || seen == "" || seen != ids[0] {
+		t.Errorf("handler saw request ID %q, response header has %v", seen, ids)
+	}
+
+	// An accepted upstream ID is propagated, as with X-Request-ID
+	upstream := metadata.AppendToOutgoingContext(ctx, grpcRequestIDKey, "req-123")
+	if _, err := client.Check(upstream, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if seen := <-srv.seen; seen != "req-123" {
+		t.Errorf("upstream request ID replaced by %q", seen)
+	}
+
+	// Streams get the same context
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	if seen := <-srv.seen; seen == "" {
+		t.Error("stream handler has no request ID")
+	}
+
+	// Panics are recovered per call
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{Service: "panic"})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("panicking call err = %v, want %v", err, codes.Internal)
+	}
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Errorf("server unusable after a panic: %v", err)
+	}
+	<-srv.seen
+
+	const method = "/grpc.health.v1.Health/Check"
+	if n := testutil.ToFloat64(app.metrics.grpcRequestsTotal.WithLabelValues(method, "OK")); n != 3 {
+		t.Errorf("OK calls recorded = %v, want 3", n)
+	}
+	if n := testutil.ToFloat64(app.metrics.grpcRequestsTotal.WithLabelValues(method, "Internal")); n != 1 {
+		t.Errorf("Internal calls recorded = %v, want 1", n)
+	}
+
+	sendShutdownSignal(t)
+	if err := waitStart(t, done); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err == nil {
+		t.Error("gRPC server still serving after shutdown")
+	}
+}
+
+func TestGRPCServerPortInUse(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.GRPCPort = freePort(t)
+	healthpb.RegisterHealthServer(app.GRPCServer(), &echoHealthServer{})
+
+	// Hold the gRPC port so serving it fails
+	other := newTestApp(t)
+	other.Config.GRPCPort = app.Config.GRPCPort
+	healthpb.RegisterHealthServer(other.GRPCServer(), &echoHealthServer{})
+	_, otherDone := startApp(t, other)
+
+	app.Config.Port = freePort(t)
+	err := app.Start()
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprint(app.Config.GRPCPort)) {
+		t.Errorf("Start err = %v, want a listen error for the gRPC port", err)
+	}
+
+	sendShutdownSignal(t)
+	waitStart(t, otherDone)
+}
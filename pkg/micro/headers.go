@@ -0,0 +1,109 @@
+package micro
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// RequireHeaders rejects requests missing any of the named headers with a
+// 400 listing them
+func (a *App) RequireHeaders(names ...string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var missing []string
+			details := map[string]string{}
+			for _, name := range names {
+				if r.Header.Get(name) == "" {
+					missing = append(missing, name)
+					details[name] = "required"
+				}
+			}
+
+			if len(missing) > 0 {
+				a.handleError(w, r, NewAPIError(http.StatusBadRequest,
+					"missing required headers: "+strings.Join(missing, ", "), details))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireHeaderValue rejects requests whose header name is not exactly value
+// with a 400, e.g. to gate an API version
+func (a *App) RequireHeaderValue(name, value string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if got := r.Header.Get(name); got != value {
+				a.handleError(w, r, NewAPIError(http.StatusBadRequest,
+					"header "+name+" must be "+value, map[string]string{name: "must be " + value}))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bodilessMethods are not checked by RequireContentType
+var bodilessMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// RequireContentType rejects requests whose Content-Type is missing or not
+// one of types with a 415. Parameters such as charset are ignored. With no
+// types, application/json is required. Bodiless methods are not checked.
+func (a *App) RequireContentType(types ...string) mux.MiddlewareFunc {
+	if len(types) == 0 {
+		types = []string{"application/json"}
+	}
+	allowed := make(map[string]bool, len(types))
+	for _, t := range types {
+		allowed[strings.ToLower(t)] = true
+	}
+	expected := strings.Join(types, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if bodilessMethods[r.Method] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ct := r.Header.Get("Content-Type")
+			mt, _, err := mime.ParseMediaType(ct)
+			if ct == "" || err != nil || !allowed[mt] {
+				a.handleError(w, r, NewAPIError(http.StatusUnsupportedMediaType,
+					"unsupported content type", map[string]string{
+						"content_type": ct,
+						"expected":     expected,
+					}))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireHeaders makes every route in the group require the named headers
+func (g *RouterGroup) RequireHeaders(names ...string) *RouterGroup {
+	return g.WithMiddleware(g.app.RequireHeaders(names...))
+}
+
+// RequireHeaderValue makes every route in the group require header name to
+// equal value
+func (g *RouterGroup) RequireHeaderValue(name, value string) *RouterGroup {
+	return g.WithMiddleware(g.app.RequireHeaderValue(name, value))
+}
+
+// RequireContentType makes every route in the group require one of the
+// given content types
+func (g *RouterGroup) RequireContentType(types ...string) *RouterGroup {
+	return g.WithMiddleware(g.app.RequireContentType(types...))
+}
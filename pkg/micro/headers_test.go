@@ -0,0 +1,165 @@
+package micro
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequireHeaders(t *testing.T) {
+	app := newTestApp(t)
+	h := app.RequireHeaders("X-API-Version", "Accept")(http.HandlerFunc(okHTTPHandler))
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+		message string
+	}{
+		{"present", map[string]string{"X-API-Version": "2", "Accept": "application/json"}, http.StatusOK, ""},
+		{"one missing", map[string]string{"Accept": "application/json"}, http.StatusBadRequest, "missing required headers: X-API-Version"},
+		{"all missing", nil, http.StatusBadRequest, "missing required headers: X-API-Version, Accept"},
+		{"empty value", map[string]string{"X-API-Version": "", "Accept": "application/json"}, http.StatusBadRequest, "missing required headers: X-API-Version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			w := serve(h, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.message != "" {
+				if msg := decodeBody(t, w)["message"]; msg != tt.message {
+					t.Errorf("message = %v, want %q", msg, tt.message)
+				}
+			}
+		})
+	}
+}
+
+func TestRequireHeaderValue(t *testing.T) {
+	app := newTestApp(t)
+	h := app.RequireHeaderValue("X-API-Version", "2")(http.HandlerFunc(okHTTPHandler))
+
+	for value, status := range map[string]int{
+		"2":  http.StatusOK,
+		"1":  http.StatusBadRequest,
+		"20": http.StatusBadRequest,
+		"":   http.StatusBadRequest,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if value != "" {
+			r.Header.Set("X-API-Version", value)
+		}
+		if w := serve(h, r); w.Code != status {
+			t.Errorf("X-API-Version %q: status = %d, want %d", value, w.Code, status)
+		}
+	}
+}
+
+func TestRouterGroupRequireHeaders(t *testing.T) {
+	app := newTestApp(t)
+	app.Group("/v2").RequireHeaderValue("X-API-Version", "2").GET("/users", okHandler)
+	app.Group("/v1").RequireHeaders("X-API-Version").GET("/users", okHandler)
+	app.GET("/public", okHandler)
+	h := app.Handler()
+
+	tests := []struct {
+		path    string
+		version string
+		status  int
+	}{
+		{"/v2/users", "2", http.StatusOK},
+		{"/v2/users", "1", http.StatusBadRequest},
+		{"/v1/users", "1", http.StatusOK},
+		{"/v1/users", "", http.StatusBadRequest},
+		// Routes outside the groups are unaffected
+		{"/public", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.version != "" {
+			r.Header.Set("X-API-Version", tt.version)
+		}
+		if w := serve(h, r); w.Code != tt.status {
+			t.Errorf("%s with version %q: status = %d, want %d", tt.path, tt.version, w.Code, tt.status)
+		}
+	}
+}
+
+func TestRequireContentType(t *testing.T) {
+	app := newTestApp(t)
+	jsonOnly := app.RequireContentType()(http.HandlerFunc(okHTTPHandler))
+	jsonOrForm := app.RequireContentType("application/json", "application/x-www-form-urlencoded")(http.HandlerFunc(okHTTPHandler))
+
+	tests := []struct {
+		name        string
+		h           http.Handler
+		method      string
+		contentType string
+		status      int
+	}{
+		{"json", jsonOnly, http.MethodPost, "application/json", http.StatusOK},
+		{"parameters ignored", jsonOnly, http.MethodPut, "application/json; charset=utf-8", http.StatusOK},
+		{"case insensitive", jsonOnly, http.MethodPost, "Application/JSON", http.StatusOK},
+		{"missing", jsonOnly, http.MethodPost, "", http.StatusUnsupportedMediaType},
+		{"wrong", jsonOnly, http.MethodPatch, "text/plain", http.StatusUnsupportedMediaType},
+		{"malformed", jsonOnly, http.MethodPost, "application/", http.StatusUnsupportedMediaType},
+		{"bodiless method", jsonOnly, http.MethodGet, "", http.StatusOK},
+		{"delete", jsonOnly, http.MethodDelete, "", http.StatusOK},
+		{"second allowed type", jsonOrForm, http.MethodPost, "application/x-www-form-urlencoded", http.StatusOK},
+		{"not in allowed set", jsonOrForm, http.MethodPost, "multipart/form-data", http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", strings.NewReader("{}"))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			if w := serve(tt.h, r); w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestRouterGroupRequireContentType(t *testing.T) {
+	app := newTestApp(t)
+	app.Group("/api").RequireContentType().POST("/users", okHandler)
+	h := app.Handler()
+
+	if w := serve(h, httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader("{}"))); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("missing Content-Type status = %d, want %d", w.Code, http.StatusUnsupportedMediaType)
+	}
+}
+
+func TestDecodeStrictContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		strict      bool
+		contentType string
+		wantCode    int
+	}{
+		{"lenient without header", false, "", 0},
+		{"strict without header", true, "", http.StatusUnsupportedMediaType},
+		{"strict with header", true, "application/json", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, func(c *Config) { c.StrictContentType = tt.strict })
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"Ada","email":"ada@example.com"}`))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			var v signupForm
+			err := app.Decode(r, &v)
+			if code := apiErrorCode(err); code != tt.wantCode || (tt.wantCode == 0 && err != nil) {
+				t.Errorf("Decode err = %v, want status %d", err, tt.wantCode)
+			}
+		})
+	}
+}
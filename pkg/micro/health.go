@@ -2,22 +2,62 @@ package micro
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"sync"
 	"time"
+
+	"go.uber.org/zap"
 )
 
-// Health check management
+// Health check management. Checks may be added while the app is serving.
 func (a *App) AddHealthCheck(name string, check HealthCheck) {
+	a.healthMu.Lock()
 	a.healthChecks[name] = check
+	if check.CacheFor > 0 && a.healthCache == nil {
+		a.healthCache = newHealthCache(a)
+		a.RegisterWorker(a.healthCache)
+	}
+	cache := a.healthCache
+	a.healthMu.Unlock()
+
+	if check.CacheFor > 0 {
+		cache.watch(name)
+	}
+}
+
+// healthCheck returns the check registered under name
+func (a *App) healthCheck(name string) (HealthCheck, bool) {
+	a.healthMu.RLock()
+	defer a.healthMu.RUnlock()
+	check, ok := a.healthChecks[name]
+	return check, ok
+}
+
+// healthCheckSnapshot returns a copy of the registered checks that is safe
+// to range over while checks are added
+func (a *App) healthCheckSnapshot() map[string]HealthCheck {
+	a.healthMu.RLock()
+	defer a.healthMu.RUnlock()
+	checks := make(map[string]HealthCheck, len(a.healthChecks))
+	for name, check := range a.healthChecks {
+		checks[name] = check
+	}
+	return checks
 }
 
 func (a *App) healthHandler(w http.ResponseWriter, r *http.Request) {
-	if len(a.healthChecks) == 0 {
+	checks := a.healthCheckSnapshot()
+	if len(checks) == 0 {
 		a.JSON(w, http.StatusOK, map[string]string{"status": "OK"})
 		return
 	}
 
+	start := RequestStartTime(r.Context())
+	if start.IsZero() {
+		start = time.Now()
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
@@ -25,28 +65,50 @@ func (a *App) healthHandler(w http.ResponseWriter, r *http.Request) {
 	var mu sync.Mutex
 	var wg sync.WaitGroup
 
-	for name, hc := range a.healthChecks {
+	// A bounded pool of workers runs the checks; checks beyond the limit
+	// queue until a worker frees up or the overall timeout expires
+	workers := a.Config.HealthCheckConcurrency
+	if workers <= 0 || workers > len(checks) {
+		workers = len(checks)
+	}
+	type namedCheck struct {
+		name  string
+		check HealthCheck
+	}
+	queue := make(chan namedCheck, len(checks))
+	for name, hc := range checks {
+		queue <- namedCheck{name: name, check: hc}
+	}
+	close(queue)
+
+	for i := 0; i < workers; i++ {
 		wg.Add(1)
-		go func(name string, check HealthCheck) {
+		a.Go(ctx, func() {
 			defer wg.Done()
-
-			err := check.Check(ctx)
-			mu.Lock()
-			defer mu.Unlock()
-
-			if err != nil {
-				results[name] = map[string]interface{}{
-					"status":    "unhealthy",
-					"error":     err.Error(),
-					"timestamp": time.Now().UTC(),
+			for nc := range queue {
+				result := healthResult{err: ctx.Err(), at: time.Now().UTC()}
+				if result.err == nil {
+					result = a.checkHealth(ctx, nc.name, nc.check)
 				}
-			} else {
-				results[name] = map[string]interface{}{
-					"status":    "healthy",
-					"timestamp": time.Now().UTC(),
+
+				mu.Lock()
+				if result.err != nil {
+					results[nc.name] = map[string]interface{}{
+						"status":    "unhealthy",
+						"critical":  !nc.check.NonCritical,
+						"error":     result.err.Error(),
+						"timestamp": result.at,
+					}
+				} else {
+					results[nc.name] = map[string]interface{}{
+						"status":    "healthy",
+						"critical":  !nc.check.NonCritical,
+						"timestamp": result.at,
+					}
 				}
+				mu.Unlock()
 			}
-		}(name, hc)
+		})
 	}
 
 	wg.Wait()
@@ -56,19 +118,46 @@ func (a *App) healthHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A failing critical check takes the service down; failing
+	// non-critical checks only degrade it
 	status := http.StatusOK
+	degraded := false
 	for _, result := range results {
-		if result.(map[string]interface{})["status"] != "healthy" {
+		check := result.(map[string]interface{})
+		if check["status"] == "healthy" {
+			continue
+		}
+		if check["critical"].(bool) {
 			status = http.StatusServiceUnavailable
-			break
+		} else {
+			degraded = true
 		}
 	}
 
 	response := map[string]interface{}{
 		"status":   http.StatusText(status),
 		"checks":   results,
-		"duration": time.Since(ctx.Value("start_time").(time.Time)).String(),
+		"duration": time.Since(start).String(),
+	}
+	if status == http.StatusOK && degraded {
+		response["status"] = "degraded"
+		response["warning"] = "one or more non-critical checks are failing"
 	}
 
 	a.JSON(w, status, response)
 }
+
+// runHealthCheck runs a check, converting a panic into an error so a buggy
+// check marks itself unhealthy instead of crashing the server
+func (a *App) runHealthCheck(ctx context.Context, name string, check HealthCheck) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			LoggerFromContext(ctx).Error("health check panicked",
+				zap.String("check", name),
+				zap.Any("panic", rec),
+			)
+			err = fmt.Errorf("health check panicked: %v", rec)
+		}
+	}()
+	return check.Check(ctx)
+}
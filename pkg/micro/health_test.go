@@ -0,0 +1,144 @@
+package micro
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// healthChecks decodes the per-check results of a health response
+func healthChecks(t *testing.T, body map[string]interface{}) map[string]map[string]interface{} {
+	t.Helper()
+	raw, ok := body["checks"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("body %v has no checks", body)
+	}
+	checks := make(map[string]map[string]interface{}, len(raw))
+	for name, c := range raw {
+		checks[name] = c.(map[string]interface{})
+	}
+	return checks
+}
+
+func TestHealthCheckPanicIsRecovered(t *testing.T) {
+	app := newTestApp(t)
+	app.AddHealthCheck("cache", HealthCheck{Check: func(ctx context.Context) error {
+		var m map[string]int
+		m["boom"]++ // Panics on the nil map
+		return nil
+	}})
+	app.AddHealthCheck("db", HealthCheck{Check: func(ctx context.Context) error { return nil }})
+
+	w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/health", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	checks := healthChecks(t, decodeBody(t, w))
+	if checks["cache"]["status"] != "unhealthy" || checks["cache"]["error"] == "" {
+		t.Errorf("cache = %v, want unhealthy with the panic message", checks["cache"])
+	}
+	if checks["db"]["status"] != "healthy" {
+		t.Errorf("db = %v, want healthy", checks["db"])
+	}
+}
+
+func TestHealthStatusAggregation(t *testing.T) {
+	healthy := func(ctx context.Context) error { return nil }
+	failing := func(ctx context.Context) error { return errors.New("connection refused") }
+
+	tests := []struct {
+		name   string
+		checks map[string]HealthCheck
+		status int
+		want   string
+	}{
+		{"all healthy", map[string]HealthCheck{
+			"db":    {Check: healthy},
+			"cache": {Check: healthy, NonCritical: true},
+		}, http.StatusOK, "OK"},
+		{"non-critical down", map[string]HealthCheck{
+			"db":    {Check: healthy},
+			"cache": {Check: failing, NonCritical: true},
+		}, http.StatusOK, "degraded"},
+		{"critical down", map[string]HealthCheck{
+			"db":    {Check: failing},
+			"cache": {Check: failing, NonCritical: true},
+		}, http.StatusServiceUnavailable, "Service Unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			for name, check := range tt.checks {
+				app.AddHealthCheck(name, check)
+			}
+
+			w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/health", nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			body := decodeBody(t, w)
+			if body["status"] != tt.want {
+				t.Errorf("overall status = %v, want %q", body["status"], tt.want)
+			}
+			if _, warned := body["warning"]; warned != (tt.want == "degraded") {
+				t.Errorf("warning = %v, want one only when degraded", body["warning"])
+			}
+
+			// Checks are critical unless marked NonCritical
+			checks := healthChecks(t, body)
+			for name, check := range tt.checks {
+				if checks[name]["critical"] != !check.NonCritical {
+					t.Errorf("%s critical = %v, want %v", name, checks[name]["critical"], !check.NonCritical)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthCheckConcurrencyIsBounded(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		want  int32
+	}{
+		{"limited", 4, 4},
+		// Zero runs every check at once
+		{"unlimited", 0, 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, func(c *Config) { c.HealthCheckConcurrency = tt.limit })
+			var running, peak atomic.Int32
+			for i := range 40 {
+				app.AddHealthCheck(fmt.Sprintf("dep-%d", i), HealthCheck{Check: func(ctx context.Context) error {
+					n := running.Add(1)
+					defer running.Add(-1)
+					for p := peak.Load(); n > p; p = peak.Load() {
+						if peak.CompareAndSwap(p, n) {
+							break
+						}
+					}
+					time.Sleep(20 * time.Millisecond)
+					return nil
+				}})
+			}
+
+			w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/health", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			// Queued checks still run within the overall timeout
+			if n := len(healthChecks(t, decodeBody(t, w))); n != 40 {
+				t.Errorf("%d checks reported, want 40", n)
+			}
+			if p := peak.Load(); p != tt.want {
+				t.Errorf("peak concurrency = %d, want %d", p, tt.want)
+			}
+		})
+	}
+}
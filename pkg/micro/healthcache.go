@@ -0,0 +1,167 @@
+package micro
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// healthResult is the outcome of a health check run
+type healthResult struct {
+	err error
+	at  time.Time
+}
+
+// healthCache keeps the latest result of checks with a CacheFor window and
+// refreshes them in the background. It is a Worker registered by
+// AddHealthCheck.
+type healthCache struct {
+	app      *App
+	mu       sync.Mutex
+	results  map[string]healthResult
+	group    singleflight.Group
+	ctx      context.Context // Set by Start; refreshers run until it is done
+	watching map[string]bool // Checks with a running refresher
+	stopped  bool
+	wg       sync.WaitGroup
+	done     chan struct{}
+}
+
+func newHealthCache(a *App) *healthCache {
+	return &healthCache{
+		app:      a,
+		results:  make(map[string]healthResult),
+		watching: make(map[string]bool),
+		done:     make(chan struct{}),
+	}
+}
+
+// checkHealth runs a check, reusing its cached result while it is fresher
+// than CacheFor. Concurrent probes of a stale check share one run.
+func (a *App) checkHealth(ctx context.Context, name string, check HealthCheck) healthResult {
+	a.healthMu.RLock()
+	c := a.healthCache
+	a.healthMu.RUnlock()
+	if check.CacheFor <= 0 || c == nil {
+		return healthResult{err: a.runHealthCheck(ctx, name, check), at: time.Now().UTC()}
+	}
+
+	c.mu.Lock()
+	result, ok := c.results[name]
+	c.mu.Unlock()
+	if ok && time.Since(result.at) < check.CacheFor {
+		return result
+	}
+
+	v, _, _ := c.group.Do(name, func() (interface{}, error) {
+		return c.refresh(ctx, name, check), nil
+	})
+	return v.(healthResult)
+}
+
+func (c *healthCache) refresh(ctx context.Context, name string, check HealthCheck) healthResult {
+	result := healthResult{err: c.app.runHealthCheck(ctx, name, check), at: time.Now().UTC()}
+	// A probe that gave up is not a verdict on the dependency
+	if ctx.Err() == nil {
+		c.mu.Lock()
+		c.results[name] = result
+		c.mu.Unlock()
+	}
+	return result
+}
+
+// Start refreshes every cached check at half its CacheFor window, so probes
+// normally find a fresh result, until ctx is cancelled. Checks added while
+// it runs are refreshed too.
+func (c *healthCache) Start(ctx context.Context) {
+	defer close(c.done)
+
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		return
+	}
+	c.ctx = ctx
+	c.mu.Unlock()
+
+	for name := range c.app.healthCheckSnapshot() {
+		c.watch(name)
+	}
+
+	<-ctx.Done()
+	c.mu.Lock()
+	c.stopped = true
+	c.mu.Unlock()
+	c.wg.Wait()
+}
+
+// watch starts the background refresher of the named check if Start is
+// running and the check has none yet
+func (c *healthCache) watch(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ctx == nil || c.stopped || c.watching[name] {
+		return
+	}
+	c.watching[name] = true
+	c.wg.Add(1)
+	ctx := c.ctx
+	c.app.Go(ctx, func() {
+		defer c.wg.Done()
+		c.refreshLoop(ctx, name)
+	})
+}
+
+// refreshLoop refreshes the named check until ctx is done or the check is
+// no longer cached. The check is looked up on every run, so replacing it
+// with AddHealthCheck takes effect.
+func (c *healthCache) refreshLoop(ctx context.Context, name string) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.watching, name)
+		c.mu.Unlock()
+	}()
+
+	for {
+		check, ok := c.app.healthCheck(name)
+		if !ok || check.CacheFor <= 0 {
+			return
+		}
+		// A result older than the window is not served, so a run may take
+		// at most that long
+		checkCtx, cancel := context.WithTimeout(ctx, check.CacheFor)
+		c.group.Do(name, func() (interface{}, error) {
+			return c.refresh(checkCtx, name, check), nil
+		})
+		cancel()
+
+		timer := time.NewTimer(check.CacheFor / 2)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Stop waits for in-progress refreshes to finish. It returns right away if
+// Start never ran, e.g. when the app is only used through Handler.
+func (c *healthCache) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	started := c.ctx != nil
+	c.stopped = true
+	c.mu.Unlock()
+	if !started {
+		return nil
+	}
+
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,158 @@
+package micro
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthCacheReusesResultWithinWindow(t *testing.T) {
+	app := newTestApp(t)
+	var calls atomic.Int32
+	app.AddHealthCheck("db", HealthCheck{
+		Check: func(ctx context.Context) error {
+			calls.Add(1)
+			return nil
+		},
+		CacheFor: 100 * time.Millisecond,
+	})
+	h := app.Handler()
+
+	for range 3 {
+		serve(h, httptest.NewRequest(http.MethodGet, "/health", nil))
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("check ran %d times within the window, want 1", got)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	serve(h, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if got := calls.Load(); got != 2 {
+		t.Errorf("check ran %d times after the window, want 2", got)
+	}
+}
+
+func TestHealthCacheRefreshesChecksAddedAfterStart(t *testing.T) {
+	app := newTestApp(t)
+	app.AddHealthCheck("db", HealthCheck{
+		Check:    func(ctx context.Context) error { return nil },
+		CacheFor: time.Hour,
+	})
+	cache := app.healthCache
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go cache.Start(ctx)
+
+	// Added once the cache is running and never probed
+	var calls atomic.Int32
+	refreshed := make(chan struct{}, 1)
+	time.Sleep(10 * time.Millisecond)
+	app.AddHealthCheck("queue", HealthCheck{
+		Check: func(ctx context.Context) error {
+			if calls.Add(1) == 2 {
+				refreshed <- struct{}{}
+			}
+			return nil
+		},
+		CacheFor: 20 * time.Millisecond,
+	})
+
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatalf("check added after Start ran %d times, want it refreshed", calls.Load())
+	}
+
+	cancel()
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), time.Second)
+	defer stopCancel()
+	if err := cache.Stop(stopCtx); err != nil {
+		t.Errorf("Stop: %v", err)
+	}
+}
+
+func TestHealthCacheRefreshTimeoutFollowsWindow(t *testing.T) {
+	app := newTestApp(t)
+	deadline := make(chan time.Duration, 1)
+	app.AddHealthCheck("db", HealthCheck{
+		Check: func(ctx context.Context) error {
+			if d, ok := ctx.Deadline(); ok {
+				select {
+				case deadline <- time.Until(d):
+				default:
+				}
+			}
+			return nil
+		},
+		CacheFor: 200 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go app.healthCache.Start(ctx)
+
+	select {
+	case d := <-deadline:
+		if d > 200*time.Millisecond {
+			t.Errorf("refresh timeout = %v, want at most the 200ms window", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("check was not refreshed")
+	}
+}
+
+func TestHealthCacheStopWithoutStart(t *testing.T) {
+	app := newTestApp(t)
+	app.AddHealthCheck("db", HealthCheck{
+		Check:    func(ctx context.Context) error { return nil },
+		CacheFor: time.Minute,
+	})
+	serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := app.healthCache.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Stop took %v without Start", elapsed)
+	}
+}
+
+func TestAddHealthCheckWhileServing(t *testing.T) {
+	app := newTestApp(t)
+	app.AddHealthCheck("db", HealthCheck{
+		Check:    func(ctx context.Context) error { return nil },
+		CacheFor: 10 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go app.healthCache.Start(ctx)
+	h := app.Handler()
+
+	// Run with -race: adding checks must not race probes or the refresher
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := range 50 {
+			app.AddHealthCheck(fmt.Sprintf("check-%d", i), HealthCheck{
+				Check:    func(ctx context.Context) error { return nil },
+				CacheFor: 10 * time.Millisecond,
+			})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 50 {
+			serve(h, httptest.NewRequest(http.MethodGet, "/health", nil))
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,138 @@
+package micro
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"golang.org/x/text/language"
+)
+
+// Translator translates messages into the language negotiated for a
+// request. Messages are keyed by their English text, so untranslated
+// messages fall through unchanged.
+type Translator struct {
+	lang  language.Tag
+	chain []map[string]string // Catalogs in fallback order
+}
+
+// Language returns the negotiated language
+func (t *Translator) Language() language.Tag {
+	return t.lang
+}
+
+// T translates message, then formats it with args when any are given
+func (t *Translator) T(message string, args ...interface{}) string {
+	for _, messages := range t.chain {
+		if translated, ok := messages[message]; ok {
+			message = translated
+			break
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
+
+// Localizer returns the translator for the request in ctx. Outside a
+// request it returns one that leaves messages untranslated.
+func Localizer(ctx context.Context) *Translator {
+	if t, ok := ctx.Value(contextKeyTranslator).(*Translator); ok {
+		return t
+	}
+	return &Translator{lang: language.English}
+}
+
+// catalog holds the translations registered with AddTranslations
+type catalog struct {
+	mu       sync.RWMutex
+	fallback language.Tag
+	messages map[language.Tag]map[string]string
+	tags     []language.Tag // Supported languages, fallback first, then in registration order
+	matcher  language.Matcher
+}
+
+func newCatalog(fallback language.Tag) *catalog {
+	return &catalog{
+		fallback: fallback,
+		messages: make(map[language.Tag]map[string]string),
+		tags:     []language.Tag{fallback},
+	}
+}
+
+// AddTranslations registers messages for lang, a BCP 47 tag such as "es"
+// or "pt-BR", keyed by the English message. Error messages, validation
+// messages and handler messages translated with Localizer use them.
+// Calling it again for the same language adds to its messages.
+func (a *App) AddTranslations(lang string, messages map[string]string) error {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return fmt.Errorf("invalid language %q: %w", lang, err)
+	}
+
+	c := a.catalog
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	existing, ok := c.messages[tag]
+	if !ok {
+		existing = make(map[string]string, len(messages))
+		c.messages[tag] = existing
+		if tag != c.fallback {
+			c.tags = append(c.tags, tag)
+		}
+	}
+	for k, v := range messages {
+		existing[k] = v
+	}
+
+	c.matcher = language.NewMatcher(c.tags)
+	return nil
+}
+
+// translator negotiates the request language from an Accept-Language
+// header. The chain falls back from the matched language to its parents,
+// e.g. pt-BR to pt, and then to the default language.
+func (c *catalog) translator(acceptLanguage string) *Translator {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.matcher == nil {
+		return &Translator{lang: c.fallback}
+	}
+
+	lang := c.fallback
+	if tags, _, err := language.ParseAcceptLanguage(acceptLanguage); err == nil && len(tags) > 0 {
+		if _, index, confidence := c.matcher.Match(tags...); confidence != language.No {
+			lang = c.tags[index]
+		}
+	}
+
+	t := &Translator{lang: lang}
+	for tag := lang; tag != language.Und; tag = tag.Parent() {
+		if messages, ok := c.messages[tag]; ok {
+			t.chain = append(t.chain, messages)
+		}
+	}
+	if lang != c.fallback {
+		if messages, ok := c.messages[c.fallback]; ok {
+			t.chain = append(t.chain, messages)
+		}
+	}
+	return t
+}
+
+// localeMiddleware negotiates the response language for the request
+func (a *App) localeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := a.catalog.translator(r.Header.Get("Accept-Language"))
+		if len(t.chain) > 0 {
+			w.Header().Set("Content-Language", t.lang.String())
+			w.Header().Add("Vary", "Accept-Language")
+		}
+		ctx := context.WithValue(r.Context(), contextKeyTranslator, t)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,136 @@
+package micro
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLocalizedErrors(t *testing.T) {
+	app := newTestApp(t)
+	if err := app.AddTranslations("es", map[string]string{"user not found": "usuario no encontrado"}); err != nil {
+		t.Fatal(err)
+	}
+	app.GET("/users/{id}", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return NewAPIError(http.StatusNotFound, "user not found")
+	})
+	h := app.Handler()
+
+	tests := []struct {
+		name     string
+		accept   string
+		message  string
+		language string
+	}{
+		{"supported", "es", "usuario no encontrado", "es"},
+		{"regional variant", "es-MX,en;q=0.5", "usuario no encontrado", "es"},
+		{"preference order", "fr, es;q=0.8", "usuario no encontrado", "es"},
+		{"unsupported", "fr", "user not found", ""},
+		{"no header", "", "user not found", ""},
+		{"malformed header", ";;;", "user not found", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			r.Header.Set("Accept-Language", tt.accept)
+			w := serve(h, r)
+
+			if msg := decodeBody(t, w)["message"]; msg != tt.message {
+				t.Errorf("message = %q, want %q", msg, tt.message)
+			}
+			if got := w.Header().Get("Content-Language"); got != tt.language {
+				t.Errorf("Content-Language = %q, want %q", got, tt.language)
+			}
+		})
+	}
+}
+
+func TestLocalizedValidationMessages(t *testing.T) {
+	expose := true
+	app := newTestApp(t, func(c *Config) { c.ExposeErrorDetails = &expose })
+	app.AddTranslations("es", map[string]string{
+		"is required":         "es obligatorio",
+		"must be at least %s": "debe ser al menos %s",
+		"validation failed":   "validación fallida",
+	})
+
+	type signup struct {
+		Name string `json:"name" validate:"required"`
+		Age  int    `json:"age" validate:"min=18"`
+	}
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"age":12}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Accept-Language", "es")
+	w := httptest.NewRecorder()
+	app.localeMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var s signup
+		app.handleError(w, r, app.Decode(r, &s))
+	})).ServeHTTP(w, r)
+
+	body := decodeBody(t, w)
+	if body["message"] != "validación fallida" {
+		t.Errorf("message = %q", body["message"])
+	}
+	details, _ := body["details"].(map[string]interface{})
+	if details["name"] != "es obligatorio" || details["age"] != "debe ser al menos 18" {
+		t.Errorf("details = %v", body["details"])
+	}
+}
+
+func TestTranslationFallbackChain(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   [3]string // hello, bye, thanks
+	}{
+		// Regional, then parent language, then the default language
+		{"pt-BR", [3]string{"oi", "tchau", "danke"}},
+		{"pt-PT", [3]string{"olá", "tchau", "danke"}},
+		{"ja", [3]string{"hallo", "tschüss", "danke"}},
+	}
+	// Negotiation must not depend on map iteration order, so build the
+	// catalog several times
+	for i := 0; i < 20; i++ {
+		app := newTestApp(t, func(c *Config) { c.DefaultLanguage = "de" })
+		app.AddTranslations("de", map[string]string{"hello": "hallo", "bye": "tschüss", "thanks": "danke"})
+		app.AddTranslations("pt", map[string]string{"hello": "olá", "bye": "tchau"})
+		app.AddTranslations("pt-BR", map[string]string{"hello": "oi"})
+
+		for _, tt := range tests {
+			tr := app.catalog.translator(tt.accept)
+			got := [3]string{tr.T("hello"), tr.T("bye"), tr.T("thanks")}
+			if got != tt.want {
+				t.Fatalf("run %d: Accept-Language %q: got %v, want %v", i, tt.accept, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestLocalizerInHandlers(t *testing.T) {
+	app := newTestApp(t)
+	app.AddTranslations("fr", map[string]string{"%d items": "%d articles"})
+	var got string
+	app.GET("/cart", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		got = Localizer(ctx).T("%d items", 3)
+		return nil
+	})
+	r := httptest.NewRequest(http.MethodGet, "/cart", nil)
+	r.Header.Set("Accept-Language", "fr-CA")
+	serve(app.Handler(), r)
+	if got != "3 articles" {
+		t.Errorf("handler message = %q, want %q", got, "3 articles")
+	}
+
+	// Outside a request messages are formatted but not translated
+	if got := Localizer(context.Background()).T("%d items", 3); got != "3 items" {
+		t.Errorf("untranslated message = %q", got)
+	}
+}
+
+func TestAddTranslationsInvalidLanguage(t *testing.T) {
+	app := newTestApp(t)
+	if err := app.AddTranslations("not a language!", map[string]string{}); err == nil {
+		t.Error("AddTranslations accepted an invalid tag")
+	}
+}
@@ -1,12 +1,18 @@
 package micro
 
 import (
+	"container/list"
+	"crypto/subtle"
+	"fmt"
+	"hash/fnv"
+	"net"
 	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
-	"golang.org/x/time/rate"
 )
 
 // RateLimiterConfig represents the configuration for rate limiting
@@ -15,67 +21,217 @@ type RateLimiterConfig struct {
 	RequestsPerS float64       `envconfig:"RATE_LIMITER_REQUESTS_PER_SECOND" default:"100"`
 	Burst        int           `envconfig:"RATE_LIMITER_BURST" default:"50"`
 	TTL          time.Duration `envconfig:"RATE_LIMITER_TTL" default:"1h"`
-	// Strategy can be "ip", "token" or "global"
-	Strategy string `envconfig:"RATE_LIMITER_STRATEGY" default:"ip" validate:"oneof=ip token global"`
+	// Algorithm is "token-bucket" or "gcra", which keeps less state per visitor
+	Algorithm string `envconfig:"RATE_LIMITER_ALGORITHM" default:"token-bucket" validate:"omitempty,oneof=token-bucket gcra"`
+	// Strategy can be "ip", "token", "global" or "composite". "token" keys
+	// clients by the Authorization header, or by the verified principal once
+	// SetRateLimitAuthenticator is called.
+	Strategy string `envconfig:"RATE_LIMITER_STRATEGY" default:"ip" validate:"oneof=ip token global composite"`
+	// CompositeOrder lists the identifiers the composite strategy tries; the
+	// first one present keys the client, e.g. the token when authenticated
+	// and the IP otherwise
+	CompositeOrder []string `envconfig:"RATE_LIMITER_COMPOSITE_ORDER" default:"token,ip" validate:"dive,oneof=ip token global"`
+	// ExemptPaths are never limited; a trailing "*" matches by prefix
+	ExemptPaths []string `envconfig:"RATE_LIMITER_EXEMPT_PATHS" default:"/health,/metrics"`
+	// ExemptCIDRs are matched against the connection address, not
+	// X-Forwarded-For, so they cannot be spoofed by clients
+	ExemptCIDRs []string `envconfig:"RATE_LIMITER_EXEMPT_CIDRS"`
+	// InternalToken lets internal services bypass the limiter by sending it
+	// in InternalTokenHeader
+	InternalToken       string `envconfig:"RATE_LIMITER_INTERNAL_TOKEN"`
+	InternalTokenHeader string `envconfig:"RATE_LIMITER_INTERNAL_TOKEN_HEADER" default:"X-Internal-Token"`
+	// MaxVisitors caps tracked visitors; the least recently seen is evicted
+	// when exceeded. The cap is enforced per shard, so the total may exceed
+	// it slightly. Zero disables the cap.
+	MaxVisitors int `envconfig:"RATE_LIMITER_MAX_VISITORS" default:"100000"`
 }
 
+// rateLimiterShards is the number of independently locked visitor maps, so
+// requests from different clients rarely contend on the same mutex
+const rateLimiterShards = 32
+
 // rateLimiter handles rate limiting functionality
 type rateLimiter struct {
-	config   RateLimiterConfig
-	limiters map[string]*visitorLimiter
-	mu       sync.Mutex
-	cleanup  *time.Ticker
+	config      RateLimiterConfig
+	shards      [rateLimiterShards]*visitorShard
+	visitors    atomic.Int64
+	cleanup     *time.Ticker
+	exemptNets  []*net.IPNet
+	exemptPaths []string
+	metrics     *metrics
+}
+
+// visitorShard holds a slice of the visitors with LRU eviction
+type visitorShard struct {
+	mu          sync.Mutex
+	limiters    map[string]*list.Element
+	order       *list.List // Most recently seen first
+	maxVisitors int
 }
 
 type visitorLimiter struct {
-	limiter  *rate.Limiter
+	key      string
+	limiter  requestLimiter
 	lastSeen time.Time
 }
 
 // newRateLimiter creates a new rate limiter instance
-func newRateLimiter(config RateLimiterConfig) *rateLimiter {
+func newRateLimiter(config RateLimiterConfig, m *metrics) (*rateLimiter, error) {
+	exemptNets, err := parseCIDRs(config.ExemptCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("exempt CIDRs: %w", err)
+	}
+
 	rl := &rateLimiter{
-		config:   config,
-		limiters: make(map[string]*visitorLimiter),
-		cleanup:  time.NewTicker(10 * time.Minute),
+		config:      config,
+		cleanup:     time.NewTicker(10 * time.Minute),
+		exemptNets:  exemptNets,
+		exemptPaths: config.ExemptPaths,
+		metrics:     m,
+	}
+
+	// Split the visitor cap across shards, rounding up so the cap is never
+	// below the configured value
+	maxPerShard := 0
+	if config.MaxVisitors > 0 {
+		maxPerShard = (config.MaxVisitors + rateLimiterShards - 1) / rateLimiterShards
+	}
+	for i := range rl.shards {
+		rl.shards[i] = &visitorShard{
+			limiters:    make(map[string]*list.Element),
+			order:       list.New(),
+			maxVisitors: maxPerShard,
+		}
 	}
 
 	// Start cleanup goroutine
 	go rl.cleanupStaleVisitors()
 
-	return rl
+	return rl, nil
 }
 
-// getLimiter returns a rate limiter for a particular visitor
-func (rl *rateLimiter) getLimiter(key string) *rate.Limiter {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	v, exists := rl.limiters[key]
-	if !exists {
-		limiter := rate.NewLimiter(rate.Limit(rl.config.RequestsPerS), rl.config.Burst)
-		rl.limiters[key] = &visitorLimiter{
-			limiter:  limiter,
-			lastSeen: time.Now(),
+// isExempt reports whether the request bypasses rate limiting
+func (rl *rateLimiter) isExempt(r *http.Request) bool {
+	for _, p := range rl.exemptPaths {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				return true
+			}
+		} else if r.URL.Path == p {
+			return true
+		}
+	}
+
+	if token := rl.config.InternalToken; token != "" {
+		provided := r.Header.Get(rl.config.InternalTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1 {
+			return true
 		}
-		return limiter
 	}
 
-	// Update the last seen time
-	v.lastSeen = time.Now()
-	return v.limiter
+	return remoteAddrIn(r.RemoteAddr, rl.exemptNets)
 }
 
-// cleanupStaleVisitors removes visitors that haven't been seen for a while
+// RateLimitResolver chooses the limit for a request, e.g. from the plan of
+// the authenticated principal. Returning rps <= 0 falls back to the static
+// configuration.
+type RateLimitResolver func(r *http.Request) (rps float64, burst int)
+
+// SetRateLimitResolver sets a per-request limit resolver
+func (a *App) SetRateLimitResolver(resolver RateLimitResolver) {
+	a.rateLimitResolver = resolver
+}
+
+// resolveLimit returns the limit for the request and the limiter key. The
+// key includes the limit so tiers sharing a client ID get separate buckets.
+func (a *App) resolveLimit(r *http.Request, clientID string) (string, float64, int) {
+	rps, burst := a.Config.RateLimiter.RequestsPerS, a.Config.RateLimiter.Burst
+	if a.rateLimitResolver == nil {
+		return clientID, rps, burst
+	}
+
+	if tierRPS, tierBurst := a.rateLimitResolver(r); tierRPS > 0 {
+		rps, burst = tierRPS, tierBurst
+	}
+	return fmt.Sprintf("%s|%g|%d", clientID, rps, burst), rps, burst
+}
+
+// shard returns the shard owning key
+func (rl *rateLimiter) shard(key string) *visitorShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return rl.shards[h.Sum32()%rateLimiterShards]
+}
+
+// getLimiter returns a rate limiter for a particular visitor
+func (rl *rateLimiter) getLimiter(key string, rps float64, burst int) requestLimiter {
+	shard := rl.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if el, exists := shard.limiters[key]; exists {
+		// Update the last seen time
+		v := el.Value.(*visitorLimiter)
+		v.lastSeen = time.Now()
+		shard.order.MoveToFront(el)
+		return v.limiter
+	}
+
+	limiter := newRequestLimiter(rl.config.Algorithm, rps, burst)
+	shard.limiters[key] = shard.order.PushFront(&visitorLimiter{
+		key:      key,
+		limiter:  limiter,
+		lastSeen: time.Now(),
+	})
+	added := int64(1)
+
+	// Evicting an active visitor resets its limit, which is acceptable to
+	// keep memory bounded under a flood of unique keys
+	for shard.maxVisitors > 0 && shard.order.Len() > shard.maxVisitors {
+		shard.remove(shard.order.Back())
+		added--
+	}
+
+	rl.metrics.rateLimitVisitors.Set(float64(rl.visitors.Add(added)))
+	return limiter
+}
+
+// peekLimiter returns the limiter of a visitor without creating one or
+// refreshing its last seen time
+func (rl *rateLimiter) peekLimiter(key string) requestLimiter {
+	shard := rl.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if el, exists := shard.limiters[key]; exists {
+		return el.Value.(*visitorLimiter).limiter
+	}
+	return nil
+}
+
+func (s *visitorShard) remove(el *list.Element) {
+	s.order.Remove(el)
+	delete(s.limiters, el.Value.(*visitorLimiter).key)
+}
+
+// cleanupStaleVisitors removes visitors that haven't been seen for a while,
+// locking one shard at a time
 func (rl *rateLimiter) cleanupStaleVisitors() {
 	for range rl.cleanup.C {
-		rl.mu.Lock()
-		for key, v := range rl.limiters {
-			if time.Since(v.lastSeen) > rl.config.TTL {
-				delete(rl.limiters, key)
+		for _, shard := range rl.shards {
+			removed := int64(0)
+			shard.mu.Lock()
+			// The list is ordered by last seen, so stale visitors are at the back
+			for el := shard.order.Back(); el != nil; el = shard.order.Back() {
+				if time.Since(el.Value.(*visitorLimiter).lastSeen) <= rl.config.TTL {
+					break
+				}
+				shard.remove(el)
+				removed++
 			}
+			shard.mu.Unlock()
+			rl.metrics.rateLimitVisitors.Set(float64(rl.visitors.Add(-removed)))
 		}
-		rl.mu.Unlock()
 	}
 }
 
@@ -88,15 +244,52 @@ func (rl *rateLimiter) stop() {
 func (app *App) initRateLimiter() {
 	// Add the RateLimiterConfig to the main Config struct
 	if app.Config.RateLimiter.Enabled {
-		app.rateLimiter = newRateLimiter(app.Config.RateLimiter)
+		rl, err := newRateLimiter(app.Config.RateLimiter, app.metrics)
+		if err != nil {
+			app.Logger.Error("failed to initialize rate limiter", zap.Error(err))
+			return
+		}
+		app.rateLimiter = rl
 		// Register the rate limiting middleware
 		app.Use(app.rateLimiterMiddleware)
 	}
 }
 
+// SetRateLimitAuthenticator makes the "token" strategy key clients by the
+// principal authenticate verifies instead of the raw Authorization header.
+// It runs before route-level authentication. Requests without a verified
+// principal are keyed by IP, so a client cannot rotate made-up tokens to
+// get fresh buckets.
+func (a *App) SetRateLimitAuthenticator(authenticate Authenticator) {
+	a.rateLimitAuthenticator = authenticate
+}
+
 // getClientIdentifier extracts the client identifier based on the strategy
 func (a *App) getClientIdentifier(r *http.Request) string {
-	switch a.Config.RateLimiter.Strategy {
+	strategy := a.Config.RateLimiter.Strategy
+	if strategy != "composite" {
+		id := a.clientIdentifier(strategy, r)
+		if id == "" && strategy == "token" && a.rateLimitAuthenticator != nil {
+			// Prefixed so an IP never shares the bucket of a principal
+			return "ip:" + a.clientIdentifier("ip", r)
+		}
+		return id
+	}
+	order := a.Config.RateLimiter.CompositeOrder
+	if len(order) == 0 {
+		order = []string{"token", "ip"}
+	}
+	// Prefixed so a token and an IP never share a bucket
+	for _, strategy := range order {
+		if id := a.clientIdentifier(strategy, r); id != "" {
+			return strategy + ":" + id
+		}
+	}
+	return ""
+}
+
+func (a *App) clientIdentifier(strategy string, r *http.Request) string {
+	switch strategy {
 	case "ip":
 		// Extract IP from X-Forwarded-For or RemoteAddr
 		ip := r.Header.Get("X-Forwarded-For")
@@ -105,6 +298,9 @@ func (a *App) getClientIdentifier(r *http.Request) string {
 		}
 		return ip
 	case "token":
+		if a.rateLimitAuthenticator != nil {
+			return a.principalIdentifier(r)
+		}
 		// Use Authorization header token
 		return r.Header.Get("Authorization")
 	case "global":
@@ -116,10 +312,25 @@ func (a *App) getClientIdentifier(r *http.Request) string {
 	}
 }
 
+// principalIdentifier returns the tenant-qualified ID of the authenticated
+// caller, or "" when the request has no verified principal
+func (a *App) principalIdentifier(r *http.Request) string {
+	p, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		if verified, err := a.rateLimitAuthenticator(r); err == nil && verified != nil {
+			p, ok = verified, true
+		}
+	}
+	if !ok || p.ID == "" {
+		return ""
+	}
+	return p.TenantID + "/" + p.ID
+}
+
 // rateLimiterMiddleware implements the rate limiting logic
 func (a *App) rateLimiterMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !a.Config.RateLimiter.Enabled {
+		if !a.Config.RateLimiter.Enabled || a.rateLimiter.isExempt(r) {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -133,11 +344,18 @@ func (a *App) rateLimiterMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// Get the limiter for this client
-		limiter := a.rateLimiter.getLimiter(clientID)
+		// Get the limiter for this client and tier
+		key, rps, burst := a.resolveLimit(r, clientID)
+		// Checking the status is limited in a bucket of its own, so it does
+		// not use up the limit it reports
+		if r.URL.Path == rateLimitStatusPath {
+			key = rateLimitStatusPath + "|" + key
+		}
+		limiter := a.rateLimiter.getLimiter(key, rps, burst)
 
 		// Check if this request is allowed
 		if !limiter.Allow() {
+			a.metrics.rateLimitRejected.WithLabelValues(a.Config.RateLimiter.Strategy).Inc()
 			requestID := r.Context().Value(contextKeyRequestID).(string)
 			a.Logger.Warn("rate limit exceeded",
 				zap.String("client_id", clientID),
@@ -147,11 +365,53 @@ func (a *App) rateLimiterMiddleware(next http.Handler) http.Handler {
 
 			apiErr := NewAPIError(http.StatusTooManyRequests, "Rate limit exceeded")
 			w.Header().Set("Retry-After", "60") // Suggest retry after 60 seconds
-			a.JSONError(w, apiErr)
+			a.handleError(w, r, apiErr)
 			return
 		}
 
 		// Request allowed, proceed to next handler
+		a.metrics.rateLimitAllowed.WithLabelValues(a.Config.RateLimiter.Strategy).Inc()
 		next.ServeHTTP(w, r)
 	})
 }
+
+// rateLimitStatusPath serves the caller's RateLimitStatus
+const rateLimitStatusPath = "/_rate_limit"
+
+// RateLimitStatus reports the live limiter state of r's client under the
+// configured strategy: the burst it may make at once, how many requests
+// are left right now and when the burst is fully replenished. A limit of 0
+// means the request is not rate limited.
+func (a *App) RateLimitStatus(r *http.Request) (limit, remaining int, reset time.Time) {
+	if !a.Config.RateLimiter.Enabled || a.rateLimiter == nil || a.rateLimiter.isExempt(r) {
+		return 0, 0, time.Time{}
+	}
+	clientID := a.getClientIdentifier(r)
+	if clientID == "" && a.Config.RateLimiter.Strategy != "global" {
+		return 0, 0, time.Time{}
+	}
+
+	key, _, burst := a.resolveLimit(r, clientID)
+	now := time.Now()
+	limiter := a.rateLimiter.peekLimiter(key)
+	if limiter == nil {
+		// No requests seen recently, so the full burst is available
+		return burst, burst, now
+	}
+	remaining, reset = limiter.state(now)
+	return burst, remaining, reset
+}
+
+func (a *App) rateLimitStatusHandler(w http.ResponseWriter, r *http.Request) {
+	limit, remaining, reset := a.RateLimitStatus(r)
+	status := map[string]interface{}{
+		"limited":   limit > 0,
+		"strategy":  a.Config.RateLimiter.Strategy,
+		"limit":     limit,
+		"remaining": remaining,
+	}
+	if limit > 0 {
+		status["reset"] = reset.UTC()
+	}
+	a.JSON(w, http.StatusOK, status)
+}
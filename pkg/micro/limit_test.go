@@ -0,0 +1,527 @@
+package micro
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newLimitedApp builds a test app allowing a burst of one request per client
+func newLimitedApp(t *testing.T, configure ...func(*Config)) *App {
+	t.Helper()
+	app := newTestApp(t, append([]func(*Config){func(c *Config) {
+		c.RateLimiter.Enabled = true
+		c.RateLimiter.RequestsPerS = 1
+		c.RateLimiter.Burst = 1
+	}}, configure...)...)
+	t.Cleanup(app.rateLimiter.stop)
+	return app
+}
+
+// limitedRequest builds a GET request from the given client address
+func limitedRequest(path, remoteAddr string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.RemoteAddr = remoteAddr
+	return r
+}
+
+func TestRateLimiterExemptions(t *testing.T) {
+	app := newLimitedApp(t, func(c *Config) {
+		c.RateLimiter.ExemptPaths = []string{"/health", "/internal/*"}
+		c.RateLimiter.ExemptCIDRs = []string{"10.0.0.0/8"}
+		c.RateLimiter.InternalToken = "secret"
+		c.RateLimiter.InternalTokenHeader = "X-Internal-Token"
+	})
+	app.GET("/internal/stats", okHandler)
+	app.GET("/users", okHandler)
+	h := app.Handler()
+
+	tests := []struct {
+		name   string
+		path   string
+		addr   string
+		header http.Header
+	}{
+		{"exact path", "/health", "192.0.2.1:1234", nil},
+		{"path prefix", "/internal/stats", "192.0.2.1:1234", nil},
+		{"trusted network", "/users", "10.1.2.3:1234", nil},
+		{"internal token", "/users", "192.0.2.2:1234", http.Header{"X-Internal-Token": {"secret"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A flood well past the burst is never limited
+			for i := range 50 {
+				r := limitedRequest(tt.path, tt.addr)
+				for k, v := range tt.header {
+					r.Header[k] = v
+				}
+				if w := serve(h, r); w.Code == http.StatusTooManyRequests {
+					t.Fatalf("request %d was rate limited", i)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterLimitsNonExemptRequests(t *testing.T) {
+	app := newLimitedApp(t, func(c *Config) {
+		c.RateLimiter.ExemptCIDRs = []string{"10.0.0.0/8"}
+		c.RateLimiter.InternalToken = "secret"
+		c.RateLimiter.InternalTokenHeader = "X-Internal-Token"
+	})
+	app.GET("/users", okHandler)
+	h := app.Handler()
+
+	tests := []struct {
+		name   string
+		addr   string
+		header http.Header
+	}{
+		{"untrusted network", "192.0.2.1:1234", nil},
+		// Exempt networks are matched on the connection, not the header
+		{"spoofed forwarded address", "192.0.2.2:1234", http.Header{"X-Forwarded-For": {"10.0.0.1"}}},
+		{"wrong internal token", "192.0.2.3:1234", http.Header{"X-Internal-Token": {"guess"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var codes []int
+			for range 2 {
+				r := limitedRequest("/users", tt.addr)
+				for k, v := range tt.header {
+					r.Header[k] = v
+				}
+				codes = append(codes, serve(h, r).Code)
+			}
+			if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+				t.Errorf("status codes = %v, want [200 429]", codes)
+			}
+		})
+	}
+}
+
+func TestRateLimitResolverTiers(t *testing.T) {
+	app := newLimitedApp(t)
+	app.SetRateLimitResolver(func(r *http.Request) (float64, int) {
+		switch r.Header.Get("X-Plan") {
+		case "paid":
+			return 1000, 5
+		case "free":
+			return 1, 2
+		}
+		return 0, 0 // Falls back to the static config
+	})
+	app.GET("/users", okHandler)
+	h := app.Handler()
+
+	tests := []struct {
+		name    string
+		plan    string
+		addr    string
+		allowed int
+	}{
+		{"paid", "paid", "192.0.2.1:1234", 5},
+		{"free", "free", "192.0.2.2:1234", 2},
+		{"no plan", "", "192.0.2.3:1234", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed := 0
+			for range 10 {
+				r := limitedRequest("/users", tt.addr)
+				r.Header.Set("X-Plan", tt.plan)
+				if serve(h, r).Code == http.StatusOK {
+					allowed++
+				}
+			}
+			if allowed != tt.allowed {
+				t.Errorf("allowed = %d, want %d", allowed, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestRateLimitResolverSeparatesTiersOnSharedIP(t *testing.T) {
+	app := newLimitedApp(t)
+	app.SetRateLimitResolver(func(r *http.Request) (float64, int) {
+		if r.Header.Get("X-Plan") == "paid" {
+			return 1000, 5
+		}
+		return 1, 1
+	})
+	app.GET("/users", okHandler)
+	h := app.Handler()
+
+	// A free user exhausting their limit does not affect a paid user
+	// behind the same address
+	serve(h, limitedRequest("/users", "192.0.2.1:1234"))
+	if w := serve(h, limitedRequest("/users", "192.0.2.1:1234")); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("free status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	r := limitedRequest("/users", "192.0.2.1:1234")
+	r.Header.Set("X-Plan", "paid")
+	if w := serve(h, r); w.Code != http.StatusOK {
+		t.Errorf("paid status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRateLimiterMetrics(t *testing.T) {
+	app := newLimitedApp(t)
+	app.GET("/users", okHandler)
+	h := app.Handler()
+
+	for range 3 {
+		serve(h, limitedRequest("/users", "192.0.2.1:1234"))
+	}
+	serve(h, limitedRequest("/users", "192.0.2.2:1234"))
+
+	if got := testutil.ToFloat64(app.metrics.rateLimitAllowed.WithLabelValues("ip")); got != 2 {
+		t.Errorf("allowed = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(app.metrics.rateLimitRejected.WithLabelValues("ip")); got != 2 {
+		t.Errorf("rejected = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(app.metrics.rateLimitVisitors); got != 2 {
+		t.Errorf("visitors = %v, want 2", got)
+	}
+}
+
+func TestRateLimiterMaxVisitors(t *testing.T) {
+	app := newLimitedApp(t, func(c *Config) { c.RateLimiter.MaxVisitors = 64 })
+	rl := app.rateLimiter
+
+	for i := range 10_000 {
+		rl.getLimiter(fmt.Sprintf("client-%d", i), 1, 1)
+	}
+	total := 0
+	for _, shard := range rl.shards {
+		if n := len(shard.limiters); n != shard.order.Len() {
+			t.Fatalf("shard map has %d visitors but list has %d", n, shard.order.Len())
+		}
+		total += len(shard.limiters)
+	}
+	// Each shard holds at most its rounded-up share of the cap
+	if limit := rateLimiterShards * ((64 + rateLimiterShards - 1) / rateLimiterShards); total > limit {
+		t.Errorf("tracked %d visitors, want at most %d", total, limit)
+	}
+	if got := testutil.ToFloat64(app.metrics.rateLimitVisitors); int(got) != total {
+		t.Errorf("visitors gauge = %v, want %d", got, total)
+	}
+}
+
+func TestRateLimiterEvictsLeastRecentlySeen(t *testing.T) {
+	app := newLimitedApp(t, func(c *Config) { c.RateLimiter.MaxVisitors = rateLimiterShards * 2 })
+	rl := app.rateLimiter
+
+	// Find three keys sharing a shard, which holds two visitors
+	var keys []string
+	target := rl.shard("client-0")
+	for i := 0; len(keys) < 3; i++ {
+		if key := fmt.Sprintf("client-%d", i); rl.shard(key) == target {
+			keys = append(keys, key)
+		}
+	}
+
+	first := rl.getLimiter(keys[0], 1, 1)
+	rl.getLimiter(keys[1], 1, 1)
+	rl.getLimiter(keys[0], 1, 1) // keys[1] is now the least recently seen
+	rl.getLimiter(keys[2], 1, 1)
+
+	if rl.peekLimiter(keys[1]) != nil {
+		t.Error("least recently seen visitor was not evicted")
+	}
+	if rl.peekLimiter(keys[0]) != first {
+		t.Error("recently seen visitor lost its limiter")
+	}
+	if rl.peekLimiter(keys[2]) == nil {
+		t.Error("new visitor was not tracked")
+	}
+}
+
+func TestRateLimiterShardsConcurrentAccess(t *testing.T) {
+	app := newLimitedApp(t, func(c *Config) { c.RateLimiter.MaxVisitors = 0 })
+	rl := app.rateLimiter
+
+	const clients, workers = 200, 8
+	limiters := make([][]requestLimiter, workers)
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range clients {
+				limiters[w] = append(limiters[w], rl.getLimiter(fmt.Sprintf("client-%d", i), 1, 1))
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Every worker saw the same limiter for each client
+	for w := 1; w < workers; w++ {
+		for i := range clients {
+			if limiters[w][i] != limiters[0][i] {
+				t.Fatalf("worker %d got a different limiter for client %d", w, i)
+			}
+		}
+	}
+	used := 0
+	for _, shard := range rl.shards {
+		if len(shard.limiters) > 0 {
+			used++
+		}
+	}
+	if used < rateLimiterShards/2 {
+		t.Errorf("clients spread over %d of %d shards", used, rateLimiterShards)
+	}
+	if got := testutil.ToFloat64(app.metrics.rateLimitVisitors); got != clients {
+		t.Errorf("visitors gauge = %v, want %d", got, clients)
+	}
+}
+
+func TestRateLimiterTokenStrategyKeysAuthorizationHeader(t *testing.T) {
+	// Without an authenticator the token strategy keys the raw header
+	app := newLimitedApp(t, func(c *Config) { c.RateLimiter.Strategy = "token" })
+	app.GET("/users", okHandler)
+	h := app.Handler()
+
+	request := func(token, addr string) int {
+		r := limitedRequest("/users", addr)
+		if token != "" {
+			r.Header.Set("Authorization", token)
+		}
+		return serve(h, r).Code
+	}
+	for _, tt := range []struct {
+		token, addr string
+		want        int
+	}{
+		{"Bearer a", "192.0.2.1:1234", http.StatusOK},
+		{"Bearer b", "192.0.2.1:1234", http.StatusOK},
+		{"Bearer a", "192.0.2.2:1234", http.StatusTooManyRequests},
+		// No token, no identifier, so the request is not limited
+		{"", "192.0.2.1:1234", http.StatusOK},
+		{"", "192.0.2.1:1234", http.StatusOK},
+	} {
+		if got := request(tt.token, tt.addr); got != tt.want {
+			t.Errorf("%q from %s: status = %d, want %d", tt.token, tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimiterTokenStrategyIgnoresUnverifiedTokens(t *testing.T) {
+	for _, strategy := range []string{"token", "composite"} {
+		t.Run(strategy, func(t *testing.T) {
+			app := newLimitedApp(t, func(c *Config) { c.RateLimiter.Strategy = strategy })
+			app.SetRateLimitAuthenticator(func(r *http.Request) (*Principal, error) {
+				return nil, errors.New("invalid token")
+			})
+			app.GET("/users", okHandler)
+			h := app.Handler()
+
+			// Rotating bogus tokens from one address does not get fresh buckets
+			var codes []int
+			for i := range 3 {
+				r := limitedRequest("/users", "192.0.2.1:1234")
+				r.Header.Set("Authorization", fmt.Sprintf("Bearer bogus-%d", i))
+				codes = append(codes, serve(h, r).Code)
+			}
+			want := []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests}
+			if fmt.Sprint(codes) != fmt.Sprint(want) {
+				t.Errorf("status codes = %v, want %v", codes, want)
+			}
+		})
+	}
+}
+
+func TestRateLimiterTokenStrategyKeysVerifiedPrincipals(t *testing.T) {
+	app := newLimitedApp(t, func(c *Config) { c.RateLimiter.Strategy = "composite" })
+	app.SetRateLimitAuthenticator(func(r *http.Request) (*Principal, error) {
+		if id, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer valid-"); ok {
+			return &Principal{ID: id}, nil
+		}
+		return nil, errors.New("invalid token")
+	})
+	app.GET("/users", okHandler)
+	h := app.Handler()
+
+	request := func(token string) int {
+		r := limitedRequest("/users", "192.0.2.1:1234")
+		r.Header.Set("Authorization", token)
+		return serve(h, r).Code
+	}
+
+	// Users behind a shared address get a bucket each, which the same user
+	// presenting another token does not reset
+	for _, tt := range []struct {
+		token string
+		want  int
+	}{
+		{"Bearer valid-1", http.StatusOK},
+		{"Bearer valid-2", http.StatusOK},
+		{"Bearer valid-1", http.StatusTooManyRequests},
+		{"Bearer bogus", http.StatusOK},
+		{"Bearer bogus-2", http.StatusTooManyRequests},
+	} {
+		if got := request(tt.token); got != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.token, got, tt.want)
+		}
+	}
+}
+
+// BenchmarkGetLimiter compares the sharded map against serializing every
+// lookup on one mutex, as the limiter did before sharding
+func BenchmarkGetLimiter(b *testing.B) {
+	app := newTestApp(b, func(c *Config) {
+		c.RateLimiter.Enabled = true
+		c.RateLimiter.RequestsPerS = 1e6
+		c.RateLimiter.Burst = 1e6
+	})
+	b.Cleanup(app.rateLimiter.stop)
+	rl := app.rateLimiter
+
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("192.0.2.%d:%d", i%256, i)
+	}
+
+	b.Run("sharded", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				rl.getLimiter(keys[i%len(keys)], 1e6, 1e6).Allow()
+			}
+		})
+	})
+
+	b.Run("single lock", func(b *testing.B) {
+		var mu sync.Mutex
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				mu.Lock()
+				rl.getLimiter(keys[i%len(keys)], 1e6, 1e6).Allow()
+				mu.Unlock()
+			}
+		})
+	})
+}
+
+func TestRateLimitStatus(t *testing.T) {
+	tests := []struct {
+		strategy string
+		// Remaining for the second client after the first used two
+		otherRemaining int
+	}{
+		{"ip", 3},
+		{"token", 3},
+		// Every client shares the global bucket
+		{"global", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			app := newLimitedApp(t, func(c *Config) {
+				c.RateLimiter.Strategy = tt.strategy
+				c.RateLimiter.RequestsPerS = 1
+				c.RateLimiter.Burst = 3
+			})
+			app.SetRateLimitAuthenticator(func(r *http.Request) (*Principal, error) {
+				return &Principal{ID: r.Header.Get("X-User")}, nil
+			})
+			app.GET("/users", okHandler)
+			h := app.Handler()
+			client := func(n int) *http.Request {
+				r := limitedRequest("/users", fmt.Sprintf("192.0.2.%d:1234", n))
+				r.Header.Set("X-User", fmt.Sprint(n))
+				return r
+			}
+
+			limit, remaining, reset := app.RateLimitStatus(client(1))
+			if limit != 3 || remaining != 3 || reset.After(time.Now()) {
+				t.Errorf("fresh status = %d, %d, %v, want the full burst now", limit, remaining, reset)
+			}
+
+			serve(h, client(1))
+			serve(h, client(1))
+			limit, remaining, reset = app.RateLimitStatus(client(1))
+			if limit != 3 || remaining != 1 {
+				t.Errorf("status after two requests = %d, %d, want 3, 1", limit, remaining)
+			}
+			// Two tokens come back at one per second
+			if d := time.Until(reset); d <= time.Second || d > 2*time.Second {
+				t.Errorf("reset in %v, want about 2s", d)
+			}
+
+			if _, remaining, _ := app.RateLimitStatus(client(2)); remaining != tt.otherRemaining {
+				t.Errorf("other client remaining = %d, want %d", remaining, tt.otherRemaining)
+			}
+		})
+	}
+}
+
+func TestRateLimitStatusUnlimited(t *testing.T) {
+	t.Run("exempt path", func(t *testing.T) {
+		app := newLimitedApp(t, func(c *Config) { c.RateLimiter.ExemptPaths = []string{"/health"} })
+		if limit, _, _ := app.RateLimitStatus(limitedRequest("/health", "192.0.2.1:1234")); limit != 0 {
+			t.Errorf("limit = %d, want 0", limit)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		app := newTestApp(t)
+		if limit, _, _ := app.RateLimitStatus(limitedRequest("/users", "192.0.2.1:1234")); limit != 0 {
+			t.Errorf("limit = %d, want 0", limit)
+		}
+		// The endpoint is only registered with the limiter enabled
+		if w := serve(app.Handler(), limitedRequest(rateLimitStatusPath, "192.0.2.1:1234")); w.Code != http.StatusNotFound {
+			t.Errorf("status endpoint = %d, want %d", w.Code, http.StatusNotFound)
+		}
+	})
+}
+
+func TestRateLimitStatusEndpoint(t *testing.T) {
+	app := newLimitedApp(t, func(c *Config) { c.RateLimiter.Burst = 2 })
+	app.GET("/users", okHandler)
+	h := app.Handler()
+	serve(h, limitedRequest("/users", "192.0.2.1:1234"))
+
+	w := serve(h, limitedRequest(rateLimitStatusPath, "192.0.2.1:1234"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	body := decodeBody(t, w)
+	if body["limited"] != true || body["strategy"] != "ip" || body["limit"] != 2.0 || body["remaining"] != 1.0 {
+		t.Errorf("body = %v", body)
+	}
+	if _, err := time.Parse(time.RFC3339, fmt.Sprint(body["reset"])); err != nil {
+		t.Errorf("reset %v is not a time: %v", body["reset"], err)
+	}
+
+	// Checking the status does not use up the limit it reports
+	w = serve(h, limitedRequest(rateLimitStatusPath, "192.0.2.1:1234"))
+	if body := decodeBody(t, w); body["remaining"] != 1.0 {
+		t.Errorf("remaining after a second check = %v, want 1", body["remaining"])
+	}
+	// but is limited in a bucket of its own
+	if w := serve(h, limitedRequest(rateLimitStatusPath, "192.0.2.1:1234")); w.Code != http.StatusTooManyRequests {
+		t.Errorf("third check status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if w := serve(h, limitedRequest("/users", "192.0.2.1:1234")); w.Code != http.StatusOK {
+		t.Errorf("request after the checks = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRateLimitStatusEndpointExempt(t *testing.T) {
+	app := newLimitedApp(t, func(c *Config) { c.RateLimiter.ExemptCIDRs = []string{"10.0.0.0/8"} })
+
+	body := decodeBody(t, serve(app.Handler(), limitedRequest(rateLimitStatusPath, "10.1.2.3:1234")))
+	if body["limited"] != false || body["limit"] != 0.0 {
+		t.Errorf("body = %v", body)
+	}
+	if _, ok := body["reset"]; ok {
+		t.Errorf("unlimited status has a reset: %v", body)
+	}
+}
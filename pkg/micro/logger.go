@@ -1,6 +1,13 @@
 package micro
 
-import "go.uber.org/zap"
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
 
 // Logger interface defines the logging contract
 type Logger interface {
@@ -14,10 +21,26 @@ type Logger interface {
 // ZapLogger implements Logger interface using zap
 type ZapLogger struct {
 	*zap.Logger
+	// verbose logs at debug level regardless of the configured level, for
+	// requests flagged for debugging. Nil when not supported.
+	verbose *zap.Logger
 }
 
 func (zl *ZapLogger) With(fields ...zap.Field) Logger {
-	return &ZapLogger{zl.Logger.With(fields...)}
+	l := &ZapLogger{Logger: zl.Logger.With(fields...)}
+	if zl.verbose != nil {
+		l.verbose = zl.verbose.With(fields...)
+	}
+	return l
+}
+
+// WithDebug returns a logger that also emits debug entries, without changing
+// the level of other loggers
+func (zl *ZapLogger) WithDebug() Logger {
+	if zl.verbose == nil {
+		return zl
+	}
+	return &ZapLogger{Logger: zl.verbose, verbose: zl.verbose}
 }
 
 // NewLogger creates a new logger instance
@@ -29,12 +52,90 @@ func NewLogger(level string) (Logger, error) {
 	case "debug":
 		logger, err = zap.NewDevelopment(zap.AddStacktrace(zap.ErrorLevel))
 	default:
-		logger, err = zap.NewProduction(zap.AddStacktrace(zap.ErrorLevel))
+		// Build at debug level and filter to the configured level, keeping
+		// the unfiltered logger for per-request debugging
+		cfg := zap.NewProductionConfig()
+		cfg.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
+		logger, err = cfg.Build(zap.AddStacktrace(zap.ErrorLevel))
+	}
+
+	if err != nil {
+		return nil, err
 	}
+	if level == "debug" {
+		return &ZapLogger{Logger: logger}, nil
+	}
+
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		lvl = zapcore.InfoLevel
+	}
+	filtered := logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		leveled, err := zapcore.NewIncreaseLevelCore(core, lvl)
+		if err != nil {
+			return core
+		}
+		return leveled
+	}))
+	return &ZapLogger{Logger: filtered, verbose: logger}, nil
+}
 
+// NewStderrLogger creates a basic JSON logger writing to stderr. Unlike
+// NewLogger it cannot fail, so it serves as a fallback.
+func NewStderrLogger(level string) Logger {
+	lvl, err := zapcore.ParseLevel(level)
 	if err != nil {
+		lvl = zapcore.InfoLevel
+	}
+	encoder := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	core := zapcore.NewCore(encoder, zapcore.Lock(os.Stderr), lvl)
+	return &ZapLogger{Logger: zap.New(core)}
+}
+
+// buildLogger builds the configured logger with build, normally NewLogger,
+// falling back to NewStderrLogger unless the config requires it
+func buildLogger(config *Config, build func(level string) (Logger, error)) (Logger, error) {
+	logger, err := build(config.LogLevel)
+	if err == nil {
+		return logger, nil
+	}
+	if config.requireLogger() {
 		return nil, err
 	}
 
-	return &ZapLogger{logger}, nil
+	fallback := NewStderrLogger(config.LogLevel)
+	fallback.Warn("failed to initialize logger, falling back to stderr", zap.Error(err))
+	return fallback, nil
+}
+
+// traceFields returns the OpenTelemetry trace and span IDs of the active
+// span in ctx, if any
+func traceFields(ctx context.Context) []zap.Field {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	return []zap.Field{
+		zap.String("trace_id", sc.TraceID().String()),
+		zap.String("span_id", sc.SpanID().String()),
+	}
+}
+
+// LoggerFromContext returns the request-scoped logger stored by the logging
+// middleware, already enriched with the request and trace IDs. It returns a
+// logger that discards everything when ctx carries none.
+func LoggerFromContext(ctx context.Context) Logger {
+	if logger, ok := ctx.Value(contextKeyLogger).(Logger); ok {
+		return logger
+	}
+	return NewNopLogger()
+}
+
+// LoggerFromContextOr returns the request-scoped logger of ctx, or fallback
+// outside a request, for layers that also run from workers and jobs
+func LoggerFromContextOr(ctx context.Context, fallback Logger) Logger {
+	if logger, ok := ctx.Value(contextKeyLogger).(Logger); ok {
+		return logger
+	}
+	return fallback
 }
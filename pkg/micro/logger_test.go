@@ -0,0 +1,132 @@
+package micro
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// entryFields returns the fields of the first entry logged with msg
+func entryFields(t *testing.T, logger *TestLogger, msg string) map[string]interface{} {
+	t.Helper()
+	for _, e := range logger.Entries() {
+		if e.Message == msg {
+			return e.ContextMap()
+		}
+	}
+	t.Fatalf("no %q entry in %v", msg, logger.Messages())
+	return nil
+}
+
+func TestLogsCarryTraceIDs(t *testing.T) {
+	app := newTestApp(t)
+	logger := NewTestLogger()
+	app.Logger = logger
+	app.GET("/users", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		LoggerFromContext(ctx).Info("loading users")
+		return okHandler(ctx, w, r)
+	})
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	})
+	r := httptest.NewRequest(http.MethodGet, "/users", nil)
+	r = r.WithContext(trace.ContextWithSpanContext(r.Context(), sc))
+	w := serve(app.Handler(), r)
+
+	for _, msg := range []string{"request processed", "loading users"} {
+		fields := entryFields(t, logger, msg)
+		if fields["trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" || fields["span_id"] != "00f067aa0ba902b7" {
+			t.Errorf("%q fields = %v, want the trace and span IDs", msg, fields)
+		}
+		if fields["request_id"] != w.Header().Get("X-Request-ID") {
+			t.Errorf("%q request_id = %v, want %q", msg, fields["request_id"], w.Header().Get("X-Request-ID"))
+		}
+	}
+}
+
+func TestLogsOmitTraceIDsWithoutSpan(t *testing.T) {
+	app := newTestApp(t)
+	logger := NewTestLogger()
+	app.Logger = logger
+	app.GET("/users", okHandler)
+
+	serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/users", nil))
+	fields := entryFields(t, logger, "request processed")
+	if _, ok := fields["trace_id"]; ok {
+		t.Errorf("fields = %v, want no trace_id", fields)
+	}
+}
+
+func TestLoggerFromContext(t *testing.T) {
+	app := newTestApp(t)
+	logger := NewTestLogger()
+	app.Logger = logger
+	app.POST("/users/{id}", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		LoggerFromContext(ctx).Info("updating user")
+		return okHandler(ctx, w, r)
+	})
+
+	w := serve(app.Handler(), httptest.NewRequest(http.MethodPost, "/users/42", nil))
+	fields := entryFields(t, logger, "updating user")
+	want := map[string]interface{}{
+		"request_id": w.Header().Get("X-Request-ID"),
+		"method":     http.MethodPost,
+		"path":       "/users/42",
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("%s = %v, want %v", k, fields[k], v)
+		}
+	}
+}
+
+func TestLoggerFromContextOutsideRequest(t *testing.T) {
+	// Without a request-scoped logger, logging is a safe no-op
+	LoggerFromContext(context.Background()).Info("dropped")
+
+	fallback := NewTestLogger()
+	LoggerFromContextOr(context.Background(), fallback).Info("from a job")
+	if !fallback.Logged("from a job") {
+		t.Error("LoggerFromContextOr did not use the fallback")
+	}
+}
+
+func TestLoggerBuildFailure(t *testing.T) {
+	buildErr := errors.New("open /unwritable/app.log: permission denied")
+	failing := func(string) (Logger, error) { return nil, buildErr }
+
+	tests := []struct {
+		name    string
+		require *bool
+		wantErr bool
+	}{
+		{"strict by default", nil, true},
+		{"required", boolPtr(true), true},
+		{"falls back", boolPtr(false), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, err := buildLogger(&Config{LogLevel: "error", RequireLogger: tt.require}, failing)
+			if tt.wantErr {
+				if !errors.Is(err, buildErr) {
+					t.Fatalf("buildLogger err = %v, want %v", err, buildErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildLogger: %v", err)
+			}
+			if logger == nil {
+				t.Fatal("no fallback logger")
+			}
+			logger.Info("still logging")
+		})
+	}
+}
@@ -0,0 +1,333 @@
+package micro
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MetricsConfig configures the Prometheus collectors
+type MetricsConfig struct {
+	// DurationBuckets are the upper bounds in seconds of the HTTP duration
+	// histogram buckets
+	DurationBuckets []float64 `envconfig:"METRICS_DURATION_BUCKETS" default:"0.005,0.01,0.025,0.05,0.1,0.25,0.5,1,2.5,5,10"`
+
+	// LabelFromContext adds labels to http_requests_total, keyed by label
+	// name and read from the handler context, e.g. the plan of the principal
+	LabelFromContext map[string]ContextLabel `ignored:"true"`
+}
+
+// ContextLabel derives a request metric label from the request context.
+// Values outside Allowed are recorded as "other" to bound cardinality.
+type ContextLabel struct {
+	Value   func(ctx context.Context) string
+	Allowed []string
+}
+
+// validate checks the context labels, which must not shadow built-in labels
+// and must list their allowed values
+func (c MetricsConfig) validate() error {
+	for name, label := range c.LabelFromContext {
+		switch name {
+		case "method", "path", "status":
+			return fmt.Errorf("metric label %q is reserved", name)
+		}
+		if label.Value == nil {
+			return fmt.Errorf("metric label %q has no Value func", name)
+		}
+		if len(label.Allowed) == 0 {
+			return fmt.Errorf("metric label %q must list its allowed values", name)
+		}
+	}
+	return nil
+}
+
+// contextLabel is a ContextLabel with its allowed values indexed
+type contextLabel struct {
+	name    string
+	value   func(ctx context.Context) string
+	allowed map[string]bool
+}
+
+// metrics holds the collectors of an App, registered on its own registry so
+// several apps (e.g. in tests) can coexist in one process
+type metrics struct {
+	registry        *prometheus.Registry
+	requestsTotal   *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	middlewareWait  *prometheus.HistogramVec
+	slowRequests    *prometheus.CounterVec
+	jobRunsTotal    *prometheus.CounterVec
+	jobDuration     *prometheus.HistogramVec
+	buildInfo       *prometheus.GaugeVec
+
+	rateLimitAllowed  *prometheus.CounterVec
+	rateLimitRejected *prometheus.CounterVec
+	rateLimitVisitors prometheus.Gauge
+
+	bulkheadInFlight *prometheus.GaugeVec
+	bulkheadRejected *prometheus.CounterVec
+	bulkheadQueued   *prometheus.GaugeVec
+	bulkheadWait     *prometheus.HistogramVec
+
+	shutdownDuration *prometheus.HistogramVec
+
+	grpcRequestsTotal   *prometheus.CounterVec
+	grpcRequestDuration *prometheus.HistogramVec
+
+	consumerMessagesTotal *prometheus.CounterVec
+
+	deprecatedRequestsTotal *prometheus.CounterVec
+
+	operationDuration *prometheus.HistogramVec
+	timerNames        *timerNames
+
+	contextLabels []contextLabel
+}
+
+func newMetrics(config MetricsConfig) *metrics {
+	buckets := config.DurationBuckets
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+
+	labels := []string{"method", "path", "status"}
+	var contextLabels []contextLabel
+	for name, label := range config.LabelFromContext {
+		allowed := make(map[string]bool, len(label.Allowed))
+		for _, v := range label.Allowed {
+			allowed[v] = true
+		}
+		contextLabels = append(contextLabels, contextLabel{name: name, value: label.Value, allowed: allowed})
+	}
+	sort.Slice(contextLabels, func(i, j int) bool { return contextLabels[i].name < contextLabels[j].name })
+	for _, l := range contextLabels {
+		labels = append(labels, l.name)
+	}
+
+	m := &metrics{
+		registry:      prometheus.NewRegistry(),
+		contextLabels: contextLabels,
+		requestsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "http_requests_total",
+				Help: "Total number of HTTP requests.",
+			},
+			labels,
+		),
+		requestDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "http_request_duration_seconds",
+				Help:    "Duration of HTTP requests.",
+				Buckets: buckets,
+			},
+			[]string{"method", "path"},
+		),
+		middlewareWait: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "http_request_middleware_seconds",
+				Help:    "Time from entering the middleware stack to the handler starting.",
+				Buckets: buckets,
+			},
+			[]string{"method", "path"},
+		),
+		slowRequests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "http_slow_requests_total",
+				Help: "Requests slower than the slow request threshold.",
+			},
+			[]string{"method", "path"},
+		),
+		jobRunsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "scheduled_job_runs_total",
+				Help: "Total number of scheduled job runs.",
+			},
+			[]string{"job", "status"},
+		),
+		jobDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "scheduled_job_duration_seconds",
+				Help:    "Duration of scheduled job runs.",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"job"},
+		),
+		buildInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "build_info",
+				Help: "Build information of the running binary, always 1.",
+			},
+			[]string{"version", "commit", "go_version"},
+		),
+		rateLimitAllowed: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "rate_limit_allowed_total",
+				Help: "Requests allowed by the rate limiter.",
+			},
+			[]string{"strategy"},
+		),
+		rateLimitRejected: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "rate_limit_rejected_total",
+				Help: "Requests rejected by the rate limiter.",
+			},
+			[]string{"strategy"},
+		),
+		rateLimitVisitors: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "rate_limit_visitors",
+				Help: "Number of visitor limiters currently tracked.",
+			},
+		),
+		bulkheadInFlight: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "http_bulkhead_in_flight",
+				Help: "Requests currently executing inside a bulkhead.",
+			},
+			[]string{"bulkhead"},
+		),
+		bulkheadRejected: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "http_bulkhead_rejected_total",
+				Help: "Requests rejected because a bulkhead was full.",
+			},
+			[]string{"bulkhead"},
+		),
+		bulkheadQueued: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "http_bulkhead_queue_depth",
+				Help: "Requests currently waiting for a bulkhead slot.",
+			},
+			[]string{"bulkhead"},
+		),
+		bulkheadWait: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "http_bulkhead_wait_seconds",
+				Help:    "Time requests spent queued for a bulkhead slot.",
+				Buckets: buckets,
+			},
+			[]string{"bulkhead"},
+		),
+		shutdownDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "server_shutdown_duration_seconds",
+				Help:    "Time taken to shut the server down.",
+				Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
+			},
+			[]string{"forced"},
+		),
+		grpcRequestsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "grpc_requests_total",
+				Help: "Total number of gRPC requests.",
+			},
+			[]string{"method", "code"},
+		),
+		grpcRequestDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "grpc_request_duration_seconds",
+				Help:    "Duration of gRPC requests.",
+				Buckets: buckets,
+			},
+			[]string{"method"},
+		),
+		consumerMessagesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "consumer_messages_total",
+				Help: "Messages handled by queue consumers, by result (ok, retry, failed).",
+			},
+			[]string{"subject", "result"},
+		),
+		deprecatedRequestsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "deprecated_requests_total",
+				Help: "Requests to routes marked Deprecated.",
+			},
+			[]string{"method", "path"},
+		),
+		operationDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "operation_duration_seconds",
+				Help:    "Duration of request sub-operations timed with micro.Timer.",
+				Buckets: buckets,
+			},
+			[]string{"operation"},
+		),
+		timerNames: &timerNames{names: make(map[string]bool)},
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requestsTotal,
+		m.requestDuration,
+		m.middlewareWait,
+		m.slowRequests,
+		m.jobRunsTotal,
+		m.jobDuration,
+		m.buildInfo,
+		m.rateLimitAllowed,
+		m.rateLimitRejected,
+		m.rateLimitVisitors,
+		m.bulkheadInFlight,
+		m.bulkheadRejected,
+		m.bulkheadQueued,
+		m.bulkheadWait,
+		m.shutdownDuration,
+		m.grpcRequestsTotal,
+		m.grpcRequestDuration,
+		m.consumerMessagesTotal,
+		m.deprecatedRequestsTotal,
+		m.operationDuration,
+	)
+
+	return m
+}
+
+// Registry returns the app's Prometheus registry for custom collectors
+func (a *App) Registry() *prometheus.Registry {
+	return a.metrics.registry
+}
+
+// observeWithTrace observes v, attaching the trace ID of a sampled span in
+// ctx as an exemplar so dashboards can link to the trace
+func observeWithTrace(ctx context.Context, o prometheus.Observer, v float64) {
+	sc := trace.SpanContextFromContext(ctx)
+	if eo, ok := o.(prometheus.ExemplarObserver); ok && sc.IsValid() && sc.IsSampled() {
+		eo.ObserveWithExemplar(v, prometheus.Labels{"trace_id": sc.TraceID().String()})
+		return
+	}
+	o.Observe(v)
+}
+
+// requestLabels returns the http_requests_total label values for a request
+// whose handler ran with ctx
+func (m *metrics) requestLabels(ctx context.Context, method, path, status string) []string {
+	values := []string{method, path, status}
+	for _, l := range m.contextLabels {
+		v := l.value(ctx)
+		if !l.allowed[v] {
+			v = "other"
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// metricsScope carries the handler context back out to the metrics
+// middleware, since values such as the principal are added further in
+type metricsScope struct {
+	ctx context.Context
+}
+
+// recordHandlerContext makes ctx available to the metrics middleware
+func recordHandlerContext(ctx context.Context) {
+	if scope, ok := ctx.Value(contextKeyMetricsScope).(*metricsScope); ok {
+		scope.ctx = ctx
+	}
+}
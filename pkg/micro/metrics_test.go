@@ -0,0 +1,242 @@
+package micro
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// scrape returns the /metrics exposition of app
+func scrape(t *testing.T, app *App) string {
+	t.Helper()
+	w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("/metrics status = %d", w.Code)
+	}
+	return w.Body.String()
+}
+
+func TestDurationBuckets(t *testing.T) {
+	tests := []struct {
+		name    string
+		buckets []float64
+		want    []string
+		notWant []string
+	}{
+		{"custom", []float64{0.001, 0.002, 0.004}, []string{`le="0.001"`, `le="0.002"`, `le="0.004"`}, []string{`le="0.005"`}},
+		{"default", nil, []string{`le="0.005"`, `le="10"`}, []string{`le="0.001"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, func(c *Config) { c.Metrics.DurationBuckets = tt.buckets })
+			app.GET("/users", okHandler)
+			serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/users", nil))
+
+			var lines []string
+			for _, line := range strings.Split(scrape(t, app), "\n") {
+				if strings.HasPrefix(line, "http_request_duration_seconds_bucket") {
+					lines = append(lines, line)
+				}
+			}
+			buckets := strings.Join(lines, "\n")
+			for _, le := range tt.want {
+				if !strings.Contains(buckets, le) {
+					t.Errorf("missing bucket %s in\n%s", le, buckets)
+				}
+			}
+			for _, le := range tt.notWant {
+				if strings.Contains(buckets, le) {
+					t.Errorf("unexpected bucket %s in\n%s", le, buckets)
+				}
+			}
+		})
+	}
+}
+
+func TestMetricsArePerApp(t *testing.T) {
+	// Apps register on their own registries, so several can coexist
+	first, second := newTestApp(t), newTestApp(t)
+	first.GET("/users", okHandler)
+	serve(first.Handler(), httptest.NewRequest(http.MethodGet, "/users", nil))
+
+	if !strings.Contains(scrape(t, first), `path="/users"`) {
+		t.Error("first app did not record its request")
+	}
+	if strings.Contains(scrape(t, second), `path="/users"`) {
+		t.Error("second app reports the first app's request")
+	}
+}
+
+func TestDurationExemplars(t *testing.T) {
+	traceID := trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	tests := []struct {
+		name  string
+		flags trace.TraceFlags
+		trace bool
+		want  bool
+	}{
+		{"sampled trace", trace.FlagsSampled, true, true},
+		{"unsampled trace", 0, true, false},
+		{"no trace", 0, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			app.GET("/users", okHandler)
+			h := app.Handler()
+
+			r := httptest.NewRequest(http.MethodGet, "/users", nil)
+			if tt.trace {
+				sc := trace.NewSpanContext(trace.SpanContextConfig{
+					TraceID:    traceID,
+					SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+					TraceFlags: tt.flags,
+				})
+				r = r.WithContext(trace.ContextWithSpanContext(r.Context(), sc))
+			}
+			serve(h, r)
+
+			// Exemplars are only exposed in the OpenMetrics format
+			mr := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			mr.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+			metrics := serve(h, mr).Body.String()
+			got := strings.Contains(metrics, `# {trace_id="`+traceID.String()+`"}`)
+			if got != tt.want {
+				t.Errorf("exemplar recorded = %v, want %v:\n%s", got, tt.want, metrics)
+			}
+		})
+	}
+}
+
+func TestContextLabels(t *testing.T) {
+	plan := ContextLabel{
+		Value: func(ctx context.Context) string {
+			if p, ok := PrincipalFromContext(ctx); ok {
+				return p.Plan
+			}
+			return ""
+		},
+		Allowed: []string{"free", "pro"},
+	}
+	app := newTestApp(t, func(c *Config) {
+		c.Metrics.LabelFromContext = map[string]ContextLabel{"plan": plan}
+	})
+	// The principal is added inside the metrics middleware, as auth would
+	app.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if p := r.Header.Get("X-Plan"); p != "" {
+				r = r.WithContext(WithPrincipal(r.Context(), &Principal{ID: "1", Plan: p}))
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	app.GET("/users", okHandler)
+	h := app.Handler()
+
+	for _, p := range []string{"pro", "pro", "free", "enterprise-acme", ""} {
+		r := httptest.NewRequest(http.MethodGet, "/users", nil)
+		r.Header.Set("X-Plan", p)
+		serve(h, r)
+	}
+
+	metrics := scrape(t, app)
+	for _, want := range []string{
+		`http_requests_total{method="GET",path="/users",plan="pro",status="200"} 2`,
+		`http_requests_total{method="GET",path="/users",plan="free",status="200"} 1`,
+		// Unlisted and missing values collapse into one series
+		`http_requests_total{method="GET",path="/users",plan="other",status="200"} 2`,
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("missing %s", want)
+		}
+	}
+	if strings.Contains(metrics, "enterprise-acme") {
+		t.Error("unlisted label value exposed")
+	}
+}
+
+func TestContextLabelsValidation(t *testing.T) {
+	value := func(context.Context) string { return "" }
+	tests := map[string]ContextLabel{
+		"status":  {Value: value, Allowed: []string{"a"}},
+		"no func": {Allowed: []string{"a"}},
+		"plan":    {Value: value},
+	}
+	for name, label := range tests {
+		c := MetricsConfig{LabelFromContext: map[string]ContextLabel{name: label}}
+		if err := c.validate(); err == nil {
+			t.Errorf("label %q accepted", name)
+		}
+	}
+}
+
+// histogramSample returns the count and sum of the series of the histogram
+// name with labels, as exposed on /metrics
+func histogramSample(t *testing.T, app *App, name, labels string) (count, sum float64) {
+	t.Helper()
+	for _, line := range strings.Split(scrape(t, app), "\n") {
+		var value float64
+		if _, err := fmt.Sscanf(line, name+"_count{"+labels+"} %g", &value); err == nil {
+			count = value
+		}
+		if _, err := fmt.Sscanf(line, name+"_sum{"+labels+"} %g", &value); err == nil {
+			sum = value
+		}
+	}
+	return count, sum
+}
+
+func TestMiddlewareWaitHistogram(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	const series = `method="GET",path="/users/{id}"`
+
+	t.Run("observed", func(t *testing.T) {
+		app := newTestApp(t)
+		// Time spent in middleware before the handler runs
+		app.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(delay)
+				next.ServeHTTP(w, r)
+			})
+		})
+		app.GET("/users/{id}", okHandler)
+		h := app.Handler()
+		serve(h, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+		serve(h, httptest.NewRequest(http.MethodGet, "/users/2", nil))
+
+		count, sum := histogramSample(t, app, "http_request_middleware_seconds", series)
+		if count != 2 {
+			t.Fatalf("count = %v, want 2", count)
+		}
+		if sum < 2*delay.Seconds() {
+			t.Errorf("sum = %vs, want at least %vs", sum, 2*delay.Seconds())
+		}
+	})
+
+	t.Run("unmatched requests", func(t *testing.T) {
+		app := newTestApp(t)
+		app.GET("/users/{id}", okHandler)
+		serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+		if strings.Contains(scrape(t, app), "http_request_middleware_seconds_count") {
+			t.Error("a request no handler served was observed")
+		}
+	})
+
+	t.Run("metrics disabled", func(t *testing.T) {
+		app := newTestApp(t, func(c *Config) { c.MetricsEnabled = false })
+		app.GET("/users/{id}", okHandler)
+		serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+		if count := testutil.CollectAndCount(app.metrics.middlewareWait); count != 0 {
+			t.Errorf("%d series observed with metrics disabled", count)
+		}
+	})
+}
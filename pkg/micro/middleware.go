@@ -14,41 +14,133 @@ import (
 // loggingResponseWriter needs to include context in its struct
 type loggingResponseWriter struct {
 	http.ResponseWriter
-	statusCode int
-	context    context.Context
+	statusCode   int
+	context      context.Context
+	statusHeader string // Set to the final status before it is written
+	wroteHeader  bool
 }
 
+// requestStartMiddleware records when the request entered the stack and
+// tracks it as in flight
+func (a *App) requestStartMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.inFlight.Add(1)
+		defer a.inFlight.Add(-1)
+
+		ctx := context.WithValue(r.Context(), contextKeyStartTime, time.Now())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestStartTime returns when the request entered the middleware stack,
+// or the zero time outside of a request
+func RequestStartTime(ctx context.Context) time.Time {
+	start, _ := ctx.Value(contextKeyStartTime).(time.Time)
+	return start
+}
+
+// maxRequestIDLength bounds upstream IDs so they cannot bloat logs
+const maxRequestIDLength = 128
+
 func (a *App) requestIDMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requestID := xid.New().String()
+		requestID := a.upstreamRequestID(r)
+		if requestID == "" {
+			requestID = a.newRequestID()
+		}
 		w.Header().Set("X-Request-ID", requestID)
 		ctx := context.WithValue(r.Context(), contextKeyRequestID, requestID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// upstreamRequestID returns the incoming X-Request-ID if it is accepted
+func (a *App) upstreamRequestID(r *http.Request) string {
+	return a.acceptRequestID(r.Header.Get("X-Request-ID"))
+}
+
+// acceptRequestID returns id when RequestIDPattern is set and id matches it
+// in full, and "" otherwise
+func (a *App) acceptRequestID(id string) string {
+	if a.requestIDPattern == nil {
+		return ""
+	}
+	if id == "" || len(id) > maxRequestIDLength {
+		return ""
+	}
+	if !a.requestIDPattern.MatchString(id) {
+		return ""
+	}
+	return id
+}
+
+func (a *App) newRequestID() string {
+	if a.Config.RequestIDGenerator != nil {
+		return a.Config.RequestIDGenerator()
+	}
+	return xid.New().String()
+}
+
 func (a *App) logMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+
+		// Correlation fields shared by the access log and the request logger
+		fields := append([]zap.Field{
+			zap.String("request_id", r.Context().Value(contextKeyRequestID).(string)),
+		}, traceFields(r.Context())...)
+
+		// Request-scoped logger for handlers and services, see LoggerFromContext
+		requestLogger := a.Logger.With(fields...).With(
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+		)
+		if a.debugRequested(r) {
+			if l, ok := requestLogger.(interface{ WithDebug() Logger }); ok {
+				requestLogger = l.WithDebug()
+			}
+		}
+		ctx := context.WithValue(r.Context(), contextKeyLogger, requestLogger)
+		r = r.WithContext(ctx)
+
 		lrw := &loggingResponseWriter{
 			ResponseWriter: w,
 			statusCode:     http.StatusOK,
-			context:        r.Context(),
+			context:        ctx,
+			statusHeader:   a.Config.ResponseStatusHeader,
 		}
 
 		next.ServeHTTP(lrw, r)
 
-		a.Logger.Info("request processed",
+		duration := time.Since(start)
+		fields = append([]zap.Field{
 			zap.String("method", r.Method),
 			zap.String("path", r.URL.Path),
 			zap.String("remote_addr", r.RemoteAddr),
 			zap.Int("status", lrw.statusCode),
-			zap.Duration("duration", time.Since(start)),
-			zap.String("request_id", lrw.context.Value(contextKeyRequestID).(string)),
-		)
+			zap.Duration("duration", duration),
+		}, fields...)
+		if threshold := a.Config.SlowRequestThreshold; threshold > 0 && duration >= threshold {
+			if a.Config.MetricsEnabled {
+				a.metrics.slowRequests.WithLabelValues(r.Method, routeLabel(r)).Inc()
+			}
+			a.Logger.Warn("slow request processed", append(fields, zap.Bool("slow", true))...)
+			return
+		}
+		a.Logger.Info("request processed", fields...)
 	})
 }
 
+// debugRequested reports whether the request asks for debug logging. The
+// header is only honored from DebugTrustedCIDRs so clients cannot flood the
+// logs.
+func (a *App) debugRequested(r *http.Request) bool {
+	if a.Config.DebugHeader == "" || r.Header.Get(a.Config.DebugHeader) == "" {
+		return false
+	}
+	return remoteAddrIn(r.RemoteAddr, a.debugNets)
+}
+
 func (a *App) recoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -58,16 +150,36 @@ func (a *App) recoveryMiddleware(next http.Handler) http.Handler {
 					zap.Any("error", err),
 					zap.String("request_id", requestID),
 				)
-				a.handleError(w, NewAPIError(http.StatusInternalServerError, "Internal server error"))
+				if a.panicHandler != nil {
+					a.panicHandler(r.Context(), err)
+				}
+				a.handleError(w, r, NewAPIError(http.StatusInternalServerError, "Internal server error"))
 			}
 		}()
 		next.ServeHTTP(w, r)
 	})
 }
 
+// timeoutMiddleware bounds the handler context by timeout, or by the
+// matched route's WithTimeout override
 func (a *App) timeoutMiddleware(timeout time.Duration) mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout := timeout
+			if cfg := a.routeConfigFor(r); cfg != nil {
+				if cfg.timeout > 0 {
+					timeout = cfg.timeout
+				}
+				switch {
+				case cfg.streaming:
+					// A zero deadline removes it
+					http.NewResponseController(w).SetWriteDeadline(time.Time{})
+				case cfg.timeout > 0 && timeout >= a.Config.WriteTimeout && a.Config.WriteTimeout > 0:
+					// Leave room to write the response, including a 504
+					http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + a.Config.WriteTimeout))
+				}
+			}
+
 			ctx, cancel := context.WithTimeout(r.Context(), timeout)
 			defer cancel()
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -84,12 +196,26 @@ func (a *App) metricsMiddleware(next http.Handler) http.Handler {
 			context:        r.Context(),
 		}
 
+		ctx := r.Context()
+		// For Timer in handlers
+		inner := context.WithValue(ctx, contextKeyMetrics, a.metrics)
+		var scope *metricsScope
+		if len(a.metrics.contextLabels) > 0 {
+			scope = &metricsScope{}
+			inner = context.WithValue(inner, contextKeyMetricsScope, scope)
+		}
+		r = r.WithContext(inner)
+
 		next.ServeHTTP(lrw, r)
 
+		if scope != nil && scope.ctx != nil {
+			ctx = scope.ctx
+		}
 		duration := time.Since(start).Seconds()
 		status := strconv.Itoa(lrw.statusCode)
-		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, status).Inc()
-		httpDuration.WithLabelValues(r.Method, r.URL.Path).Observe(duration)
+		path := routeLabel(r)
+		a.metrics.requestsTotal.WithLabelValues(a.metrics.requestLabels(ctx, r.Method, path, status)...).Inc()
+		observeWithTrace(r.Context(), a.metrics.requestDuration.WithLabelValues(r.Method, path), duration)
 	})
 }
 
@@ -107,5 +233,17 @@ func (a *App) securityHeadersMiddleware(next http.Handler) http.Handler {
 type contextKey string
 
 const (
-	contextKeyRequestID contextKey = "request_id"
+	contextKeyRequestID    contextKey = "request_id"
+	contextKeyLogger       contextKey = "logger"
+	contextKeyPrincipal    contextKey = "principal"
+	contextKeyTenant       contextKey = "tenant"
+	contextKeyStartTime    contextKey = "start_time"
+	contextKeyAPIVersion   contextKey = "api_version"
+	contextKeyRequestScope contextKey = "request_scope"
+	contextKeyMetricsScope contextKey = "metrics_scope"
+	contextKeyFeatureFlags contextKey = "feature_flags"
+	contextKeyTranslator   contextKey = "translator"
+	contextKeyQuery        contextKey = "query"
+	contextKeyMetrics      contextKey = "metrics"
+	contextKeyMethods      contextKey = "allowed_methods"
 )
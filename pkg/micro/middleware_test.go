@@ -0,0 +1,425 @@
+package micro
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRequestStartTime(t *testing.T) {
+	app := newTestApp(t)
+	var start time.Time
+	app.GET("/users", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		start = RequestStartTime(ctx)
+		return okHandler(ctx, w, r)
+	})
+
+	before := time.Now()
+	serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/users", nil))
+	if start.Before(before) || start.After(time.Now()) {
+		t.Errorf("start time %v outside the request", start)
+	}
+
+	if got := RequestStartTime(context.Background()); !got.IsZero() {
+		t.Errorf("RequestStartTime outside a request = %v, want zero", got)
+	}
+}
+
+func TestHealthHandlerWithoutStartTime(t *testing.T) {
+	app := newTestApp(t)
+	app.AddHealthCheck("db", HealthCheck{Check: func(ctx context.Context) error { return nil }})
+
+	// Called outside the middleware stack, as when mounted on another mux
+	w := httptest.NewRecorder()
+	app.healthHandler(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if _, ok := decodeBody(t, w)["duration"]; !ok {
+		t.Error("response has no duration")
+	}
+}
+
+func TestPerRequestDebugLogging(t *testing.T) {
+	app := newTestApp(t, func(c *Config) {
+		c.DebugHeader = "X-Debug"
+		c.DebugTrustedCIDRs = []string{"10.0.0.0/8"}
+	})
+	// An info-level logger that keeps an unfiltered copy, as NewLogger does
+	core, logs := observer.New(zapcore.DebugLevel)
+	filtered, _ := zapcore.NewIncreaseLevelCore(core, zapcore.InfoLevel)
+	app.Logger = &ZapLogger{Logger: zap.New(filtered), verbose: zap.New(core)}
+	app.GET("/users", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		LoggerFromContext(ctx).Debug("cache lookup", zap.String("key", r.URL.Query().Get("id")))
+		return okHandler(ctx, w, r)
+	})
+	h := app.Handler()
+
+	tests := []struct {
+		id     string
+		addr   string
+		header string
+		debug  bool
+	}{
+		{"trusted", "10.1.2.3:1234", "1", true},
+		{"plain", "10.1.2.3:1234", "", false},
+		{"untrusted", "192.0.2.1:1234", "1", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/users?id="+tt.id, nil)
+		r.RemoteAddr = tt.addr
+		if tt.header != "" {
+			r.Header.Set("X-Debug", tt.header)
+		}
+		serve(h, r)
+	}
+
+	var flagged []string
+	for _, e := range logs.FilterMessage("cache lookup").All() {
+		flagged = append(flagged, e.ContextMap()["key"].(string))
+		// The request fields carry over to the debug logger
+		if e.ContextMap()["request_id"] == nil {
+			t.Errorf("debug entry lacks request fields: %v", e.ContextMap())
+		}
+	}
+	if len(flagged) != 1 || flagged[0] != "trusted" {
+		t.Errorf("debug lines logged for %v, want only the trusted flagged request", flagged)
+	}
+	// Other requests still log at the configured level
+	if n := logs.FilterMessage("request processed").Len(); n != len(tests) {
+		t.Errorf("access log entries = %d, want %d", n, len(tests))
+	}
+}
+
+// sleepHandler takes d unless its context ends first
+func sleepHandler(d time.Duration) Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		select {
+		case <-time.After(d):
+			return okHandler(ctx, w, r)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func TestPerRouteTimeout(t *testing.T) {
+	app := newTestApp(t, func(c *Config) { c.HandlerTimeout = 50 * time.Millisecond })
+	app.GET("/report", sleepHandler(100*time.Millisecond), WithTimeout(5*time.Second))
+	app.GET("/lookup", sleepHandler(100*time.Millisecond))
+	app.GET("/fast", sleepHandler(30*time.Millisecond), WithTimeout(10*time.Millisecond))
+	h := app.Handler()
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		// Exceeds the global timeout but not its override
+		{"/report", http.StatusOK},
+		{"/lookup", http.StatusGatewayTimeout},
+		// Within the global timeout but not its shorter override
+		{"/fast", http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		if w := serve(h, httptest.NewRequest(http.MethodGet, tt.path, nil)); w.Code != tt.status {
+			t.Errorf("GET %s status = %d, want %d", tt.path, w.Code, tt.status)
+		}
+	}
+}
+
+// uuidV4 is a minimal UUIDv4 generator standing in for a team's own scheme
+func uuidV4() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+var uuidV4Format = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestRequestIDGenerator(t *testing.T) {
+	app := newTestApp(t, func(c *Config) { c.RequestIDGenerator = uuidV4 })
+	var seen string
+	app.GET("/users", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		seen, _ = ctx.Value(contextKeyRequestID).(string)
+		return nil
+	})
+
+	w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/users", nil))
+	id := w.Header().Get("X-Request-ID")
+	if !uuidV4Format.MatchString(id) {
+		t.Errorf("X-Request-ID = %q, want a UUIDv4", id)
+	}
+	if seen != id {
+		t.Errorf("handler saw request ID %q, header has %q", seen, id)
+	}
+}
+
+func TestRequestIDDefaultsToXID(t *testing.T) {
+	app := newTestApp(t)
+	app.GET("/users", okHandler)
+	w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/users", nil))
+	if id := w.Header().Get("X-Request-ID"); !regexp.MustCompile(`^[0-9a-v]{20}$`).MatchString(id) {
+		t.Errorf("X-Request-ID = %q, want an xid", id)
+	}
+}
+
+func TestUpstreamRequestID(t *testing.T) {
+	uuidPattern := `[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`
+	upstream := uuidV4()
+	tests := []struct {
+		name     string
+		pattern  string
+		incoming string
+		honored  bool
+	}{
+		{"matching", uuidPattern, upstream, true},
+		{"not matching", uuidPattern, "abc", false},
+		{"partial match", uuidPattern, upstream + "-evil", false},
+		{"too long", `.*`, strings.Repeat("a", maxRequestIDLength+1), false},
+		{"no pattern", "", upstream, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, func(c *Config) {
+				c.RequestIDPattern = tt.pattern
+				c.RequestIDGenerator = uuidV4
+			})
+			app.GET("/users", okHandler)
+
+			r := httptest.NewRequest(http.MethodGet, "/users", nil)
+			r.Header.Set("X-Request-ID", tt.incoming)
+			id := serve(app.Handler(), r).Header().Get("X-Request-ID")
+			if honored := id == tt.incoming; honored != tt.honored {
+				t.Errorf("X-Request-ID = %q, honored = %v, want %v", id, honored, tt.honored)
+			}
+			if !tt.honored && !uuidV4Format.MatchString(id) {
+				t.Errorf("replacement ID %q not from the generator", id)
+			}
+		})
+	}
+}
+
+func TestInvalidRequestIDPattern(t *testing.T) {
+	config := &Config{
+		Port:             8080,
+		LogLevel:         "error",
+		DBDSN:            "postgres://localhost/test",
+		HandlerTimeout:   time.Second,
+		RateLimiter:      RateLimiterConfig{Strategy: "ip"},
+		RequestIDPattern: "(",
+	}
+	_, err := NewApp(config)
+	if err == nil || !strings.Contains(err.Error(), "request ID pattern") {
+		t.Errorf("NewApp err = %v, want an invalid request ID pattern error", err)
+	}
+}
+
+// sseHandler streams five events 50ms apart, outlasting a 100ms write
+// timeout, and reports why it stopped on done: nil once all events are
+// sent, the context error when the handler timed out
+func sseHandler(done chan<- error) Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) (err error) {
+		defer func() { done <- err }()
+		w.Header().Set("Content-Type", "text/event-stream")
+		rc := http.NewResponseController(w)
+		for i := range 5 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(50 * time.Millisecond):
+			}
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			if err := rc.Flush(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestStreamingRoute(t *testing.T) {
+	app := newTestApp(t, func(c *Config) {
+		c.WriteTimeout = 100 * time.Millisecond
+		c.HandlerTimeout = 5 * time.Second
+	})
+	streamErr, cutErr, boundedErr := make(chan error, 1), make(chan error, 1), make(chan error, 1)
+	app.GET("/events", sseHandler(streamErr), Streaming())
+	app.GET("/events/unmarked", sseHandler(cutErr))
+	// Streaming lifts the write deadline, not the handler timeout
+	app.GET("/events/bounded", sseHandler(boundedErr), Streaming(), WithTimeout(120*time.Millisecond))
+
+	// A real server, since httptest.ResponseRecorder has no write deadline
+	srv := httptest.NewUnstartedServer(nil)
+	srv.Config = app.newServer()
+	srv.Config.Handler = app.Handler()
+	srv.Start()
+	defer srv.Close()
+
+	read := func(path string) (string, error) {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	body, err := read("/events")
+	if err != nil || strings.Count(body, "data:") != 5 {
+		t.Errorf("streaming route: body %q, err %v, want all 5 events", body, err)
+	}
+	if err := <-streamErr; err != nil {
+		t.Errorf("streaming handler stopped with %v", err)
+	}
+
+	// Without the option the write timeout cuts the stream short
+	body, err = read("/events/unmarked")
+	if err == nil && strings.Count(body, "data:") == 5 {
+		t.Error("unmarked route streamed past the write timeout")
+	}
+	<-cutErr
+
+	body, _ = read("/events/bounded")
+	if n := strings.Count(body, "data:"); n == 0 || n == 5 {
+		t.Errorf("bounded route sent %d events, want the stream cut by its handler timeout", n)
+	}
+	if err := <-boundedErr; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("bounded handler stopped with %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestResponseStatusHeader(t *testing.T) {
+	statusHandler := func(status int) Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			w.WriteHeader(status)
+			return nil
+		}
+	}
+	tests := []struct {
+		name   string
+		header string
+		path   string
+		want   string
+	}{
+		{"explicit status", "X-Response-Status", "/created", "201"},
+		{"implicit 200", "X-Response-Status", "/ok", "200"},
+		{"handler error", "X-Response-Status", "/fail", "409"},
+		{"unmatched route", "X-Response-Status", "/missing", "404"},
+		{"disabled", "", "/created", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, func(c *Config) { c.ResponseStatusHeader = tt.header })
+			app.GET("/created", statusHandler(http.StatusCreated))
+			// Writing the body without a status sends an implicit 200
+			app.GET("/ok", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				_, err := io.WriteString(w, "ok")
+				return err
+			})
+			app.GET("/fail", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				return NewAPIError(http.StatusConflict, "conflict")
+			})
+
+			w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if got := w.Header().Get("X-Response-Status"); got != tt.want {
+				t.Errorf("X-Response-Status = %q, want %q", got, tt.want)
+			}
+			if tt.header == "" && len(w.Header().Values("X-Response-Status")) != 0 {
+				t.Errorf("header set while disabled: %v", w.Header())
+			}
+		})
+	}
+}
+
+func TestResponseStatusHeaderSkipsInformational(t *testing.T) {
+	app := newTestApp(t, func(c *Config) { c.ResponseStatusHeader = "X-Response-Status" })
+	app.GET("/hints", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("Link", "</app.css>; rel=preload")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.WriteHeader(http.StatusAccepted)
+		return nil
+	})
+	srv := httptest.NewServer(app.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/hints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	// The header reports the final status, not the 103
+	if resp.StatusCode != http.StatusAccepted || resp.Header.Get("X-Response-Status") != "202" {
+		t.Errorf("response = %d with X-Response-Status %q, want 202", resp.StatusCode, resp.Header.Get("X-Response-Status"))
+	}
+}
+
+func TestSlowRequestThreshold(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		path      string
+		slow      bool
+	}{
+		{"slow request", 20 * time.Millisecond, "/slow", true},
+		{"fast request", 20 * time.Millisecond, "/fast", false},
+		{"disabled", 0, "/slow", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, func(c *Config) { c.SlowRequestThreshold = tt.threshold })
+			logger := NewTestLogger()
+			app.Logger = logger
+			app.GET("/slow", sleepHandler(40*time.Millisecond))
+			app.GET("/fast", okHandler)
+
+			serve(app.Handler(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			want := 0.0
+			if tt.slow {
+				want = 1
+			}
+			if got := testutil.ToFloat64(app.metrics.slowRequests.WithLabelValues(http.MethodGet, tt.path)); got != want {
+				t.Errorf("http_slow_requests_total = %v, want %v", got, want)
+			}
+			if !tt.slow {
+				if logger.Logged("slow request processed") {
+					t.Error("request was logged as slow")
+				}
+				if fields := entryFields(t, logger, "request processed"); fields["slow"] != nil {
+					t.Errorf("access log fields = %v, want no slow flag", fields)
+				}
+				return
+			}
+
+			fields := entryFields(t, logger, "slow request processed")
+			if fields["slow"] != true || fields["status"] != int64(http.StatusOK) {
+				t.Errorf("slow entry fields = %v", fields)
+			}
+			for _, e := range logger.Entries() {
+				if e.Message == "slow request processed" && e.Level != zapcore.WarnLevel {
+					t.Errorf("slow entry level = %v, want warn", e.Level)
+				}
+				// A slow request is logged once, not also as a plain access entry
+				if e.Message == "request processed" {
+					t.Error("slow request was also logged at info")
+				}
+			}
+		})
+	}
+}
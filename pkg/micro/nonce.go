@@ -0,0 +1,137 @@
+package micro
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// NonceHeader carries the client-supplied nonce checked by NonceMiddleware
+const NonceHeader = "X-Nonce"
+
+const maxNonceLength = 128
+
+// ErrNonceReused is returned when a request repeats a nonce within the window
+var ErrNonceReused = NewAPIError(http.StatusConflict, "nonce already used")
+
+// NonceStore records seen nonces. Add reports whether the nonce was new and
+// keeps it for ttl; it must be atomic so concurrent replays cannot both win.
+type NonceStore interface {
+	Add(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+// NonceMiddleware rejects requests without an X-Nonce header with 400 and
+// requests reusing a nonce seen within window with 409. Nonces are scoped to
+// the authenticated principal when there is one.
+//
+// A nonce alone does not stop an attacker from minting new ones; combine it
+// with WebhookVerifyMiddleware (or other request signing) so the nonce is
+// covered by the signature.
+func (a *App) NonceMiddleware(store NonceStore, window time.Duration) mux.MiddlewareFunc {
+	if window <= 0 {
+		window = 5 * time.Minute
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			nonce := r.Header.Get(NonceHeader)
+			if nonce == "" {
+				a.handleError(w, r, NewAPIError(http.StatusBadRequest, "X-Nonce header is required"))
+				return
+			}
+			if len(nonce) > maxNonceLength {
+				a.handleError(w, r, NewAPIError(http.StatusBadRequest, "X-Nonce header is too long"))
+				return
+			}
+
+			key := nonce
+			if p, ok := PrincipalFromContext(r.Context()); ok {
+				key = p.ID + ":" + nonce
+			}
+
+			added, err := store.Add(r.Context(), key, window)
+			if err != nil {
+				a.handleError(w, r, fmt.Errorf("record nonce: %w", err))
+				return
+			}
+			if !added {
+				LoggerFromContext(r.Context()).Warn("replayed nonce rejected", zap.String("nonce", nonce))
+				a.handleError(w, r, ErrNonceReused)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// memoryNonceStore keeps nonces in insertion order so expired ones can be
+// dropped from the oldest end
+type memoryNonceStore struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type memoryNonceEntry struct {
+	nonce     string
+	expiresAt time.Time
+}
+
+// NewMemoryNonceStore creates a NonceStore for a single instance. Use a
+// shared store such as RedisNonceStore when running several replicas.
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (s *memoryNonceStore) Add(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for el := s.order.Back(); el != nil; el = s.order.Back() {
+		entry := el.Value.(*memoryNonceEntry)
+		if now.Before(entry.expiresAt) {
+			break
+		}
+		s.order.Remove(el)
+		delete(s.entries, entry.nonce)
+	}
+
+	if el, ok := s.entries[nonce]; ok && now.Before(el.Value.(*memoryNonceEntry).expiresAt) {
+		return false, nil
+	}
+	s.entries[nonce] = s.order.PushFront(&memoryNonceEntry{nonce: nonce, expiresAt: now.Add(ttl)})
+	return true, nil
+}
+
+// RedisNonceStore stores nonces in Redis with SET NX and an expiry. SetNX
+// wraps the client of your choice, e.g. with go-redis:
+//
+//	micro.RedisNonceStore{
+//		Prefix: "nonce:",
+//		SetNX: func(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+//			return rdb.SetNX(ctx, key, 1, ttl).Result()
+//		},
+//	}
+type RedisNonceStore struct {
+	Prefix string // Namespaces keys, e.g. "nonce:"
+	SetNX  func(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// Add implements NonceStore
+func (s RedisNonceStore) Add(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	if s.SetNX == nil {
+		return false, fmt.Errorf("redis nonce store has no SetNX function")
+	}
+	return s.SetNX(ctx, s.Prefix+nonce, ttl)
+}
@@ -0,0 +1,140 @@
+package micro
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func nonceRequest(nonce string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/transfers", nil)
+	if nonce != "" {
+		r.Header.Set(NonceHeader, nonce)
+	}
+	return r
+}
+
+func TestNonceMiddleware(t *testing.T) {
+	app := newTestApp(t)
+	h := app.NonceMiddleware(NewMemoryNonceStore(), time.Minute)(http.HandlerFunc(okHTTPHandler))
+
+	tests := []struct {
+		name   string
+		nonce  string
+		status int
+	}{
+		{"first use", "n-1", http.StatusOK},
+		{"replay", "n-1", http.StatusConflict},
+		{"new nonce", "n-2", http.StatusOK},
+		{"missing", "", http.StatusBadRequest},
+		{"too long", strings.Repeat("n", maxNonceLength+1), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := serve(h, nonceRequest(tt.nonce)); w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
+
+func TestNonceMiddlewareScopesToPrincipal(t *testing.T) {
+	app := newTestApp(t)
+	h := app.NonceMiddleware(NewMemoryNonceStore(), time.Minute)(http.HandlerFunc(okHTTPHandler))
+
+	as := func(id string) *http.Request {
+		r := nonceRequest("shared")
+		return r.WithContext(WithPrincipal(r.Context(), &Principal{ID: id}))
+	}
+	if w := serve(h, as("alice")); w.Code != http.StatusOK {
+		t.Fatalf("alice: status = %d", w.Code)
+	}
+	// Another caller picking the same nonce is not a replay
+	if w := serve(h, as("bob")); w.Code != http.StatusOK {
+		t.Errorf("bob: status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := serve(h, as("alice")); w.Code != http.StatusConflict {
+		t.Errorf("alice replay: status = %d, want %d", w.Code, http.StatusConflict)
+	}
+}
+
+func TestNonceMiddlewareStoreError(t *testing.T) {
+	app := newTestApp(t)
+	store := RedisNonceStore{SetNX: func(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+		return false, errors.New("connection refused")
+	}}
+	h := app.NonceMiddleware(store, time.Minute)(http.HandlerFunc(okHTTPHandler))
+	if w := serve(h, nonceRequest("n-1")); w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestMemoryNonceStoreExpiry(t *testing.T) {
+	store := NewMemoryNonceStore()
+	ctx := context.Background()
+
+	if added, _ := store.Add(ctx, "n", 20*time.Millisecond); !added {
+		t.Fatal("first Add rejected")
+	}
+	if added, _ := store.Add(ctx, "n", 20*time.Millisecond); added {
+		t.Fatal("replay accepted within the window")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if added, _ := store.Add(ctx, "n", 20*time.Millisecond); !added {
+		t.Error("nonce still rejected after its window")
+	}
+	if n := len(store.(*memoryNonceStore).entries); n != 1 {
+		t.Errorf("store holds %d entries, want 1", n)
+	}
+}
+
+func TestMemoryNonceStoreConcurrentReplay(t *testing.T) {
+	store := NewMemoryNonceStore()
+	var accepted atomic.Int32
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if added, _ := store.Add(context.Background(), "n", time.Minute); added {
+				accepted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := accepted.Load(); n != 1 {
+		t.Errorf("nonce accepted %d times, want 1", n)
+	}
+}
+
+func TestRedisNonceStore(t *testing.T) {
+	seen := make(map[string]time.Duration)
+	store := RedisNonceStore{
+		Prefix: "nonce:",
+		SetNX: func(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+			if _, ok := seen[key]; ok {
+				return false, nil
+			}
+			seen[key] = ttl
+			return true, nil
+		},
+	}
+	ctx := context.Background()
+	if added, err := store.Add(ctx, "n-1", time.Minute); !added || err != nil {
+		t.Fatalf("Add = %v, %v", added, err)
+	}
+	if added, _ := store.Add(ctx, "n-1", time.Minute); added {
+		t.Error("replay accepted")
+	}
+	if ttl := seen["nonce:n-1"]; ttl != time.Minute {
+		t.Errorf("stored keys %v, want nonce:n-1 with a one minute TTL", seen)
+	}
+
+	if _, err := (RedisNonceStore{}).Add(ctx, "n", time.Minute); err == nil {
+		t.Error("store without SetNX accepted a nonce")
+	}
+}
@@ -0,0 +1,373 @@
+package micro
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// OpenAPIOptions configures the generated OpenAPI document
+type OpenAPIOptions struct {
+	Title       string
+	Version     string
+	Description string
+	SpecPath    string // Defaults to /openapi.json
+	DocsPath    string // Defaults to /docs
+}
+
+// RouteDoc holds the OpenAPI metadata attached to a route with WithDoc
+type RouteDoc struct {
+	Summary  string
+	Request  interface{}
+	Response interface{}
+	Status   int
+}
+
+var pathParamPattern = regexp.MustCompile(`\{([^}:]+)(?::[^}]*)?\}`)
+
+// EnableOpenAPI serves a generated OpenAPI 3 spec and a Swagger UI page
+func (a *App) EnableOpenAPI(opts OpenAPIOptions) {
+	if opts.Title == "" {
+		opts.Title = a.Config.AppName
+	}
+	if opts.Version == "" {
+		opts.Version = "1.0.0"
+	}
+	if opts.SpecPath == "" {
+		opts.SpecPath = "/openapi.json"
+	}
+	if opts.DocsPath == "" {
+		opts.DocsPath = "/docs"
+	}
+
+	a.Router.HandleFunc(opts.SpecPath, func(w http.ResponseWriter, r *http.Request) {
+		a.JSON(w, http.StatusOK, a.OpenAPISpec(opts))
+	}).Methods(http.MethodGet)
+
+	a.Router.HandleFunc(opts.DocsPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, swaggerUITemplate, opts.Title, opts.SpecPath)
+	}).Methods(http.MethodGet)
+}
+
+// OpenAPISpec builds an OpenAPI 3 document from the registered routes
+func (a *App) OpenAPISpec(opts OpenAPIOptions) map[string]interface{} {
+	schemas := map[string]interface{}{
+		"APIError": schemaFor(reflect.TypeOf(APIError{}), nil),
+	}
+	paths := map[string]interface{}{}
+
+	a.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		// Only routes annotated with WithDoc are published
+		doc, ok := a.docs[route]
+		if !ok {
+			return nil
+		}
+		tpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+
+		path := pathParamPattern.ReplaceAllString(tpl, "{$1}")
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+
+		for _, method := range methods {
+			item[strings.ToLower(method)] = buildOperation(method, tpl, doc, schemas)
+		}
+		return nil
+	})
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       opts.Title,
+			"version":     opts.Version,
+			"description": opts.Description,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+		},
+	}
+}
+
+func buildOperation(method, tpl string, doc *RouteDoc, schemas map[string]interface{}) map[string]interface{} {
+	op := map[string]interface{}{}
+	parameters := []interface{}{}
+
+	for _, match := range pathParamPattern.FindAllStringSubmatch(tpl, -1) {
+		parameters = append(parameters, map[string]interface{}{
+			"name":     match[1],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "string"},
+		})
+	}
+
+	status := http.StatusOK
+	var response interface{}
+
+	if doc != nil {
+		if doc.Summary != "" {
+			op["summary"] = doc.Summary
+		}
+		status = doc.Status
+		response = doc.Response
+
+		if doc.Request != nil {
+			reqType := indirectType(reflect.TypeOf(doc.Request))
+			parameters = append(parameters, queryParameters(reqType)...)
+
+			switch method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch:
+				op["requestBody"] = map[string]interface{}{
+					"required": true,
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{
+							"schema": schemaFor(reqType, schemas),
+						},
+					},
+				}
+			}
+		}
+	}
+
+	if len(parameters) > 0 {
+		op["parameters"] = parameters
+	}
+
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	if response != nil && status != http.StatusNoContent {
+		success["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": schemaFor(reflect.TypeOf(response), schemas),
+			},
+		}
+	}
+
+	op["responses"] = map[string]interface{}{
+		strconv.Itoa(status): success,
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": map[string]interface{}{"$ref": "#/components/schemas/APIError"},
+				},
+			},
+		},
+	}
+
+	return op
+}
+
+// queryParameters documents struct fields tagged with `query`
+func queryParameters(t reflect.Type) []interface{} {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var params []interface{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("query")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		schema := schemaFor(field.Type, nil)
+		required := applyValidateTag(schema, field.Tag.Get("validate"))
+		params = append(params, map[string]interface{}{
+			"name":     name,
+			"in":       "query",
+			"required": required,
+			"schema":   schema,
+		})
+	}
+	return params
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// schemaFor reflects a JSON schema for t. Named structs are registered in
+// schemas and referenced; a nil schemas map inlines them instead.
+func schemaFor(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	t = indirectType(t)
+
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	// Optional fields are documented as their value type, accepting null
+	if t.Implements(reflect.TypeOf((*optionalValue)(nil)).Elem()) {
+		field, _ := t.FieldByName("Value")
+		schema := schemaFor(field.Type, schemas)
+		if schema["$ref"] == nil {
+			schema["nullable"] = true
+		}
+		return schema
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem(), schemas)}
+	case reflect.Struct:
+		if schemas == nil || t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+		if _, exists := schemas[t.Name()]; !exists {
+			// Reserve the name first so recursive types terminate
+			schemas[t.Name()] = map[string]interface{}{}
+			schemas[t.Name()] = structSchema(t, schemas)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		jsonTag := field.Tag.Get("json")
+		name := strings.Split(jsonTag, ",")[0]
+		// Query-only fields are documented as parameters, not body properties
+		if name == "-" || (jsonTag == "" && field.Tag.Get("query") != "") {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := schemaFor(field.Type, schemas)
+		if applyValidateTag(schema, field.Tag.Get("validate")) {
+			required = append(required, name)
+		}
+		properties[name] = schema
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// applyValidateTag maps validator constraints onto a schema and reports
+// whether the field is required
+func applyValidateTag(schema map[string]interface{}, tag string) bool {
+	if tag == "" {
+		return false
+	}
+
+	required := false
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		if name == "required" {
+			required = true
+			continue
+		}
+		// $ref schemas cannot carry sibling keywords
+		if schema["$ref"] != nil {
+			continue
+		}
+
+		switch name {
+		case "email":
+			schema["format"] = "email"
+		case "url", "uri":
+			schema["format"] = "uri"
+		case "oneof":
+			schema["enum"] = strings.Fields(param)
+		case "min", "max", "len":
+			n, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+			applyBound(schema, name, n)
+		}
+	}
+	return required
+}
+
+func applyBound(schema map[string]interface{}, rule string, n float64) {
+	var lower, upper string
+	switch schema["type"] {
+	case "string":
+		lower, upper = "minLength", "maxLength"
+	case "array":
+		lower, upper = "minItems", "maxItems"
+	case "integer", "number":
+		lower, upper = "minimum", "maximum"
+	default:
+		return
+	}
+
+	switch rule {
+	case "min":
+		schema[lower] = n
+	case "max":
+		schema[upper] = n
+	case "len":
+		schema[lower] = n
+		schema[upper] = n
+	}
+}
+
+const swaggerUITemplate = `<!DOCTYPE html>
+<html>
+<head>
+  <title>%s</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "%s", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>`
@@ -0,0 +1,110 @@
+package micro
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type createWidgetRequest struct {
+	Name  string `json:"name" validate:"required,min=2"`
+	Color string `json:"color" validate:"oneof=red blue"`
+}
+
+type widgetResponse struct {
+	ID   int32  `json:"id"`
+	Name string `json:"name"`
+}
+
+type listWidgetsParams struct {
+	Limit int `query:"limit" validate:"min=1,max=50"`
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	app := newTestApp(t)
+	app.POST("/widgets", okHandler).
+		WithDoc("Create a widget", createWidgetRequest{}, widgetResponse{}, http.StatusCreated)
+	app.GET("/widgets", okHandler).
+		WithDoc("List widgets", listWidgetsParams{}, []widgetResponse{})
+	app.GET("/widgets/{id:[0-9]+}", okHandler).
+		WithDoc("Get a widget", nil, widgetResponse{})
+	app.GET("/undocumented", okHandler)
+	app.EnableOpenAPI(OpenAPIOptions{Title: "widgets"})
+
+	w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	spec := decodeBody(t, w)
+
+	paths := spec["paths"].(map[string]interface{})
+	if _, ok := paths["/undocumented"]; ok {
+		t.Error("route without WithDoc is published")
+	}
+
+	create := lookup(t, paths, "/widgets", "post")
+	if _, ok := lookup(t, create, "responses").(map[string]interface{})["201"]; !ok {
+		t.Errorf("create responses = %v, want a 201", lookup(t, create, "responses"))
+	}
+	bodySchema := lookup(t, create, "requestBody", "content", "application/json", "schema")
+	if ref := bodySchema.(map[string]interface{})["$ref"]; ref != "#/components/schemas/createWidgetRequest" {
+		t.Errorf("request body $ref = %v", ref)
+	}
+
+	// Path parameter regexps are stripped from the OpenAPI path
+	get := lookup(t, paths, "/widgets/{id}", "get").(map[string]interface{})
+	param := get["parameters"].([]interface{})[0].(map[string]interface{})
+	if param["name"] != "id" || param["in"] != "path" {
+		t.Errorf("path parameter = %v", param)
+	}
+
+	list := lookup(t, paths, "/widgets", "get").(map[string]interface{})
+	query := list["parameters"].([]interface{})[0].(map[string]interface{})
+	wantQuery := map[string]interface{}{
+		"name":     "limit",
+		"in":       "query",
+		"required": false,
+		"schema":   map[string]interface{}{"type": "integer", "format": "int64", "minimum": 1.0, "maximum": 50.0},
+	}
+	if !reflect.DeepEqual(query, wantQuery) {
+		t.Errorf("query parameter = %v, want %v", query, wantQuery)
+	}
+
+	schema := lookup(t, spec, "components", "schemas", "createWidgetRequest").(map[string]interface{})
+	if !reflect.DeepEqual(schema["required"], []interface{}{"name"}) {
+		t.Errorf("required = %v, want [name]", schema["required"])
+	}
+	color := lookup(t, schema, "properties", "color").(map[string]interface{})
+	if !reflect.DeepEqual(color["enum"], []interface{}{"red", "blue"}) {
+		t.Errorf("color enum = %v", color["enum"])
+	}
+}
+
+func TestOpenAPIDocsPage(t *testing.T) {
+	app := newTestApp(t)
+	app.EnableOpenAPI(OpenAPIOptions{})
+
+	w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
+
+// lookup walks nested JSON objects by key
+func lookup(t *testing.T, v interface{}, keys ...string) interface{} {
+	t.Helper()
+	for _, key := range keys {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			t.Fatalf("%q: not an object: %v", key, v)
+		}
+		if v, ok = m[key]; !ok {
+			t.Fatalf("missing key %q in %v", key, m)
+		}
+	}
+	return v
+}
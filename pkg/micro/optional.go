@@ -0,0 +1,87 @@
+package micro
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+)
+
+// Optional is a JSON field that distinguishes an absent field from an
+// explicit null, for partial updates:
+//
+//	absent:  Set == false
+//	null:    Set == true, Null == true
+//	value:   Set == true, Null == false
+type Optional[T any] struct {
+	Value T
+	Set   bool
+	Null  bool
+}
+
+// Some returns an Optional holding v
+func Some[T any](v T) Optional[T] {
+	return Optional[T]{Value: v, Set: true}
+}
+
+// Null returns an Optional that is explicitly null
+func Null[T any]() Optional[T] {
+	return Optional[T]{Set: true, Null: true}
+}
+
+// Get returns the value and whether one is present and not null
+func (o Optional[T]) Get() (T, bool) {
+	return o.Value, o.Set && !o.Null
+}
+
+// UnmarshalJSON is only called for fields present in the document, which is
+// what lets absent fields keep Set false
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		var zero T
+		o.Value = zero
+		o.Null = true
+		return nil
+	}
+	o.Null = false
+	return json.Unmarshal(data, &o.Value)
+}
+
+// MarshalJSON encodes absent and null values as null
+func (o Optional[T]) MarshalJSON() ([]byte, error) {
+	if !o.Set || o.Null {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.Value)
+}
+
+// validationValue exposes the value to the validator, or nil when absent or
+// null so "omitempty" skips it
+func (o Optional[T]) validationValue() interface{} {
+	if v, ok := o.Get(); ok {
+		return v
+	}
+	return nil
+}
+
+type optionalValue interface {
+	validationValue() interface{}
+}
+
+// optionalTypes are the Optional instantiations validated through their
+// value. Validation tags on other instantiations are not applied.
+var optionalTypes = []interface{}{
+	Optional[string]{},
+	Optional[bool]{},
+	Optional[int]{},
+	Optional[int32]{},
+	Optional[int64]{},
+	Optional[float64]{},
+}
+
+func optionalTypeFunc(v reflect.Value) interface{} {
+	if o, ok := v.Interface().(optionalValue); ok {
+		return o.validationValue()
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package micro
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type optionalUpdate struct {
+	Name  Optional[string] `json:"name" validate:"omitempty,min=2"`
+	Phone Optional[string] `json:"phone" validate:"omitempty,e164"`
+	Age   Optional[int]    `json:"age"`
+}
+
+func TestOptionalUnmarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want Optional[string]
+	}{
+		{"omitted", `{}`, Optional[string]{}},
+		{"explicit null", `{"phone":null}`, Optional[string]{Set: true, Null: true}},
+		{"value", `{"phone":"+15550100"}`, Optional[string]{Value: "+15550100", Set: true}},
+		{"empty string", `{"phone":""}`, Optional[string]{Set: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var u optionalUpdate
+			if err := json.Unmarshal([]byte(tt.body), &u); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if u.Phone != tt.want {
+				t.Errorf("phone = %+v, want %+v", u.Phone, tt.want)
+			}
+			_, ok := u.Phone.Get()
+			if want := tt.want.Set && !tt.want.Null; ok != want {
+				t.Errorf("Get ok = %v, want %v", ok, want)
+			}
+		})
+	}
+}
+
+func TestOptionalUnmarshalTypeMismatch(t *testing.T) {
+	var u optionalUpdate
+	if err := json.Unmarshal([]byte(`{"age":"forty"}`), &u); err == nil {
+		t.Error("Unmarshal accepted a string for Optional[int]")
+	}
+}
+
+func TestOptionalMarshal(t *testing.T) {
+	b, err := json.Marshal(optionalUpdate{Name: Some("Ada"), Phone: Null[string]()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"name":"Ada","phone":null,"age":null}`; string(b) != want {
+		t.Errorf("Marshal = %s, want %s", b, want)
+	}
+}
+
+func TestOptionalValidation(t *testing.T) {
+	app := newTestApp(t)
+
+	tests := []struct {
+		name  string
+		input optionalUpdate
+		valid bool
+	}{
+		{"omitted", optionalUpdate{}, true},
+		{"null skips rules", optionalUpdate{Phone: Null[string]()}, true},
+		{"valid values", optionalUpdate{Name: Some("Ada"), Phone: Some("+15550100")}, true},
+		{"invalid phone", optionalUpdate{Phone: Some("555")}, false},
+		{"short name", optionalUpdate{Name: Some("A")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := app.Validator.Struct(tt.input); (err == nil) != tt.valid {
+				t.Errorf("Struct err = %v, want valid = %v", err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package micro
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+)
+
+// PaginationConfig bounds the page size of list endpoints. BindQuery applies
+// it to integer fields tagged `query:"limit"`.
+type PaginationConfig struct {
+	DefaultLimit int `envconfig:"PAGINATION_DEFAULT_LIMIT" default:"20"` // Used when limit is absent; 0 leaves the field alone
+	MaxLimit     int `envconfig:"PAGINATION_MAX_LIMIT" default:"100"`    // Largest accepted limit; 0 disables the cap
+	// RejectOverMax answers an oversized limit with 400 instead of clamping
+	// it to MaxLimit
+	RejectOverMax bool `envconfig:"PAGINATION_REJECT_OVER_MAX" default:"false"`
+}
+
+// limitFields returns the integer fields of elem tagged `query:"limit"`
+func limitFields(elem reflect.Value) []reflect.Value {
+	var fields []reflect.Value
+	t := elem.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("query") != "limit" {
+			continue
+		}
+		switch elem.Field(i).Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			fields = append(fields, elem.Field(i))
+		}
+	}
+	return fields
+}
+
+// applyPaginationDefault sets the default limit when the parameter is
+// absent. It runs before validation so a required limit is satisfied.
+func (a *App) applyPaginationDefault(elem reflect.Value, values url.Values) {
+	cfg := a.Config.Pagination
+	if _, ok := values["limit"]; ok || cfg.DefaultLimit <= 0 {
+		return
+	}
+	for _, field := range limitFields(elem) {
+		if field.Int() == 0 {
+			field.SetInt(int64(cfg.DefaultLimit))
+		}
+	}
+}
+
+// capPaginationLimit enforces MaxLimit on limits that passed validation, so
+// a `validate` tag on the field takes precedence and reports 422
+func (a *App) capPaginationLimit(elem reflect.Value) error {
+	cfg := a.Config.Pagination
+	if cfg.MaxLimit <= 0 {
+		return nil
+	}
+	for _, field := range limitFields(elem) {
+		if field.Int() <= int64(cfg.MaxLimit) {
+			continue
+		}
+		if cfg.RejectOverMax {
+			return NewAPIError(http.StatusBadRequest, "limit exceeds maximum", map[string]string{
+				"parameter": "limit",
+				"max":       strconv.Itoa(cfg.MaxLimit),
+			})
+		}
+		field.SetInt(int64(cfg.MaxLimit))
+	}
+	return nil
+}
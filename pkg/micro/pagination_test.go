@@ -0,0 +1,99 @@
+package micro
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type pageParams struct {
+	Limit  int32  `query:"limit"`
+	Cursor string `query:"cursor"`
+}
+
+func TestPagination(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     PaginationConfig
+		query   string
+		limit   int32
+		status  int
+		details map[string]string
+	}{
+		{"default limit", PaginationConfig{DefaultLimit: 20, MaxLimit: 100}, "", 20, 0, nil},
+		{"explicit limit", PaginationConfig{DefaultLimit: 20, MaxLimit: 100}, "limit=50", 50, 0, nil},
+		{"limit at max", PaginationConfig{DefaultLimit: 20, MaxLimit: 100}, "limit=100", 100, 0, nil},
+		{"clamped to max", PaginationConfig{DefaultLimit: 20, MaxLimit: 100}, "limit=500", 100, 0, nil},
+		// An explicit 0 is the caller's choice, not an absent limit
+		{"explicit zero", PaginationConfig{DefaultLimit: 20, MaxLimit: 100}, "limit=0", 0, 0, nil},
+		{"no default", PaginationConfig{MaxLimit: 100}, "", 0, 0, nil},
+		{"no cap", PaginationConfig{DefaultLimit: 20}, "limit=500", 500, 0, nil},
+		{"rejected over max", PaginationConfig{DefaultLimit: 20, MaxLimit: 100, RejectOverMax: true}, "limit=500", 0,
+			http.StatusBadRequest, map[string]string{"parameter": "limit", "max": "100"}},
+		{"accepted at max when rejecting", PaginationConfig{DefaultLimit: 20, MaxLimit: 100, RejectOverMax: true}, "limit=100", 100, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, func(c *Config) { c.Pagination = tt.cfg })
+
+			var params pageParams
+			err := app.BindQuery(httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil), &params)
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatalf("BindQuery: %v", err)
+				}
+				if params.Limit != tt.limit {
+					t.Errorf("limit = %d, want %d", params.Limit, tt.limit)
+				}
+				return
+			}
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("err = %v, want an *APIError", err)
+			}
+			if apiErr.Code != tt.status || !reflect.DeepEqual(apiErr.Details, tt.details) {
+				t.Errorf("error = %d %v, want %d %v", apiErr.Code, apiErr.Details, tt.status, tt.details)
+			}
+		})
+	}
+}
+
+func TestPaginationDefaultSatisfiesValidation(t *testing.T) {
+	app := newTestApp(t, func(c *Config) { c.Pagination = PaginationConfig{DefaultLimit: 20, MaxLimit: 100} })
+
+	// The default is applied before validation, so a required limit passes
+	var params struct {
+		Limit int `query:"limit" validate:"required"`
+	}
+	if err := app.BindQuery(httptest.NewRequest(http.MethodGet, "/", nil), &params); err != nil {
+		t.Fatalf("BindQuery: %v", err)
+	}
+	if params.Limit != 20 {
+		t.Errorf("limit = %d, want 20", params.Limit)
+	}
+}
+
+func TestPaginationRejectOverMaxResponse(t *testing.T) {
+	app := newTestApp(t, func(c *Config) {
+		c.Pagination = PaginationConfig{DefaultLimit: 20, MaxLimit: 100, RejectOverMax: true}
+	})
+	app.GET("/items", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		var params pageParams
+		if err := app.BindQuery(r, &params); err != nil {
+			return err
+		}
+		return app.JSON(w, http.StatusOK, params)
+	})
+
+	w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/items?limit=101", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if body := decodeBody(t, w); body["message"] != "limit exceeds maximum" {
+		t.Errorf("body = %v", body)
+	}
+}
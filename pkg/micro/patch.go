@@ -0,0 +1,93 @@
+package micro
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+// DecodeMergePatch applies the request body as an RFC 7386 JSON merge patch
+// to current and stores the validated result in v. A null in the patch
+// removes the field, which leaves it at its zero value in v. current and v
+// may be the same pointer.
+func (a *App) DecodeMergePatch(r *http.Request, current, v interface{}) error {
+	patch, err := a.readPatchBody(r)
+	if err != nil {
+		return err
+	}
+
+	original, err := json.Marshal(current)
+	if err != nil {
+		return fmt.Errorf("marshal patch target: %w", err)
+	}
+
+	patched, err := jsonpatch.MergePatch(original, patch)
+	if err != nil {
+		return NewAPIError(http.StatusBadRequest, "invalid merge patch")
+	}
+	return a.decodePatched(r.Context(), patched, v)
+}
+
+// DecodeJSONPatch applies the request body as an RFC 6902 JSON patch to doc,
+// which must be a pointer, and validates the result. doc is left unchanged
+// when the patch cannot be applied.
+func (a *App) DecodeJSONPatch(r *http.Request, doc interface{}) error {
+	body, err := a.readPatchBody(r)
+	if err != nil {
+		return err
+	}
+
+	patch, err := jsonpatch.DecodePatch(body)
+	if err != nil {
+		return NewAPIError(http.StatusBadRequest, "invalid JSON patch")
+	}
+
+	original, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("marshal patch target: %w", err)
+	}
+
+	patched, err := patch.Apply(original)
+	if err != nil {
+		return NewAPIError(http.StatusUnprocessableEntity, "JSON patch could not be applied",
+			map[string]string{"patch": err.Error()})
+	}
+	return a.decodePatched(r.Context(), patched, doc)
+}
+
+func (a *App) readPatchBody(r *http.Request) ([]byte, error) {
+	defer r.Body.Close()
+
+	body, err := a.readBody(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) == 0 {
+		return nil, NewAPIError(http.StatusBadRequest, "request body is required")
+	}
+	return body, nil
+}
+
+// decodePatched decodes a patched document into a fresh value so removed
+// fields do not keep their previous values, then validates it
+func (a *App) decodePatched(ctx context.Context, patched []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("patch target must be a non-nil pointer, got %T", v)
+	}
+
+	fresh := reflect.New(rv.Elem().Type())
+	if err := json.Unmarshal(patched, fresh.Interface()); err != nil {
+		return NewAPIError(http.StatusUnprocessableEntity, "patched document is invalid")
+	}
+	if err := a.Validator.Struct(fresh.Interface()); err != nil {
+		return a.newValidationError(ctx, http.StatusUnprocessableEntity, err)
+	}
+
+	rv.Elem().Set(fresh.Elem())
+	return nil
+}
@@ -0,0 +1,155 @@
+package micro
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type patchProfile struct {
+	Name  string   `json:"name" validate:"required,min=2"`
+	Email string   `json:"email,omitempty" validate:"omitempty,email"`
+	Phone string   `json:"phone,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+func patchRequest(body string) *http.Request {
+	return httptest.NewRequest(http.MethodPatch, "/profile", strings.NewReader(body))
+}
+
+// apiErrorCode returns the status of err as an APIError, or 0
+func apiErrorCode(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return 0
+}
+
+func currentProfile() patchProfile {
+	return patchProfile{Name: "Ada", Email: "ada@example.com", Phone: "+15550100", Tags: []string{"math"}}
+}
+
+func TestDecodeMergePatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		patch  string
+		want   patchProfile
+		status int
+	}{
+		{"replace field", `{"name":"Grace"}`, patchProfile{Name: "Grace", Email: "ada@example.com", Phone: "+15550100", Tags: []string{"math"}}, 0},
+		// Omitted fields are kept and null removes them
+		{"remove field", `{"phone":null}`, patchProfile{Name: "Ada", Email: "ada@example.com", Tags: []string{"math"}}, 0},
+		{"replace array", `{"tags":["code","navy"]}`, patchProfile{Name: "Ada", Email: "ada@example.com", Phone: "+15550100", Tags: []string{"code", "navy"}}, 0},
+		{"invalid result", `{"email":"not-an-email"}`, patchProfile{}, http.StatusUnprocessableEntity},
+		{"remove required", `{"name":null}`, patchProfile{}, http.StatusUnprocessableEntity},
+		{"malformed", `{"name":`, patchProfile{}, http.StatusBadRequest},
+		{"empty body", ``, patchProfile{}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			current := currentProfile()
+			var got patchProfile
+
+			err := app.DecodeMergePatch(patchRequest(tt.patch), &current, &got)
+			if tt.status != 0 {
+				if code := apiErrorCode(err); code != tt.status {
+					t.Fatalf("err = %v, want status %d", err, tt.status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeMergePatch: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("result = %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(current, currentProfile()) {
+				t.Errorf("current modified to %+v", current)
+			}
+		})
+	}
+}
+
+func TestDecodeMergePatchInPlace(t *testing.T) {
+	app := newTestApp(t)
+	profile := currentProfile()
+	if err := app.DecodeMergePatch(patchRequest(`{"phone":null,"name":"Grace"}`), &profile, &profile); err != nil {
+		t.Fatalf("DecodeMergePatch: %v", err)
+	}
+	if profile.Name != "Grace" || profile.Phone != "" || profile.Email != "ada@example.com" {
+		t.Errorf("profile = %+v", profile)
+	}
+}
+
+func TestDecodeJSONPatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		patch  string
+		want   patchProfile
+		status int
+	}{
+		{"add", `[{"op":"add","path":"/tags/-","value":"code"}]`, patchProfile{Name: "Ada", Email: "ada@example.com", Phone: "+15550100", Tags: []string{"math", "code"}}, 0},
+		{"remove", `[{"op":"remove","path":"/phone"}]`, patchProfile{Name: "Ada", Email: "ada@example.com", Tags: []string{"math"}}, 0},
+		{"replace", `[{"op":"replace","path":"/name","value":"Grace"}]`, patchProfile{Name: "Grace", Email: "ada@example.com", Phone: "+15550100", Tags: []string{"math"}}, 0},
+		{"test passes", `[{"op":"test","path":"/name","value":"Ada"},{"op":"remove","path":"/tags/0"}]`, patchProfile{Name: "Ada", Email: "ada@example.com", Phone: "+15550100", Tags: []string{}}, 0},
+		{"test fails", `[{"op":"test","path":"/name","value":"Bob"}]`, patchProfile{}, http.StatusUnprocessableEntity},
+		{"missing path", `[{"op":"remove","path":"/nickname"}]`, patchProfile{}, http.StatusUnprocessableEntity},
+		{"invalid result", `[{"op":"replace","path":"/name","value":"A"}]`, patchProfile{}, http.StatusUnprocessableEntity},
+		{"not a patch", `{"name":"Grace"}`, patchProfile{}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			doc := currentProfile()
+
+			err := app.DecodeJSONPatch(patchRequest(tt.patch), &doc)
+			if tt.status != 0 {
+				if code := apiErrorCode(err); code != tt.status {
+					t.Fatalf("err = %v, want status %d", err, tt.status)
+				}
+				// A rejected patch leaves the document untouched
+				if !reflect.DeepEqual(doc, currentProfile()) {
+					t.Errorf("doc modified to %+v", doc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeJSONPatch: %v", err)
+			}
+			if !reflect.DeepEqual(doc, tt.want) {
+				t.Errorf("doc = %+v, want %+v", doc, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodePatchRejectsOversizedBody(t *testing.T) {
+	app := newTestApp(t, func(c *Config) { c.MaxBodyBytes = 64 })
+	large := `{"name":"` + strings.Repeat("a", 100) + `"}`
+
+	current := currentProfile()
+	var merged patchProfile
+	if err := app.DecodeMergePatch(patchRequest(large), &current, &merged); apiErrorCode(err) != http.StatusRequestEntityTooLarge {
+		t.Errorf("DecodeMergePatch error = %v, want 413", err)
+	}
+
+	doc := currentProfile()
+	jsonPatch := `[{"op":"replace","path":"/name","value":"` + strings.Repeat("a", 100) + `"}]`
+	if err := app.DecodeJSONPatch(patchRequest(jsonPatch), &doc); apiErrorCode(err) != http.StatusRequestEntityTooLarge {
+		t.Errorf("DecodeJSONPatch error = %v, want 413", err)
+	}
+	if doc.Name != "Ada" {
+		t.Errorf("rejected patch changed the document: %+v", doc)
+	}
+
+	// A body at the limit is accepted
+	atLimit := `{"name":"` + strings.Repeat("a", 64-len(`{"name":""}`)) + `"}`
+	if err := app.DecodeMergePatch(patchRequest(atLimit), &current, &merged); err != nil {
+		t.Errorf("DecodeMergePatch at the limit: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package micro
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+)
+
+// handler returns the root handler served by the app. Unless StrictSlash is
+// set, paths are canonicalized before routing so /users/ and /users//
+// resolve to /users. The rewrite happens in place rather than through a
+// redirect, which clients commonly replay as GET and which drops POST bodies.
+// Path matching stays case-sensitive because path parameters may be.
+func (a *App) handler() http.Handler {
+	var h http.Handler = a.Router
+	if a.Config.APIVendor != "" {
+		h = a.negotiateVersion(h)
+	}
+	if !a.Config.StrictSlash {
+		h = normalizePath(h)
+	}
+	return h
+}
+
+// normalizePath cleans the escaped path, so an encoded slash such as %2F
+// inside a segment stays part of that segment, and keeps RawPath for routers
+// matching on the encoded path
+func normalizePath(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		escaped := r.URL.EscapedPath()
+		if canonical := canonicalPath(escaped); canonical != escaped {
+			unescaped, err := url.PathUnescape(canonical)
+			if err == nil {
+				r2 := r.Clone(r.Context())
+				r2.URL.Path = unescaped
+				r2.URL.RawPath = canonical
+				r = r2
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// canonicalPath cleans p and drops any trailing slash except for the root
+func canonicalPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	return path.Clean(p)
+}
+
+// routeLabel returns the matched route template for use as a metric label,
+// keeping series bounded regardless of path parameters or unknown paths
+func routeLabel(r *http.Request) string {
+	if pattern, _ := MatchedRoute(r); pattern != "" {
+		return pattern
+	}
+	return "unmatched"
+}
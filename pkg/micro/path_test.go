@@ -0,0 +1,100 @@
+package micro
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPathCanonicalization(t *testing.T) {
+	tests := []struct {
+		name   string
+		strict bool
+		method string
+		path   string
+		status int
+	}{
+		{"exact", false, http.MethodGet, "/users", http.StatusOK},
+		{"trailing slash", false, http.MethodGet, "/users/", http.StatusOK},
+		{"duplicate slashes", false, http.MethodGet, "/users//", http.StatusOK},
+		{"dot segments", false, http.MethodGet, "/admin/../users", http.StatusOK},
+		// Rewritten in place rather than redirected, so the body survives
+		{"trailing slash on POST", false, http.MethodPost, "/users/", http.StatusCreated},
+		{"case is preserved", false, http.MethodGet, "/Users", http.StatusNotFound},
+		{"strict trailing slash", true, http.MethodGet, "/users/", http.StatusNotFound},
+		{"strict exact", true, http.MethodGet, "/users", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, func(c *Config) { c.StrictSlash = tt.strict })
+			app.GET("/users", okHandler)
+			app.POST("/users", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				body, _ := io.ReadAll(r.Body)
+				if string(body) != `{"name":"ada"}` {
+					return NewAPIError(http.StatusBadRequest, "body lost")
+				}
+				w.WriteHeader(http.StatusCreated)
+				return nil
+			})
+
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"name":"ada"}`))
+			if w := serve(app.Handler(), r); w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestPathCanonicalizationKeepsEncodedSegments(t *testing.T) {
+	tests := []struct {
+		path string
+		want string // Raw {name} seen by the handler
+	}{
+		{"/files/a%2Fb", "a%2Fb"},
+		{"/files/a%2Fb/", "a%2Fb"},
+		{"/files//a%2Fb", "a%2Fb"},
+		{"/files/a%20b/", "a%20b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			app := newTestApp(t)
+			app.Router.UseEncodedPath()
+			var got string
+			app.GET("/files/{name}", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				got = app.URLParam(r, "name")
+				return nil
+			})
+
+			w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			if got != tt.want {
+				t.Errorf("name = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricsUseCanonicalRoute(t *testing.T) {
+	app := newTestApp(t)
+	app.GET("/users/{id}", okHandler)
+	h := app.Handler()
+	for _, p := range []string{"/users/1", "/users/2/", "/users//3", "/missing"} {
+		serve(h, httptest.NewRequest(http.MethodGet, p, nil))
+	}
+
+	metrics := scrape(t, app)
+	if !strings.Contains(metrics, `http_requests_total{method="GET",path="/users/{id}",status="200"} 3`) {
+		t.Errorf("requests were not labelled by route template:\n%s", metrics)
+	}
+	if !strings.Contains(metrics, `path="unmatched"`) {
+		t.Error("unknown paths were not labelled unmatched")
+	}
+	if strings.Contains(metrics, `path="/users/1"`) {
+		t.Error("raw paths leaked into labels")
+	}
+}
@@ -0,0 +1,73 @@
+package micro
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	ID       string
+	TenantID string
+	Roles    []string
+	Plan     string
+}
+
+// HasRole reports whether the principal has the given role
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// WithPrincipal returns a copy of ctx carrying the principal
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKeyPrincipal, p)
+}
+
+// PrincipalFromContext returns the authenticated principal, if any
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(contextKeyPrincipal).(*Principal)
+	return p, ok && p != nil
+}
+
+// WithTenant returns a copy of ctx scoped to the tenant
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, contextKeyTenant, tenantID)
+}
+
+// TenantFromContext returns the tenant the request is scoped to, if any
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(contextKeyTenant).(string)
+	return tenantID, ok
+}
+
+// Authenticator resolves the principal of a request, e.g. by verifying a
+// bearer token
+type Authenticator func(r *http.Request) (*Principal, error)
+
+// AuthMiddleware authenticates requests and stores the principal and its
+// tenant in the context for handlers and services. Requests that fail
+// authentication are rejected with 401.
+func (a *App) AuthMiddleware(authenticate Authenticator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := authenticate(r)
+			if err != nil || principal == nil {
+				a.handleError(w, r, NewAPIError(http.StatusUnauthorized, "unauthorized"))
+				return
+			}
+
+			ctx := WithPrincipal(r.Context(), principal)
+			if principal.TenantID != "" {
+				ctx = WithTenant(ctx, principal.TenantID)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
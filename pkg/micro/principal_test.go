@@ -0,0 +1,91 @@
+package micro
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPrincipalContext(t *testing.T) {
+	ctx := context.Background()
+	if _, ok := PrincipalFromContext(ctx); ok {
+		t.Fatal("empty context has a principal")
+	}
+	if _, ok := PrincipalFromContext(WithPrincipal(ctx, nil)); ok {
+		t.Error("nil principal reported as present")
+	}
+
+	p := &Principal{ID: "42", Roles: []string{"admin"}}
+	got, ok := PrincipalFromContext(WithPrincipal(ctx, p))
+	if !ok || got != p {
+		t.Fatalf("PrincipalFromContext = %v, %v, want %v", got, ok, p)
+	}
+	if !got.HasRole("admin") || got.HasRole("billing") {
+		t.Errorf("HasRole mismatch for roles %v", got.Roles)
+	}
+}
+
+func TestTenantContext(t *testing.T) {
+	if _, ok := TenantFromContext(context.Background()); ok {
+		t.Fatal("empty context has a tenant")
+	}
+	if got, ok := TenantFromContext(WithTenant(context.Background(), "acme")); !ok || got != "acme" {
+		t.Errorf("TenantFromContext = %q, %v, want acme", got, ok)
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	app := newTestApp(t)
+	auth := app.AuthMiddleware(func(r *http.Request) (*Principal, error) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer ada":
+			return &Principal{ID: "1", TenantID: "acme"}, nil
+		case "Bearer root":
+			return &Principal{ID: "2"}, nil
+		}
+		return nil, errors.New("invalid token")
+	})
+
+	var principal *Principal
+	var tenant string
+	h := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = PrincipalFromContext(r.Context())
+		tenant, _ = TenantFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name       string
+		token      string
+		status     int
+		wantID     string
+		wantTenant string
+	}{
+		{"tenant user", "Bearer ada", http.StatusOK, "1", "acme"},
+		{"user without tenant", "Bearer root", http.StatusOK, "2", ""},
+		{"invalid token", "Bearer eve", http.StatusUnauthorized, "", ""},
+		{"anonymous", "", http.StatusUnauthorized, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, tenant = nil, ""
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Authorization", tt.token)
+			w := serve(h, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				if principal != nil {
+					t.Error("handler ran for a rejected request")
+				}
+				return
+			}
+			if principal == nil || principal.ID != tt.wantID || tenant != tt.wantTenant {
+				t.Errorf("principal = %+v, tenant = %q, want %s in %q", principal, tenant, tt.wantID, tt.wantTenant)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package micro
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+// Config.Env profiles
+const (
+	EnvDevelopment = "development"
+	EnvStaging     = "staging"
+	EnvProduction  = "production"
+)
+
+// Default is a default of the setting read from the environment variable
+// Env, applied by LoadConfig unless the variable is set
+type Default struct {
+	Env   string
+	Apply func(*Config)
+}
+
+// profiles holds the defaults of each Config.Env
+var profiles = map[string][]Default{
+	// Console logs, verbose errors and relaxed CORS. Browsers refuse
+	// credentials for any origin, so they are off unless configured.
+	EnvDevelopment: {
+		{"LOG_LEVEL", func(c *Config) { c.LogLevel = "debug" }},
+		{"EXPOSE_ERROR_DETAILS", func(c *Config) { c.ExposeErrorDetails = boolPtr(true) }},
+		{"CORS_ALLOWED_ORIGINS", func(c *Config) { c.CORS.AllowedOrigins = []string{"*"} }},
+		{"CORS_ALLOW_CREDENTIALS", func(c *Config) { c.CORS.AllowCredentials = false }},
+		{"ROUTES_ENDPOINT_ENABLED", func(c *Config) { c.RoutesEndpoint = true }},
+	},
+	EnvStaging: {
+		{"LOG_LEVEL", func(c *Config) { c.LogLevel = "info" }},
+		{"EXPOSE_ERROR_DETAILS", func(c *Config) { c.ExposeErrorDetails = boolPtr(false) }},
+		{"ROUTES_ENDPOINT_ENABLED", func(c *Config) { c.RoutesEndpoint = true }},
+	},
+	// JSON logs, no error details, and CORS only for configured origins
+	EnvProduction: {
+		{"LOG_LEVEL", func(c *Config) { c.LogLevel = "info" }},
+		{"EXPOSE_ERROR_DETAILS", func(c *Config) { c.ExposeErrorDetails = boolPtr(false) }},
+		{"ROUTES_ENDPOINT_ENABLED", func(c *Config) { c.RoutesEndpoint = false }},
+		{"CORS_ENABLED", func(c *Config) {
+			_, hasOrigins := c.LookupEnv("CORS_ALLOWED_ORIGINS")
+			c.CORS.Enabled = hasOrigins
+		}},
+	},
+}
+
+// LoadConfig loads the config from environment variables, layered over the
+// defaults of the profile named by APP_ENV. Precedence, lowest first: field
+// defaults, the service defaults passed in, profile defaults, the file named
+// by CONFIG_FILE, environment variables, then whatever the caller changes on
+// the returned config. The process environment is never modified.
+func LoadConfig(defaults ...Default) (*Config, error) {
+	fileEnv, err := readConfigFile(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{fileEnv: fileEnv}
+	if err := envconfig.Process("", config); err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := config.applyConfigFile(); err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	applyDefaults(config, defaults)
+	if err := config.applyProfile(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// LookupEnv looks key up in the environment, then in the file named by
+// CONFIG_FILE. Services use it for settings they read themselves, such as
+// secrets, so the file works for them too.
+func (c *Config) LookupEnv(key string) (string, bool) {
+	if value, ok := os.LookupEnv(key); ok {
+		return value, true
+	}
+	value, ok := c.fileEnv[key]
+	return value, ok
+}
+
+// readConfigFile reads the KEY=VALUE lines of a dotenv file. Blank lines and
+// lines starting with # are skipped, and values may be quoted.
+func readConfigFile(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CONFIG_FILE: %w", err)
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(text, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("CONFIG_FILE %s:%d: want KEY=VALUE, got %q", path, line, text)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read CONFIG_FILE: %w", err)
+	}
+	return values, nil
+}
+
+// applyConfigFile sets the fields whose variables are in CONFIG_FILE but not
+// in the environment. Variables that are not config fields are left for
+// LookupEnv.
+func (c *Config) applyConfigFile() error {
+	for _, key := range slices.Sorted(maps.Keys(c.fileEnv)) {
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		if field, ok := configField(reflect.ValueOf(c).Elem(), "", key); ok {
+			if err := setConfigField(field, key, c.fileEnv[key]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// configField finds the field envconfig fills from the variable key: one
+// whose envconfig tag, or prefixed name, matches, including in nested
+// structs
+func configField(v reflect.Value, prefix, key string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() || sf.Tag.Get("ignored") == "true" {
+			continue
+		}
+		name := sf.Tag.Get("envconfig")
+		if name == "" {
+			name = sf.Name
+		}
+		full := strings.ToUpper(name)
+		if prefix != "" {
+			full = prefix + "_" + full
+		}
+
+		if sf.Type.Kind() == reflect.Struct {
+			innerPrefix := prefix
+			if !sf.Anonymous {
+				innerPrefix = full
+			}
+			if field, ok := configField(v.Field(i), innerPrefix, key); ok {
+				return field, true
+			}
+			continue
+		}
+		if key == full || key == strings.ToUpper(sf.Tag.Get("envconfig")) {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// setConfigField parses value into field with envconfig, so values in the
+// file are read exactly like environment variables: the value becomes the
+// default of a one-field struct, which envconfig then processes. key is
+// known to be unset in the environment.
+func setConfigField(field reflect.Value, key, value string) error {
+	holder := reflect.New(reflect.StructOf([]reflect.StructField{{
+		Name: "Value",
+		Type: field.Type(),
+		Tag:  reflect.StructTag(fmt.Sprintf("envconfig:%q default:%q", key, value)),
+	}}))
+	if err := envconfig.Process("", holder.Interface()); err != nil {
+		return err
+	}
+	field.Set(holder.Elem().Field(0))
+	return nil
+}
+
+// applyDefaults applies the defaults whose variables are not set in the
+// environment or CONFIG_FILE
+func applyDefaults(c *Config, defaults []Default) {
+	for _, d := range defaults {
+		if _, set := c.LookupEnv(d.Env); !set {
+			d.Apply(c)
+		}
+	}
+}
+
+// applyProfile sets the profile defaults whose variables are not set
+func (c *Config) applyProfile() error {
+	if c.Env == "" {
+		return nil
+	}
+	settings, ok := profiles[c.Env]
+	if !ok {
+		return fmt.Errorf("unknown APP_ENV %q: must be %s, %s or %s", c.Env, EnvDevelopment, EnvStaging, EnvProduction)
+	}
+	applyDefaults(c, settings)
+	return nil
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
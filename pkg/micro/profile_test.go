@@ -0,0 +1,210 @@
+package micro
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// unsetEnv clears variables for the test, restoring them afterwards
+func unsetEnv(t *testing.T, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
+
+// loadProfileConfig loads the config with only DB_DSN and the given
+// variables set
+func loadProfileConfig(t *testing.T, env map[string]string, defaults ...Default) *Config {
+	t.Helper()
+	unsetEnv(t, "APP_ENV", "CONFIG_FILE", "LOG_LEVEL", "EXPOSE_ERROR_DETAILS", "CORS_ENABLED",
+		"CORS_ALLOWED_ORIGINS", "CORS_ALLOW_CREDENTIALS", "ROUTES_ENDPOINT_ENABLED", "APP_NAME")
+	t.Setenv("DB_DSN", "postgres://localhost/test")
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+	cfg, err := LoadConfig(defaults...)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	return cfg
+}
+
+func TestProfileSettings(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           map[string]string
+		logLevel      string
+		exposeDetails *bool
+		routes        bool
+		corsEnabled   bool
+		origins       []string
+	}{
+		{"no profile", nil, "info", nil, false, true, []string{"*"}},
+		{"development", map[string]string{"APP_ENV": EnvDevelopment}, "debug", boolPtr(true), true, true, []string{"*"}},
+		{"staging", map[string]string{"APP_ENV": EnvStaging}, "info", boolPtr(false), true, true, []string{"*"}},
+		{"production without origins", map[string]string{"APP_ENV": EnvProduction}, "info", boolPtr(false), false, false, []string{"*"}},
+		{"production with origins", map[string]string{
+			"APP_ENV":              EnvProduction,
+			"CORS_ALLOWED_ORIGINS": "https://app.example.com",
+		}, "info", boolPtr(false), false, true, []string{"https://app.example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadProfileConfig(t, tt.env)
+			if cfg.LogLevel != tt.logLevel {
+				t.Errorf("LogLevel = %q, want %q", cfg.LogLevel, tt.logLevel)
+			}
+			if (cfg.ExposeErrorDetails == nil) != (tt.exposeDetails == nil) ||
+				(cfg.ExposeErrorDetails != nil && *cfg.ExposeErrorDetails != *tt.exposeDetails) {
+				t.Errorf("ExposeErrorDetails = %v, want %v", cfg.ExposeErrorDetails, tt.exposeDetails)
+			}
+			if cfg.RoutesEndpoint != tt.routes {
+				t.Errorf("RoutesEndpoint = %v, want %v", cfg.RoutesEndpoint, tt.routes)
+			}
+			if cfg.CORS.Enabled != tt.corsEnabled {
+				t.Errorf("CORS.Enabled = %v, want %v", cfg.CORS.Enabled, tt.corsEnabled)
+			}
+			if !slices.Equal(cfg.CORS.AllowedOrigins, tt.origins) {
+				t.Errorf("CORS.AllowedOrigins = %v, want %v", cfg.CORS.AllowedOrigins, tt.origins)
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Errorf("profile config fails Validate: %v", err)
+			}
+		})
+	}
+}
+
+func TestUnknownProfile(t *testing.T) {
+	unsetEnv(t, "CONFIG_FILE")
+	t.Setenv("DB_DSN", "postgres://localhost/test")
+	t.Setenv("APP_ENV", "qa")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig accepted an unknown APP_ENV")
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.env")
+	content := "# Deployment settings\nAPP_ENV=development\nLOG_LEVEL=warn\nAPP_NAME=\"from-file\"\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	serviceDefaults := []Default{
+		{"APP_NAME", func(c *Config) { c.AppName = "from-service" }},
+		{"CORS_ALLOWED_ORIGINS", func(c *Config) { c.CORS.AllowedOrigins = []string{"https://service.example.com"} }},
+		{"CORS_MAX_AGE", func(c *Config) { c.CORS.MaxAge = 600 }},
+	}
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		appName  string
+		logLevel string
+	}{
+		// The file beats the profile's debug level and the service default
+		{"file", map[string]string{"CONFIG_FILE": file}, "from-file", "warn"},
+		{"environment", map[string]string{"CONFIG_FILE": file, "LOG_LEVEL": "error", "APP_NAME": "from-env"}, "from-env", "error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unsetEnv(t, "CORS_MAX_AGE")
+			cfg := loadProfileConfig(t, tt.env, serviceDefaults...)
+			if cfg.AppName != tt.appName {
+				t.Errorf("AppName = %q, want %q", cfg.AppName, tt.appName)
+			}
+			if cfg.LogLevel != tt.logLevel {
+				t.Errorf("LogLevel = %q, want %q", cfg.LogLevel, tt.logLevel)
+			}
+			// The development profile from the file overrides the service
+			// default, which still applies where no layer above sets a value
+			if !slices.Equal(cfg.CORS.AllowedOrigins, []string{"*"}) {
+				t.Errorf("CORS.AllowedOrigins = %v, want the profile's *", cfg.CORS.AllowedOrigins)
+			}
+			if cfg.CORS.MaxAge != 600 {
+				t.Errorf("CORS.MaxAge = %d, want the service default 600", cfg.CORS.MaxAge)
+			}
+		})
+	}
+}
+
+func TestConfigFileLeavesEnvironmentUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.env")
+	second := filepath.Join(dir, "second.env")
+	content := "DB_DSN=postgres://file/app\nLOG_LEVEL=warn\nRATE_LIMITER_BURST=7\n" +
+		"CORS_ALLOWED_ORIGINS=https://a.example.com,https://b.example.com\nSESSION_KEY='s3cret'\n"
+	if err := os.WriteFile(first, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte("DB_DSN=postgres://file/other\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	unsetEnv(t, "DB_DSN", "LOG_LEVEL", "RATE_LIMITER_BURST", "CORS_ALLOWED_ORIGINS", "SESSION_KEY", "APP_ENV")
+
+	t.Setenv("CONFIG_FILE", first)
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	// Values are parsed like environment variables
+	if cfg.DBDSN != "postgres://file/app" || cfg.LogLevel != "warn" || cfg.RateLimiter.Burst != 7 {
+		t.Errorf("config = %q, %q, %d, want the file's values", cfg.DBDSN, cfg.LogLevel, cfg.RateLimiter.Burst)
+	}
+	if want := []string{"https://a.example.com", "https://b.example.com"}; !slices.Equal(cfg.CORS.AllowedOrigins, want) {
+		t.Errorf("CORS.AllowedOrigins = %v, want %v", cfg.CORS.AllowedOrigins, want)
+	}
+	// Variables the service reads itself are available through LookupEnv
+	if v, ok := cfg.LookupEnv("SESSION_KEY"); v != "s3cret" || !ok {
+		t.Errorf("LookupEnv(SESSION_KEY) = %q, %v", v, ok)
+	}
+	for _, key := range []string{"DB_DSN", "LOG_LEVEL", "SESSION_KEY"} {
+		if v, set := os.LookupEnv(key); set {
+			t.Errorf("%s was exported to the environment as %q", key, v)
+		}
+	}
+
+	// Nothing carries over to the next load
+	t.Setenv("CONFIG_FILE", second)
+	cfg, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.DBDSN != "postgres://file/other" || cfg.LogLevel != "info" || cfg.RateLimiter.Burst != 50 {
+		t.Errorf("second config = %q, %q, %d, want only the second file's values", cfg.DBDSN, cfg.LogLevel, cfg.RateLimiter.Burst)
+	}
+	if _, ok := cfg.LookupEnv("SESSION_KEY"); ok {
+		t.Error("SESSION_KEY of the first file is still visible")
+	}
+}
+
+func TestConfigFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	malformed := filepath.Join(dir, "bad.env")
+	if err := os.WriteFile(malformed, []byte("LOG_LEVEL=info\nnot a setting\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	badValue := filepath.Join(dir, "value.env")
+	if err := os.WriteFile(badValue, []byte("RATE_LIMITER_BURST=many\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, path := range map[string]string{
+		"missing file":   filepath.Join(dir, "missing.env"),
+		"malformed line": malformed,
+		"invalid value":  badValue,
+	} {
+		t.Run(name, func(t *testing.T) {
+			unsetEnv(t, "LOG_LEVEL", "RATE_LIMITER_BURST")
+			t.Setenv("DB_DSN", "postgres://localhost/test")
+			t.Setenv("CONFIG_FILE", path)
+			if _, err := LoadConfig(); err == nil {
+				t.Error("LoadConfig succeeded, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package micro
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// queryCache holds the parsed query string of a request
+type queryCache struct {
+	mu     sync.Mutex
+	raw    string
+	values url.Values
+}
+
+// queryMiddleware rejects query strings longer than Config.MaxQueryBytes
+// with 414 and lets the query helpers parse the query once per request
+func (a *App) queryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limit := a.Config.MaxQueryBytes; limit > 0 && len(r.URL.RawQuery) > limit {
+			a.handleError(w, r, NewAPIError(http.StatusRequestURITooLong, "query string too long", map[string]string{
+				"max_bytes": strconv.Itoa(limit),
+			}))
+			return
+		}
+		ctx := context.WithValue(r.Context(), contextKeyQuery, &queryCache{})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// queryValues returns the parsed query of r, reusing the result of earlier
+// calls for the same request. It is reparsed if the query was rewritten.
+func queryValues(r *http.Request) url.Values {
+	cache, ok := r.Context().Value(contextKeyQuery).(*queryCache)
+	if !ok {
+		return r.URL.Query()
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.values == nil || cache.raw != r.URL.RawQuery {
+		cache.raw = r.URL.RawQuery
+		cache.values = r.URL.Query()
+	}
+	return cache.values
+}
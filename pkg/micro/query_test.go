@@ -0,0 +1,75 @@
+package micro
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMaxQueryBytes(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int
+		query  string
+		status int
+	}{
+		{"short query", 16, "q=go", http.StatusOK},
+		{"at the limit", 16, "q=" + strings.Repeat("a", 14), http.StatusOK},
+		{"over the limit", 16, "q=" + strings.Repeat("a", 15), http.StatusRequestURITooLong},
+		{"no limit", 0, "q=" + strings.Repeat("a", 64<<10), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, func(c *Config) {
+				c.MaxQueryBytes = tt.limit
+				c.ExposeErrorDetails = boolPtr(true)
+			})
+			app.GET("/search", okHandler)
+
+			w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/search?"+tt.query, nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status != http.StatusRequestURITooLong {
+				return
+			}
+			body := decodeBody(t, w)
+			if details, _ := body["details"].(map[string]interface{}); details["max_bytes"] != "16" {
+				t.Errorf("body = %v, want max_bytes 16 in details", body)
+			}
+		})
+	}
+}
+
+func TestQueryValues(t *testing.T) {
+	app := newTestApp(t)
+	var first, second, rewritten map[string][]string
+	app.GET("/search", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		first = queryValues(r)
+		second = queryValues(r)
+		r.URL.RawQuery = "q=rust"
+		rewritten = queryValues(r)
+		return okHandler(ctx, w, r)
+	})
+	serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/search?q=go&page=2", nil))
+
+	if want := map[string][]string{"q": {"go"}, "page": {"2"}}; !reflect.DeepEqual(first, want) {
+		t.Errorf("values = %v, want %v", first, want)
+	}
+	// The query is parsed once per request
+	if reflect.ValueOf(first).Pointer() != reflect.ValueOf(second).Pointer() {
+		t.Error("second call parsed the query again")
+	}
+	if rewritten["q"][0] != "rust" {
+		t.Errorf("values after rewriting the query = %v", rewritten)
+	}
+
+	// Outside the middleware the query is parsed on every call
+	r := httptest.NewRequest(http.MethodGet, "/search?q=go", nil)
+	if got := queryValues(r).Get("q"); got != "go" {
+		t.Errorf("q outside the middleware = %q, want go", got)
+	}
+}
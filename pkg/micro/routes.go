@@ -0,0 +1,165 @@
+package micro
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Route is a registered route that can be annotated after registration
+type Route struct {
+	app   *App
+	route *mux.Route
+}
+
+// RouteOption configures a route at registration
+type RouteOption func(*Route)
+
+// routeConfig holds per-route settings read by the app middleware
+type routeConfig struct {
+	timeout   time.Duration
+	cors      *CORSConfig
+	streaming bool
+}
+
+// WithTimeout replaces Config.HandlerTimeout for the route. Longer timeouts
+// also extend the server write deadline so the response can be sent.
+func WithTimeout(d time.Duration) RouteOption {
+	return func(rt *Route) {
+		rt.config().timeout = d
+	}
+}
+
+// Streaming lifts the server write deadline (WRITE_TIMEOUT) for the route,
+// for SSE and other long-lived responses it would otherwise cut off. The
+// handler context stays bounded by HANDLER_TIMEOUT or WithTimeout, so pair
+// it with WithTimeout for streams longer than that.
+func Streaming() RouteOption {
+	return func(rt *Route) {
+		rt.config().streaming = true
+	}
+}
+
+func (rt *Route) config() *routeConfig {
+	cfg, ok := rt.app.routeConfigs[rt.route]
+	if !ok {
+		cfg = &routeConfig{}
+		rt.app.routeConfigs[rt.route] = cfg
+	}
+	return cfg
+}
+
+func (rt *Route) apply(opts []RouteOption) *Route {
+	for _, opt := range opts {
+		opt(rt)
+	}
+	return rt
+}
+
+// routeConfigFor returns the settings of the matched route, or nil
+func (a *App) routeConfigFor(r *http.Request) *routeConfig {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return nil
+	}
+	return a.routeConfigs[route]
+}
+
+// MatchedRoute returns the path template, e.g. "/users/{id}", and name of
+// the route that matched r. Both are empty for unmatched requests.
+func MatchedRoute(r *http.Request) (pattern, name string) {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "", ""
+	}
+	pattern, _ = route.GetPathTemplate()
+	return pattern, route.GetName()
+}
+
+// Name sets the route name reported by Routes
+func (rt *Route) Name(name string) *Route {
+	rt.route.Name(name)
+	return rt
+}
+
+// Use wraps the route handler with middleware that applies to this route
+// only, inside the app and group middleware. The first middleware is the
+// outermost.
+func (rt *Route) Use(middleware ...mux.MiddlewareFunc) *Route {
+	h := rt.route.GetHandler()
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	rt.route.Handler(h)
+	return rt
+}
+
+// WithDoc attaches OpenAPI metadata to the route. request and response are
+// zero values (or pointers) of the DTOs used by the handler; either may be nil.
+// An optional status overrides the documented success status (default 200).
+func (rt *Route) WithDoc(summary string, request, response interface{}, status ...int) *Route {
+	doc := &RouteDoc{
+		Summary:  summary,
+		Request:  request,
+		Response: response,
+		Status:   http.StatusOK,
+	}
+	if len(status) > 0 {
+		doc.Status = status[0]
+	}
+	rt.app.docs[rt.route] = doc
+	return rt
+}
+
+// RouteInfo describes a registered route
+type RouteInfo struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Name   string `json:"name,omitempty"`
+}
+
+// Routes returns all registered routes sorted by path and method
+func (a *App) Routes() []RouteInfo {
+	var routes []RouteInfo
+
+	a.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		// Group prefixes have no handler of their own
+		if route.GetHandler() == nil {
+			return nil
+		}
+
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{"ANY"}
+		}
+
+		for _, method := range methods {
+			routes = append(routes, RouteInfo{
+				Method: method,
+				Path:   path,
+				Name:   route.GetName(),
+			})
+		}
+		return nil
+	})
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	return routes
+}
+
+func (a *App) routesHandler(w http.ResponseWriter, r *http.Request) {
+	a.JSON(w, http.StatusOK, a.Routes())
+}
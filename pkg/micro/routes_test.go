@@ -0,0 +1,179 @@
+package micro
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRoutes(t *testing.T) {
+	app := newTestApp(t)
+	app.GET("/users/{id}", okHandler).Name("get-user")
+	app.POST("/users", okHandler)
+	app.Group("/v1").GET("/welcome", okHandler)
+
+	routes := app.Routes()
+	want := []RouteInfo{
+		{Method: http.MethodPost, Path: "/users"},
+		{Method: http.MethodGet, Path: "/users/{id}", Name: "get-user"},
+		{Method: http.MethodGet, Path: "/v1/welcome"},
+	}
+	for _, w := range want {
+		if !containsRoute(routes, w) {
+			t.Errorf("Routes() = %v, missing %v", routes, w)
+		}
+	}
+
+	for i := 1; i < len(routes); i++ {
+		prev, cur := routes[i-1], routes[i]
+		if prev.Path > cur.Path || (prev.Path == cur.Path && prev.Method > cur.Method) {
+			t.Fatalf("routes not sorted: %v before %v", prev, cur)
+		}
+	}
+}
+
+func TestRoutesEndpoint(t *testing.T) {
+	t.Run("disabled by default", func(t *testing.T) {
+		app := newTestApp(t)
+		w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/_routes", nil))
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		app := newTestApp(t, func(c *Config) { c.RoutesEndpoint = true })
+		app.GET("/users", okHandler)
+
+		w := serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/_routes", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+		var routes []RouteInfo
+		if err := json.Unmarshal(w.Body.Bytes(), &routes); err != nil {
+			t.Fatal(err)
+		}
+		if !containsRoute(routes, RouteInfo{Method: http.MethodGet, Path: "/users"}) {
+			t.Errorf("routes = %v, missing GET /users", routes)
+		}
+	})
+}
+
+func containsRoute(routes []RouteInfo, want RouteInfo) bool {
+	for _, r := range routes {
+		if r == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMatchedRoute(t *testing.T) {
+	app := newTestApp(t)
+	var pattern, name string
+	capture := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		pattern, name = MatchedRoute(r)
+		return okHandler(ctx, w, r)
+	}
+	app.GET("/users/{id}", capture).Name("get-user")
+	app.Group("/v1").GET("/orders/{id:[0-9]+}", capture)
+	h := app.Handler()
+
+	tests := []struct {
+		path        string
+		wantPattern string
+		wantName    string
+	}{
+		{"/users/42", "/users/{id}", "get-user"},
+		{"/v1/orders/7", "/v1/orders/{id:[0-9]+}", ""},
+	}
+	for _, tt := range tests {
+		pattern, name = "", ""
+		serve(h, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if pattern != tt.wantPattern || name != tt.wantName {
+			t.Errorf("MatchedRoute for %s = %q, %q, want %q, %q", tt.path, pattern, name, tt.wantPattern, tt.wantName)
+		}
+	}
+
+	// Requests that never went through the router match nothing
+	if p, n := MatchedRoute(httptest.NewRequest(http.MethodGet, "/users/42", nil)); p != "" || n != "" {
+		t.Errorf("MatchedRoute outside the router = %q, %q", p, n)
+	}
+}
+
+func TestMatchRoutes(t *testing.T) {
+	app := newTestApp(t)
+	app.Match([]string{http.MethodGet, http.MethodPost}, "/search", okHandler)
+	app.Any("/proxy", okHandler)
+	app.Group("/v1").Match([]string{http.MethodPut}, "/items", okHandler).Any("/proxy", okHandler)
+	h := app.Handler()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		allow  string
+	}{
+		{"match GET", http.MethodGet, "/search", http.StatusOK, ""},
+		{"match POST", http.MethodPost, "/search", http.StatusOK, ""},
+		{"match other method", http.MethodDelete, "/search", http.StatusMethodNotAllowed, "GET, POST, HEAD, OPTIONS"},
+		{"any PATCH", http.MethodPatch, "/proxy", http.StatusOK, ""},
+		{"any DELETE", http.MethodDelete, "/proxy", http.StatusOK, ""},
+		// OPTIONS stays with the app so it lists the methods
+		{"any OPTIONS", http.MethodOptions, "/proxy", http.StatusNoContent, "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS"},
+		{"group match", http.MethodPut, "/v1/items", http.StatusOK, ""},
+		{"group match other method", http.MethodGet, "/v1/items", http.StatusMethodNotAllowed, "PUT, OPTIONS"},
+		{"group any", http.MethodPost, "/v1/proxy", http.StatusOK, ""},
+		{"group options", http.MethodOptions, "/v1/items", http.StatusNoContent, "PUT, OPTIONS"},
+		{"unknown path", http.MethodGet, "/v1/missing", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(h, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("Allow"); got != tt.allow {
+				t.Errorf("Allow = %q, want %q", got, tt.allow)
+			}
+		})
+	}
+}
+
+func TestMatchPaths(t *testing.T) {
+	app := newTestApp(t)
+	routes := app.MatchPaths([]string{http.MethodGet, http.MethodDelete},
+		[]string{"/users/{id}", "/members/{id}"}, okHandler, NoStore())
+	if len(routes) != 2 {
+		t.Fatalf("MatchPaths returned %d routes, want 2", len(routes))
+	}
+	h := app.Handler()
+
+	for _, path := range []string{"/users/7", "/members/7"} {
+		for _, method := range []string{http.MethodGet, http.MethodDelete} {
+			w := serve(h, httptest.NewRequest(method, path, nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("%s %s status = %d, want %d", method, path, w.Code, http.StatusOK)
+			}
+			// Options apply to every path
+			if got := w.Header().Get("Cache-Control"); got != "no-store" {
+				t.Errorf("%s %s Cache-Control = %q, want no-store", method, path, got)
+			}
+		}
+		if w := serve(h, httptest.NewRequest(http.MethodPost, path, nil)); w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("POST %s status = %d, want %d", path, w.Code, http.StatusMethodNotAllowed)
+		}
+	}
+
+	listed := app.Routes()
+	for _, path := range []string{"/users/{id}", "/members/{id}"} {
+		for _, method := range []string{http.MethodGet, http.MethodDelete} {
+			if !containsRoute(listed, RouteInfo{Method: method, Path: path}) {
+				t.Errorf("Routes() = %v, missing %s %s", listed, method, path)
+			}
+		}
+	}
+}
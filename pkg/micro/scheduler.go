@@ -0,0 +1,196 @@
+package micro
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+)
+
+// Clock abstracts time so schedules can be driven deterministically in tests
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Job is a unit of scheduled work
+type Job func(ctx context.Context) error
+
+// JobOption configures a scheduled job
+type JobOption func(*scheduledJob)
+
+// WithJobName sets the name used in logs and metrics (defaults to the spec)
+func WithJobName(name string) JobOption {
+	return func(j *scheduledJob) {
+		j.name = name
+	}
+}
+
+// AllowOverlap lets a job start even if its previous run is still in
+// progress. By default overlapping runs are skipped.
+func AllowOverlap() JobOption {
+	return func(j *scheduledJob) {
+		j.allowOverlap = true
+	}
+}
+
+type scheduledJob struct {
+	name         string
+	schedule     cron.Schedule
+	job          Job
+	allowOverlap bool
+	running      atomic.Bool
+}
+
+// Scheduler runs jobs on cron schedules. It implements Worker so it shares
+// the app lifecycle.
+type Scheduler struct {
+	logger  Logger
+	clock   Clock
+	jobs    []*scheduledJob
+	wg      sync.WaitGroup
+	metrics *metrics // Set when owned by an App
+}
+
+// NewScheduler creates a scheduler. A nil clock uses the system clock.
+func NewScheduler(logger Logger, clock Clock) *Scheduler {
+	if clock == nil {
+		clock = realClock{}
+	}
+	return &Scheduler{
+		logger: logger.With(zap.String("component", "scheduler")),
+		clock:  clock,
+	}
+}
+
+// Add registers a job using standard five-field cron syntax or descriptors
+// such as "@every 1m" and "@hourly"
+func (s *Scheduler) Add(spec string, job Job, opts ...JobOption) error {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return fmt.Errorf("invalid schedule %q: %w", spec, err)
+	}
+
+	j := &scheduledJob{
+		name:     spec,
+		schedule: schedule,
+		job:      job,
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+
+	s.jobs = append(s.jobs, j)
+	return nil
+}
+
+// Start runs all jobs until ctx is cancelled
+func (s *Scheduler) Start(ctx context.Context) {
+	var loops sync.WaitGroup
+	for _, j := range s.jobs {
+		loops.Add(1)
+		go func(j *scheduledJob) {
+			defer loops.Done()
+			s.loop(ctx, j)
+		}(j)
+	}
+	loops.Wait()
+}
+
+// Stop waits for in-flight job runs to finish or for ctx to expire
+func (s *Scheduler) Stop(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("scheduler stop: %w", ctx.Err())
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, j *scheduledJob) {
+	for {
+		now := s.clock.Now()
+		next := j.schedule.Next(now)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.clock.After(next.Sub(now)):
+		}
+
+		if !j.allowOverlap && !j.running.CompareAndSwap(false, true) {
+			s.logger.Warn("skipping job run, previous run still in progress", zap.String("job", j.name))
+			s.recordRun(j, "skipped", 0)
+			continue
+		}
+
+		s.wg.Add(1)
+		go s.execute(ctx, j)
+	}
+}
+
+func (s *Scheduler) execute(ctx context.Context, j *scheduledJob) {
+	defer s.wg.Done()
+	if !j.allowOverlap {
+		defer j.running.Store(false)
+	}
+
+	runID := xid.New().String()
+	ctx = context.WithValue(ctx, contextKeyRequestID, runID)
+	logger := s.logger.With(zap.String("job", j.name), zap.String("run_id", runID))
+	start := s.clock.Now()
+
+	status := "success"
+	defer func() {
+		if err := recover(); err != nil {
+			status = "panic"
+			logger.Error("job panicked", zap.Any("error", err))
+		}
+		s.recordRun(j, status, s.clock.Now().Sub(start))
+	}()
+
+	logger.Debug("job started")
+	if err := j.job(ctx); err != nil {
+		status = "error"
+		logger.Error("job failed", zap.Error(err))
+		return
+	}
+	logger.Debug("job completed", zap.Duration("duration", s.clock.Now().Sub(start)))
+}
+
+func (s *Scheduler) recordRun(j *scheduledJob, status string, duration time.Duration) {
+	if s.metrics == nil {
+		return
+	}
+	s.metrics.jobRunsTotal.WithLabelValues(j.name, status).Inc()
+	if status != "skipped" {
+		s.metrics.jobDuration.WithLabelValues(j.name).Observe(duration.Seconds())
+	}
+}
+
+// Schedule registers a periodic job on the app scheduler, which starts and
+// stops with the app
+func (a *App) Schedule(spec string, job Job, opts ...JobOption) error {
+	if a.scheduler == nil {
+		a.scheduler = NewScheduler(a.Logger, nil)
+		a.scheduler.metrics = a.metrics
+		a.RegisterWorker(a.scheduler)
+	}
+	return a.scheduler.Add(spec, job, opts...)
+}
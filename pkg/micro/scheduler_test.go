@@ -0,0 +1,225 @@
+package micro
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeClock hands each timer to the test, which fires it with tick
+type fakeClock struct {
+	now    time.Time
+	timers chan chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		timers: make(chan chan time.Time, 16),
+	}
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	timer := make(chan time.Time, 1)
+	c.timers <- timer
+	return timer
+}
+
+// tick fires the next timer a job loop is waiting on
+func (c *fakeClock) tick(t *testing.T) {
+	t.Helper()
+	select {
+	case timer := <-c.timers:
+		timer <- c.now
+	case <-time.After(5 * time.Second):
+		t.Fatal("no job is waiting on the clock")
+	}
+}
+
+// waitIdle waits until a job loop is back waiting on the clock, so a tick
+// has been fully handled. The timer is put back for the next tick.
+func (c *fakeClock) waitIdle(t *testing.T) {
+	t.Helper()
+	select {
+	case timer := <-c.timers:
+		c.timers <- timer
+	case <-time.After(5 * time.Second):
+		t.Fatal("job loop did not return to the clock")
+	}
+}
+
+// runScheduler starts s and returns a func that cancels it and waits for
+// Start and Stop to return
+func runScheduler(t *testing.T, s *Scheduler) func() {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Start(ctx)
+		close(done)
+	}()
+
+	var stopped bool
+	stop := func() {
+		if stopped {
+			return
+		}
+		stopped = true
+		cancel()
+		<-done
+		stopCtx, stopCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer stopCancel()
+		if err := s.Stop(stopCtx); err != nil {
+			t.Errorf("Stop: %v", err)
+		}
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+func TestSchedulerRunsJobs(t *testing.T) {
+	clock := newFakeClock()
+	s := NewScheduler(NewNopLogger(), clock)
+
+	runs := make(chan string, 4)
+	err := s.Add("@every 1m", func(ctx context.Context) error {
+		id, _ := ctx.Value(contextKeyRequestID).(string)
+		runs <- id
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	runScheduler(t, s)
+
+	var ids []string
+	for range 2 {
+		clock.tick(t)
+		select {
+		case id := <-runs:
+			ids = append(ids, id)
+		case <-time.After(5 * time.Second):
+			t.Fatal("job did not run")
+		}
+	}
+	// Each run is correlated by its own ID
+	if ids[0] == "" || ids[0] == ids[1] {
+		t.Errorf("run IDs = %q, want distinct non-empty IDs", ids)
+	}
+}
+
+func TestSchedulerAddInvalidSpec(t *testing.T) {
+	s := NewScheduler(NewNopLogger(), nil)
+	if err := s.Add("every minute", func(context.Context) error { return nil }); err == nil {
+		t.Fatal("Add accepted an invalid spec")
+	}
+}
+
+func TestSchedulerOverlap(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []JobOption
+		wantRuns int32
+	}{
+		{"skipped by default", nil, 1},
+		{"allowed", []JobOption{AllowOverlap()}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			s := NewScheduler(NewNopLogger(), clock)
+
+			var runs atomic.Int32
+			release := make(chan struct{})
+			s.Add("@every 1m", func(ctx context.Context) error {
+				runs.Add(1)
+				<-release
+				return nil
+			}, tt.opts...)
+			stop := runScheduler(t, s)
+
+			// The first run is still blocked when the second tick fires
+			clock.tick(t)
+			clock.waitIdle(t)
+			clock.tick(t)
+			clock.waitIdle(t)
+
+			close(release)
+			stop()
+			if got := runs.Load(); got != tt.wantRuns {
+				t.Errorf("runs = %d, want %d", got, tt.wantRuns)
+			}
+		})
+	}
+}
+
+func TestSchedulerRecoversPanics(t *testing.T) {
+	app := newTestApp(t)
+	clock := newFakeClock()
+	app.scheduler = NewScheduler(app.Logger, clock)
+	app.scheduler.metrics = app.metrics
+
+	var runs atomic.Int32
+	err := app.Schedule("@hourly", func(ctx context.Context) error {
+		switch runs.Add(1) {
+		case 1:
+			panic("boom")
+		case 2:
+			return errors.New("failed")
+		}
+		return nil
+	}, WithJobName("cleanup"), AllowOverlap())
+	if err != nil {
+		t.Fatalf("Schedule: %v", err)
+	}
+	stop := runScheduler(t, app.scheduler)
+
+	for range 3 {
+		clock.tick(t)
+		clock.waitIdle(t)
+	}
+	stop()
+
+	// A panicking run does not take the job or the scheduler down
+	for _, status := range []string{"panic", "error", "success"} {
+		got := testutil.ToFloat64(app.metrics.jobRunsTotal.WithLabelValues("cleanup", status))
+		if got != 1 {
+			t.Errorf("%s runs = %v, want 1", status, got)
+		}
+	}
+}
+
+func TestSchedulerStopWaitsForRuns(t *testing.T) {
+	clock := newFakeClock()
+	s := NewScheduler(NewNopLogger(), clock)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s.Add("@every 1m", func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Start(ctx)
+	clock.tick(t)
+	<-started
+	cancel()
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer stopCancel()
+	if err := s.Stop(stopCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Stop with a run in flight = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop after the run finished: %v", err)
+	}
+}
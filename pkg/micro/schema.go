@@ -0,0 +1,122 @@
+package micro
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// DecodeWithSchema validates the request body against a JSON Schema (draft
+// 2020-12 unless the schema declares another $schema) and then unmarshals
+// it into v. It suits payloads without a fixed Go type, such as config
+// blobs decoded into a map. Failures are reported per JSON pointer, e.g.
+//
+//	{"/limits/max": "must be <= 100", "/name": "missing properties: 'name'"}
+//
+// Compiled schemas are cached by content, so schemaJSON can be a constant
+// passed on every request.
+func (a *App) DecodeWithSchema(r *http.Request, schemaJSON []byte, v interface{}) error {
+	defer r.Body.Close()
+
+	schema, err := a.compileSchema(schemaJSON)
+	if err != nil {
+		return err
+	}
+
+	mt := mediaType(r)
+	if mt == "" && a.Config.StrictContentType {
+		return NewAPIError(http.StatusUnsupportedMediaType, "Content-Type header is required")
+	}
+	if mt != "" && mt != "application/json" {
+		return NewAPIError(http.StatusUnsupportedMediaType, "unsupported content type", map[string]string{
+			"content_type": r.Header.Get("Content-Type"),
+		})
+	}
+
+	body, err := a.readBody(r)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return NewAPIError(http.StatusBadRequest, "request body is required")
+	}
+
+	// The validator expects numbers as json.Number to keep their precision
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var instance interface{}
+	if err := dec.Decode(&instance); err != nil {
+		return NewAPIError(http.StatusBadRequest, "invalid request body")
+	}
+
+	if err := schema.Validate(instance); err != nil {
+		var ve *jsonschema.ValidationError
+		if !errors.As(err, &ve) {
+			return fmt.Errorf("validate request body: %w", err)
+		}
+		return NewAPIError(http.StatusBadRequest, "validation failed", schemaErrorDetails(ve))
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return NewAPIError(http.StatusBadRequest, "invalid request body")
+	}
+	return nil
+}
+
+// compileSchema returns the cached compiled schema for schemaJSON. An
+// invalid schema is a programming error and surfaces as a 500.
+func (a *App) compileSchema(schemaJSON []byte) (*jsonschema.Schema, error) {
+	key := string(schemaJSON)
+	if cached, ok := a.schemas.Load(key); ok {
+		return cached.(*jsonschema.Schema), nil
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	compiler.AssertFormat = true
+	if err := compiler.AddResource("request.json", bytes.NewReader(schemaJSON)); err != nil {
+		return nil, fmt.Errorf("load request schema: %w", err)
+	}
+	schema, err := compiler.Compile("request.json")
+	if err != nil {
+		return nil, fmt.Errorf("compile request schema: %w", err)
+	}
+
+	cached, _ := a.schemas.LoadOrStore(key, schema)
+	return cached.(*jsonschema.Schema), nil
+}
+
+// schemaErrorDetails flattens a validation error tree into messages keyed
+// by the JSON pointer of the failing value. Only leaf errors are reported
+// since their parents merely say a subschema failed.
+func schemaErrorDetails(ve *jsonschema.ValidationError) map[string]string {
+	messages := make(map[string][]string)
+	var walk func(*jsonschema.ValidationError)
+	walk = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			path := e.InstanceLocation
+			if path == "" {
+				path = "/"
+			}
+			messages[path] = append(messages[path], e.Message)
+			return
+		}
+		for _, cause := range e.Causes {
+			walk(cause)
+		}
+	}
+	walk(ve)
+
+	details := make(map[string]string, len(messages))
+	for path, msgs := range messages {
+		sort.Strings(msgs)
+		details[path] = strings.Join(msgs, "; ")
+	}
+	return details
+}
@@ -0,0 +1,137 @@
+package micro
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var configBlobSchema = []byte(`{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["name", "limits"],
+	"properties": {
+		"name": {"type": "string", "minLength": 1},
+		"email": {"type": "string", "format": "email"},
+		"limits": {
+			"type": "object",
+			"properties": {"max": {"type": "integer", "maximum": 100}}
+		}
+	}
+}`)
+
+func schemaRequest(body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/config", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
+
+func TestDecodeWithSchema(t *testing.T) {
+	app := newTestApp(t)
+
+	var blob map[string]interface{}
+	err := app.DecodeWithSchema(schemaRequest(`{"name":"edge","limits":{"max":10},"extra":[1,2]}`), configBlobSchema, &blob)
+	if err != nil {
+		t.Fatalf("DecodeWithSchema: %v", err)
+	}
+	if blob["name"] != "edge" || blob["limits"].(map[string]interface{})["max"] != 10.0 {
+		t.Errorf("decoded %v", blob)
+	}
+}
+
+func TestDecodeWithSchemaErrors(t *testing.T) {
+	app := newTestApp(t)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		paths  []string
+	}{
+		{"multiple errors", `{"name":"","email":"nope","limits":{"max":500}}`, http.StatusBadRequest, []string{"/name", "/email", "/limits/max"}},
+		{"missing required", `{"name":"edge"}`, http.StatusBadRequest, []string{"/"}},
+		{"wrong type", `{"name":"edge","limits":{"max":1.5}}`, http.StatusBadRequest, []string{"/limits/max"}},
+		{"malformed", `{"name":`, http.StatusBadRequest, nil},
+		{"empty", ``, http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var blob map[string]interface{}
+			err := app.DecodeWithSchema(schemaRequest(tt.body), configBlobSchema, &blob)
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("err = %v, want an *APIError", err)
+			}
+			if apiErr.Code != tt.status {
+				t.Errorf("code = %d, want %d", apiErr.Code, tt.status)
+			}
+			if len(apiErr.Details) != len(tt.paths) {
+				t.Errorf("details = %v, want paths %v", apiErr.Details, tt.paths)
+			}
+			for _, path := range tt.paths {
+				if apiErr.Details[path] == "" {
+					t.Errorf("no message for %s in %v", path, apiErr.Details)
+				}
+			}
+			if blob != nil {
+				t.Errorf("invalid body decoded into %v", blob)
+			}
+		})
+	}
+}
+
+func TestDecodeWithSchemaContentType(t *testing.T) {
+	app := newTestApp(t)
+	r := schemaRequest(`{"name":"edge","limits":{}}`)
+	r.Header.Set("Content-Type", "text/plain")
+
+	var blob map[string]interface{}
+	var apiErr *APIError
+	if err := app.DecodeWithSchema(r, configBlobSchema, &blob); !errors.As(err, &apiErr) || apiErr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("err = %v, want 415", err)
+	}
+}
+
+func TestDecodeWithSchemaCachesCompiledSchemas(t *testing.T) {
+	app := newTestApp(t)
+	first, err := app.compileSchema(configBlobSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An equal schema in a different slice hits the cache
+	second, err := app.compileSchema(append([]byte(nil), configBlobSchema...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Error("schema compiled twice")
+	}
+}
+
+func TestDecodeWithInvalidSchema(t *testing.T) {
+	app := newTestApp(t)
+	var blob map[string]interface{}
+	err := app.DecodeWithSchema(schemaRequest(`{}`), []byte(`{"type": 12}`), &blob)
+	var apiErr *APIError
+	if err == nil || errors.As(err, &apiErr) {
+		t.Errorf("err = %v, want a plain error that surfaces as a 500", err)
+	}
+}
+
+func TestDecodeWithSchemaRejectsOversizedBody(t *testing.T) {
+	app := newTestApp(t, func(c *Config) { c.MaxBodyBytes = 64 })
+
+	var blob map[string]interface{}
+	body := `{"name":"` + strings.Repeat("a", 100) + `","limits":{}}`
+	err := app.DecodeWithSchema(schemaRequest(body), configBlobSchema, &blob)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("DecodeWithSchema error = %v, want 413", err)
+	}
+	if blob != nil {
+		t.Errorf("oversized body was decoded: %v", blob)
+	}
+}
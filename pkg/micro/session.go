@@ -0,0 +1,304 @@
+package micro
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ErrInvalidSession is returned by SessionStore.Get when the session cookie
+// is tampered with, signed by an unknown key or expired
+var ErrInvalidSession = errors.New("invalid session cookie")
+
+const csrfSessionKey = "_csrf"
+
+// SessionOptions configures cookie-backed sessions
+type SessionOptions struct {
+	// Keys sign (and encrypt) cookies. The first key is used for new
+	// cookies and all keys are accepted, so prepend a new key to rotate.
+	Keys       [][]byte
+	Encrypt    bool          // Encrypt values with AES-GCM in addition to signing
+	CookieName string        // Defaults to "session"
+	MaxAge     time.Duration // Defaults to 24 hours
+	Path       string        // Defaults to "/"
+	Domain     string
+	Secure     bool
+	SameSite   http.SameSite // Defaults to Lax
+}
+
+// SessionStore stores sessions in signed cookies
+type SessionStore struct {
+	opts SessionOptions
+}
+
+// Session holds values persisted in the session cookie. Values are stored as
+// JSON; use SessionValue to read them back as a concrete type.
+type Session struct {
+	Values map[string]json.RawMessage
+	IsNew  bool
+}
+
+type sessionPayload struct {
+	Values  map[string]json.RawMessage `json:"v"`
+	Expires int64                      `json:"e"`
+}
+
+// NewSessionStore creates a cookie session store
+func NewSessionStore(opts SessionOptions) (*SessionStore, error) {
+	if len(opts.Keys) == 0 {
+		return nil, errors.New("session store requires at least one key")
+	}
+	for i, key := range opts.Keys {
+		if len(key) < 32 {
+			return nil, fmt.Errorf("session key %d must be at least 32 bytes", i)
+		}
+	}
+	if opts.CookieName == "" {
+		opts.CookieName = "session"
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = 24 * time.Hour
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	if opts.SameSite == 0 {
+		opts.SameSite = http.SameSiteLaxMode
+	}
+	return &SessionStore{opts: opts}, nil
+}
+
+// Get loads the session from the request. A missing cookie yields a new
+// session; an invalid one yields a new session and ErrInvalidSession.
+func (s *SessionStore) Get(r *http.Request) (*Session, error) {
+	session := &Session{Values: map[string]json.RawMessage{}, IsNew: true}
+
+	cookie, err := r.Cookie(s.opts.CookieName)
+	if err != nil {
+		return session, nil
+	}
+
+	payload, err := s.decode(cookie.Value)
+	if err != nil {
+		return session, err
+	}
+	if time.Now().Unix() > payload.Expires {
+		return session, ErrInvalidSession
+	}
+
+	if payload.Values != nil {
+		session.Values = payload.Values
+	}
+	session.IsNew = false
+	return session, nil
+}
+
+// Save writes the session cookie, re-signing it with the newest key
+func (s *SessionStore) Save(w http.ResponseWriter, session *Session) error {
+	value, err := s.encode(sessionPayload{
+		Values:  session.Values,
+		Expires: time.Now().Add(s.opts.MaxAge).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, s.cookie(value, int(s.opts.MaxAge.Seconds())))
+	return nil
+}
+
+// Destroy removes the session cookie
+func (s *SessionStore) Destroy(w http.ResponseWriter) {
+	http.SetCookie(w, s.cookie("", -1))
+}
+
+func (s *SessionStore) cookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     s.opts.CookieName,
+		Value:    value,
+		Path:     s.opts.Path,
+		Domain:   s.opts.Domain,
+		MaxAge:   maxAge,
+		Secure:   s.opts.Secure,
+		HttpOnly: true,
+		SameSite: s.opts.SameSite,
+	}
+}
+
+// encode produces base64(data).base64(mac), where data is the JSON payload,
+// encrypted when configured. The cookie name is bound into the MAC so a
+// value cannot be replayed under another cookie.
+func (s *SessionStore) encode(payload sessionPayload) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("encode session: %w", err)
+	}
+
+	key := s.opts.Keys[0]
+	if s.opts.Encrypt {
+		if data, err = encrypt(key, data); err != nil {
+			return "", fmt.Errorf("encrypt session: %w", err)
+		}
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.sign(key, encoded)), nil
+}
+
+func (s *SessionStore) decode(value string) (*sessionPayload, error) {
+	encoded, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, ErrInvalidSession
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, ErrInvalidSession
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidSession
+	}
+
+	for _, key := range s.opts.Keys {
+		if !hmac.Equal(mac, s.sign(key, encoded)) {
+			continue
+		}
+		if s.opts.Encrypt {
+			if data, err = decrypt(key, data); err != nil {
+				return nil, ErrInvalidSession
+			}
+		}
+		var payload sessionPayload
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return nil, ErrInvalidSession
+		}
+		return &payload, nil
+	}
+	return nil, ErrInvalidSession
+}
+
+func (s *SessionStore) sign(key []byte, encoded string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(s.opts.CookieName + "|" + encoded))
+	return mac.Sum(nil)
+}
+
+// encryptionKey derives a key distinct from the signing key
+func encryptionKey(key []byte) []byte {
+	sum := sha256.Sum256(append([]byte("session-encryption|"), key...))
+	return sum[:]
+}
+
+func encrypt(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(encryptionKey(key))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func decrypt(key, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(encryptionKey(key))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, ErrInvalidSession
+	}
+	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+// Set stores a JSON-encodable value in the session
+func (s *Session) Set(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("set session value %q: %w", key, err)
+	}
+	s.Values[key] = data
+	return nil
+}
+
+// Delete removes a value from the session
+func (s *Session) Delete(key string) {
+	delete(s.Values, key)
+}
+
+// SessionValue reads a session value as T, reporting whether it was present
+// and decodable
+func SessionValue[T any](s *Session, key string) (T, bool) {
+	var value T
+	data, ok := s.Values[key]
+	if !ok {
+		return value, false
+	}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return value, false
+	}
+	return value, true
+}
+
+// CSRFToken returns the session's CSRF token, generating one if needed. Save
+// the session after calling it so the token persists.
+func (s *Session) CSRFToken() string {
+	if token, ok := SessionValue[string](s, csrfSessionKey); ok && token != "" {
+		return token
+	}
+	b := make([]byte, 32)
+	rand.Read(b)
+	token := base64.RawURLEncoding.EncodeToString(b)
+	s.Set(csrfSessionKey, token)
+	return token
+}
+
+// CSRFMiddleware rejects unsafe requests with 403 unless the X-CSRF-Token
+// header or csrf_token form field matches the token in the session
+func (a *App) CSRFMiddleware(store *SessionStore) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			session, _ := store.Get(r)
+			expected, _ := SessionValue[string](session, csrfSessionKey)
+
+			token := r.Header.Get("X-CSRF-Token")
+			if token == "" {
+				token = r.PostFormValue("csrf_token")
+			}
+
+			if expected == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+				a.handleError(w, r, NewAPIError(http.StatusForbidden, "invalid CSRF token"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
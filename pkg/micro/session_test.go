@@ -0,0 +1,220 @@
+package micro
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	sessionKeyA = bytes.Repeat([]byte("a"), 32)
+	sessionKeyB = bytes.Repeat([]byte("b"), 32)
+)
+
+func newSessionStore(t *testing.T, opts SessionOptions) *SessionStore {
+	t.Helper()
+	store, err := NewSessionStore(opts)
+	if err != nil {
+		t.Fatalf("NewSessionStore: %v", err)
+	}
+	return store
+}
+
+// saveSession saves session with store and returns the cookie it set
+func saveSession(t *testing.T, store *SessionStore, session *Session) *http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if err := store.Save(w, session); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Save set %d cookies, want 1", len(cookies))
+	}
+	return cookies[0]
+}
+
+// loadSession reads the session carried by cookie
+func loadSession(store *SessionStore, cookie *http.Cookie) (*Session, error) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookie)
+	return store.Get(r)
+}
+
+type cart struct {
+	Items []string `json:"items"`
+}
+
+func TestSessionRoundTrip(t *testing.T) {
+	for _, encrypt := range []bool{false, true} {
+		store := newSessionStore(t, SessionOptions{Keys: [][]byte{sessionKeyA}, Encrypt: encrypt})
+
+		session, err := store.Get(httptest.NewRequest(http.MethodGet, "/", nil))
+		if err != nil || !session.IsNew {
+			t.Fatalf("Get without cookie = %+v, %v, want a new session", session, err)
+		}
+		session.Set("user_id", 42)
+		session.Set("cart", cart{Items: []string{"book"}})
+		cookie := saveSession(t, store, session)
+
+		if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+			t.Errorf("cookie = %+v, want HttpOnly and SameSite=Lax", cookie)
+		}
+		if encrypt && strings.Contains(cookie.Value, "Ym9vaw") {
+			t.Error("encrypted cookie carries the plaintext")
+		}
+
+		loaded, err := loadSession(store, cookie)
+		if err != nil {
+			t.Fatalf("Get (encrypt=%v): %v", encrypt, err)
+		}
+		if loaded.IsNew {
+			t.Error("loaded session reported as new")
+		}
+		if id, ok := SessionValue[int](loaded, "user_id"); !ok || id != 42 {
+			t.Errorf("user_id = %v, %v, want 42", id, ok)
+		}
+		if c, ok := SessionValue[cart](loaded, "cart"); !ok || len(c.Items) != 1 || c.Items[0] != "book" {
+			t.Errorf("cart = %+v, %v", c, ok)
+		}
+		if _, ok := SessionValue[string](loaded, "missing"); ok {
+			t.Error("missing value reported as present")
+		}
+	}
+}
+
+func TestSessionTamperDetection(t *testing.T) {
+	store := newSessionStore(t, SessionOptions{Keys: [][]byte{sessionKeyA}})
+	session, _ := store.Get(httptest.NewRequest(http.MethodGet, "/", nil))
+	session.Set("role", "user")
+	cookie := saveSession(t, store, session)
+
+	data, sig, _ := strings.Cut(cookie.Value, ".")
+	tampered := map[string]string{
+		"modified payload":  data[:len(data)-2] + "AA" + "." + sig,
+		"modified mac":      data + "." + sig[:len(sig)-2] + "AA",
+		"missing mac":       data,
+		"not base64":        "!!!." + sig,
+		"renamed cookie":    cookie.Value,
+		"foreign signature": data + "." + "c2lnbmF0dXJl",
+	}
+	for name, value := range tampered {
+		t.Run(name, func(t *testing.T) {
+			c := &http.Cookie{Name: cookie.Name, Value: value}
+			s := store
+			if name == "renamed cookie" {
+				// The cookie name is bound into the MAC
+				s = newSessionStore(t, SessionOptions{Keys: [][]byte{sessionKeyA}, CookieName: "other"})
+				c.Name = "other"
+			}
+			loaded, err := loadSession(s, c)
+			if !errors.Is(err, ErrInvalidSession) {
+				t.Fatalf("err = %v, want %v", err, ErrInvalidSession)
+			}
+			if !loaded.IsNew || len(loaded.Values) != 0 {
+				t.Errorf("tampered cookie yielded values %v", loaded.Values)
+			}
+		})
+	}
+}
+
+func TestSessionKeyRotation(t *testing.T) {
+	for _, encrypt := range []bool{false, true} {
+		old := newSessionStore(t, SessionOptions{Keys: [][]byte{sessionKeyA}, Encrypt: encrypt})
+		session, _ := old.Get(httptest.NewRequest(http.MethodGet, "/", nil))
+		session.Set("user_id", 7)
+		oldCookie := saveSession(t, old, session)
+
+		// B is now the signing key and A is still accepted
+		rotated := newSessionStore(t, SessionOptions{Keys: [][]byte{sessionKeyB, sessionKeyA}, Encrypt: encrypt})
+		loaded, err := loadSession(rotated, oldCookie)
+		if err != nil {
+			t.Fatalf("rotated store rejected a cookie signed with the old key (encrypt=%v): %v", encrypt, err)
+		}
+		newCookie := saveSession(t, rotated, loaded)
+
+		// Once A is retired, only re-signed cookies remain valid
+		retired := newSessionStore(t, SessionOptions{Keys: [][]byte{sessionKeyB}, Encrypt: encrypt})
+		if _, err := loadSession(retired, oldCookie); !errors.Is(err, ErrInvalidSession) {
+			t.Errorf("retired key still accepted (encrypt=%v): %v", encrypt, err)
+		}
+		if loaded, err := loadSession(retired, newCookie); err != nil {
+			t.Errorf("re-signed cookie rejected (encrypt=%v): %v", encrypt, err)
+		} else if id, _ := SessionValue[int](loaded, "user_id"); id != 7 {
+			t.Errorf("user_id = %d, want 7", id)
+		}
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	store := newSessionStore(t, SessionOptions{Keys: [][]byte{sessionKeyA}, MaxAge: time.Second})
+	value, err := store.encode(sessionPayload{Expires: time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSession(store, &http.Cookie{Name: "session", Value: value}); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("expired session err = %v, want %v", err, ErrInvalidSession)
+	}
+}
+
+func TestNewSessionStoreRejectsWeakKeys(t *testing.T) {
+	for name, keys := range map[string][][]byte{
+		"no keys":   nil,
+		"short key": {[]byte("too short")},
+		"short old": {sessionKeyA, []byte("too short")},
+	} {
+		if _, err := NewSessionStore(SessionOptions{Keys: keys}); err == nil {
+			t.Errorf("%s: NewSessionStore accepted the keys", name)
+		}
+	}
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	app := newTestApp(t)
+	store := newSessionStore(t, SessionOptions{Keys: [][]byte{sessionKeyA}})
+	h := app.CSRFMiddleware(store)(http.HandlerFunc(okHTTPHandler))
+
+	session, _ := store.Get(httptest.NewRequest(http.MethodGet, "/", nil))
+	token := session.CSRFToken()
+	if again := session.CSRFToken(); again != token {
+		t.Errorf("CSRFToken changed from %q to %q", token, again)
+	}
+	cookie := saveSession(t, store, session)
+
+	tests := []struct {
+		name   string
+		method string
+		cookie *http.Cookie
+		header string
+		form   string
+		status int
+	}{
+		{"safe method", http.MethodGet, nil, "", "", http.StatusOK},
+		{"header token", http.MethodPost, cookie, token, "", http.StatusOK},
+		{"form token", http.MethodPost, cookie, "", "csrf_token=" + token, http.StatusOK},
+		{"wrong token", http.MethodPost, cookie, "forged", "", http.StatusForbidden},
+		{"no token", http.MethodDelete, cookie, "", "", http.StatusForbidden},
+		{"no session", http.MethodPost, nil, token, "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.form))
+			if tt.form != "" {
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			if tt.cookie != nil {
+				r.AddCookie(tt.cookie)
+			}
+			if tt.header != "" {
+				r.Header.Set("X-CSRF-Token", tt.header)
+			}
+			if w := serve(h, r); w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package micro
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ShutdownInfo describes a completed server shutdown
+type ShutdownInfo struct {
+	Duration time.Duration
+	InFlight int64 // Requests in flight when shutdown started
+	Drained  int64 // Of those, requests that completed before the server closed
+	Forced   bool  // Connections were closed before draining finished
+	Err      error
+}
+
+// OnShutdownComplete registers fn to run once shutdown has finished, after
+// workers have stopped. Hooks run in registration order.
+func (a *App) OnShutdownComplete(fn func(ShutdownInfo)) {
+	a.shutdownHooks = append(a.shutdownHooks, fn)
+}
+
+// beginShutdown records when shutdown started and how many requests were
+// in flight at that point
+func (a *App) beginShutdown() {
+	a.shutdownStart = time.Now()
+	a.shutdownInFlight = a.inFlight.Load()
+	a.Logger.Info("server shutdown initiated",
+		zap.Int64("in_flight", a.shutdownInFlight),
+		zap.Duration("timeout", a.Config.ShutdownTimeout),
+	)
+}
+
+// completeShutdown records the shutdown metric, logs the outcome and runs
+// the OnShutdownComplete hooks. Only the first call has any effect, since a
+// forced shutdown may race the graceful one.
+func (a *App) completeShutdown(forced bool, err error) {
+	a.shutdownOnce.Do(func() {
+		info := ShutdownInfo{
+			Duration: time.Since(a.shutdownStart),
+			InFlight: a.shutdownInFlight,
+			Forced:   forced,
+			Err:      err,
+		}
+		// Requests still counted were cut off by the forced close
+		info.Drained = max(info.InFlight-a.inFlight.Load(), 0)
+
+		a.metrics.shutdownDuration.WithLabelValues(boolLabel(forced)).Observe(info.Duration.Seconds())
+
+		fields := []zap.Field{
+			zap.Duration("duration", info.Duration),
+			zap.Int64("in_flight", info.InFlight),
+			zap.Int64("drained", info.Drained),
+			zap.Bool("forced", forced),
+		}
+		if err != nil {
+			a.Logger.Error("server shutdown complete", append(fields, zap.Error(err))...)
+		} else {
+			a.Logger.Info("server shutdown complete", fields...)
+		}
+
+		for _, hook := range a.shutdownHooks {
+			hook(info)
+		}
+	})
+}
+
+func boolLabel(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
@@ -0,0 +1,72 @@
+package micro
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGracefulShutdownReport(t *testing.T) {
+	app := newTestApp(t)
+	logger := NewTestLogger()
+	app.Logger = logger
+
+	inHandler, release := make(chan struct{}), make(chan struct{})
+	app.GET("/slow", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		close(inHandler)
+		<-release
+		return okHandler(ctx, w, r)
+	})
+	var infos []ShutdownInfo
+	app.OnShutdownComplete(func(i ShutdownInfo) { infos = append(infos, i) })
+
+	base, done := startApp(t, app)
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(base + "/slow")
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	<-inHandler
+
+	sendShutdownSignal(t)
+	for deadline := time.Now().Add(5 * time.Second); !logger.Logged("server shutdown initiated"); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("shutdown did not start")
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	if err := waitStart(t, done); err != nil {
+		t.Fatalf("Start = %v, want nil", err)
+	}
+	if code := <-status; code != http.StatusOK {
+		t.Errorf("in-flight request status = %d, want %d", code, http.StatusOK)
+	}
+
+	if len(infos) != 1 {
+		t.Fatalf("OnShutdownComplete ran %d times, want 1", len(infos))
+	}
+	info := infos[0]
+	if info.InFlight != 1 || info.Drained != 1 || info.Forced || info.Err != nil {
+		t.Errorf("info = %+v, want one request drained without forcing", info)
+	}
+	if info.Duration < 20*time.Millisecond {
+		t.Errorf("duration = %v, want it to include the drain", info.Duration)
+	}
+
+	fields := entryFields(t, logger, "server shutdown complete")
+	if fields["drained"] != int64(1) || fields["forced"] != false {
+		t.Errorf("completion log fields = %v", fields)
+	}
+	if metrics := scrape(t, app); !strings.Contains(metrics, `server_shutdown_duration_seconds_count{forced="false"} 1`) {
+		t.Errorf("shutdown duration not observed:\n%s", metrics)
+	}
+}
@@ -0,0 +1,56 @@
+package micro
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/sync/singleflight"
+)
+
+// SingleFlightMiddleware coalesces concurrent identical GET and HEAD requests
+// so only one reaches the handler and the others receive a copy of its
+// response. Requests are identical when method, host, tenant, path, query
+// and credentials (Authorization and Cookie headers) match, so responses are
+// never shared between callers or tenants; TenantMiddleware must run first. The leader's response is buffered in memory to be
+// replayed, and cancelling the leader's request cancels it for all waiters.
+func (a *App) SingleFlightMiddleware() mux.MiddlewareFunc {
+	var group singleflight.Group
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := r.Method + " " + cacheKey(r, []string{"Authorization", "Cookie"})
+			leader := false
+			v, _, _ := group.Do(key, func() (interface{}, error) {
+				leader = true
+				rec := &cacheRecorder{ResponseWriter: w, status: http.StatusOK}
+				next.ServeHTTP(rec, r)
+				if rec.header == nil {
+					rec.header = w.Header().Clone()
+				}
+				return &CachedResponse{
+					Status: rec.status,
+					Header: rec.header,
+					Body:   rec.body.Bytes(),
+				}, nil
+			})
+			if leader {
+				return
+			}
+
+			shared := v.(*CachedResponse)
+			// Keep headers set by outer middleware, such as the request ID
+			for k, vals := range shared.Header {
+				if _, exists := w.Header()[k]; !exists {
+					w.Header()[k] = vals
+				}
+			}
+			w.WriteHeader(shared.Status)
+			w.Write(shared.Body)
+		})
+	}
+}
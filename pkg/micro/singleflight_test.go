@@ -0,0 +1,98 @@
+package micro
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowCountingHandler counts its calls and holds each one long enough for
+// concurrent requests to pile up behind it
+func slowCountingHandler(calls *atomic.Int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "call %d for %s", n, r.Header.Get("Authorization"))
+	})
+}
+
+// fireConcurrently serves the requests built by newRequest at the same time
+func fireConcurrently(h http.Handler, n int, newRequest func(i int) *http.Request) []*httptest.ResponseRecorder {
+	responses := make([]*httptest.ResponseRecorder, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i] = serve(h, newRequest(i))
+		}()
+	}
+	wg.Wait()
+	return responses
+}
+
+func TestSingleFlightCoalescesIdenticalRequests(t *testing.T) {
+	app := newTestApp(t)
+	var calls atomic.Int32
+	h := app.SingleFlightMiddleware()(slowCountingHandler(&calls))
+
+	responses := fireConcurrently(h, 20, func(int) *http.Request {
+		return httptest.NewRequest(http.MethodGet, "/report?year=2024", nil)
+	})
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("handler ran %d times, want 1", n)
+	}
+	for i, w := range responses {
+		if w.Code != http.StatusOK || w.Body.String() != "call 1 for " {
+			t.Errorf("response %d = %d %q, want the shared response", i, w.Code, w.Body.String())
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "text/plain" {
+			t.Errorf("response %d Content-Type = %q", i, ct)
+		}
+	}
+}
+
+func TestSingleFlightKeepsRequestsApart(t *testing.T) {
+	tests := []struct {
+		name       string
+		newRequest func(i int) *http.Request
+	}{
+		{"different credentials", func(i int) *http.Request {
+			r := httptest.NewRequest(http.MethodGet, "/me", nil)
+			r.Header.Set("Authorization", fmt.Sprintf("Bearer %d", i))
+			return r
+		}},
+		{"different queries", func(i int) *http.Request {
+			return httptest.NewRequest(http.MethodGet, fmt.Sprintf("/report?year=%d", 2020+i), nil)
+		}},
+		{"different hosts", func(i int) *http.Request {
+			r := httptest.NewRequest(http.MethodGet, "/report", nil)
+			r.Host = fmt.Sprintf("tenant-%d.example.com", i)
+			return r
+		}},
+		{"different tenants", func(i int) *http.Request {
+			r := httptest.NewRequest(http.MethodGet, "/report", nil)
+			return r.WithContext(WithTenant(r.Context(), fmt.Sprintf("tenant-%d", i)))
+		}},
+		{"unsafe method", func(i int) *http.Request {
+			return httptest.NewRequest(http.MethodPost, "/report", nil)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			var calls atomic.Int32
+			h := app.SingleFlightMiddleware()(slowCountingHandler(&calls))
+
+			fireConcurrently(h, 3, tt.newRequest)
+			if n := calls.Load(); n != 3 {
+				t.Errorf("handler ran %d times, want 3", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package micro
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// streamFlushInterval is the number of elements written between flushes
+const streamFlushInterval = 100
+
+// StreamJSON writes the values received on ch as a JSON array without
+// buffering the whole list in memory. The array is closed when ch is closed.
+// Receiving an error value on ch, or cancellation of ctx, aborts the stream
+// without closing the array so clients can detect the truncated response.
+func (a *App) StreamJSON(ctx context.Context, w http.ResponseWriter, status int, ch <-chan interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	if _, err := w.Write([]byte("[")); err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	count := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case item, ok := <-ch:
+			if !ok {
+				if _, err := w.Write([]byte("]\n")); err != nil {
+					return err
+				}
+				flush()
+				return nil
+			}
+
+			if err, isErr := item.(error); isErr {
+				return err
+			}
+
+			if count > 0 {
+				if _, err := w.Write([]byte(",")); err != nil {
+					return err
+				}
+			}
+			if err := encoder.Encode(item); err != nil {
+				return err
+			}
+
+			count++
+			if count%streamFlushInterval == 0 {
+				flush()
+			}
+		}
+	}
+}
+
+// NDJSONWriter writes a newline delimited JSON (JSON Lines) response
+type NDJSONWriter struct {
+	encoder *json.Encoder
+	flusher http.Flusher
+}
+
+// NDJSON starts an application/x-ndjson response with status. Each value
+// passed to Write becomes one line, sent to the client right away, so
+// records can be streamed from a cursor without buffering.
+func (a *App) NDJSON(w http.ResponseWriter, status int) *NDJSONWriter {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(status)
+	flusher, _ := w.(http.Flusher)
+	return &NDJSONWriter{encoder: json.NewEncoder(w), flusher: flusher}
+}
+
+// Write encodes v on its own line and flushes it. It fails once the client
+// is gone, which should end the stream.
+func (nw *NDJSONWriter) Write(v interface{}) error {
+	if err := nw.encoder.Encode(v); err != nil {
+		return err
+	}
+	if nw.flusher != nil {
+		nw.flusher.Flush()
+	}
+	return nil
+}
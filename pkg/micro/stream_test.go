@@ -0,0 +1,192 @@
+package micro
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type streamItem struct {
+	ID int `json:"id"`
+}
+
+func TestStreamJSON(t *testing.T) {
+	app := newTestApp(t)
+	ch := make(chan interface{})
+	go func() {
+		defer close(ch)
+		for i := 1; i <= 250; i++ {
+			ch <- streamItem{ID: i}
+		}
+	}()
+
+	w := httptest.NewRecorder()
+	if err := app.StreamJSON(context.Background(), w, http.StatusOK, ch); err != nil {
+		t.Fatalf("StreamJSON: %v", err)
+	}
+
+	var items []streamItem
+	if err := json.Unmarshal(w.Body.Bytes(), &items); err != nil {
+		t.Fatalf("body is not a JSON array: %v", err)
+	}
+	if len(items) != 250 || items[0].ID != 1 || items[249].ID != 250 {
+		t.Errorf("got %d items, want 1..250", len(items))
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !w.Flushed {
+		t.Error("response was not flushed")
+	}
+}
+
+func TestStreamJSONEmpty(t *testing.T) {
+	app := newTestApp(t)
+	ch := make(chan interface{})
+	close(ch)
+
+	w := httptest.NewRecorder()
+	if err := app.StreamJSON(context.Background(), w, http.StatusOK, ch); err != nil {
+		t.Fatalf("StreamJSON: %v", err)
+	}
+	if got := w.Body.String(); got != "[]\n" {
+		t.Errorf("body = %q, want %q", got, "[]\n")
+	}
+}
+
+func TestStreamJSONAborts(t *testing.T) {
+	app := newTestApp(t)
+
+	t.Run("error value", func(t *testing.T) {
+		errBoom := errors.New("boom")
+		ch := make(chan interface{}, 2)
+		ch <- streamItem{ID: 1}
+		ch <- errBoom
+
+		w := httptest.NewRecorder()
+		if err := app.StreamJSON(context.Background(), w, http.StatusOK, ch); !errors.Is(err, errBoom) {
+			t.Fatalf("err = %v, want %v", err, errBoom)
+		}
+		// The array is left open so the client sees a truncated response
+		if json.Valid(w.Body.Bytes()) {
+			t.Errorf("body %q is valid JSON, want it truncated", w.Body.String())
+		}
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		w := httptest.NewRecorder()
+		err := app.StreamJSON(ctx, w, http.StatusOK, make(chan interface{}))
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want %v", err, context.Canceled)
+		}
+	})
+}
+
+// flushCounter records the body and how often it was flushed, and fails
+// writes once failAfter of them succeeded (0 never fails)
+type flushCounter struct {
+	header    http.Header
+	status    int
+	body      strings.Builder
+	flushes   int
+	writes    int
+	failAfter int
+}
+
+func (f *flushCounter) Header() http.Header {
+	if f.header == nil {
+		f.header = http.Header{}
+	}
+	return f.header
+}
+
+func (f *flushCounter) WriteHeader(status int) { f.status = status }
+
+func (f *flushCounter) Write(p []byte) (int, error) {
+	if f.failAfter > 0 && f.writes >= f.failAfter {
+		return 0, errClientGone
+	}
+	f.writes++
+	return f.body.Write(p)
+}
+
+func (f *flushCounter) Flush() { f.flushes++ }
+
+var errClientGone = errors.New("client gone")
+
+func TestNDJSONWriter(t *testing.T) {
+	app := newTestApp(t)
+	w := &flushCounter{}
+
+	lines := app.NDJSON(w, http.StatusAccepted)
+	if w.status != http.StatusAccepted || w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("response = %d %v", w.status, w.Header())
+	}
+	for i := 1; i <= 3; i++ {
+		if err := lines.Write(streamItem{ID: i}); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		// Every line reaches the client before the next is produced
+		if w.flushes != i {
+			t.Fatalf("flushes after %d lines = %d", i, w.flushes)
+		}
+	}
+
+	want := "{\"id\":1}\n{\"id\":2}\n{\"id\":3}\n"
+	if got := w.body.String(); got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(w.body.String(), "\n"), "\n") {
+		if !json.Valid([]byte(line)) {
+			t.Errorf("line %q is not JSON", line)
+		}
+	}
+}
+
+func TestNDJSONWriterErrors(t *testing.T) {
+	app := newTestApp(t)
+
+	t.Run("client gone", func(t *testing.T) {
+		w := &flushCounter{failAfter: 1}
+		lines := app.NDJSON(w, http.StatusOK)
+		if err := lines.Write(streamItem{ID: 1}); err != nil {
+			t.Fatalf("first Write: %v", err)
+		}
+		if err := lines.Write(streamItem{ID: 2}); !errors.Is(err, errClientGone) {
+			t.Fatalf("Write after the client left = %v, want %v", err, errClientGone)
+		}
+		if w.flushes != 1 {
+			t.Errorf("flushes = %d, want 1", w.flushes)
+		}
+	})
+
+	t.Run("unencodable value", func(t *testing.T) {
+		w := &flushCounter{}
+		lines := app.NDJSON(w, http.StatusOK)
+		if err := lines.Write(func() {}); err == nil {
+			t.Fatal("Write of a func succeeded")
+		}
+		if w.body.Len() != 0 || w.flushes != 0 {
+			t.Errorf("failed Write sent %q with %d flushes", w.body.String(), w.flushes)
+		}
+	})
+
+	t.Run("without flusher", func(t *testing.T) {
+		// A writer that cannot flush still gets every line
+		w := httptest.NewRecorder()
+		lines := app.NDJSON(struct{ http.ResponseWriter }{w}, http.StatusOK)
+		if err := lines.Write(streamItem{ID: 1}); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		if w.Body.String() != "{\"id\":1}\n" || w.Flushed {
+			t.Errorf("body = %q, flushed = %v", w.Body.String(), w.Flushed)
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package micro
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// TenantOptions configures how TenantMiddleware resolves the tenant
+type TenantOptions struct {
+	// Header carrying the tenant ID (defaults to X-Tenant-ID)
+	Header string
+	// BaseDomain enables subdomain resolution, e.g. "example.com" resolves
+	// "acme.example.com" to tenant "acme". Subdomains take precedence over
+	// the header.
+	BaseDomain string
+	// Required rejects requests without a tenant with 400
+	Required bool
+}
+
+// TenantMiddleware scopes requests to a tenant resolved from the subdomain
+// or a header. When an authenticated principal belongs to a different
+// tenant the request is rejected with 403.
+func (a *App) TenantMiddleware(opts TenantOptions) mux.MiddlewareFunc {
+	if opts.Header == "" {
+		opts.Header = "X-Tenant-ID"
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenantID := tenantFromSubdomain(r.Host, opts.BaseDomain)
+			if tenantID == "" {
+				tenantID = r.Header.Get(opts.Header)
+			}
+
+			if tenantID == "" {
+				if opts.Required {
+					a.handleError(w, r, NewAPIError(http.StatusBadRequest, "tenant is required"))
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if p, ok := PrincipalFromContext(r.Context()); ok && p.TenantID != "" && p.TenantID != tenantID {
+				a.handleError(w, r, NewAPIError(http.StatusForbidden, "tenant mismatch"))
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithTenant(r.Context(), tenantID)))
+		})
+	}
+}
+
+func tenantFromSubdomain(host, baseDomain string) string {
+	if baseDomain == "" {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	sub, ok := strings.CutSuffix(strings.ToLower(host), "."+strings.ToLower(baseDomain))
+	if !ok || sub == "" || strings.Contains(sub, ".") {
+		return ""
+	}
+	return sub
+}
@@ -0,0 +1,59 @@
+package micro
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTenantMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       TenantOptions
+		host       string
+		header     string
+		principal  *Principal
+		status     int
+		wantTenant string
+	}{
+		{"header", TenantOptions{}, "api.test", "acme", nil, http.StatusOK, "acme"},
+		{"subdomain", TenantOptions{BaseDomain: "example.com"}, "acme.example.com:8080", "", nil, http.StatusOK, "acme"},
+		{"subdomain wins over header", TenantOptions{BaseDomain: "example.com"}, "acme.example.com", "globex", nil, http.StatusOK, "acme"},
+		{"nested subdomain ignored", TenantOptions{BaseDomain: "example.com"}, "a.b.example.com", "", nil, http.StatusOK, ""},
+		{"custom header", TenantOptions{Header: "X-Org"}, "api.test", "acme", nil, http.StatusOK, "acme"},
+		{"optional tenant missing", TenantOptions{}, "api.test", "", nil, http.StatusOK, ""},
+		{"required tenant missing", TenantOptions{Required: true}, "api.test", "", nil, http.StatusBadRequest, ""},
+		{"principal of tenant", TenantOptions{}, "api.test", "acme", &Principal{ID: "1", TenantID: "acme"}, http.StatusOK, "acme"},
+		{"principal of other tenant", TenantOptions{}, "api.test", "globex", &Principal{ID: "1", TenantID: "acme"}, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			var tenant string
+			h := app.TenantMiddleware(tt.opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tenant, _ = TenantFromContext(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Host = tt.host
+			if tt.header != "" {
+				header := tt.opts.Header
+				if header == "" {
+					header = "X-Tenant-ID"
+				}
+				r.Header.Set(header, tt.header)
+			}
+			if tt.principal != nil {
+				r = r.WithContext(WithPrincipal(r.Context(), tt.principal))
+			}
+
+			w := serve(h, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tenant != tt.wantTenant {
+				t.Errorf("tenant = %q, want %q", tenant, tt.wantTenant)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package micro
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// NewNopLogger returns a Logger that discards everything
+func NewNopLogger() Logger {
+	return &ZapLogger{Logger: zap.NewNop()}
+}
+
+// TestLogger is a Logger that records entries in memory so tests can assert
+// on what was logged. Loggers derived with With share the same record.
+type TestLogger struct {
+	*ZapLogger
+	logs *observer.ObservedLogs
+}
+
+// NewTestLogger creates a TestLogger capturing entries at debug level and
+// above
+func NewTestLogger() *TestLogger {
+	core, logs := observer.New(zapcore.DebugLevel)
+	return &TestLogger{
+		ZapLogger: &ZapLogger{Logger: zap.New(core)},
+		logs:      logs,
+	}
+}
+
+// Entries returns all captured entries
+func (t *TestLogger) Entries() []observer.LoggedEntry {
+	return t.logs.All()
+}
+
+// Messages returns the messages of all captured entries in order
+func (t *TestLogger) Messages() []string {
+	entries := t.logs.All()
+	messages := make([]string, len(entries))
+	for i, e := range entries {
+		messages[i] = e.Message
+	}
+	return messages
+}
+
+// Logged reports whether an entry with msg was captured
+func (t *TestLogger) Logged(msg string) bool {
+	return t.logs.FilterMessage(msg).Len() > 0
+}
+
+// Reset discards all captured entries
+func (t *TestLogger) Reset() {
+	t.logs.TakeAll()
+}
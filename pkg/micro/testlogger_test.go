@@ -0,0 +1,48 @@
+package micro
+
+import (
+	"fmt"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestTestLoggerCapturesEntries(t *testing.T) {
+	logger := NewTestLogger()
+	logger.Debug("starting")
+	// Derived loggers record into the same log
+	logger.With(zap.String("component", "users")).Info("user created", zap.Int("id", 7))
+
+	if got := logger.Messages(); len(got) != 2 || got[0] != "starting" || got[1] != "user created" {
+		t.Fatalf("messages = %v", got)
+	}
+	if !logger.Logged("user created") || logger.Logged("user deleted") {
+		t.Error("Logged does not match the captured messages")
+	}
+	fields := entryFields(t, logger, "user created")
+	if fields["component"] != "users" || fields["id"] != int64(7) {
+		t.Errorf("fields = %v", fields)
+	}
+
+	logger.Reset()
+	if n := len(logger.Entries()); n != 0 {
+		t.Errorf("%d entries after Reset", n)
+	}
+}
+
+func TestNopLoggerDiscards(t *testing.T) {
+	logger := NewNopLogger()
+	// Derived loggers must be usable too
+	logger.With(zap.String("k", "v")).Error("ignored")
+}
+
+func ExampleNewTestLogger() {
+	logger := NewTestLogger()
+	logger.Info("user registered successfully", zap.Int32("user_id", 42))
+
+	fmt.Println(logger.Logged("user registered successfully"))
+	fmt.Println(logger.Entries()[0].ContextMap()["user_id"])
+	// Output:
+	// true
+	// 42
+}
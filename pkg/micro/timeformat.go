@@ -0,0 +1,102 @@
+package micro
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Config.TimeFormat values; any other value is a time.Format layout
+const (
+	TimeFormatRFC3339   = "rfc3339"   // Go's default, RFC 3339 with nanoseconds
+	TimeFormatUnix      = "unix"      // Seconds since the epoch
+	TimeFormatUnixMilli = "unixmilli" // Milliseconds since the epoch
+)
+
+// validTimeFormat reports whether format is empty, a named format or a
+// layout with at least one time element
+func validTimeFormat(format string) bool {
+	switch format {
+	case "", TimeFormatRFC3339, TimeFormatUnix, TimeFormatUnixMilli:
+		return true
+	}
+	return time.Unix(0, 0).UTC().Format(format) != format
+}
+
+// jsonTimeFormat is the Config.TimeFormat of the most recently created App.
+// A Time is marshaled without access to the App, so the format is shared by
+// the process.
+var jsonTimeFormat atomic.Value // string
+
+func timeFormat() string {
+	format, _ := jsonTimeFormat.Load().(string)
+	return format
+}
+
+// Time is a time.Time that encodes and decodes JSON in Config.TimeFormat.
+// Use it for timestamp fields of request and response types; plain
+// time.Time fields keep Go's RFC 3339 encoding.
+type Time struct {
+	time.Time
+}
+
+// TimeFromTimestamptz converts a database timestamp, returning nil for NULL
+// so the field encodes as null
+func TimeFromTimestamptz(ts pgtype.Timestamptz) *Time {
+	if !ts.Valid {
+		return nil
+	}
+	return &Time{Time: ts.Time}
+}
+
+func (t Time) MarshalJSON() ([]byte, error) {
+	switch format := timeFormat(); format {
+	case "", TimeFormatRFC3339:
+		return t.Time.MarshalJSON()
+	case TimeFormatUnix:
+		return strconv.AppendInt(nil, t.Unix(), 10), nil
+	case TimeFormatUnixMilli:
+		return strconv.AppendInt(nil, t.UnixMilli(), 10), nil
+	default:
+		return json.Marshal(t.Format(format))
+	}
+}
+
+// UnmarshalJSON accepts the configured format. Like time.Time, null leaves
+// the time unchanged.
+func (t *Time) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	switch format := timeFormat(); format {
+	case "", TimeFormatRFC3339:
+		return t.Time.UnmarshalJSON(data)
+	case TimeFormatUnix, TimeFormatUnixMilli:
+		n, err := strconv.ParseInt(string(data), 10, 64)
+		if err != nil {
+			return fmt.Errorf("time %s must be an integer in %s format", data, format)
+		}
+		if format == TimeFormatUnix {
+			t.Time = time.Unix(n, 0).UTC()
+		} else {
+			t.Time = time.UnixMilli(n).UTC()
+		}
+		return nil
+	default:
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return fmt.Errorf("time %s must be a string in the format %q", data, format)
+		}
+		parsed, err := time.Parse(format, s)
+		if err != nil {
+			return fmt.Errorf("time %q must be in the format %q", s, format)
+		}
+		t.Time = parsed
+		return nil
+	}
+}
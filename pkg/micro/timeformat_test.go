@@ -0,0 +1,121 @@
+package micro
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var testTime = time.Date(2024, 3, 5, 14, 30, 15, 123000000, time.UTC)
+
+func encodeWithFormat(t *testing.T, format string, v interface{}) string {
+	t.Helper()
+	app := newTestApp(t, func(c *Config) { c.TimeFormat = format })
+	w := httptest.NewRecorder()
+	if err := app.JSON(w, 200, v); err != nil {
+		t.Fatalf("JSON: %v", err)
+	}
+	return strings.TrimSpace(w.Body.String())
+}
+
+func TestTimeFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"", `"2024-03-05T14:30:15.123Z"`},
+		{TimeFormatRFC3339, `"2024-03-05T14:30:15.123Z"`},
+		{TimeFormatUnix, `1709649015`},
+		{TimeFormatUnixMilli, `1709649015123`},
+		{"2006-01-02", `"2024-03-05"`},
+		{time.RFC1123, `"Tue, 05 Mar 2024 14:30:15 UTC"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			if got := encodeWithFormat(t, tt.format, Time{testTime}); got != tt.want {
+				t.Errorf("Time = %s, want %s", got, tt.want)
+			}
+			if got := encodeWithFormat(t, tt.format, &Time{testTime}); got != tt.want {
+				t.Errorf("*Time = %s, want %s", got, tt.want)
+			}
+			ts := pgtype.Timestamptz{Time: testTime, Valid: true}
+			if got := encodeWithFormat(t, tt.format, TimeFromTimestamptz(ts)); got != tt.want {
+				t.Errorf("TimeFromTimestamptz = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeFormatFields(t *testing.T) {
+	rec := struct {
+		CreatedAt Time      `json:"created_at"`
+		UpdatedAt *Time     `json:"updated_at,omitempty"`
+		DeletedAt *Time     `json:"deleted_at"`
+		History   []Time    `json:"history"`
+		Plain     time.Time `json:"plain"`
+	}{
+		CreatedAt: Time{testTime},
+		DeletedAt: TimeFromTimestamptz(pgtype.Timestamptz{}),
+		History:   []Time{{testTime}, {testTime.Add(time.Second)}},
+		Plain:     testTime,
+	}
+	got := encodeWithFormat(t, TimeFormatUnix, rec)
+	want := `{"created_at":1709649015,"deleted_at":null,"history":[1709649015,1709649016],` +
+		`"plain":"2024-03-05T14:30:15.123Z"}`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestTimeUnmarshal(t *testing.T) {
+	tests := []struct {
+		format string
+		input  string
+		want   time.Time
+	}{
+		{TimeFormatRFC3339, `"2024-03-05T14:30:15.123Z"`, testTime},
+		{TimeFormatUnix, `1709649015`, testTime.Truncate(time.Second)},
+		{TimeFormatUnixMilli, `1709649015123`, testTime},
+		{"2006-01-02", `"2024-03-05"`, time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			newTestApp(t, func(c *Config) { c.TimeFormat = tt.format })
+			var got Time
+			if err := json.Unmarshal([]byte(tt.input), &got); err != nil {
+				t.Fatalf("Unmarshal(%s): %v", tt.input, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("Unmarshal(%s) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+
+	newTestApp(t, func(c *Config) { c.TimeFormat = TimeFormatUnix })
+	var got Time
+	if err := json.Unmarshal([]byte(`"2024-03-05T14:30:15Z"`), &got); err == nil {
+		t.Error("unix format accepted a string")
+	}
+	if err := json.Unmarshal([]byte(`null`), &got); err != nil || !got.IsZero() {
+		t.Errorf("null = %v, %v; want the zero time", got, err)
+	}
+}
+
+func TestConfigValidatesTimeFormat(t *testing.T) {
+	for _, format := range []string{"", TimeFormatRFC3339, TimeFormatUnix, TimeFormatUnixMilli, "2006-01-02", time.Kitchen} {
+		c := Config{TimeFormat: format}
+		if err := c.Validate(); err != nil {
+			t.Errorf("TimeFormat %q: unexpected error %v", format, err)
+		}
+	}
+
+	c := Config{TimeFormat: "iso"}
+	err := c.Validate()
+	if err == nil || !strings.Contains(err.Error(), `TIME_FORMAT "iso"`) {
+		t.Errorf("Validate() = %v, want a TIME_FORMAT error", err)
+	}
+}
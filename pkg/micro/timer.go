@@ -0,0 +1,56 @@
+package micro
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxTimerNames bounds the operation label of Timer; names beyond it are
+// recorded as "other"
+const maxTimerNames = 100
+
+// timerNames tracks the operation names seen by Timer
+type timerNames struct {
+	mu    sync.Mutex
+	names map[string]bool
+}
+
+// label returns name while fewer than maxTimerNames are in use, else "other"
+func (t *timerNames) label(name string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.names[name] {
+		return name
+	}
+	if len(t.names) >= maxTimerNames {
+		return "other"
+	}
+	t.names[name] = true
+	return name
+}
+
+// Timer starts timing a sub-operation of a request, such as a call to an
+// external API. The returned stop function records the elapsed time in
+// operation_duration_seconds{operation=name} on the app registry, linked to
+// the request trace, and returns it. Outside a request or with metrics
+// disabled it only measures. Use a fixed set of names: past 100 distinct
+// names they are recorded as "other".
+//
+//	stop := micro.Timer(ctx, "payment_api")
+//	err := payments.Charge(ctx, order)
+//	stop()
+func Timer(ctx context.Context, name string) func() time.Duration {
+	start := time.Now()
+	var once sync.Once
+	var elapsed time.Duration
+	return func() time.Duration {
+		once.Do(func() {
+			elapsed = time.Since(start)
+			if m, ok := ctx.Value(contextKeyMetrics).(*metrics); ok {
+				observeWithTrace(ctx, m.operationDuration.WithLabelValues(m.timerNames.label(name)), elapsed.Seconds())
+			}
+		})
+		return elapsed
+	}
+}
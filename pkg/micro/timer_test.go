@@ -0,0 +1,87 @@
+package micro
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// timedHandler times a sleep of d under name and stops the timer twice
+func timedHandler(name string, d time.Duration, elapsed *[2]time.Duration) Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		stop := Timer(ctx, name)
+		time.Sleep(d)
+		elapsed[0] = stop()
+		time.Sleep(d)
+		elapsed[1] = stop()
+		return okHandler(ctx, w, r)
+	}
+}
+
+func TestTimer(t *testing.T) {
+	const delay = 10 * time.Millisecond
+	app := newTestApp(t)
+	var elapsed [2]time.Duration
+	app.GET("/checkout", timedHandler("payment_api", delay, &elapsed))
+
+	serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/checkout", nil))
+
+	if elapsed[0] < delay {
+		t.Errorf("elapsed = %v, want at least %v", elapsed[0], delay)
+	}
+	// Only the first stop counts
+	if elapsed[1] != elapsed[0] {
+		t.Errorf("second stop = %v, want %v", elapsed[1], elapsed[0])
+	}
+	count, sum := histogramSample(t, app, "operation_duration_seconds", `operation="payment_api"`)
+	if count != 1 || math.Abs(sum-elapsed[0].Seconds()) > 1e-9 {
+		t.Errorf("observed count %v sum %v, want 1 observation of %v", count, sum, elapsed[0].Seconds())
+	}
+}
+
+func TestTimerWithoutMetrics(t *testing.T) {
+	t.Run("outside a request", func(t *testing.T) {
+		stop := Timer(context.Background(), "payment_api")
+		time.Sleep(time.Millisecond)
+		if elapsed := stop(); elapsed < time.Millisecond {
+			t.Errorf("elapsed = %v, want at least 1ms", elapsed)
+		}
+	})
+
+	t.Run("metrics disabled", func(t *testing.T) {
+		app := newTestApp(t, func(c *Config) { c.MetricsEnabled = false })
+		var elapsed [2]time.Duration
+		app.GET("/checkout", timedHandler("payment_api", time.Millisecond, &elapsed))
+
+		serve(app.Handler(), httptest.NewRequest(http.MethodGet, "/checkout", nil))
+		if elapsed[0] < time.Millisecond {
+			t.Errorf("elapsed = %v, want at least 1ms", elapsed[0])
+		}
+		if count := testutil.CollectAndCount(app.metrics.operationDuration); count != 0 {
+			t.Errorf("%d series observed with metrics disabled", count)
+		}
+	})
+}
+
+func TestTimerNameCap(t *testing.T) {
+	names := &timerNames{names: make(map[string]bool)}
+	for i := range maxTimerNames {
+		name := fmt.Sprintf("op_%d", i)
+		if got := names.label(name); got != name {
+			t.Fatalf("label(%q) = %q before the cap", name, got)
+		}
+	}
+	if got := names.label("one_too_many"); got != "other" {
+		t.Errorf("label past the cap = %q, want other", got)
+	}
+	// Names seen before the cap keep their label
+	if got := names.label("op_0"); got != "op_0" {
+		t.Errorf("label(op_0) = %q after the cap", got)
+	}
+}
@@ -0,0 +1,86 @@
+package micro
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+
+	"github.com/gorilla/mux"
+)
+
+// StatusCoder lets a typed handler response choose its status code
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// NoContent is a typed handler response written as 204 with no body
+type NoContent struct{}
+
+// StatusCode implements StatusCoder
+func (NoContent) StatusCode() int { return http.StatusNoContent }
+
+// Handle adapts a typed function to a Handler. The request is bound into
+// Req and validated before fn runs:
+//
+//   - fields tagged `path` are set from route variables
+//   - GET, HEAD and DELETE bind `query` fields from the query string
+//   - other methods decode the body with App.Decode
+//
+// The result is written as JSON with 201 for POST and 200 otherwise, unless
+// Res implements StatusCoder. Errors go through the app error handling.
+//
+//	app.POST("/register", micro.Handle(app, h.RegisterUser))
+func Handle[Req, Res any](app *App, fn func(ctx context.Context, req Req) (Res, error)) Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		var req Req
+		if err := app.bindRequest(r, &req); err != nil {
+			return err
+		}
+
+		res, err := fn(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		status := http.StatusOK
+		if r.Method == http.MethodPost {
+			status = http.StatusCreated
+		}
+		if sc, ok := any(res).(StatusCoder); ok {
+			status = sc.StatusCode()
+		}
+
+		if status == http.StatusNoContent {
+			w.WriteHeader(status)
+			return nil
+		}
+		return app.JSON(w, status, res)
+	}
+}
+
+// bindRequest fills v from path variables and then the query string or body
+func (a *App) bindRequest(r *http.Request, v interface{}) error {
+	if rv := reflect.ValueOf(v).Elem(); rv.Kind() == reflect.Struct {
+		vars := url.Values{}
+		for k, val := range mux.Vars(r) {
+			vars.Set(k, val)
+		}
+		if name, value, err := bindValues(rv, vars, "path"); err != nil {
+			return NewAPIError(http.StatusBadRequest, "invalid path parameter", map[string]string{
+				"parameter": name,
+				"value":     value,
+			})
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete:
+		if reflect.ValueOf(v).Elem().Kind() != reflect.Struct {
+			return nil
+		}
+		return a.BindQuery(r, v)
+	default:
+		return a.Decode(r, v)
+	}
+}
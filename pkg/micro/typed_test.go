@@ -0,0 +1,83 @@
+package micro
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type getItemRequest struct {
+	ID     int    `path:"id" validate:"min=1"`
+	Fields string `query:"fields"`
+}
+
+type createItemRequest struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type item struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Fields string `json:"fields,omitempty"`
+}
+
+type acceptedJob struct {
+	JobID string `json:"job_id"`
+}
+
+func (acceptedJob) StatusCode() int { return http.StatusAccepted }
+
+func TestHandle(t *testing.T) {
+	app := newTestApp(t)
+	app.GET("/items/{id}", Handle(app, func(ctx context.Context, req getItemRequest) (item, error) {
+		if req.ID == 404 {
+			return item{}, NewAPIError(http.StatusNotFound, "item not found")
+		}
+		return item{ID: req.ID, Name: "widget", Fields: req.Fields}, nil
+	}))
+	app.POST("/items", Handle(app, func(ctx context.Context, req createItemRequest) (item, error) {
+		return item{ID: 1, Name: req.Name}, nil
+	}))
+	app.POST("/jobs", Handle(app, func(ctx context.Context, req createItemRequest) (acceptedJob, error) {
+		return acceptedJob{JobID: "job-1"}, nil
+	}))
+	app.DELETE("/items/{id}", Handle(app, func(ctx context.Context, req getItemRequest) (NoContent, error) {
+		return NoContent{}, nil
+	}))
+	h := app.Handler()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		want   string
+	}{
+		{"path and query", http.MethodGet, "/items/7?fields=name", "", http.StatusOK, `{"id":7,"name":"widget","fields":"name"}`},
+		{"body on POST", http.MethodPost, "/items", `{"name":"gadget"}`, http.StatusCreated, `{"id":1,"name":"gadget"}`},
+		{"status coder", http.MethodPost, "/jobs", `{"name":"report"}`, http.StatusAccepted, `{"job_id":"job-1"}`},
+		{"no content", http.MethodDelete, "/items/7", "", http.StatusNoContent, ``},
+		{"invalid path parameter", http.MethodGet, "/items/abc", "", http.StatusBadRequest, ""},
+		{"path validation", http.MethodGet, "/items/0", "", http.StatusUnprocessableEntity, ""},
+		{"body validation", http.MethodPost, "/items", `{}`, http.StatusBadRequest, ""},
+		{"handler error", http.MethodGet, "/items/404", "", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.body != "" {
+				r.Header.Set("Content-Type", "application/json")
+			}
+			w := serve(h, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status < 300 && strings.TrimSpace(w.Body.String()) != tt.want {
+				t.Errorf("body = %s, want %s", w.Body.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package micro
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// UsageRecorder records the usage of a single request, e.g. for billing
+type UsageRecorder interface {
+	Record(key string, bytesIn, bytesOut int64)
+}
+
+// UsageRecord is the usage of one key aggregated over a flush period
+type UsageRecord struct {
+	Key         string
+	Requests    int64
+	BytesIn     int64
+	BytesOut    int64
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+}
+
+// UsageSink persists aggregated usage records
+type UsageSink interface {
+	WriteUsage(ctx context.Context, records []UsageRecord) error
+}
+
+// UsageMiddleware records request count and bytes in and out per
+// authenticated principal. Requests without a principal are not recorded,
+// so apply it after AuthMiddleware.
+func (a *App) UsageMiddleware(recorder UsageRecorder) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := PrincipalFromContext(r.Context())
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body := &countingReader{ReadCloser: r.Body}
+			if r.Body != nil {
+				r.Body = body
+			}
+			cw := &countingResponseWriter{ResponseWriter: w}
+
+			next.ServeHTTP(cw, r)
+			recorder.Record(principal.ID, body.n, cw.n)
+		})
+	}
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type countingResponseWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (c *countingResponseWriter) Write(b []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingResponseWriter) Flush() {
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (c *countingResponseWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+type usageCounter struct {
+	requests atomic.Int64
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+}
+
+// UsageAggregator is a UsageRecorder that aggregates usage in memory and
+// flushes it to a sink periodically. It implements Worker so it can be
+// registered with the App, which flushes the remainder on shutdown.
+type UsageAggregator struct {
+	sink     UsageSink
+	interval time.Duration
+	logger   Logger
+
+	mu          sync.RWMutex
+	counters    map[string]*usageCounter
+	periodStart time.Time
+}
+
+// NewUsageAggregator creates an aggregator flushing to sink every interval
+func NewUsageAggregator(sink UsageSink, interval time.Duration, logger Logger) *UsageAggregator {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &UsageAggregator{
+		sink:        sink,
+		interval:    interval,
+		logger:      logger.With(zap.String("component", "usage")),
+		counters:    make(map[string]*usageCounter),
+		periodStart: time.Now(),
+	}
+}
+
+// Record adds a request to the key's counters. Existing keys are updated
+// with atomic adds under a shared lock.
+func (u *UsageAggregator) Record(key string, bytesIn, bytesOut int64) {
+	u.mu.RLock()
+	c, ok := u.counters[key]
+	if ok {
+		c.add(bytesIn, bytesOut)
+		u.mu.RUnlock()
+		return
+	}
+	u.mu.RUnlock()
+
+	u.mu.Lock()
+	c, ok = u.counters[key]
+	if !ok {
+		c = &usageCounter{}
+		u.counters[key] = c
+	}
+	c.add(bytesIn, bytesOut)
+	u.mu.Unlock()
+}
+
+func (c *usageCounter) add(bytesIn, bytesOut int64) {
+	c.requests.Add(1)
+	c.bytesIn.Add(bytesIn)
+	c.bytesOut.Add(bytesOut)
+}
+
+// Flush writes the usage aggregated since the last flush to the sink. On
+// failure the records are merged back so they are retried next time.
+func (u *UsageAggregator) Flush(ctx context.Context) error {
+	u.mu.Lock()
+	counters, start := u.counters, u.periodStart
+	u.counters = make(map[string]*usageCounter)
+	u.periodStart = time.Now()
+	u.mu.Unlock()
+
+	if len(counters) == 0 {
+		return nil
+	}
+
+	end := time.Now()
+	records := make([]UsageRecord, 0, len(counters))
+	for key, c := range counters {
+		records = append(records, UsageRecord{
+			Key:         key,
+			Requests:    c.requests.Load(),
+			BytesIn:     c.bytesIn.Load(),
+			BytesOut:    c.bytesOut.Load(),
+			PeriodStart: start,
+			PeriodEnd:   end,
+		})
+	}
+
+	if err := u.sink.WriteUsage(ctx, records); err != nil {
+		u.restore(counters, start)
+		return fmt.Errorf("write usage: %w", err)
+	}
+	return nil
+}
+
+// restore merges unflushed counters back into the current period
+func (u *UsageAggregator) restore(counters map[string]*usageCounter, start time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for key, old := range counters {
+		c, ok := u.counters[key]
+		if !ok {
+			u.counters[key] = old
+			continue
+		}
+		c.requests.Add(old.requests.Load())
+		c.bytesIn.Add(old.bytesIn.Load())
+		c.bytesOut.Add(old.bytesOut.Load())
+	}
+	u.periodStart = start
+}
+
+// Start flushes periodically until ctx is cancelled
+func (u *UsageAggregator) Start(ctx context.Context) {
+	ticker := time.NewTicker(u.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := u.Flush(ctx); err != nil {
+				u.logger.Error("usage flush failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Stop flushes the remaining usage
+func (u *UsageAggregator) Stop(ctx context.Context) error {
+	return u.Flush(ctx)
+}
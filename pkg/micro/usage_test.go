@@ -0,0 +1,166 @@
+package micro
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memorySink collects written usage records and fails while err is set
+type memorySink struct {
+	mu      sync.Mutex
+	records []UsageRecord
+	err     error
+}
+
+func (s *memorySink) WriteUsage(ctx context.Context, records []UsageRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.records = append(s.records, records...)
+	return nil
+}
+
+// byKey returns the written records keyed by API key
+func (s *memorySink) byKey() map[string]UsageRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := make(map[string]UsageRecord, len(s.records))
+	for _, rec := range s.records {
+		m[rec.Key] = rec
+	}
+	return m
+}
+
+func TestUsageMiddlewareCountsBytes(t *testing.T) {
+	app := newTestApp(t)
+	sink := &memorySink{}
+	usage := NewUsageAggregator(sink, time.Hour, NewNopLogger())
+	h := app.UsageMiddleware(usage)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte("hello, world"))
+	}))
+
+	send := func(principal *Principal, body string) {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		if principal != nil {
+			r = r.WithContext(WithPrincipal(r.Context(), principal))
+		}
+		serve(h, r)
+	}
+	send(&Principal{ID: "key-a"}, "12345")
+	send(&Principal{ID: "key-a"}, "123")
+	send(&Principal{ID: "key-b"}, "")
+	send(nil, "anonymous is not billed")
+
+	if err := usage.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	got := sink.byKey()
+	if len(got) != 2 {
+		t.Fatalf("records = %+v, want one per principal", sink.records)
+	}
+	if a := got["key-a"]; a.Requests != 2 || a.BytesIn != 8 || a.BytesOut != 24 {
+		t.Errorf("key-a = %+v, want 2 requests, 8 bytes in and 24 out", a)
+	}
+	if b := got["key-b"]; b.Requests != 1 || b.BytesIn != 0 || b.BytesOut != 12 {
+		t.Errorf("key-b = %+v, want 1 request, 0 bytes in and 12 out", b)
+	}
+}
+
+func TestUsageAggregatorConcurrentRecords(t *testing.T) {
+	sink := &memorySink{}
+	usage := NewUsageAggregator(sink, time.Hour, NewNopLogger())
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key := []string{"key-a", "key-b"}[i%2]
+			for range 100 {
+				usage.Record(key, 1, 10)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := usage.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	for key, rec := range sink.byKey() {
+		if rec.Requests != 500 || rec.BytesIn != 500 || rec.BytesOut != 5000 {
+			t.Errorf("%s = %+v, want 500 requests", key, rec)
+		}
+		if !rec.PeriodEnd.After(rec.PeriodStart) {
+			t.Errorf("%s period %v to %v", key, rec.PeriodStart, rec.PeriodEnd)
+		}
+	}
+}
+
+func TestUsageAggregatorFlush(t *testing.T) {
+	sink := &memorySink{}
+	usage := NewUsageAggregator(sink, time.Hour, NewNopLogger())
+	ctx := context.Background()
+
+	usage.Record("key-a", 1, 1)
+	if err := usage.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	// A second flush has nothing new to write
+	if err := usage.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if n := len(sink.records); n != 1 {
+		t.Fatalf("wrote %d records, want 1", n)
+	}
+
+	// Usage from a failed flush is kept and merged with later usage
+	sink.err = errors.New("database unavailable")
+	usage.Record("key-a", 2, 2)
+	if err := usage.Flush(ctx); !errors.Is(err, sink.err) {
+		t.Fatalf("Flush err = %v, want %v", err, sink.err)
+	}
+	usage.Record("key-a", 3, 3)
+	usage.Record("key-b", 4, 4)
+	sink.err = nil
+
+	// Stop flushes what is left
+	if err := usage.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	last := sink.records[1:]
+	sort.Slice(last, func(i, j int) bool { return last[i].Key < last[j].Key })
+	if len(last) != 2 || last[0].Requests != 2 || last[0].BytesIn != 5 || last[1].Requests != 1 {
+		t.Errorf("records after retry = %+v", last)
+	}
+}
+
+func TestUsageAggregatorFlushesPeriodically(t *testing.T) {
+	sink := &memorySink{}
+	usage := NewUsageAggregator(sink, 10*time.Millisecond, NewNopLogger())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		usage.Start(ctx)
+		close(done)
+	}()
+
+	usage.Record("key-a", 1, 1)
+	for deadline := time.Now().Add(5 * time.Second); len(sink.byKey()) == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("usage was not flushed")
+		}
+	}
+	cancel()
+	<-done
+}
@@ -0,0 +1,121 @@
+package micro
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Messages for common validation rules, keyed by tag. The parameter of the
+// failed rule is substituted for %s.
+var defaultValidationMessages = map[string]string{
+	"required":        "is required",
+	"email":           "must be a valid email address",
+	"url":             "must be a valid URL",
+	"min":             "must be at least %s",
+	"max":             "must be at most %s",
+	"len":             "must have length %s",
+	"oneof":           "must be one of: %s",
+	"e164":            "must be a phone number in E.164 format",
+	"strong_password": "must contain upper and lower case letters, a digit and a symbol",
+}
+
+// RegisterValidation adds a custom validation rule usable in `validate`
+// struct tags, with an optional message reported in validation errors
+func (a *App) RegisterValidation(tag string, fn validator.Func, message ...string) error {
+	if err := a.Validator.RegisterValidation(tag, fn); err != nil {
+		return fmt.Errorf("failed to register validation %q: %w", tag, err)
+	}
+	if len(message) > 0 {
+		a.validationMessages[tag] = message[0]
+	}
+	return nil
+}
+
+// RegisterStructValidation adds a struct-level rule for the given types,
+// for constraints spanning several fields such as "password must not equal
+// email". Report failures with StructLevel.ReportError.
+func (a *App) RegisterStructValidation(fn validator.StructLevelFunc, types ...interface{}) {
+	a.Validator.RegisterStructValidation(fn, types...)
+}
+
+// registerBuiltinValidations adds the rules shipped with the framework.
+// Phone numbers can use the validator's built-in e164 tag.
+func registerBuiltinValidations(v *validator.Validate) error {
+	v.RegisterTagNameFunc(fieldName)
+	v.RegisterCustomTypeFunc(optionalTypeFunc, optionalTypes...)
+	return v.RegisterValidation("strong_password", strongPassword)
+}
+
+// fieldName reports fields in validation errors by the name clients use:
+// the json, query or form tag, falling back to the Go field name
+func fieldName(fld reflect.StructField) string {
+	for _, key := range []string{"json", "query", "form"} {
+		name, _, _ := strings.Cut(fld.Tag.Get(key), ",")
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return ""
+}
+
+// strongPassword requires upper and lower case letters, a digit and a symbol
+func strongPassword(fl validator.FieldLevel) bool {
+	var upper, lower, digit, symbol bool
+	for _, c := range fl.Field().String() {
+		switch {
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsDigit(c):
+			digit = true
+		case unicode.IsPunct(c) || unicode.IsSymbol(c):
+			symbol = true
+		}
+	}
+	return upper && lower && digit && symbol
+}
+
+// Config.ValidationMode values
+const (
+	ValidationModeAll   = "all"
+	ValidationModeFirst = "first"
+)
+
+// newValidationError converts validator errors into an APIError whose details
+// map each failing field to a readable message in the request language. In
+// ValidationModeFirst only the first field in struct order is reported;
+// ErrorCount always counts every failing field.
+func (a *App) newValidationError(ctx context.Context, status int, err error) *APIError {
+	t := Localizer(ctx)
+	validationErrors := make(map[string]string)
+	ve, _ := err.(validator.ValidationErrors)
+	for _, fe := range ve {
+		validationErrors[fe.Field()] = a.validationMessage(t, fe)
+		if a.Config.ValidationMode == ValidationModeFirst {
+			break
+		}
+	}
+	apiErr := NewAPIError(status, "validation failed", validationErrors)
+	apiErr.ErrorCount = len(ve)
+	return apiErr
+}
+
+func (a *App) validationMessage(t *Translator, fe validator.FieldError) string {
+	message, ok := a.validationMessages[fe.Tag()]
+	if !ok {
+		message, ok = defaultValidationMessages[fe.Tag()]
+	}
+	if !ok {
+		return t.T("failed on the '%s' rule", fe.Tag())
+	}
+	if strings.Contains(message, "%s") {
+		return t.T(message, fe.Param())
+	}
+	return t.T(message)
+}
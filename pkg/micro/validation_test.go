@@ -0,0 +1,235 @@
+package micro
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// decodeError decodes body into v and returns the resulting APIError, or
+// nil when Decode succeeds
+func decodeError(t *testing.T, app *App, body string, v interface{}) *APIError {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	err := app.Decode(r, v)
+	if err == nil {
+		return nil
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want an *APIError", err)
+	}
+	return apiErr
+}
+
+type signupRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,strong_password"`
+	Phone    string `json:"phone" validate:"omitempty,e164"`
+}
+
+func TestBuiltinValidations(t *testing.T) {
+	app := newTestApp(t)
+
+	tests := []struct {
+		name    string
+		body    string
+		details map[string]string
+	}{
+		{"valid", `{"email":"ada@example.com","password":"Str0ng!pw","phone":"+442071838750"}`, nil},
+		{"weak password", `{"email":"ada@example.com","password":"password1"}`, map[string]string{
+			"password": "must contain upper and lower case letters, a digit and a symbol",
+		}},
+		{"local phone number", `{"email":"ada@example.com","password":"Str0ng!pw","phone":"020 7183 8750"}`, map[string]string{
+			"phone": "must be a phone number in E.164 format",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req signupRequest
+			apiErr := decodeError(t, app, tt.body, &req)
+			if tt.details == nil {
+				if apiErr != nil {
+					t.Fatalf("Decode: %v", apiErr)
+				}
+				return
+			}
+			if apiErr == nil {
+				t.Fatal("Decode accepted an invalid body")
+			}
+			if !reflect.DeepEqual(apiErr.Details, tt.details) {
+				t.Errorf("details = %v, want %v", apiErr.Details, tt.details)
+			}
+		})
+	}
+}
+
+type skuRequest struct {
+	SKU string `json:"sku" validate:"sku"`
+}
+
+func TestRegisterValidation(t *testing.T) {
+	app := newTestApp(t)
+	err := app.RegisterValidation("sku", func(fl validator.FieldLevel) bool {
+		return strings.HasPrefix(fl.Field().String(), "SKU-")
+	}, "must start with SKU-")
+	if err != nil {
+		t.Fatalf("RegisterValidation: %v", err)
+	}
+
+	var req skuRequest
+	if apiErr := decodeError(t, app, `{"sku":"SKU-1"}`, &req); apiErr != nil {
+		t.Fatalf("Decode: %v", apiErr)
+	}
+	apiErr := decodeError(t, app, `{"sku":"1"}`, &req)
+	if apiErr == nil {
+		t.Fatal("Decode accepted an invalid SKU")
+	}
+	if got := apiErr.Details["sku"]; got != "must start with SKU-" {
+		t.Errorf("message = %q, want the registered message", got)
+	}
+}
+
+func TestRegisterValidationWithoutMessage(t *testing.T) {
+	app := newTestApp(t)
+	app.RegisterValidation("sku", func(fl validator.FieldLevel) bool { return false })
+
+	var req skuRequest
+	apiErr := decodeError(t, app, `{"sku":"1"}`, &req)
+	if apiErr == nil {
+		t.Fatal("Decode accepted an invalid SKU")
+	}
+	if got := apiErr.Details["sku"]; got != "failed on the 'sku' rule" {
+		t.Errorf("message = %q, want the generic message", got)
+	}
+}
+
+func TestRegisterStructValidation(t *testing.T) {
+	app := newTestApp(t)
+	app.RegisterStructValidation(func(sl validator.StructLevel) {
+		req := sl.Current().Interface().(signupRequest)
+		if strings.EqualFold(req.Password, req.Email) {
+			sl.ReportError(req.Password, "password", "Password", "nefield", "email")
+		}
+	}, signupRequest{})
+
+	var req signupRequest
+	apiErr := decodeError(t, app, `{"email":"ada1@example.com","password":"Ada1@example.com"}`, &req)
+	if apiErr == nil {
+		t.Fatal("Decode accepted a password equal to the email")
+	}
+	want := map[string]string{"password": "failed on the 'nefield' rule"}
+	if !reflect.DeepEqual(apiErr.Details, want) {
+		t.Errorf("details = %v, want %v", apiErr.Details, want)
+	}
+}
+
+type contactRequest struct {
+	EmailAddress string `json:"email" validate:"required,email"`
+	Nickname     string `json:"nick,omitempty" validate:"omitempty,min=3"`
+	Internal     string `json:"-" validate:"required"`
+	Untagged     string `validate:"required"`
+}
+
+func TestValidationErrorsUseTagNames(t *testing.T) {
+	app := newTestApp(t)
+
+	var req contactRequest
+	apiErr := decodeError(t, app, `{"email":"nope","nick":"x"}`, &req)
+	if apiErr == nil {
+		t.Fatal("Decode accepted an invalid body")
+	}
+	// json names, ignoring options; "-" and untagged fields keep the Go name
+	for _, field := range []string{"email", "nick", "Internal", "Untagged"} {
+		if _, ok := apiErr.Details[field]; !ok {
+			t.Errorf("details %v have no %q", apiErr.Details, field)
+		}
+	}
+	for _, goName := range []string{"EmailAddress", "Nickname"} {
+		if _, ok := apiErr.Details[goName]; ok {
+			t.Errorf("details %v use the Go field name %q", apiErr.Details, goName)
+		}
+	}
+}
+
+func TestFieldNameTags(t *testing.T) {
+	type params struct {
+		JSON  string `json:"json_name,omitempty"`
+		Query string `query:"q"`
+		Form  string `form:"form_name"`
+		Plain string
+	}
+	typ := reflect.TypeOf(params{})
+	want := []string{"json_name", "q", "form_name", ""}
+	for i, w := range want {
+		if got := fieldName(typ.Field(i)); got != w {
+			t.Errorf("fieldName(%s) = %q, want %q", typ.Field(i).Name, got, w)
+		}
+	}
+}
+
+func TestConfigureValidatorKeepsTagNames(t *testing.T) {
+	app := newTestApp(t, func(c *Config) {
+		c.ConfigureValidator = func(v *validator.Validate) error {
+			return v.RegisterValidation("sku", func(fl validator.FieldLevel) bool {
+				return strings.HasPrefix(fl.Field().String(), "SKU-")
+			})
+		}
+	})
+
+	var req skuRequest
+	apiErr := decodeError(t, app, `{"sku":"1"}`, &req)
+	if apiErr == nil {
+		t.Fatal("Decode accepted an invalid SKU")
+	}
+	if _, ok := apiErr.Details["sku"]; !ok {
+		t.Errorf("details = %v, want the json name sku", apiErr.Details)
+	}
+	if _, ok := apiErr.Details["SKU"]; ok {
+		t.Errorf("details = %v use the Go field name", apiErr.Details)
+	}
+}
+
+func TestValidationMode(t *testing.T) {
+	// Both email and password are invalid; email comes first in the struct
+	const body = `{"email":"nope","password":"weak"}`
+
+	tests := []struct {
+		name   string
+		mode   string
+		fields []string
+	}{
+		{"all", ValidationModeAll, []string{"email", "password"}},
+		{"unset", "", []string{"email", "password"}},
+		{"first", ValidationModeFirst, []string{"email"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, func(c *Config) { c.ValidationMode = tt.mode })
+
+			var req signupRequest
+			apiErr := decodeError(t, app, body, &req)
+			if apiErr == nil {
+				t.Fatal("Decode accepted an invalid body")
+			}
+			if len(apiErr.Details) != len(tt.fields) {
+				t.Errorf("details = %v, want only %v", apiErr.Details, tt.fields)
+			}
+			for _, field := range tt.fields {
+				if _, ok := apiErr.Details[field]; !ok {
+					t.Errorf("details = %v, want %q", apiErr.Details, field)
+				}
+			}
+			// The count covers every failing field in both modes
+			if apiErr.ErrorCount != 2 {
+				t.Errorf("ErrorCount = %d, want 2", apiErr.ErrorCount)
+			}
+		})
+	}
+}
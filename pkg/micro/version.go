@@ -0,0 +1,101 @@
+package micro
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var vendorVersionPattern = regexp.MustCompile(`application/vnd\.([^.;,\s]+)\.v(\d+)\+json`)
+
+// Version creates a route group for an API version under /v{n}. v may be
+// given as "2" or "v2". Handlers can read the version with APIVersion.
+//
+// When Config.APIVendor is set, unprefixed requests carrying
+// "Accept: application/vnd.<vendor>.v{n}+json" are routed to the same group.
+func (a *App) Version(v string) *RouterGroup {
+	v = strings.TrimPrefix(v, "v")
+	a.versions[v] = true
+
+	return a.Group("/v" + v).WithMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), contextKeyAPIVersion, v)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+}
+
+// VersionedGroups registers the same handler in several API versions
+type VersionedGroups []*RouterGroup
+
+// Versions creates a group per version so handlers shared across versions
+// are registered once
+func (a *App) Versions(versions ...string) VersionedGroups {
+	groups := make(VersionedGroups, len(versions))
+	for i, v := range versions {
+		groups[i] = a.Version(v)
+	}
+	return groups
+}
+
+// GET adds a GET route to every version
+func (vg VersionedGroups) GET(path string, handler Handler, opts ...RouteOption) VersionedGroups {
+	return vg.HandleMethod(http.MethodGet, path, handler, opts...)
+}
+
+// POST adds a POST route to every version
+func (vg VersionedGroups) POST(path string, handler Handler, opts ...RouteOption) VersionedGroups {
+	return vg.HandleMethod(http.MethodPost, path, handler, opts...)
+}
+
+// PUT adds a PUT route to every version
+func (vg VersionedGroups) PUT(path string, handler Handler, opts ...RouteOption) VersionedGroups {
+	return vg.HandleMethod(http.MethodPut, path, handler, opts...)
+}
+
+// DELETE adds a DELETE route to every version
+func (vg VersionedGroups) DELETE(path string, handler Handler, opts ...RouteOption) VersionedGroups {
+	return vg.HandleMethod(http.MethodDelete, path, handler, opts...)
+}
+
+// HandleMethod adds a route with the specified method to every version
+func (vg VersionedGroups) HandleMethod(method, path string, handler Handler, opts ...RouteOption) VersionedGroups {
+	for _, g := range vg {
+		g.HandleMethod(method, path, handler, opts...)
+	}
+	return vg
+}
+
+// APIVersion returns the API version of the request, e.g. "2", or "" for
+// unversioned routes
+func APIVersion(ctx context.Context) string {
+	v, _ := ctx.Value(contextKeyAPIVersion).(string)
+	return v
+}
+
+// negotiateVersion routes unprefixed requests asking for a registered
+// version through the Accept header to that version's group
+func (a *App) negotiateVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// An explicit version in the path wins over the Accept header
+		first, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if strings.HasPrefix(first, "v") && a.versions[first[1:]] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		for _, m := range vendorVersionPattern.FindAllStringSubmatch(r.Header.Get("Accept"), -1) {
+			v := m[2]
+			if m[1] != a.Config.APIVendor || !a.versions[v] {
+				continue
+			}
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = "/v" + v + r.URL.Path
+			r2.URL.RawPath = ""
+			r = r2
+			break
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,86 @@
+package micro
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// versionHandler writes the handler name and the negotiated API version
+func versionHandler(name string) Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		fmt.Fprintf(w, "%s:%s", name, APIVersion(ctx))
+		return nil
+	}
+}
+
+func newVersionedApp(t *testing.T) http.Handler {
+	t.Helper()
+	app := newTestApp(t, func(c *Config) { c.APIVendor = "myapi" })
+	app.Version("1").GET("/users", versionHandler("users-v1"))
+	app.Version("v2").GET("/users", versionHandler("users-v2"))
+	// Registered once for both versions
+	app.Versions("1", "2").GET("/status", versionHandler("status"))
+	app.GET("/ping", versionHandler("ping"))
+	return app.Handler()
+}
+
+func TestVersionURLPrefix(t *testing.T) {
+	h := newVersionedApp(t)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/v1/users", "users-v1:1"},
+		{"/v2/users", "users-v2:2"},
+		{"/v1/status", "status:1"},
+		{"/v2/status", "status:2"},
+		{"/ping", "ping:"},
+	}
+	for _, tt := range tests {
+		w := serve(h, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != http.StatusOK || w.Body.String() != tt.want {
+			t.Errorf("GET %s = %d %q, want %q", tt.path, w.Code, w.Body.String(), tt.want)
+		}
+	}
+	if w := serve(h, httptest.NewRequest(http.MethodGet, "/v3/users", nil)); w.Code != http.StatusNotFound {
+		t.Errorf("unknown version status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestVersionAcceptHeader(t *testing.T) {
+	h := newVersionedApp(t)
+
+	tests := []struct {
+		name   string
+		path   string
+		accept string
+		status int
+		want   string
+	}{
+		{"vendor v2", "/users", "application/vnd.myapi.v2+json", http.StatusOK, "users-v2:2"},
+		{"vendor v1 among others", "/users", "text/html, application/vnd.myapi.v1+json;q=0.9", http.StatusOK, "users-v1:1"},
+		{"shared route", "/status", "application/vnd.myapi.v2+json", http.StatusOK, "status:2"},
+		// The path version wins over the header
+		{"path wins", "/v1/users", "application/vnd.myapi.v2+json", http.StatusOK, "users-v1:1"},
+		{"other vendor", "/users", "application/vnd.other.v2+json", http.StatusNotFound, ""},
+		{"unregistered version", "/users", "application/vnd.myapi.v9+json", http.StatusNotFound, ""},
+		{"plain json", "/users", "application/json", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Header.Set("Accept", tt.accept)
+			w := serve(h, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.want != "" && w.Body.String() != tt.want {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package micro
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// Worker is a background process whose lifecycle is managed by the App.
+// Workers are started with the server and stopped after HTTP traffic has
+// drained during shutdown.
+type Worker interface {
+	// Start runs the worker and must return once ctx is cancelled
+	Start(ctx context.Context)
+	// Stop waits for in-flight work to finish or for ctx to expire
+	Stop(ctx context.Context) error
+}
+
+// RegisterWorker adds a worker to be started by Start
+func (a *App) RegisterWorker(w Worker) {
+	a.workers = append(a.workers, w)
+}
+
+func (a *App) startWorkers() {
+	for _, w := range a.workers {
+		a.wg.Add(1)
+		go func(w Worker) {
+			defer a.wg.Done()
+			w.Start(a.ctx)
+		}(w)
+	}
+}
+
+// stopWorkers stops workers in reverse registration order
+func (a *App) stopWorkers(ctx context.Context) {
+	for i := len(a.workers) - 1; i >= 0; i-- {
+		if err := a.workers[i].Stop(ctx); err != nil {
+			a.Logger.Error("worker stop failed", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package micro
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// eventLog records events from several goroutines in order
+type eventLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *eventLog) add(event string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+}
+
+func (l *eventLog) snapshot() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.events...)
+}
+
+// recordingWorker logs its lifecycle under name
+type recordingWorker struct {
+	name    string
+	log     *eventLog
+	started chan struct{}
+}
+
+func (w *recordingWorker) Start(ctx context.Context) {
+	close(w.started)
+	<-ctx.Done()
+	w.log.add(w.name + " cancelled")
+}
+
+func (w *recordingWorker) Stop(ctx context.Context) error {
+	w.log.add(w.name + " stopped")
+	return nil
+}
+
+func TestWorkersStopAfterHTTPDrains(t *testing.T) {
+	app := newTestApp(t)
+	log := &eventLog{}
+	first := &recordingWorker{name: "first", log: log, started: make(chan struct{})}
+	second := &recordingWorker{name: "second", log: log, started: make(chan struct{})}
+	app.RegisterWorker(first)
+	app.RegisterWorker(second)
+
+	inHandler := make(chan struct{})
+	app.GET("/slow", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		close(inHandler)
+		time.Sleep(200 * time.Millisecond)
+		log.add("request done")
+		return okHandler(ctx, w, r)
+	})
+
+	base, done := startApp(t, app)
+	<-first.started
+	<-second.started
+
+	resp := make(chan int, 1)
+	go func() {
+		res, err := http.Get(base + "/slow")
+		if err != nil {
+			resp <- 0
+			return
+		}
+		res.Body.Close()
+		resp <- res.StatusCode
+	}()
+	<-inHandler
+	sendShutdownSignal(t)
+
+	if err := waitStart(t, done); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if status := <-resp; status != http.StatusOK {
+		t.Errorf("in-flight request status = %d, want %d", status, http.StatusOK)
+	}
+
+	// Workers shut down only once traffic has drained, in reverse
+	// registration order
+	events := log.snapshot()
+	if len(events) != 5 || events[0] != "request done" {
+		t.Fatalf("events = %v, want the request to finish first", events)
+	}
+	var stopped []string
+	for _, e := range events {
+		if strings.HasSuffix(e, " stopped") {
+			stopped = append(stopped, e)
+		}
+	}
+	if len(stopped) != 2 || stopped[0] != "second stopped" || stopped[1] != "first stopped" {
+		t.Errorf("events = %v, want second stopped before first", events)
+	}
+}